@@ -0,0 +1,140 @@
+// Command shortener-migrate moves short URLs from one storage to another,
+// e.g. from JSONL file to Postgres, keeping short IDs.
+//
+// Storages are set by DSN: file:///path/to/file.json, sqlite:///path/to/file.db
+// or Postgres connection string. Conflicts are written as JSON lines to report file
+// or to stdout.
+//
+//	shortener-migrate -from file:///tmp/short-url-db.json \
+//		-to "host=localhost user=postgres dbname=courses" -resume ./migrate.checkpoint
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/config"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// fileScheme DSN scheme of JSONL file storage.
+const fileScheme = "file://"
+
+func main() {
+	err := logger.Initialize(zapcore.InfoLevel.String())
+	if err != nil {
+		log.Fatal("logger.Initialize", err)
+	}
+	defer logger.Log.Sync()
+
+	if err = run(); err != nil {
+		logger.Log.Fatal("migrate error", zap.Error(err))
+	}
+}
+
+func run() error {
+	from := flag.String("from", "", "Source storage DSN")
+	to := flag.String("to", "", "Destination storage DSN")
+	after := flag.String("after", "", "Migrate only short IDs greater than this one")
+	pageSize := flag.Int("page-size", 1000, "Amount of records read from source at once")
+	dryRun := flag.Bool("dry-run", false, "Check destination for conflicts without writing")
+	resume := flag.String("resume", "", "Checkpoint file with last migrated short ID")
+	report := flag.String("report", "", "File to write conflicts to, stdout by default")
+	flag.Parse()
+
+	if *from == "" || *to == "" {
+		return errors.New("both -from and -to must be set")
+	}
+	if *from == *to {
+		return errors.New("source and destination are the same")
+	}
+	if isPostgres(*from) && isPostgres(*to) {
+		return errors.New("only one Postgres storage is supported at once")
+	}
+	if *pageSize <= 0 {
+		return fmt.Errorf("page size must be positive, got %d", *pageSize)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	src, closeSrc, err := openStorage(*from)
+	if err != nil {
+		return fmt.Errorf("open source storage: %w", err)
+	}
+	defer closeSrc.Close()
+	dst, closeDst, err := openStorage(*to)
+	if err != nil {
+		return fmt.Errorf("open destination storage: %w", err)
+	}
+	defer closeDst.Close()
+
+	var w io.Writer = os.Stdout
+	if *report != "" {
+		f, fErr := os.Create(*report)
+		if fErr != nil {
+			return fmt.Errorf("os.Create: %w", fErr)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	m := &migrator{
+		src:        src,
+		dst:        dst,
+		pageSize:   *pageSize,
+		dryRun:     *dryRun,
+		resumeFile: *resume,
+		report:     w,
+	}
+	sum, err := m.run(ctx, *after)
+	logger.Log.Info("migration finished",
+		zap.Bool("dryRun", *dryRun),
+		zap.Int("migrated", sum.Migrated),
+		zap.Int("exists", sum.Exists),
+		zap.Int("conflicts", sum.Conflicts),
+		zap.String("lastID", sum.LastID))
+	return err
+}
+
+// openStorage opens storage by DSN.
+// Short IDs are never generated while migrating, so default generator is used.
+func openStorage(dsn string) (storage.Storage, io.Closer, error) {
+	gen := generator.DefaultIDGenerator()
+	switch {
+	case strings.HasPrefix(dsn, fileScheme):
+		fs, err := storage.NewFileStorage(strings.TrimPrefix(dsn, fileScheme), gen, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		return fs, fs, nil
+	case strings.HasPrefix(dsn, config.SQLiteScheme):
+		ss, err := storage.NewSQLiteStorage(strings.TrimPrefix(dsn, config.SQLiteScheme), gen)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ss, ss, nil
+	default:
+		ds, err := storage.NewDBStorage(dsn, gen)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ds, ds, nil
+	}
+}
+
+func isPostgres(dsn string) bool {
+	return !strings.HasPrefix(dsn, fileScheme) && !strings.HasPrefix(dsn, config.SQLiteScheme)
+}
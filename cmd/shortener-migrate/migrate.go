@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+)
+
+// Outcomes of migrating single record.
+const (
+	outcomeMigrated = "migrated"
+	outcomeExists   = "exists"
+	outcomeConflict = "conflict"
+)
+
+// conflict describes record that can't be moved to destination storage.
+type conflict struct {
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+	UserID      string `json:"user_id"`
+	Reason      string `json:"reason"`
+}
+
+// summary result of migration.
+type summary struct {
+	Migrated  int
+	Exists    int
+	Conflicts int
+	LastID    string
+}
+
+// migrator moves records from one storage to another page by page.
+// Short IDs are preserved, so the links keep working after switching the storage.
+type migrator struct {
+	src        storage.Storage
+	dst        storage.Storage
+	pageSize   int
+	dryRun     bool
+	resumeFile string
+	report     io.Writer
+}
+
+// run migrates records with short ID greater than after.
+// When resume file is set, it is updated after every page and read on start.
+func (m *migrator) run(ctx context.Context, after string) (summary, error) {
+	sum := summary{LastID: after}
+	if m.resumeFile != "" && after == "" {
+		last, err := readCheckpoint(m.resumeFile)
+		if err != nil {
+			return sum, fmt.Errorf("readCheckpoint: %w", err)
+		}
+		sum.LastID = last
+	}
+	enc := json.NewEncoder(m.report)
+	for {
+		page, err := m.src.ExportURLs(ctx, sum.LastID, m.pageSize)
+		if err != nil {
+			return sum, fmt.Errorf("src.ExportURLs after %q: %w", sum.LastID, err)
+		}
+		if len(page) == 0 {
+			return sum, nil
+		}
+		for _, rec := range page {
+			outcome, reason, mErr := m.migrateRecord(ctx, rec)
+			if mErr != nil {
+				return sum, fmt.Errorf("migrate short URL %s: %w", rec.ShortURL, mErr)
+			}
+			switch outcome {
+			case outcomeMigrated:
+				sum.Migrated++
+			case outcomeExists:
+				sum.Exists++
+			case outcomeConflict:
+				sum.Conflicts++
+				c := conflict{
+					ShortURL:    rec.ShortURL,
+					OriginalURL: rec.OriginalURL,
+					UserID:      rec.UserID,
+					Reason:      reason,
+				}
+				if err = enc.Encode(c); err != nil {
+					return sum, fmt.Errorf("report conflict: %w", err)
+				}
+			}
+			sum.LastID = rec.ShortURL
+		}
+		if m.resumeFile != "" && !m.dryRun {
+			if err = writeCheckpoint(m.resumeFile, sum.LastID); err != nil {
+				return sum, fmt.Errorf("writeCheckpoint: %w", err)
+			}
+		}
+	}
+}
+
+// migrateRecord saves single record to destination.
+// In dry-run mode destination is only checked for conflicts.
+func (m *migrator) migrateRecord(ctx context.Context,
+	rec storage.ExportRecord) (string, string, error) {
+	if m.dryRun {
+		return m.check(ctx, rec)
+	}
+	existing, err := m.dst.ImportURL(ctx, rec)
+	switch {
+	case err == nil:
+		return outcomeMigrated, "", nil
+	case errors.Is(err, storage.ErrDBConflict):
+		return outcomeConflict, fmt.Sprintf("canonical URL is already stored as %s", existing), nil
+	case errors.Is(err, storage.ErrIDConflict):
+		return m.check(ctx, rec)
+	default:
+		return "", "", fmt.Errorf("dst.ImportURL: %w", err)
+	}
+}
+
+// check compares record with the one stored in destination under the same short ID.
+func (m *migrator) check(ctx context.Context, rec storage.ExportRecord) (string, string, error) {
+	orig, err := m.dst.FindURL(ctx, rec.ShortURL)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return outcomeMigrated, "", nil
+	case errors.Is(err, storage.ErrResultIsDeleted), errors.Is(err, storage.ErrResultIsExpired):
+		// Destination doesn't expose inactive records, it is the same record
+		// if it is inactive in source too.
+		if rec.DeletedFlag || !rec.ExpiresAt.IsZero() && !time.Now().Before(rec.ExpiresAt) {
+			return outcomeExists, "", nil
+		}
+		return outcomeConflict, "short ID is taken by inactive URL", nil
+	case err != nil:
+		return "", "", fmt.Errorf("dst.FindURL: %w", err)
+	}
+	if orig.OriginalURL != rec.OriginalURL || orig.UserID != rec.UserID {
+		return outcomeConflict, fmt.Sprintf("short ID is taken by %s", orig.OriginalURL), nil
+	}
+	return outcomeExists, "", nil
+}
+
+func readCheckpoint(filename string) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// writeCheckpoint replaces checkpoint file atomically,
+// so it is never left half-written when migration is interrupted.
+func writeCheckpoint(filename string, lastID string) error {
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, []byte(lastID+"\n"), 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
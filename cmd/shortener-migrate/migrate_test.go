@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrator_Run(t *testing.T) {
+	ctx := context.Background()
+	userID := generator.UUIDString()
+	src := storage.NewMapStorage(generator.DefaultIDGenerator())
+	dst := storage.NewMapStorage(generator.DefaultIDGenerator())
+	createdAt := time.Now().Add(-48 * time.Hour)
+
+	for i, u := range []string{"http://a.com/", "http://b.com/", "http://c.com/", "http://d.com/"} {
+		_, err := src.SaveURLWithID(ctx, userID, "id-0000"+string(rune('1'+i)), u, u, time.Time{}, createdAt)
+		require.NoError(t, err)
+	}
+	_, err := src.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(userID, []string{"id-00002"}))
+	require.NoError(t, err)
+	_, err = dst.SaveURLWithID(ctx, userID, "id-00003", "http://other.com/", "http://other.com/", time.Time{}, time.Now())
+	require.NoError(t, err)
+
+	resume := filepath.Join(t.TempDir(), "checkpoint")
+	var report bytes.Buffer
+	m := &migrator{
+		src:        src,
+		dst:        dst,
+		pageSize:   3,
+		dryRun:     true,
+		resumeFile: resume,
+		report:     &report,
+	}
+
+	sum, err := m.run(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, summary{Migrated: 3, Conflicts: 1, LastID: "id-00004"}, sum)
+	_, err = dst.FindURL(ctx, "id-00001")
+	assert.ErrorIs(t, err, storage.ErrNotFound, "dry run must not write")
+	last, err := readCheckpoint(resume)
+	require.NoError(t, err)
+	assert.Empty(t, last, "dry run must not write checkpoint")
+
+	report.Reset()
+	m.dryRun = false
+	sum, err = m.run(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, summary{Migrated: 3, Conflicts: 1, LastID: "id-00004"}, sum)
+	var c conflict
+	require.NoError(t, json.Unmarshal(report.Bytes(), &c))
+	assert.Equal(t, "id-00003", c.ShortURL)
+
+	orig, err := dst.FindURL(ctx, "id-00001")
+	require.NoError(t, err)
+	assert.Equal(t, "http://a.com/", orig.OriginalURL)
+	exported, err := dst.ExportURLs(ctx, "", 1)
+	require.NoError(t, err)
+	require.Len(t, exported, 1)
+	assert.True(t, createdAt.Equal(exported[0].CreatedAt), "creation time is kept")
+	_, err = dst.FindURL(ctx, "id-00002")
+	assert.ErrorIs(t, err, storage.ErrResultIsDeleted)
+
+	last, err = readCheckpoint(resume)
+	require.NoError(t, err)
+	assert.Equal(t, "id-00004", last)
+
+	sum, err = m.run(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, summary{LastID: "id-00004"}, sum, "resumed run has nothing to do")
+
+	sum, err = m.run(ctx, "id-00001")
+	require.NoError(t, err)
+	assert.Equal(t, summary{Exists: 2, Conflicts: 1, LastID: "id-00004"}, sum)
+}
+
+func TestMigrator_RunDeleted(t *testing.T) {
+	ctx := context.Background()
+	userID := generator.UUIDString()
+	src := storage.NewMapStorage(generator.DefaultIDGenerator())
+	dst := storage.NewMapStorage(generator.DefaultIDGenerator())
+	const u = "http://e.com/"
+	_, err := src.SaveURLWithID(ctx, userID, "b-dead", u, u, time.Time{}, time.Now())
+	require.NoError(t, err)
+	_, err = src.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(userID, []string{"b-dead"}))
+	require.NoError(t, err)
+	_, err = src.SaveURLWithID(ctx, userID, "a-live", u, u, time.Time{}, time.Now())
+	require.NoError(t, err)
+
+	var report bytes.Buffer
+	m := &migrator{src: src, dst: dst, pageSize: 10, report: &report}
+	sum, err := m.run(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, summary{Migrated: 2, LastID: "b-dead"}, sum, "deleted record is not deduplicated")
+	assert.Empty(t, report.String())
+
+	_, err = dst.FindURL(ctx, "b-dead")
+	assert.ErrorIs(t, err, storage.ErrResultIsDeleted)
+	orig, err := dst.FindURL(ctx, "a-live")
+	require.NoError(t, err)
+	assert.Equal(t, u, orig.OriginalURL)
+}
@@ -25,6 +25,13 @@ type testConf struct {
 	tStorage *storage.MockedStorage
 }
 
+// newMockedStorage creates mocked storage where no token is revoked.
+func newMockedStorage() *storage.MockedStorage {
+	st := new(storage.MockedStorage)
+	st.On("IsTokenRevoked", mock.Anything, mock.Anything).Return(false, nil).Maybe()
+	return st
+}
+
 func newTestConf(srv *httptest.Server, tStorage *storage.MockedStorage) *testConf {
 	return &testConf{Server: srv, tStorage: tStorage}
 }
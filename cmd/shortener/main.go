@@ -5,22 +5,36 @@ import (
 	"errors"
 	"fmt"
 	"github.com/denis-oreshkevich/shortener/internal/app/config"
+	"github.com/denis-oreshkevich/shortener/internal/app/metrics"
 	"github.com/denis-oreshkevich/shortener/internal/app/model"
 	"github.com/denis-oreshkevich/shortener/internal/app/server"
+	pb "github.com/denis-oreshkevich/shortener/internal/app/server/proto"
 	"github.com/denis-oreshkevich/shortener/internal/app/shortener"
 	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/auth"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/hostlist"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 	"log"
 	"net/http"
+	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 )
 
+// healthSyncInterval how often grpc.health.v1 status is refreshed.
+const healthSyncInterval = 5 * time.Second
+
 var buildVersion = "N/A"
 
 var buildDate = "N/A"
@@ -54,17 +68,40 @@ func run() error {
 	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	defer stop()
 
+	keys, err := auth.LoadKeySet(conf.JWTKeysFile(), conf.JWTSecret())
+	if err != nil {
+		return fmt.Errorf("auth.LoadKeySet: %w", err)
+	}
+	if conf.JWTKeysFile() == "" && conf.JWTSecret() == "" {
+		logger.Log.Warn("JWT signing key is not configured, random key is used and sessions don't survive restart")
+	}
+	auth.SetKeys(keys)
+	auth.SetTokenTTL(conf.AccessTokenTTL(), conf.RefreshTokenTTL())
+
+	gen, err := generator.New(conf.IDGenerator(), conf.IDAlphabet(), conf.IDLength())
+	if err != nil {
+		return fmt.Errorf("generator.New: %w", err)
+	}
+
 	var s storage.Storage
 	if conf.DatabaseDSN() != "" {
-		dbStorage, err := storage.NewDBStorage(conf.DatabaseDSN())
+		dbStorage, err := storage.NewDBStorage(conf.DatabaseDSN(), gen)
 		if err != nil {
 			return fmt.Errorf("initializing db storage %w", err)
 		}
 		defer dbStorage.Close()
 		s = dbStorage
 		logger.Log.Info("using dbStorage as storage")
+	} else if conf.SQLitePath() != "" {
+		sqliteStorage, err := storage.NewSQLiteStorage(conf.SQLitePath(), gen)
+		if err != nil {
+			return fmt.Errorf("initializing sqlite storage %w", err)
+		}
+		defer sqliteStorage.Close()
+		s = sqliteStorage
+		logger.Log.Info("using sqliteStorage as storage")
 	} else if conf.FsPath() != "" {
-		fileStorage, err := storage.NewFileStorage(conf.FsPath())
+		fileStorage, err := storage.NewFileStorage(conf.FsPath(), gen, conf.FileCompactThreshold())
 		if err != nil {
 			return fmt.Errorf("initializing file storage %w", err)
 		}
@@ -72,83 +109,270 @@ func run() error {
 		s = fileStorage
 		logger.Log.Info("using fileStorage as storage")
 	} else {
-		mapStorage := storage.NewMapStorage()
+		mapStorage := storage.NewMapStorage(gen)
 		s = mapStorage
 		logger.Log.Info("using mapStorage as storage")
 	}
 
-	delChannel := make(chan model.BatchDeleteEntry, 3)
+	s = metrics.NewInstrumentedStorage(s)
+
+	if conf.CacheSize() > 0 && (conf.DatabaseDSN() != "" || conf.SQLitePath() != "") {
+		s = storage.NewCachingStorage(s, conf.CacheSize(), conf.CacheTTL(), conf.CacheNegativeTTL())
+		logger.Log.Info("using redirect cache", zap.Int("size", conf.CacheSize()))
+	}
+
+	if cg, ok := gen.(*generator.CounterGenerator); ok {
+		stat, err := s.FindStats(ctx)
+		if err != nil {
+			return fmt.Errorf("find stats to seed counter %w", err)
+		}
+		cg.Reset(uint64(stat.URLs))
+	}
+
 	sh := shortener.New(s)
+	sh.SetQuota(shortener.Quota{
+		MaxActive: conf.QuotaMaxActive(),
+		MaxPerDay: conf.QuotaMaxPerDay(),
+		MaxBatch:  conf.QuotaMaxBatch(),
+	})
+	sh.SetCanonical(shortener.Canonical{
+		StripParams: conf.CanonicalStripParams(),
+		SortQuery:   conf.CanonicalSortQuery(),
+	})
+	hosts, err := hostlist.NewFilter(conf.HostAllowlistFile(), conf.HostBlocklistFile())
+	if err != nil {
+		return fmt.Errorf("hostlist.NewFilter: %w", err)
+	}
+	sh.SetHostFilter(hosts)
+
+	err = metrics.RegisterQueueDepth("delete", sh.DeleteQueueLen)
+	if err != nil {
+		return fmt.Errorf("metrics.RegisterQueueDepth: %w", err)
+	}
+	err = metrics.RegisterStats(sh.FindStats)
+	if err != nil {
+		return fmt.Errorf("metrics.RegisterStats: %w", err)
+	}
 
 	var wg sync.WaitGroup
 
-	//delete worker
+	//delete workers
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		sh.DeleteUserURLs(ctx, delChannel)
+		sh.RunDeleteWorkers(ctx, conf.DeleteWorkers(), shortener.DeleteRetryPolicy{
+			MaxAttempts: conf.DeleteMaxAttempts(),
+			Backoff:     conf.DeleteRetryBackoff(),
+		})
 	}()
 
-	uh := server.New(conf, sh, delChannel)
-	r := setUpRouter(conf, uh)
+	//expired URLs reaper
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sh.ReapExpiredURLs(ctx, conf.ReaperInterval())
+	}()
 
-	addr := fmt.Sprintf("%s:%s", conf.Host(), conf.Port())
+	//host lists reloader
+	if conf.HostAllowlistFile() != "" || conf.HostBlocklistFile() != "" {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hosts.Watch(ctx, conf.HostListsCheckInterval(), hup)
+		}()
+	}
+
+	//click analytics writer
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sh.RecordClicks(ctx, conf.ClickBatchSize(), conf.ClickFlushInterval())
+	}()
+
+	uh := server.New(conf, sh)
+	var handler http.Handler
+	if conf.EnableHTTP() {
+		handler = setUpRouter(conf, uh)
+	} else {
+		handler = setUpProbeRouter(uh)
+	}
+
+	var grpcSrv *grpc.Server
+	healthSrv := health.NewServer()
+	h2 := server.MuxHTTP2Server(conf)
+	if conf.EnableGRPC() {
+		grpcSrv, err = newGRPCServer(conf, sh, healthSrv, uh.RateLimiter())
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			server.SyncGRPCHealth(ctx, sh, healthSrv, healthSyncInterval)
+		}()
+		if conf.GRPCMultiplex() {
+			handler = server.MuxGRPC(grpcSrv, handler, h2, conf.EnableHTTPS())
+		}
+	}
 
 	srv := &http.Server{
-		Addr:    addr,
-		Handler: r,
+		Addr:    fmt.Sprintf("%s:%s", conf.Host(), conf.Port()),
+		Handler: handler,
+	}
+	if grpcSrv != nil && conf.GRPCMultiplex() && conf.EnableHTTPS() {
+		if err = server.ConfigureMuxHTTP2(srv, h2); err != nil {
+			return err
+		}
 	}
 
+	//single shutdown of all servers
 	wg.Add(1)
 	go func() {
-		defer close(delChannel)
 		defer wg.Done()
 		<-ctx.Done()
-
+		sh.BeginShutdown()
+		healthSrv.Shutdown()
+		if grpcSrv != nil {
+			grpcSrv.GracefulStop()
+		}
 		if err := srv.Shutdown(context.Background()); err != nil {
 			logger.Log.Error("HTTP server Shutdown", zap.Error(err))
 		}
 	}()
 
-	var err error
-	if conf.EnableHTTPS() {
-		manager, errHTTPS := server.NewCertManager("./certs/cert.pem", "./certs/key.pem")
-		if errHTTPS != nil {
-			return fmt.Errorf("server.NewCertManager: %w", errHTTPS)
-		}
-		err = srv.ListenAndServeTLS(manager.CertPath, manager.KeyPath)
-	} else {
-		err = srv.ListenAndServe()
+	errs := make(chan error, 2)
+	serve := func(name string, fn func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(); err != nil {
+				errs <- fmt.Errorf("%s run %w", name, err)
+				stop()
+			}
+		}()
 	}
 
-	if err != nil {
-		if errors.Is(err, http.ErrServerClosed) {
-			logger.Log.Info("Server closed")
-		} else {
-			return fmt.Errorf("router run %w", err)
+	serve("HTTP server", func() error {
+		if err := serveHTTP(conf, srv); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
 		}
+		logger.Log.Info("HTTP server closed")
+		return nil
+	})
+	if grpcSrv != nil && !conf.GRPCMultiplex() {
+		lis, err := server.GRPCListener(conf)
+		if err != nil {
+			stop()
+			wg.Wait()
+			return fmt.Errorf("server.GRPCListener: %w", err)
+		}
+		serve("gRPC server", func() error {
+			if err := grpcSrv.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+				return err
+			}
+			logger.Log.Info("gRPC server closed")
+			return nil
+		})
 	}
+	logger.Log.Info("servers started", zap.String("address", srv.Addr),
+		zap.Bool("http", conf.EnableHTTP()), zap.Bool("https", conf.EnableHTTPS()),
+		zap.Bool("grpc", conf.EnableGRPC()), zap.Bool("grpcMultiplex", conf.GRPCMultiplex()),
+		zap.String("grpcAddress", conf.GRPCAddress()))
 
 	wg.Wait()
+	close(errs)
+	if err = <-errs; err != nil {
+		return err
+	}
 	logger.Log.Info("Server Shutdown gracefully")
 	return nil
 }
 
+// serveHTTP serves HTTP or HTTPS depending on configuration.
+func serveHTTP(conf config.Conf, srv *http.Server) error {
+	if !conf.EnableHTTPS() {
+		return srv.ListenAndServe()
+	}
+	manager, err := server.NewCertManager(conf.TLSCertFile(), conf.TLSKeyFile())
+	if err != nil {
+		return fmt.Errorf("server.NewCertManager: %w", err)
+	}
+	return srv.ListenAndServeTLS(manager.CertPath, manager.KeyPath)
+}
+
+// newGRPCServer creates gRPC server with shortener and health services.
+func newGRPCServer(conf config.Conf, sh *shortener.Shortener,
+	healthSrv *health.Server, limiter *server.RateLimiter) (*grpc.Server, error) {
+	opts, err := server.GRPCServerOptions(conf)
+	if err != nil {
+		return nil, fmt.Errorf("server.GRPCServerOptions: %w", err)
+	}
+	gAuth := server.NewGRPCAuth(sh)
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(server.MetricsUnaryInterceptor, gAuth.UnaryInterceptor,
+			limiter.UnaryInterceptor),
+		grpc.ChainStreamInterceptor(server.MetricsStreamInterceptor, gAuth.StreamInterceptor,
+			limiter.StreamInterceptor),
+	)
+	srv := grpc.NewServer(opts...)
+	reflection.Register(srv)
+	pb.RegisterShortenerServer(srv, server.NewGRPCServer(sh, conf))
+	healthpb.RegisterHealthServer(srv, healthSrv)
+	return srv, nil
+}
+
 func setUpRouter(conf config.Conf, uh *server.Server) *gin.Engine {
 	r := gin.New()
 	pprof.Register(r)
 
-	r.Use(gin.Recovery(), server.JWTAuth, server.Gzip, server.Logging)
+	r.Use(gin.Recovery(), uh.Auth, server.Gzip, server.Logging)
 
-	r.POST(`/`, uh.Post)
-	r.GET(conf.BasePath()+`/:id`, uh.Get)
-	r.GET(`/api/user/urls`, uh.GetUsersURLs)
-	r.POST(`/api/shorten`, uh.ShortenPost)
-	r.POST(`/api/shorten/batch`, uh.ShortenBatch)
+	read := server.RequireScope(model.ScopeRead)
+	create := server.RequireScope(model.ScopeCreate)
+	del := server.RequireScope(model.ScopeDelete)
+	createLimit := uh.RateLimit(server.RateClassCreate)
+	redirectLimit := uh.RateLimit(server.RateClassRedirect)
+	listLimit := uh.RateLimit(server.RateClassList)
+	authLimit := uh.RateLimit(server.RateClassAuth)
+	r.POST(`/`, create, createLimit, uh.Post)
+	r.GET(conf.BasePath()+`/:id`, redirectLimit, uh.Get)
+	r.GET(`/api/user/urls`, read, listLimit, uh.GetUsersURLs)
+	r.POST(`/api/shorten`, create, createLimit, uh.ShortenPost)
+	r.POST(`/api/shorten/batch`, create, createLimit, uh.ShortenBatch)
 	r.GET(`/ping`, uh.Ping)
-	r.DELETE(`/api/user/urls`, uh.DeleteURLs)
+	r.GET(`/healthz`, uh.Healthz)
+	r.GET(`/readyz`, uh.Readyz)
+	r.DELETE(`/api/user/urls`, del, uh.DeleteURLs)
+	r.GET(`/api/user/urls/delete-jobs/:id`, read, uh.GetDeleteJob)
+	r.GET(`/api/user/urls/:id/stats`, read, uh.GetURLStats)
+	r.GET(`/api/user/quota`, read, uh.GetQuota)
+	r.POST(`/api/user/register`, authLimit, uh.Register)
+	r.POST(`/api/user/login`, authLimit, uh.Login)
+	r.POST(`/api/user/refresh`, authLimit, uh.Refresh)
+	r.POST(`/api/user/logout`, authLimit, uh.Logout)
+	r.POST(`/api/user/keys`, authLimit, uh.CreateAPIKey)
+	r.GET(`/api/user/keys`, authLimit, uh.GetAPIKeys)
+	r.DELETE(`/api/user/keys/:id`, authLimit, uh.DeleteAPIKey)
 	r.GET(`/api/internal/stats`, uh.GetAPIInternalStats)
+	r.POST(`/api/internal/compact`, uh.Compact)
+	r.POST(`/api/internal/recheck`, uh.RecheckURLs)
+	r.GET(`/metrics`, uh.Metrics)
+	r.GET(`/.well-known/jwks.json`, uh.JWKS)
 	r.NoRoute(uh.NoRoute)
 
 	return r
 }
+
+// setUpProbeRouter serves only probes and metrics when HTTP API is disabled.
+func setUpProbeRouter(uh *server.Server) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.GET(`/metrics`, uh.Metrics)
+	r.GET(`/healthz`, uh.Healthz)
+	r.GET(`/readyz`, uh.Readyz)
+	r.GET(`/.well-known/jwks.json`, uh.JWKS)
+	return r
+}
@@ -9,6 +9,8 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -19,7 +21,10 @@ import (
 	"github.com/denis-oreshkevich/shortener/internal/app/server"
 	"github.com/denis-oreshkevich/shortener/internal/app/shortener"
 	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/auth"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/hostlist"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
@@ -27,10 +32,9 @@ import (
 
 func TestPost(t *testing.T) {
 	conf := config.Get()
-	tStorage := new(storage.MockedStorage)
+	tStorage := newMockedStorage()
 	short := shortener.New(tStorage)
-	delChannel := make(chan model.BatchDeleteEntry, 3)
-	uh := server.New(conf, short, delChannel)
+	uh := server.New(conf, short)
 	r := setUpRouter(conf, uh)
 
 	srv := httptest.NewServer(r)
@@ -42,8 +46,8 @@ func TestPost(t *testing.T) {
 			name:   "simple Post test #1",
 			isMock: true,
 			mockOn: func(m *storage.MockedStorage) *mock.Call {
-				return m.On("SaveURL", mock.Anything, mock.Anything,
-					mock.Anything).Return("CCCCCCCC", nil)
+				return m.On("SaveURL", mock.Anything, mock.Anything, mock.Anything,
+					mock.Anything, mock.Anything).Return("CCCCCCCC", nil)
 			},
 			reqFunc: func() *http.Request {
 				body := strings.NewReader("https://practicum.yandex.ru/")
@@ -66,7 +70,7 @@ func TestPost(t *testing.T) {
 				return req
 			},
 			want: want{
-				contentType: server.TextPlain,
+				contentType: server.ApplicationJSON,
 				statusCode:  400,
 			},
 		},
@@ -80,8 +84,24 @@ func TestPost(t *testing.T) {
 				return req
 			},
 			want: want{
-				contentType: server.TextPlain,
+				contentType: server.ApplicationJSON,
 				statusCode:  400,
+				body:        `{"error":"invalid url: scheme is missing","code":"url_invalid_syntax"}`,
+			},
+		},
+		{
+			name:   "not allowed scheme Post test #4",
+			isMock: false,
+			reqFunc: func() *http.Request {
+				body := strings.NewReader("javascript://example.com/%0Aalert(1)")
+				req := httptest.NewRequest("POST", srv.URL+"/", body)
+				req.RequestURI = ""
+				return req
+			},
+			want: want{
+				contentType: server.ApplicationJSON,
+				statusCode:  400,
+				body:        `{"error":"invalid url: scheme \"javascript\" is not allowed","code":"url_scheme_not_allowed"}`,
 			},
 		},
 	}
@@ -90,10 +110,9 @@ func TestPost(t *testing.T) {
 
 func TestGet(t *testing.T) {
 	conf := config.Get()
-	tStorage := new(storage.MockedStorage)
+	tStorage := newMockedStorage()
 	short := shortener.New(tStorage)
-	delChannel := make(chan model.BatchDeleteEntry, 3)
-	uh := server.New(conf, short, delChannel)
+	uh := server.New(conf, short)
 	r := setUpRouter(conf, uh)
 
 	srv := httptest.NewServer(r)
@@ -134,7 +153,23 @@ func TestGet(t *testing.T) {
 			},
 		},
 		{
-			name:   "not stored url Get test #3",
+			name:   "expired url Get test #3",
+			isMock: true,
+			mockOn: func(m *storage.MockedStorage) *mock.Call {
+				return m.On("FindURL", mock.Anything, "GGGGGGGG").Return(&storage.OrigURL{},
+					storage.ErrResultIsExpired)
+			},
+			reqFunc: func() *http.Request {
+				req := httptest.NewRequest("GET", srv.URL+conf.BasePath()+"/GGGGGGGG", nil)
+				req.RequestURI = ""
+				return req
+			},
+			want: want{
+				statusCode: 410,
+			},
+		},
+		{
+			name:   "not stored url Get test #4",
 			isMock: true,
 			mockOn: func(m *storage.MockedStorage) *mock.Call {
 				return m.On("FindURL", mock.Anything, "HHHHHHHH").Return(&storage.OrigURL{}, errors.New("test error"))
@@ -155,10 +190,9 @@ func TestGet(t *testing.T) {
 
 func TestShortenPost(t *testing.T) {
 	conf := config.Get()
-	tStorage := new(storage.MockedStorage)
+	tStorage := newMockedStorage()
 	short := shortener.New(tStorage)
-	delChannel := make(chan model.BatchDeleteEntry, 3)
-	uh := server.New(conf, short, delChannel)
+	uh := server.New(conf, short)
 	r := setUpRouter(conf, uh)
 
 	srv := httptest.NewServer(r)
@@ -169,13 +203,23 @@ func TestShortenPost(t *testing.T) {
 	if err != nil {
 		logger.Log.Error("marshal json", zap.Error(err))
 	}
+	aliasRes, err := json.Marshal(server.NewResult(conf.BaseURL() + "/" + "spring-sale"))
+	if err != nil {
+		logger.Log.Error("marshal json", zap.Error(err))
+	}
+	existing := conf.BaseURL() + "/" + "EEEEEEEE"
+	aliasConflict, err := json.Marshal(server.NewAliasConflict(
+		"alias late-alias is not created, URL is already shortened as "+existing, existing))
+	if err != nil {
+		logger.Log.Error("marshal json", zap.Error(err))
+	}
 	tests := []test{
 		{
 			name:   "simple ShortenPost test #1",
 			isMock: true,
 			mockOn: func(m *storage.MockedStorage) *mock.Call {
-				return m.On("SaveURL", mock.Anything, mock.Anything,
-					mock.Anything).Return("EEEEEEEE", nil)
+				return m.On("SaveURL", mock.Anything, mock.Anything, mock.Anything,
+					mock.Anything, mock.Anything).Return("EEEEEEEE", nil)
 			},
 			reqFunc: func() *http.Request {
 				url := server.NewURL("https://practicum.yandex.ru/")
@@ -195,10 +239,59 @@ func TestShortenPost(t *testing.T) {
 			},
 		},
 		{
-			name:   "empty body url ShortenPost test #2",
+			name:   "alias ShortenPost test #2",
+			isMock: true,
+			mockOn: func(m *storage.MockedStorage) *mock.Call {
+				return m.On("SaveURLWithID", mock.Anything, mock.Anything,
+					"spring-sale", mock.Anything, mock.Anything, mock.Anything,
+					mock.Anything).Return("spring-sale", nil)
+			},
+			reqFunc: func() *http.Request {
+				url := server.URLModel{URL: "https://practicum.yandex.ru/", Alias: "spring-sale"}
+				marshal, err := json.Marshal(url)
+				if err != nil {
+					logger.Log.Error("marshal json", zap.Error(err))
+				}
+				req := httptest.NewRequest("POST", srv.URL+"/api/shorten",
+					bytes.NewReader(marshal))
+				req.RequestURI = ""
+				return req
+			},
+			want: want{
+				contentType: server.ApplicationJSON,
+				statusCode:  201,
+				body:        string(aliasRes),
+			},
+		},
+		{
+			name:   "taken alias ShortenPost test #3",
+			isMock: true,
+			mockOn: func(m *storage.MockedStorage) *mock.Call {
+				return m.On("SaveURLWithID", mock.Anything, mock.Anything,
+					"taken-alias", mock.Anything, mock.Anything, mock.Anything,
+					mock.Anything).Return("", storage.ErrIDConflict)
+			},
+			reqFunc: func() *http.Request {
+				url := server.URLModel{URL: "https://practicum.yandex.ru/", Alias: "taken-alias"}
+				marshal, err := json.Marshal(url)
+				if err != nil {
+					logger.Log.Error("marshal json", zap.Error(err))
+				}
+				req := httptest.NewRequest("POST", srv.URL+"/api/shorten",
+					bytes.NewReader(marshal))
+				req.RequestURI = ""
+				return req
+			},
+			want: want{
+				contentType: server.TextPlain,
+				statusCode:  409,
+			},
+		},
+		{
+			name:   "invalid alias ShortenPost test #4",
 			isMock: false,
 			reqFunc: func() *http.Request {
-				url := server.NewURL("")
+				url := server.URLModel{URL: "https://practicum.yandex.ru/", Alias: "ping"}
 				marshal, err := json.Marshal(url)
 				if err != nil {
 					logger.Log.Error("marshal json", zap.Error(err))
@@ -214,7 +307,26 @@ func TestShortenPost(t *testing.T) {
 			},
 		},
 		{
-			name:   "empty json ShortenPost test #3",
+			name:   "empty body url ShortenPost test #5",
+			isMock: false,
+			reqFunc: func() *http.Request {
+				url := server.NewURL("")
+				marshal, err := json.Marshal(url)
+				if err != nil {
+					logger.Log.Error("marshal json", zap.Error(err))
+				}
+				req := httptest.NewRequest("POST", srv.URL+"/api/shorten",
+					bytes.NewReader(marshal))
+				req.RequestURI = ""
+				return req
+			},
+			want: want{
+				contentType: server.ApplicationJSON,
+				statusCode:  400,
+			},
+		},
+		{
+			name:   "empty json ShortenPost test #6",
 			isMock: false,
 			reqFunc: func() *http.Request {
 				body := strings.NewReader("{}")
@@ -223,20 +335,44 @@ func TestShortenPost(t *testing.T) {
 				return req
 			},
 			want: want{
-				contentType: server.TextPlain,
+				contentType: server.ApplicationJSON,
 				statusCode:  400,
 			},
 		},
+		{
+			name:   "alias of shortened URL ShortenPost test #7",
+			isMock: true,
+			mockOn: func(m *storage.MockedStorage) *mock.Call {
+				return m.On("SaveURLWithID", mock.Anything, mock.Anything,
+					"late-alias", mock.Anything, mock.Anything, mock.Anything,
+					mock.Anything).Return("EEEEEEEE", storage.ErrDBConflict)
+			},
+			reqFunc: func() *http.Request {
+				url := server.URLModel{URL: "https://practicum.yandex.ru/", Alias: "late-alias"}
+				marshal, err := json.Marshal(url)
+				if err != nil {
+					logger.Log.Error("marshal json", zap.Error(err))
+				}
+				req := httptest.NewRequest("POST", srv.URL+"/api/shorten",
+					bytes.NewReader(marshal))
+				req.RequestURI = ""
+				return req
+			},
+			want: want{
+				contentType: server.ApplicationJSON,
+				statusCode:  409,
+				body:        string(aliasConflict),
+			},
+		},
 	}
 	RunSubTests(t, tests, tSrv)
 }
 
 func TestShortenBatch(t *testing.T) {
 	conf := config.Get()
-	tStorage := new(storage.MockedStorage)
+	tStorage := newMockedStorage()
 	short := shortener.New(tStorage)
-	delChannel := make(chan model.BatchDeleteEntry, 3)
-	uh := server.New(conf, short, delChannel)
+	uh := server.New(conf, short)
 	r := setUpRouter(conf, uh)
 
 	srv := httptest.NewServer(r)
@@ -301,10 +437,9 @@ func TestShortenBatch(t *testing.T) {
 
 func TestNoRoutes(t *testing.T) {
 	conf := config.Get()
-	tStorage := new(storage.MockedStorage)
+	tStorage := newMockedStorage()
 	short := shortener.New(tStorage)
-	delChannel := make(chan model.BatchDeleteEntry, 3)
-	uh := server.New(conf, short, delChannel)
+	uh := server.New(conf, short)
 	r := setUpRouter(conf, uh)
 
 	srv := httptest.NewServer(r)
@@ -359,10 +494,9 @@ func TestNoRoutes(t *testing.T) {
 
 func TestGetUsersURLs(t *testing.T) {
 	conf := config.Get()
-	tStorage := new(storage.MockedStorage)
+	tStorage := newMockedStorage()
 	short := shortener.New(tStorage)
-	delChannel := make(chan model.BatchDeleteEntry, 3)
-	uh := server.New(conf, short, delChannel)
+	uh := server.New(conf, short)
 	r := setUpRouter(conf, uh)
 
 	srv := httptest.NewServer(r)
@@ -414,6 +548,67 @@ func TestGetUsersURLs(t *testing.T) {
 	RunSubTests(t, tests, tSrv)
 }
 
+func TestDeleteURLs(t *testing.T) {
+	conf := config.Get()
+	tStorage := newMockedStorage()
+	short := shortener.New(tStorage)
+	uh := server.New(conf, short)
+	r := setUpRouter(conf, uh)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	tSrv := newTestConf(srv, tStorage)
+
+	tests := []test{
+		{
+			name:   "accepted delete job #1",
+			isMock: true,
+			mockOn: func(m *storage.MockedStorage) *mock.Call {
+				return m.On("SaveDeleteJob", mock.Anything, mock.Anything).Return(nil)
+			},
+			reqFunc: func() *http.Request {
+				body := strings.NewReader(`["AAAAAAAA","BBBBBBBB"]`)
+				req := httptest.NewRequest("DELETE", tSrv.URL+"/api/user/urls", body)
+				req.RequestURI = ""
+				return req
+			},
+			want: want{
+				contentType: server.ApplicationJSON,
+				statusCode:  202,
+			},
+		},
+		{
+			name: "empty batch #2",
+			reqFunc: func() *http.Request {
+				req := httptest.NewRequest("DELETE", tSrv.URL+"/api/user/urls", strings.NewReader(`[]`))
+				req.RequestURI = ""
+				return req
+			},
+			want: want{
+				contentType: server.TextPlain,
+				statusCode:  400,
+			},
+		},
+		{
+			name:   "delete job not found #3",
+			isMock: true,
+			mockOn: func(m *storage.MockedStorage) *mock.Call {
+				return m.On("FindDeleteJob", mock.Anything, mock.Anything, "missing").
+					Return(model.DeleteJob{}, storage.ErrNotFound)
+			},
+			reqFunc: func() *http.Request {
+				req := httptest.NewRequest("GET", tSrv.URL+"/api/user/urls/delete-jobs/missing", nil)
+				req.RequestURI = ""
+				return req
+			},
+			want: want{
+				statusCode: 404,
+			},
+		},
+	}
+	RunSubTests(t, tests, tSrv)
+}
+
 func TestGetAPIInternalStats(t *testing.T) {
 	conf := config.Get()
 	_, ipNet, err := net.ParseCIDR("192.168.1.0/24")
@@ -421,10 +616,9 @@ func TestGetAPIInternalStats(t *testing.T) {
 		require.NoError(t, err)
 	}
 	conf.TrustedSubnetCIDR = ipNet
-	tStorage := new(storage.MockedStorage)
+	tStorage := newMockedStorage()
 	short := shortener.New(tStorage)
-	delChannel := make(chan model.BatchDeleteEntry, 3)
-	uh := server.New(conf, short, delChannel)
+	uh := server.New(conf, short)
 	r := setUpRouter(conf, uh)
 
 	srv := httptest.NewServer(r)
@@ -476,14 +670,59 @@ func TestGetAPIInternalStats(t *testing.T) {
 	RunSubTests(t, tests, tSrv)
 }
 
+func TestMetrics(t *testing.T) {
+	conf := config.Get()
+	_, ipNet, err := net.ParseCIDR("192.168.1.0/24")
+	if err != nil {
+		require.NoError(t, err)
+	}
+	conf.TrustedSubnetCIDR = ipNet
+	tStorage := newMockedStorage()
+	short := shortener.New(tStorage)
+	uh := server.New(conf, short)
+	r := setUpRouter(conf, uh)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	tSrv := newTestConf(srv, tStorage)
+
+	tests := []test{
+		{
+			name: "trusted ip test #1",
+			reqFunc: func() *http.Request {
+				req := httptest.NewRequest("GET", tSrv.URL+"/metrics", nil)
+				req.RequestURI = ""
+				req.Header.Set("x-real-ip", "192.168.1.100")
+				return req
+			},
+			want: want{
+				contentType: "text/plain; version=0.0.4; charset=utf-8",
+				statusCode:  200,
+			},
+		},
+		{
+			name: "untrusted ip test #2",
+			reqFunc: func() *http.Request {
+				req := httptest.NewRequest("GET", tSrv.URL+"/metrics", nil)
+				req.RequestURI = ""
+				req.Header.Set("x-real-ip", "10.0.0.1")
+				return req
+			},
+			want: want{
+				statusCode: 403,
+			},
+		},
+	}
+	RunSubTests(t, tests, tSrv)
+}
+
 func TestGzipCompression(t *testing.T) {
 	conf := config.Get()
-	tStorage := new(storage.MockedStorage)
-	tStorage.On("SaveURL", mock.Anything, mock.Anything,
-		mock.Anything).Return("MMMMMMMM", nil)
+	tStorage := newMockedStorage()
+	tStorage.On("SaveURL", mock.Anything, mock.Anything, mock.Anything,
+		mock.Anything, mock.Anything).Return("MMMMMMMM", nil)
 	short := shortener.New(tStorage)
-	delChannel := make(chan model.BatchDeleteEntry, 3)
-	uh := server.New(conf, short, delChannel)
+	uh := server.New(conf, short)
 	r := setUpRouter(conf, uh)
 
 	srv := httptest.NewServer(r)
@@ -558,3 +797,338 @@ func TestGzipCompression(t *testing.T) {
 		require.True(t, IDURLRegex.MatchString(string(b)))
 	})
 }
+
+func TestAPIKeys(t *testing.T) {
+	conf := config.Get()
+	short := shortener.New(storage.NewMapStorage(generator.DefaultIDGenerator()))
+	uh := server.New(conf, short)
+	srv := httptest.NewServer(setUpRouter(conf, uh))
+	defer srv.Close()
+	session := createHTTPAuthClient(t, srv)
+
+	body := strings.NewReader(`{"name":"ci","scopes":["read","read"]}`)
+	resp, err := session.Post(srv.URL+"/api/user/keys", "application/json", body)
+	require.NoError(t, err)
+	var created server.APIKeyCreatedModel
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.True(t, strings.HasPrefix(created.Key, created.Prefix))
+	require.Equal(t, []string{model.ScopeRead}, created.Scopes)
+
+	resp, err = session.Get(srv.URL + "/api/user/keys")
+	require.NoError(t, err)
+	listed, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotContains(t, string(listed), created.Key)
+
+	token, err := auth.GenerateToken()
+	require.NoError(t, err)
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		authHeader string
+		want       int
+	}{
+		{name: "read with read-only key #1", method: http.MethodGet, path: "/api/user/urls",
+			authHeader: "Bearer " + created.Key, want: http.StatusNoContent},
+		{name: "create with read-only key #2", method: http.MethodPost, path: "/api/shorten",
+			authHeader: "Bearer " + created.Key, want: http.StatusForbidden},
+		{name: "manage keys with key #3", method: http.MethodGet, path: "/api/user/keys",
+			authHeader: "Bearer " + created.Key, want: http.StatusForbidden},
+		{name: "unknown key #4", method: http.MethodGet, path: "/api/user/urls",
+			authHeader: "Bearer " + auth.APIKeyPrefix + "unknown", want: http.StatusUnauthorized},
+		{name: "invalid bearer JWT #5", method: http.MethodPost, path: "/api/shorten",
+			authHeader: "Bearer invalid", want: http.StatusUnauthorized},
+		{name: "unsupported scheme #6", method: http.MethodGet, path: "/api/user/urls",
+			authHeader: "Basic dXNlcjpwYXNz", want: http.StatusUnauthorized},
+		{name: "bearer JWT #7", method: http.MethodPost, path: "/api/shorten",
+			authHeader: "Bearer " + token, want: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path,
+				strings.NewReader(`{"url":"https://practicum.yandex.ru/"}`))
+			require.NoError(t, err)
+			req.Header.Set(server.AuthorizationHeader, tt.authHeader)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.want, resp.StatusCode)
+			assert.Empty(t, resp.Cookies())
+		})
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, srv.URL+"/api/user/keys/"+created.ID, nil)
+	require.NoError(t, err)
+	resp, err = session.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodGet, srv.URL+"/api/user/urls", nil)
+	require.NoError(t, err)
+	req.Header.Set(server.AuthorizationHeader, "Bearer "+created.Key)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestAccounts(t *testing.T) {
+	conf := config.Get()
+	short := shortener.New(storage.NewMapStorage(generator.DefaultIDGenerator()))
+	uh := server.New(conf, short)
+	srv := httptest.NewServer(setUpRouter(conf, uh))
+	defer srv.Close()
+
+	shorten := func(client *http.Client, url string) {
+		resp, err := client.Post(srv.URL+"/api/shorten", "application/json",
+			strings.NewReader(`{"url":"`+url+`"}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+	userURLs := func(client *http.Client) int {
+		resp, err := client.Get(srv.URL + "/api/user/urls")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var pairs []model.URLPair
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&pairs))
+		}
+		return len(pairs)
+	}
+	account := func(client *http.Client, path string, creds string) (int, server.AccountModel) {
+		resp, err := client.Post(srv.URL+path, "application/json", strings.NewReader(creds))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var acc server.AccountModel
+		if resp.StatusCode < 300 {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&acc))
+		}
+		return resp.StatusCode, acc
+	}
+	const creds = `{"email":" User@Example.com ","password":"secret-password"}`
+
+	first := createHTTPAuthClient(t, srv)
+	shorten(first, "https://practicum.yandex.ru/first")
+	status, registered := account(first, "/api/user/register", creds)
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "user@example.com", registered.Email)
+	assert.NotEmpty(t, registered.Token)
+	assert.Equal(t, 1, userURLs(first))
+
+	second := createHTTPAuthClient(t, srv)
+	shorten(second, "https://practicum.yandex.ru/second")
+	status, loggedIn := account(second, "/api/user/login", creds)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, registered.ID, loggedIn.ID)
+	assert.Equal(t, 2, userURLs(second))
+	assert.Equal(t, 2, userURLs(first))
+
+	tests := []struct {
+		name  string
+		path  string
+		creds string
+		want  int
+	}{
+		{name: "email is taken #1", path: "/api/user/register", creds: creds, want: http.StatusConflict},
+		{name: "invalid email #2", path: "/api/user/register",
+			creds: `{"email":"user","password":"secret-password"}`, want: http.StatusBadRequest},
+		{name: "short password #3", path: "/api/user/register",
+			creds: `{"email":"new@example.com","password":"short"}`, want: http.StatusBadRequest},
+		{name: "wrong password #4", path: "/api/user/login",
+			creds: `{"email":"user@example.com","password":"wrong-password"}`, want: http.StatusUnauthorized},
+		{name: "unknown email #5", path: "/api/user/login",
+			creds: `{"email":"unknown@example.com","password":"secret-password"}`, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _ := account(createHTTPAuthClient(t, srv), tt.path, tt.creds)
+			assert.Equal(t, tt.want, status)
+		})
+	}
+}
+
+func TestSessions(t *testing.T) {
+	conf := config.Get()
+	short := shortener.New(storage.NewMapStorage(generator.DefaultIDGenerator()))
+	uh := server.New(conf, short)
+	srv := httptest.NewServer(setUpRouter(conf, uh))
+	defer srv.Close()
+
+	cookies := func(resp *http.Response) map[string]string {
+		res := make(map[string]string)
+		for _, c := range resp.Cookies() {
+			res[c.Name] = c.Value
+		}
+		return res
+	}
+	refresh := func(token string) (int, server.SessionModel) {
+		resp, err := http.Post(srv.URL+"/api/user/refresh", "application/json",
+			strings.NewReader(`{"refresh_token":"`+token+`"}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var sess server.SessionModel
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&sess))
+		}
+		return resp.StatusCode, sess
+	}
+	withBearer := func(method string, path string, token string, body string) int {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set(server.AuthorizationHeader, "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	resp, err := http.Post(srv.URL+"/api/shorten", "application/json",
+		strings.NewReader(`{"url":"https://practicum.yandex.ru/"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	issued := cookies(resp)
+	require.NotEmpty(t, issued[server.UserCookieName])
+	require.NotEmpty(t, issued[server.RefreshCookieName])
+
+	status, sess := refresh(issued[server.RefreshCookieName])
+	require.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, sess.Token)
+	status, reused := refresh(issued[server.RefreshCookieName])
+	assert.Equal(t, http.StatusOK, status, "refresh token is reused within grace window")
+	assert.Equal(t, sess, reused, "reused refresh token returns the rotated session")
+	status, _ = refresh(sess.Token)
+	assert.Equal(t, http.StatusUnauthorized, status, "access token is used as refresh token")
+	assert.Equal(t, http.StatusUnauthorized,
+		withBearer(http.MethodGet, "/api/user/urls", sess.RefreshToken, ""),
+		"refresh token is used as access token")
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/user/urls", nil)
+	require.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: server.RefreshCookieName, Value: sess.RefreshToken})
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "session is renewed by refresh cookie")
+	rotated := cookies(resp)
+	require.NotEmpty(t, rotated[server.UserCookieName])
+	require.NotEmpty(t, rotated[server.RefreshCookieName])
+	status, reused = refresh(sess.RefreshToken)
+	assert.Equal(t, http.StatusOK, status, "refresh cookie is reused within grace window")
+	assert.Equal(t, rotated[server.RefreshCookieName], reused.RefreshToken, "refresh cookie is rotated")
+
+	access := rotated[server.UserCookieName]
+	assert.Equal(t, http.StatusOK, withBearer(http.MethodGet, "/api/user/urls", access, ""))
+	assert.Equal(t, http.StatusNoContent, withBearer(http.MethodPost, "/api/user/logout", access,
+		`{"refresh_token":"`+rotated[server.RefreshCookieName]+`"}`))
+	assert.Equal(t, http.StatusUnauthorized, withBearer(http.MethodGet, "/api/user/urls", access, ""),
+		"access token is revoked by logout")
+	status, _ = refresh(rotated[server.RefreshCookieName])
+	assert.Equal(t, http.StatusUnauthorized, status, "refresh token is revoked by logout")
+	status, _ = refresh(sess.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status, "rotated session is revoked by logout")
+}
+
+func TestQuota(t *testing.T) {
+	conf := config.Get()
+	short := shortener.New(storage.NewMapStorage(generator.DefaultIDGenerator()))
+	short.SetQuota(shortener.Quota{MaxActive: 2, MaxBatch: 2})
+	uh := server.New(conf, short)
+	srv := httptest.NewServer(setUpRouter(conf, uh))
+	defer srv.Close()
+	session := createHTTPAuthClient(t, srv)
+
+	post := func(path string, body string) (int, server.QuotaErrorModel) {
+		resp, err := session.Post(srv.URL+path, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var qe server.QuotaErrorModel
+		if resp.StatusCode >= http.StatusBadRequest {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&qe))
+		}
+		return resp.StatusCode, qe
+	}
+	code, qe := post("/api/shorten/batch", `[{"correlation_id":"1","original_url":"https://a.ru/"},`+
+		`{"correlation_id":"2","original_url":"https://b.ru/"},{"correlation_id":"3","original_url":"https://c.ru/"}]`)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, shortener.QuotaBatch, qe.Quota)
+	assert.Equal(t, 3, qe.Requested)
+
+	code, _ = post("/api/shorten/batch", `[{"correlation_id":"1","original_url":"https://a.ru/"}]`)
+	assert.Equal(t, http.StatusCreated, code)
+	code, _ = post("/api/shorten", `{"url":"https://b.ru/"}`)
+	assert.Equal(t, http.StatusCreated, code)
+	code, qe = post("/api/shorten", `{"url":"https://c.ru/"}`)
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.Equal(t, server.QuotaErrorModel{Error: qe.Error, Quota: shortener.QuotaActive,
+		Limit: 2, Used: 2, Requested: 1}, qe)
+
+	resp, err := session.Get(srv.URL + "/api/user/quota")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var usage model.QuotaUsage
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&usage))
+	assert.Equal(t, model.QuotaUsage{
+		Active:   model.QuotaValue{Used: 2, Limit: 2},
+		Daily:    model.QuotaValue{Used: 2},
+		MaxBatch: 2,
+	}, usage)
+}
+
+func TestHostLists(t *testing.T) {
+	dir := t.TempDir()
+	blockPath := filepath.Join(dir, "block.txt")
+	require.NoError(t, os.WriteFile(blockPath, []byte("*.evil.ru\n"), 0o600))
+	hosts, err := hostlist.NewFilter("", blockPath)
+	require.NoError(t, err)
+
+	conf := config.Get()
+	short := shortener.New(storage.NewMapStorage(generator.DefaultIDGenerator()))
+	short.SetHostFilter(hosts)
+	uh := server.New(conf, short)
+	srv := httptest.NewServer(setUpRouter(conf, uh))
+	defer srv.Close()
+	session := createHTTPAuthClient(t, srv)
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		wantCode int
+	}{
+		{name: "plain blocked #1", path: "/", body: "https://www.evil.ru/", wantCode: http.StatusUnprocessableEntity},
+		{name: "json blocked #2", path: "/api/shorten", body: `{"url":"https://a.evil.ru/"}`,
+			wantCode: http.StatusUnprocessableEntity},
+		{name: "batch blocked #3", path: "/api/shorten/batch",
+			body:     `[{"correlation_id":"1","original_url":"https://a.ru/"},{"correlation_id":"2","original_url":"https://b.evil.ru/"}]`,
+			wantCode: http.StatusUnprocessableEntity},
+		{name: "json allowed #4", path: "/api/shorten", body: `{"url":"https://evil.ru/"}`, wantCode: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := session.Post(srv.URL+tt.path, "application/json", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tt.wantCode, resp.StatusCode)
+			if tt.wantCode != http.StatusUnprocessableEntity {
+				return
+			}
+			var em server.ErrorModel
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&em))
+			assert.Equal(t, server.ErrorCodeHostBlocked, em.Code)
+		})
+	}
+
+	resp, err := http.Post(srv.URL+"/api/internal/recheck", "", nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "recheck is allowed for trusted subnet only")
+}
@@ -7,12 +7,17 @@ import (
 	"fmt"
 	"go.uber.org/zap"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/denis-oreshkevich/shortener/internal/app/util/auth"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/ratelimit"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/validator"
 )
 
@@ -29,9 +34,180 @@ const (
 
 	databaseDSN = "DATABASE_DSN"
 
+	// SQLiteScheme DSN scheme that selects embedded SQLite storage,
+	// e.g. sqlite:///var/lib/shortener.db or sqlite://shortener.db.
+	SQLiteScheme = "sqlite://"
+
 	enableHTTPS = "ENABLE_HTTPS"
 
 	trustedSubnet = "TRUSTED_SUBNET"
+
+	aliasPattern = "ALIAS_PATTERN"
+
+	reaperInterval = "REAPER_INTERVAL"
+
+	idGenerator = "ID_GENERATOR"
+
+	idAlphabet = "ID_ALPHABET"
+
+	idLength = "ID_LENGTH"
+
+	fileCompactThreshold = "FILE_COMPACT_THRESHOLD"
+
+	cacheSize = "CACHE_SIZE"
+
+	cacheTTL = "CACHE_TTL"
+
+	cacheNegativeTTL = "CACHE_NEGATIVE_TTL"
+
+	clickBatchSize = "CLICK_BATCH_SIZE"
+
+	clickFlushInterval = "CLICK_FLUSH_INTERVAL"
+
+	deleteWorkers = "DELETE_WORKERS"
+
+	deleteMaxAttempts = "DELETE_MAX_ATTEMPTS"
+
+	deleteRetryBackoff = "DELETE_RETRY_BACKOFF"
+
+	jwtSecret = "JWT_SECRET"
+
+	jwtKeysFile = "JWT_KEYS_FILE"
+
+	accessTokenTTL = "ACCESS_TOKEN_TTL"
+
+	refreshTokenTTL = "REFRESH_TOKEN_TTL"
+
+	cookieSecure = "COOKIE_SECURE"
+
+	cookieSameSite = "COOKIE_SAMESITE"
+
+	cookieDomain = "COOKIE_DOMAIN"
+
+	cookiePath = "COOKIE_PATH"
+
+	rateLimitCreate = "RATE_LIMIT_CREATE"
+
+	rateLimitRedirect = "RATE_LIMIT_REDIRECT"
+
+	rateLimitList = "RATE_LIMIT_LIST"
+
+	rateLimitAuth = "RATE_LIMIT_AUTH"
+
+	rateLimitIPFactor = "RATE_LIMIT_IP_FACTOR"
+
+	rateLimitStore = "RATE_LIMIT_STORE"
+
+	quotaMaxActive = "QUOTA_MAX_ACTIVE"
+
+	quotaMaxPerDay = "QUOTA_MAX_PER_DAY"
+
+	quotaMaxBatch = "QUOTA_MAX_BATCH"
+
+	hostAllowlistFile = "HOST_ALLOWLIST_FILE"
+
+	hostBlocklistFile = "HOST_BLOCKLIST_FILE"
+
+	hostListsCheckInterval = "HOST_LISTS_CHECK_INTERVAL"
+
+	canonicalStripParams = "CANONICAL_STRIP_PARAMS"
+
+	canonicalSortQuery = "CANONICAL_SORT_QUERY"
+
+	urlAllowedSchemes = "URL_ALLOWED_SCHEMES"
+
+	urlAllowPrivate = "URL_ALLOW_PRIVATE"
+
+	urlMaxLength = "URL_MAX_LENGTH"
+
+	enableHTTP = "ENABLE_HTTP"
+
+	enableGRPC = "ENABLE_GRPC"
+
+	grpcMultiplex = "GRPC_MULTIPLEX"
+
+	tlsCertFile = "TLS_CERT_FILE"
+
+	tlsKeyFile = "TLS_KEY_FILE"
+
+	grpcAddress = "GRPC_ADDRESS"
+
+	grpcClientCAFile = "GRPC_CLIENT_CA_FILE"
+
+	grpcMaxMsgSize = "GRPC_MAX_MSG_SIZE"
+
+	grpcMaxConcurrentStreams = "GRPC_MAX_CONCURRENT_STREAMS"
+
+	grpcMaxConnections = "GRPC_MAX_CONNECTIONS"
+
+	grpcKeepaliveTime = "GRPC_KEEPALIVE_TIME"
+
+	grpcKeepaliveTimeout = "GRPC_KEEPALIVE_TIMEOUT"
+
+	grpcKeepaliveMinTime = "GRPC_KEEPALIVE_MIN_TIME"
+
+	grpcMaxConnectionIdle = "GRPC_MAX_CONNECTION_IDLE"
+)
+
+const defaultReaperInterval = time.Minute
+
+// defaultHostListsCheckInterval how often host list files are checked for changes.
+const defaultHostListsCheckInterval = 10 * time.Second
+
+const defaultFileCompactThreshold = 1000
+
+// Defaults of redirect cache.
+const (
+	defaultCacheSize        = 10000
+	defaultCacheTTL         = time.Minute
+	defaultCacheNegativeTTL = 5 * time.Second
+)
+
+// Defaults of click analytics pipeline.
+const (
+	defaultClickBatchSize     = 100
+	defaultClickFlushInterval = time.Second
+)
+
+// Defaults of deletion pipeline.
+const (
+	defaultDeleteWorkers      = 4
+	defaultDeleteMaxAttempts  = 5
+	defaultDeleteRetryBackoff = time.Second
+)
+
+// Defaults of rate limits per user, limits per client IP are multiplied by IP factor.
+// Auth limit is limit per client IP.
+const (
+	defaultRateLimitCreate   = "10/s:20"
+	defaultRateLimitRedirect = "100/s:200"
+	defaultRateLimitList     = "2/s:10"
+	defaultRateLimitAuth     = "10/m:20"
+	defaultRateLimitIPFactor = 5
+)
+
+// Stores of rate limit buckets.
+const (
+	// RateLimitStoreMemory keeps buckets in memory of the instance.
+	RateLimitStoreMemory = "memory"
+	// RateLimitStoreStorage keeps buckets in database, so they are shared by instances.
+	RateLimitStoreStorage = "storage"
+)
+
+// Defaults of TLS certificate, it's generated if files don't exist.
+const (
+	defaultTLSCertFile = "./certs/cert.pem"
+	defaultTLSKeyFile  = "./certs/key.pem"
+)
+
+// Defaults of gRPC server.
+const (
+	defaultGRPCAddress              = ":3200"
+	defaultGRPCMaxMsgSize           = 4 << 20
+	defaultGRPCMaxConcurrentStreams = 100
+	defaultGRPCKeepaliveTime        = 2 * time.Hour
+	defaultGRPCKeepaliveTimeout     = 20 * time.Second
+	defaultGRPCKeepaliveMinTime     = 5 * time.Minute
 )
 
 var conf Conf
@@ -57,9 +233,64 @@ func Parse() error {
 	// /tmp/short-url-db.json
 	f := flag.String("f", "", "Path to storage file")
 	//host=localhost port=5433 user=postgres password=postgres dbname=courses sslmode=disable
-	d := flag.String("d", "", "Database connection")
+	d := flag.String("d", "", "Database connection, sqlite:// prefix selects embedded SQLite file")
 	s := flag.String("s", "", "Enables HTTPS")
 	t := flag.String("t", "", "Trusted subnet")
+	ap := flag.String("alias-pattern", "", "Regular expression for custom short IDs")
+	ri := flag.String("reaper-interval", "", "Interval between expired URLs cleanups")
+	ig := flag.String("id-generator", "", "Short ID generation strategy: random, counter or hash")
+	ia := flag.String("id-alphabet", "", "Alphabet of generated short IDs")
+	il := flag.String("id-length", "", "Length of generated short IDs")
+	fct := flag.String("file-compact-threshold", "", "Amount of deleted records in storage file that triggers compaction, 0 disables it")
+	cs := flag.String("cache-size", "", "Max amount of cached redirects for DB storages, 0 disables cache")
+	ct := flag.String("cache-ttl", "", "How long found URLs are cached")
+	cnt := flag.String("cache-negative-ttl", "", "How long not found and deleted URLs are cached")
+	cbs := flag.String("click-batch-size", "", "Max amount of clicks saved at once")
+	cfi := flag.String("click-flush-interval", "", "Interval between saving of incomplete click batches")
+	dw := flag.String("delete-workers", "", "Amount of workers that process delete jobs")
+	dma := flag.String("delete-max-attempts", "", "Max attempts to process delete job before it fails")
+	drb := flag.String("delete-retry-backoff", "", "Delay before the first retry of delete job, doubled on every next retry")
+	js := flag.String("jwt-secret", "", "HMAC secret to sign JWT, at least 32 bytes")
+	jkf := flag.String("jwt-keys-file", "", "Path to JSON file with JWT signing keys, overrides jwt secret")
+	att := flag.String("access-token-ttl", "", "Lifetime of access JWT")
+	rtt := flag.String("refresh-token-ttl", "", "Lifetime of refresh JWT")
+	cks := flag.String("cookie-secure", "", "Sends session cookies over HTTPS only")
+	ckss := flag.String("cookie-samesite", "", "SameSite attribute of session cookies: lax, strict or none")
+	ckd := flag.String("cookie-domain", "", "Domain attribute of session cookies")
+	ckp := flag.String("cookie-path", "", "Path attribute of session cookies")
+	rlc := flag.String("rate-limit-create", "", "Rate limit of URL creation per user, e.g. 10/s:20, off disables it")
+	rlr := flag.String("rate-limit-redirect", "", "Rate limit of redirects per user, e.g. 100/s:200, off disables it")
+	rll := flag.String("rate-limit-list", "", "Rate limit of user URLs listing per user, e.g. 2/s:10, off disables it")
+	rla := flag.String("rate-limit-auth", "", "Rate limit of sign up, sign in and API keys management per client IP, "+
+		"e.g. 10/m:20, off disables it")
+	rlif := flag.String("rate-limit-ip-factor", "", "Multiplier of rate limits per client IP, 0 disables them")
+	rls := flag.String("rate-limit-store", "", "Store of rate limit buckets: memory or storage")
+	qma := flag.String("quota-max-active", "", "Max amount of active URLs per user, 0 means no limit")
+	qmd := flag.String("quota-max-per-day", "", "Max amount of URLs created per user during 24 hours, 0 means no limit")
+	qmb := flag.String("quota-max-batch", "", "Max amount of URLs in batch request, 0 means no limit")
+	haf := flag.String("host-allowlist-file", "", "Path to list of hosts URLs may point to, empty allows every host")
+	hbf := flag.String("host-blocklist-file", "", "Path to list of hosts URLs must not point to")
+	hlci := flag.String("host-lists-check-interval", "", "Interval between checks of host list files for changes, 0 disables it")
+	csp := flag.String("canonical-strip-params", "", "Comma separated query parameters removed from canonical form of URLs, "+
+		"name ending with * is a prefix, e.g. utm_*,fbclid")
+	csq := flag.String("canonical-sort-query", "", "Sorts query parameters in canonical form of URLs")
+	uas := flag.String("url-allowed-schemes", "", "Comma separated schemes of URLs that can be shortened, http,https by default")
+	uap := flag.String("url-allow-private", "", "Allows URLs pointing to localhost, loopback and private IP addresses")
+	uml := flag.String("url-max-length", "", "Max length of URL in bytes, 0 means no limit")
+	eh := flag.String("enable-http", "", "Enables HTTP API, probes and metrics are served anyway")
+	eg := flag.String("enable-grpc", "", "Enables gRPC API")
+	gm := flag.String("grpc-multiplex", "", "Serves gRPC on HTTP server address instead of separate gRPC address")
+	tcf := flag.String("tls-cert-file", "", "Path to TLS certificate, generated if it doesn't exist")
+	tkf := flag.String("tls-key-file", "", "Path to TLS private key, generated if it doesn't exist")
+	ga := flag.String("grpc-address", "", "gRPC server address")
+	gca := flag.String("grpc-client-ca-file", "", "Path to CA certificate of gRPC clients, enables mTLS")
+	gmms := flag.String("grpc-max-msg-size", "", "Max size of gRPC message in bytes")
+	gmcs := flag.String("grpc-max-concurrent-streams", "", "Max amount of concurrent streams per gRPC connection")
+	gmc := flag.String("grpc-max-connections", "", "Max amount of simultaneous gRPC connections, 0 means unlimited")
+	gkt := flag.String("grpc-keepalive-time", "", "Idle time after which gRPC server pings client")
+	gkto := flag.String("grpc-keepalive-timeout", "", "How long gRPC server waits for ping ack before closing connection")
+	gkmt := flag.String("grpc-keepalive-min-time", "", "Min interval between client pings, more frequent pings close connection")
+	gmci := flag.String("grpc-max-connection-idle", "", "Idle time after which gRPC connection is closed, 0 means infinity")
 	c := flag.String("c", "./conf/config.json", "Path to configuration file")
 	flag.Parse()
 
@@ -116,6 +347,13 @@ func Parse() error {
 		argVal:     *d,
 		defaultVal: cfJSON.DatabaseDSN,
 		initFunc: func(s string) error {
+			if strings.HasPrefix(s, SQLiteScheme) {
+				conf.sqlitePath = strings.TrimPrefix(s, SQLiteScheme)
+				if conf.sqlitePath == "" {
+					return errors.New("sqlite DSN has empty path")
+				}
+				return nil
+			}
 			conf.databaseDSN = s
 			return nil
 		},
@@ -166,7 +404,745 @@ func Parse() error {
 		return err
 	}
 
-	logger.Log.Info(fmt.Sprintf("Result configuration: %+v\n", conf))
+	iap := initStructure{
+		envName:    aliasPattern,
+		argVal:     *ap,
+		defaultVal: cfJSON.AliasPattern,
+		initFunc: func(s string) error {
+			if len(s) == 0 {
+				return nil
+			}
+			if pErr := validator.SetAliasPattern(s); pErr != nil {
+				return fmt.Errorf("validator.SetAliasPattern: %w", pErr)
+			}
+			conf.aliasPattern = s
+			return nil
+		},
+	}
+	err = initAppParam(iap)
+	if err != nil {
+		return err
+	}
+
+	iri := initStructure{
+		envName:    reaperInterval,
+		argVal:     *ri,
+		defaultVal: cfJSON.ReaperInterval,
+		initFunc: func(s string) error {
+			if len(s) == 0 {
+				conf.reaperInterval = defaultReaperInterval
+				return nil
+			}
+			d, pErr := time.ParseDuration(s)
+			if pErr != nil {
+				return fmt.Errorf("time.ParseDuration: %w", pErr)
+			}
+			if d <= 0 {
+				return fmt.Errorf("reaper interval must be positive, got %s", s)
+			}
+			conf.reaperInterval = d
+			return nil
+		},
+	}
+	err = initAppParam(iri)
+	if err != nil {
+		return err
+	}
+
+	iig := initStructure{
+		envName:    idGenerator,
+		argVal:     *ig,
+		defaultVal: cfJSON.IDGenerator,
+		initFunc: func(s string) error {
+			if len(s) == 0 {
+				s = generator.KindRandom
+			}
+			conf.idGenerator = s
+			return nil
+		},
+	}
+	err = initAppParam(iig)
+	if err != nil {
+		return err
+	}
+
+	iia := initStructure{
+		envName:    idAlphabet,
+		argVal:     *ia,
+		defaultVal: cfJSON.IDAlphabet,
+		initFunc: func(s string) error {
+			if len(s) == 0 {
+				s = generator.DefaultAlphabet
+			}
+			conf.idAlphabet = s
+			return nil
+		},
+	}
+	err = initAppParam(iia)
+	if err != nil {
+		return err
+	}
+
+	iil := initStructure{
+		envName:    idLength,
+		argVal:     *il,
+		defaultVal: cfJSON.IDLength,
+		initFunc: func(s string) error {
+			if len(s) == 0 {
+				conf.idLength = generator.DefaultLength
+				return nil
+			}
+			l, pErr := strconv.Atoi(s)
+			if pErr != nil {
+				return fmt.Errorf("strconv.Atoi: %w", pErr)
+			}
+			conf.idLength = l
+			return nil
+		},
+	}
+	err = initAppParam(iil)
+	if err != nil {
+		return err
+	}
+	ifct := initStructure{
+		envName:    fileCompactThreshold,
+		argVal:     *fct,
+		defaultVal: cfJSON.FileCompactThreshold,
+		initFunc: func(s string) error {
+			if len(s) == 0 {
+				conf.fileCompactThreshold = defaultFileCompactThreshold
+				return nil
+			}
+			v, pErr := strconv.ParseInt(s, 10, 64)
+			if pErr != nil {
+				return fmt.Errorf("strconv.ParseInt: %w", pErr)
+			}
+			if v < 0 {
+				return fmt.Errorf("file compact threshold must not be negative, got %s", s)
+			}
+			conf.fileCompactThreshold = v
+			return nil
+		},
+	}
+	err = initAppParam(ifct)
+	if err != nil {
+		return err
+	}
+
+	ics := initStructure{
+		envName:    cacheSize,
+		argVal:     *cs,
+		defaultVal: cfJSON.CacheSize,
+		initFunc: func(s string) error {
+			if len(s) == 0 {
+				conf.cacheSize = defaultCacheSize
+				return nil
+			}
+			v, pErr := strconv.Atoi(s)
+			if pErr != nil {
+				return fmt.Errorf("strconv.Atoi: %w", pErr)
+			}
+			if v < 0 {
+				return fmt.Errorf("cache size must not be negative, got %s", s)
+			}
+			conf.cacheSize = v
+			return nil
+		},
+	}
+	err = initAppParam(ics)
+	if err != nil {
+		return err
+	}
+
+	ict := initStructure{
+		envName:    cacheTTL,
+		argVal:     *ct,
+		defaultVal: cfJSON.CacheTTL,
+		initFunc:   durationFunc(&conf.cacheTTL, defaultCacheTTL),
+	}
+	err = initAppParam(ict)
+	if err != nil {
+		return err
+	}
+
+	icnt := initStructure{
+		envName:    cacheNegativeTTL,
+		argVal:     *cnt,
+		defaultVal: cfJSON.CacheNegativeTTL,
+		initFunc:   durationFunc(&conf.cacheNegativeTTL, defaultCacheNegativeTTL),
+	}
+	err = initAppParam(icnt)
+	if err != nil {
+		return err
+	}
+
+	icbs := initStructure{
+		envName:    clickBatchSize,
+		argVal:     *cbs,
+		defaultVal: cfJSON.ClickBatchSize,
+		initFunc: func(s string) error {
+			if len(s) == 0 {
+				conf.clickBatchSize = defaultClickBatchSize
+				return nil
+			}
+			v, pErr := strconv.Atoi(s)
+			if pErr != nil {
+				return fmt.Errorf("strconv.Atoi: %w", pErr)
+			}
+			if v <= 0 {
+				return fmt.Errorf("click batch size must be positive, got %s", s)
+			}
+			conf.clickBatchSize = v
+			return nil
+		},
+	}
+	err = initAppParam(icbs)
+	if err != nil {
+		return err
+	}
+
+	icfi := initStructure{
+		envName:    clickFlushInterval,
+		argVal:     *cfi,
+		defaultVal: cfJSON.ClickFlushInterval,
+		initFunc:   durationFunc(&conf.clickFlushInterval, defaultClickFlushInterval),
+	}
+	err = initAppParam(icfi)
+	if err != nil {
+		return err
+	}
+	if conf.clickFlushInterval == 0 {
+		return errors.New("click flush interval must be positive")
+	}
+
+	idw := initStructure{
+		envName:    deleteWorkers,
+		argVal:     *dw,
+		defaultVal: cfJSON.DeleteWorkers,
+		initFunc:   positiveIntFunc(&conf.deleteWorkers, defaultDeleteWorkers),
+	}
+	err = initAppParam(idw)
+	if err != nil {
+		return err
+	}
+
+	idma := initStructure{
+		envName:    deleteMaxAttempts,
+		argVal:     *dma,
+		defaultVal: cfJSON.DeleteMaxAttempts,
+		initFunc:   positiveIntFunc(&conf.deleteMaxAttempts, defaultDeleteMaxAttempts),
+	}
+	err = initAppParam(idma)
+	if err != nil {
+		return err
+	}
+
+	idrb := initStructure{
+		envName:    deleteRetryBackoff,
+		argVal:     *drb,
+		defaultVal: cfJSON.DeleteRetryBackoff,
+		initFunc:   durationFunc(&conf.deleteRetryBackoff, defaultDeleteRetryBackoff),
+	}
+	err = initAppParam(idrb)
+	if err != nil {
+		return err
+	}
+
+	ijs := initStructure{
+		envName:    jwtSecret,
+		argVal:     *js,
+		defaultVal: cfJSON.JWTSecret,
+		initFunc:   stringFunc(&conf.jwtSecret, ""),
+	}
+	err = initAppParam(ijs)
+	if err != nil {
+		return err
+	}
+
+	ijkf := initStructure{
+		envName:    jwtKeysFile,
+		argVal:     *jkf,
+		defaultVal: cfJSON.JWTKeysFile,
+		initFunc:   stringFunc(&conf.jwtKeysFile, ""),
+	}
+	err = initAppParam(ijkf)
+	if err != nil {
+		return err
+	}
+
+	iatt := initStructure{
+		envName:    accessTokenTTL,
+		argVal:     *att,
+		defaultVal: cfJSON.AccessTokenTTL,
+		initFunc:   durationFunc(&conf.accessTokenTTL, auth.DefaultAccessTokenTTL),
+	}
+	err = initAppParam(iatt)
+	if err != nil {
+		return err
+	}
+
+	irtt := initStructure{
+		envName:    refreshTokenTTL,
+		argVal:     *rtt,
+		defaultVal: cfJSON.RefreshTokenTTL,
+		initFunc:   durationFunc(&conf.refreshTokenTTL, auth.DefaultRefreshTokenTTL),
+	}
+	err = initAppParam(irtt)
+	if err != nil {
+		return err
+	}
+	if conf.accessTokenTTL == 0 {
+		return errors.New("access token TTL must be positive")
+	}
+	if conf.refreshTokenTTL <= conf.accessTokenTTL {
+		return errors.New("refresh token TTL must be longer than access token TTL")
+	}
+
+	icks := initStructure{
+		envName:    cookieSecure,
+		argVal:     *cks,
+		defaultVal: cfJSON.CookieSecure,
+		initFunc:   boolFunc(&conf.cookieSecure, false),
+	}
+	err = initAppParam(icks)
+	if err != nil {
+		return err
+	}
+
+	ickss := initStructure{
+		envName:    cookieSameSite,
+		argVal:     *ckss,
+		defaultVal: cfJSON.CookieSameSite,
+		initFunc:   sameSiteFunc(&conf.cookieSameSite, http.SameSiteLaxMode),
+	}
+	err = initAppParam(ickss)
+	if err != nil {
+		return err
+	}
+	if conf.cookieSameSite == http.SameSiteNoneMode && !conf.cookieSecure {
+		return errors.New("SameSite=None cookies must be secure")
+	}
+
+	ickd := initStructure{
+		envName:    cookieDomain,
+		argVal:     *ckd,
+		defaultVal: cfJSON.CookieDomain,
+		initFunc:   stringFunc(&conf.cookieDomain, ""),
+	}
+	err = initAppParam(ickd)
+	if err != nil {
+		return err
+	}
+
+	ickp := initStructure{
+		envName:    cookiePath,
+		argVal:     *ckp,
+		defaultVal: cfJSON.CookiePath,
+		initFunc: func(s string) error {
+			if len(s) == 0 {
+				s = "/"
+			}
+			if !strings.HasPrefix(s, "/") {
+				return fmt.Errorf("cookie path %q must start with /", s)
+			}
+			conf.cookiePath = s
+			return nil
+		},
+	}
+	err = initAppParam(ickp)
+	if err != nil {
+		return err
+	}
+
+	irlc := initStructure{
+		envName:    rateLimitCreate,
+		argVal:     *rlc,
+		defaultVal: cfJSON.RateLimitCreate,
+		initFunc:   limitFunc(&conf.rateLimitCreate, defaultRateLimitCreate),
+	}
+	err = initAppParam(irlc)
+	if err != nil {
+		return err
+	}
+
+	irlr := initStructure{
+		envName:    rateLimitRedirect,
+		argVal:     *rlr,
+		defaultVal: cfJSON.RateLimitRedirect,
+		initFunc:   limitFunc(&conf.rateLimitRedirect, defaultRateLimitRedirect),
+	}
+	err = initAppParam(irlr)
+	if err != nil {
+		return err
+	}
+
+	irll := initStructure{
+		envName:    rateLimitList,
+		argVal:     *rll,
+		defaultVal: cfJSON.RateLimitList,
+		initFunc:   limitFunc(&conf.rateLimitList, defaultRateLimitList),
+	}
+	err = initAppParam(irll)
+	if err != nil {
+		return err
+	}
+
+	irla := initStructure{
+		envName:    rateLimitAuth,
+		argVal:     *rla,
+		defaultVal: cfJSON.RateLimitAuth,
+		initFunc:   limitFunc(&conf.rateLimitAuth, defaultRateLimitAuth),
+	}
+	err = initAppParam(irla)
+	if err != nil {
+		return err
+	}
+
+	irlif := initStructure{
+		envName:    rateLimitIPFactor,
+		argVal:     *rlif,
+		defaultVal: cfJSON.RateLimitIPFactor,
+		initFunc:   nonNegativeIntFunc(&conf.rateLimitIPFactor, defaultRateLimitIPFactor),
+	}
+	err = initAppParam(irlif)
+	if err != nil {
+		return err
+	}
+
+	iqma := initStructure{
+		envName:    quotaMaxActive,
+		argVal:     *qma,
+		defaultVal: cfJSON.QuotaMaxActive,
+		initFunc:   nonNegativeIntFunc(&conf.quotaMaxActive, 0),
+	}
+	err = initAppParam(iqma)
+	if err != nil {
+		return err
+	}
+
+	iqmd := initStructure{
+		envName:    quotaMaxPerDay,
+		argVal:     *qmd,
+		defaultVal: cfJSON.QuotaMaxPerDay,
+		initFunc:   nonNegativeIntFunc(&conf.quotaMaxPerDay, 0),
+	}
+	err = initAppParam(iqmd)
+	if err != nil {
+		return err
+	}
+
+	iqmb := initStructure{
+		envName:    quotaMaxBatch,
+		argVal:     *qmb,
+		defaultVal: cfJSON.QuotaMaxBatch,
+		initFunc:   nonNegativeIntFunc(&conf.quotaMaxBatch, 0),
+	}
+	err = initAppParam(iqmb)
+	if err != nil {
+		return err
+	}
+
+	ihaf := initStructure{
+		envName:    hostAllowlistFile,
+		argVal:     *haf,
+		defaultVal: cfJSON.HostAllowlistFile,
+		initFunc:   stringFunc(&conf.hostAllowlistFile, ""),
+	}
+	err = initAppParam(ihaf)
+	if err != nil {
+		return err
+	}
+
+	ihbf := initStructure{
+		envName:    hostBlocklistFile,
+		argVal:     *hbf,
+		defaultVal: cfJSON.HostBlocklistFile,
+		initFunc:   stringFunc(&conf.hostBlocklistFile, ""),
+	}
+	err = initAppParam(ihbf)
+	if err != nil {
+		return err
+	}
+
+	ihlci := initStructure{
+		envName:    hostListsCheckInterval,
+		argVal:     *hlci,
+		defaultVal: cfJSON.HostListsCheckInterval,
+		initFunc:   durationFunc(&conf.hostListsCheckInterval, defaultHostListsCheckInterval),
+	}
+	err = initAppParam(ihlci)
+	if err != nil {
+		return err
+	}
+
+	icsp := initStructure{
+		envName:    canonicalStripParams,
+		argVal:     *csp,
+		defaultVal: cfJSON.CanonicalStripParams,
+		initFunc:   listFunc(&conf.canonicalStripParams),
+	}
+	err = initAppParam(icsp)
+	if err != nil {
+		return err
+	}
+
+	icsq := initStructure{
+		envName:    canonicalSortQuery,
+		argVal:     *csq,
+		defaultVal: cfJSON.CanonicalSortQuery,
+		initFunc:   boolFunc(&conf.canonicalSortQuery, false),
+	}
+	err = initAppParam(icsq)
+	if err != nil {
+		return err
+	}
+
+	iuas := initStructure{
+		envName:    urlAllowedSchemes,
+		argVal:     *uas,
+		defaultVal: cfJSON.URLAllowedSchemes,
+		initFunc:   schemesFunc(&conf.urlAllowedSchemes),
+	}
+	err = initAppParam(iuas)
+	if err != nil {
+		return err
+	}
+
+	iuap := initStructure{
+		envName:    urlAllowPrivate,
+		argVal:     *uap,
+		defaultVal: cfJSON.URLAllowPrivate,
+		initFunc:   boolFunc(&conf.urlAllowPrivate, true),
+	}
+	err = initAppParam(iuap)
+	if err != nil {
+		return err
+	}
+
+	iuml := initStructure{
+		envName:    urlMaxLength,
+		argVal:     *uml,
+		defaultVal: cfJSON.URLMaxLength,
+		initFunc:   nonNegativeIntFunc(&conf.urlMaxLength, validator.DefaultMaxURLLength),
+	}
+	err = initAppParam(iuml)
+	if err != nil {
+		return err
+	}
+
+	iehttp := initStructure{
+		envName:    enableHTTP,
+		argVal:     *eh,
+		defaultVal: cfJSON.EnableHTTP,
+		initFunc:   boolFunc(&conf.enableHTTP, true),
+	}
+	err = initAppParam(iehttp)
+	if err != nil {
+		return err
+	}
+
+	ieg := initStructure{
+		envName:    enableGRPC,
+		argVal:     *eg,
+		defaultVal: cfJSON.EnableGRPC,
+		initFunc:   boolFunc(&conf.enableGRPC, false),
+	}
+	err = initAppParam(ieg)
+	if err != nil {
+		return err
+	}
+
+	igm := initStructure{
+		envName:    grpcMultiplex,
+		argVal:     *gm,
+		defaultVal: cfJSON.GRPCMultiplex,
+		initFunc:   boolFunc(&conf.grpcMultiplex, false),
+	}
+	err = initAppParam(igm)
+	if err != nil {
+		return err
+	}
+	if !conf.enableHTTP && !conf.enableGRPC {
+		return errors.New("at least one of HTTP and gRPC must be enabled")
+	}
+	if conf.grpcMultiplex && !conf.enableGRPC {
+		return errors.New("gRPC multiplexing requires gRPC to be enabled")
+	}
+
+	itcf := initStructure{
+		envName:    tlsCertFile,
+		argVal:     *tcf,
+		defaultVal: cfJSON.TLSCertFile,
+		initFunc:   stringFunc(&conf.tlsCertFile, defaultTLSCertFile),
+	}
+	err = initAppParam(itcf)
+	if err != nil {
+		return err
+	}
+
+	itkf := initStructure{
+		envName:    tlsKeyFile,
+		argVal:     *tkf,
+		defaultVal: cfJSON.TLSKeyFile,
+		initFunc:   stringFunc(&conf.tlsKeyFile, defaultTLSKeyFile),
+	}
+	err = initAppParam(itkf)
+	if err != nil {
+		return err
+	}
+
+	iga := initStructure{
+		envName:    grpcAddress,
+		argVal:     *ga,
+		defaultVal: cfJSON.GRPCAddress,
+		initFunc: func(s string) error {
+			if len(s) == 0 {
+				s = defaultGRPCAddress
+			}
+			if _, _, sErr := net.SplitHostPort(s); sErr != nil {
+				return fmt.Errorf("grpc address split host %w", sErr)
+			}
+			conf.grpcAddress = s
+			return nil
+		},
+	}
+	err = initAppParam(iga)
+	if err != nil {
+		return err
+	}
+
+	igca := initStructure{
+		envName:    grpcClientCAFile,
+		argVal:     *gca,
+		defaultVal: cfJSON.GRPCClientCAFile,
+		initFunc:   stringFunc(&conf.grpcClientCAFile, ""),
+	}
+	err = initAppParam(igca)
+	if err != nil {
+		return err
+	}
+	if conf.grpcClientCAFile != "" && !conf.enableHTTPS {
+		return errors.New("gRPC client CA requires HTTPS to be enabled")
+	}
+
+	igmms := initStructure{
+		envName:    grpcMaxMsgSize,
+		argVal:     *gmms,
+		defaultVal: cfJSON.GRPCMaxMsgSize,
+		initFunc:   positiveIntFunc(&conf.grpcMaxMsgSize, defaultGRPCMaxMsgSize),
+	}
+	err = initAppParam(igmms)
+	if err != nil {
+		return err
+	}
+
+	igmcs := initStructure{
+		envName:    grpcMaxConcurrentStreams,
+		argVal:     *gmcs,
+		defaultVal: cfJSON.GRPCMaxConcurrentStreams,
+		initFunc:   positiveIntFunc(&conf.grpcMaxConcurrentStreams, defaultGRPCMaxConcurrentStreams),
+	}
+	err = initAppParam(igmcs)
+	if err != nil {
+		return err
+	}
+
+	igmc := initStructure{
+		envName:    grpcMaxConnections,
+		argVal:     *gmc,
+		defaultVal: cfJSON.GRPCMaxConnections,
+		initFunc:   nonNegativeIntFunc(&conf.grpcMaxConnections, 0),
+	}
+	err = initAppParam(igmc)
+	if err != nil {
+		return err
+	}
+
+	igkt := initStructure{
+		envName:    grpcKeepaliveTime,
+		argVal:     *gkt,
+		defaultVal: cfJSON.GRPCKeepaliveTime,
+		initFunc:   durationFunc(&conf.grpcKeepaliveTime, defaultGRPCKeepaliveTime),
+	}
+	err = initAppParam(igkt)
+	if err != nil {
+		return err
+	}
+
+	igkto := initStructure{
+		envName:    grpcKeepaliveTimeout,
+		argVal:     *gkto,
+		defaultVal: cfJSON.GRPCKeepaliveTimeout,
+		initFunc:   durationFunc(&conf.grpcKeepaliveTimeout, defaultGRPCKeepaliveTimeout),
+	}
+	err = initAppParam(igkto)
+	if err != nil {
+		return err
+	}
+
+	igkmt := initStructure{
+		envName:    grpcKeepaliveMinTime,
+		argVal:     *gkmt,
+		defaultVal: cfJSON.GRPCKeepaliveMinTime,
+		initFunc:   durationFunc(&conf.grpcKeepaliveMinTime, defaultGRPCKeepaliveMinTime),
+	}
+	err = initAppParam(igkmt)
+	if err != nil {
+		return err
+	}
+
+	igmci := initStructure{
+		envName:    grpcMaxConnectionIdle,
+		argVal:     *gmci,
+		defaultVal: cfJSON.GRPCMaxConnectionIdle,
+		initFunc:   durationFunc(&conf.grpcMaxConnectionIdle, 0),
+	}
+	err = initAppParam(igmci)
+	if err != nil {
+		return err
+	}
+	if err = checkGRPCMultiplex(); err != nil {
+		return err
+	}
+
+	irls := initStructure{
+		envName:    rateLimitStore,
+		argVal:     *rls,
+		defaultVal: cfJSON.RateLimitStore,
+		initFunc: func(s string) error {
+			switch s {
+			case "":
+				s = RateLimitStoreMemory
+			case RateLimitStoreMemory:
+			case RateLimitStoreStorage:
+				if conf.databaseDSN == "" && conf.sqlitePath == "" {
+					return errors.New("rate limit store requires database storage")
+				}
+			default:
+				return fmt.Errorf("unknown rate limit store %q", s)
+			}
+			conf.rateLimitStore = s
+			return nil
+		},
+	}
+	err = initAppParam(irls)
+	if err != nil {
+		return err
+	}
+
+	if _, err = generator.New(conf.idGenerator, conf.idAlphabet, conf.idLength); err != nil {
+		return fmt.Errorf("generator.New: %w", err)
+	}
+	if err = validator.SetIDAlphabet(conf.idAlphabet, conf.idLength); err != nil {
+		return fmt.Errorf("validator.SetIDAlphabet: %w", err)
+	}
+	validator.SetURLPolicy(validator.URLPolicy{
+		Schemes:      conf.urlAllowedSchemes,
+		AllowPrivate: conf.urlAllowPrivate,
+		MaxLength:    conf.urlMaxLength,
+	})
+
+	logger.Log.Info(fmt.Sprintf("Result configuration: %+v\n", conf.redacted()))
 	return nil
 }
 
@@ -183,6 +1159,172 @@ func initAppParam(is initStructure) error {
 	return err
 }
 
+// durationFunc parses non-negative duration into dst, empty value sets def.
+func durationFunc(dst *time.Duration, def time.Duration) func(s string) error {
+	return func(s string) error {
+		if len(s) == 0 {
+			*dst = def
+			return nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("time.ParseDuration: %w", err)
+		}
+		if d < 0 {
+			return fmt.Errorf("duration must not be negative, got %s", s)
+		}
+		*dst = d
+		return nil
+	}
+}
+
+// positiveIntFunc parses positive integer into dst, empty value sets def.
+func positiveIntFunc(dst *int, def int) func(s string) error {
+	return func(s string) error {
+		if len(s) == 0 {
+			*dst = def
+			return nil
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("strconv.Atoi: %w", err)
+		}
+		if v <= 0 {
+			return fmt.Errorf("value must be positive, got %s", s)
+		}
+		*dst = v
+		return nil
+	}
+}
+
+// checkGRPCMultiplex rejects settings of gRPC server that can't be applied when gRPC is served
+// by HTTP server: client certificates, connection limit and keepalive pings.
+// Max concurrent streams and max connection idle are applied to HTTP/2 server.
+func checkGRPCMultiplex() error {
+	if !conf.grpcMultiplex {
+		return nil
+	}
+	if conf.grpcClientCAFile != "" {
+		return errors.New("gRPC client CA is not supported with gRPC multiplexing")
+	}
+	if conf.grpcMaxConnections > 0 {
+		return errors.New("gRPC max connections is not supported with gRPC multiplexing")
+	}
+	if conf.grpcKeepaliveTime != defaultGRPCKeepaliveTime ||
+		conf.grpcKeepaliveTimeout != defaultGRPCKeepaliveTimeout ||
+		conf.grpcKeepaliveMinTime != defaultGRPCKeepaliveMinTime {
+		return errors.New("gRPC keepalive settings are not supported with gRPC multiplexing")
+	}
+	return nil
+}
+
+// nonNegativeIntFunc parses non-negative integer into dst, empty value sets def.
+func nonNegativeIntFunc(dst *int, def int) func(s string) error {
+	return func(s string) error {
+		if len(s) == 0 {
+			*dst = def
+			return nil
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("strconv.Atoi: %w", err)
+		}
+		if v < 0 {
+			return fmt.Errorf("value must not be negative, got %s", s)
+		}
+		*dst = v
+		return nil
+	}
+}
+
+// boolFunc parses boolean into dst, empty value sets def.
+func boolFunc(dst *bool, def bool) func(s string) error {
+	return func(s string) error {
+		if len(s) == 0 {
+			*dst = def
+			return nil
+		}
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("strconv.ParseBool: %w", err)
+		}
+		*dst = v
+		return nil
+	}
+}
+
+// stringFunc sets s into dst, empty value sets def.
+func stringFunc(dst *string, def string) func(s string) error {
+	return func(s string) error {
+		if len(s) == 0 {
+			s = def
+		}
+		*dst = s
+		return nil
+	}
+}
+
+// listFunc splits comma separated list into dst, empty items are skipped.
+func listFunc(dst *[]string) func(s string) error {
+	return func(s string) error {
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*dst = list
+		return nil
+	}
+}
+
+// schemesFunc parses comma separated list of URL schemes into dst, empty value sets http and https.
+func schemesFunc(dst *[]string) func(s string) error {
+	return func(s string) error {
+		if err := listFunc(dst)(strings.ToLower(s)); err != nil {
+			return err
+		}
+		if len(*dst) == 0 {
+			*dst = validator.DefaultURLPolicy().Schemes
+		}
+		return nil
+	}
+}
+
+// limitFunc parses rate limit into dst, empty value sets def.
+func limitFunc(dst *ratelimit.Limit, def string) func(s string) error {
+	return func(s string) error {
+		if len(s) == 0 {
+			s = def
+		}
+		l, err := ratelimit.ParseLimit(s)
+		if err != nil {
+			return fmt.Errorf("ratelimit.ParseLimit: %w", err)
+		}
+		*dst = l
+		return nil
+	}
+}
+
+// sameSiteFunc parses SameSite mode into dst, empty value sets def.
+func sameSiteFunc(dst *http.SameSite, def http.SameSite) func(s string) error {
+	return func(s string) error {
+		switch strings.ToLower(s) {
+		case "":
+			*dst = def
+		case "lax":
+			*dst = http.SameSiteLaxMode
+		case "strict":
+			*dst = http.SameSiteStrictMode
+		case "none":
+			*dst = http.SameSiteNoneMode
+		default:
+			return fmt.Errorf("unknown SameSite mode %q", s)
+		}
+		return nil
+	}
+}
+
 func serverAddrFunc() func(s string) error {
 	return func(hp string) error {
 		if hp == "" {
@@ -200,8 +1342,8 @@ func serverAddrFunc() func(s string) error {
 
 func baseURLFunc() func(s string) error {
 	return func(u string) error {
-		if !validator.URL(u) {
-			return errors.New("baseURLFunc validating URL")
+		if _, err := validator.DefaultURLPolicy().Check(u); err != nil {
+			return fmt.Errorf("baseURLFunc validating URL %w", err)
 		}
 		parsed, err := url.Parse(u)
 		if err != nil {
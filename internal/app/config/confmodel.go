@@ -2,20 +2,78 @@ package config
 
 import (
 	"net"
+	"net/http"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/util/ratelimit"
 )
 
 // Conf model that represents a configuration from ENV or command line.
 type Conf struct {
-	scheme            string
-	host              string
-	port              string
-	baseURL           string
-	basePath          string
-	fsPath            string
-	databaseDSN       string
-	enableHTTPS       bool
-	trustedSubnet     string
-	TrustedSubnetCIDR *net.IPNet
+	scheme                   string
+	host                     string
+	port                     string
+	baseURL                  string
+	basePath                 string
+	fsPath                   string
+	databaseDSN              string
+	sqlitePath               string
+	enableHTTPS              bool
+	trustedSubnet            string
+	TrustedSubnetCIDR        *net.IPNet
+	aliasPattern             string
+	reaperInterval           time.Duration
+	idGenerator              string
+	idAlphabet               string
+	idLength                 int
+	fileCompactThreshold     int64
+	cacheSize                int
+	cacheTTL                 time.Duration
+	cacheNegativeTTL         time.Duration
+	clickBatchSize           int
+	clickFlushInterval       time.Duration
+	deleteWorkers            int
+	deleteMaxAttempts        int
+	deleteRetryBackoff       time.Duration
+	jwtSecret                string
+	jwtKeysFile              string
+	accessTokenTTL           time.Duration
+	refreshTokenTTL          time.Duration
+	cookieSecure             bool
+	cookieSameSite           http.SameSite
+	cookieDomain             string
+	cookiePath               string
+	rateLimitCreate          ratelimit.Limit
+	rateLimitRedirect        ratelimit.Limit
+	rateLimitList            ratelimit.Limit
+	rateLimitAuth            ratelimit.Limit
+	rateLimitIPFactor        int
+	rateLimitStore           string
+	quotaMaxActive           int
+	quotaMaxPerDay           int
+	quotaMaxBatch            int
+	hostAllowlistFile        string
+	hostBlocklistFile        string
+	hostListsCheckInterval   time.Duration
+	canonicalStripParams     []string
+	canonicalSortQuery       bool
+	urlAllowedSchemes        []string
+	urlAllowPrivate          bool
+	urlMaxLength             int
+	enableHTTP               bool
+	enableGRPC               bool
+	grpcMultiplex            bool
+	tlsCertFile              string
+	tlsKeyFile               string
+	grpcAddress              string
+	grpcClientCAFile         string
+	grpcMaxMsgSize           int
+	grpcMaxConcurrentStreams int
+	grpcMaxConnections       int
+	grpcKeepaliveTime        time.Duration
+	grpcKeepaliveTimeout     time.Duration
+	grpcKeepaliveMinTime     time.Duration
+	grpcMaxConnectionIdle    time.Duration
 }
 
 // Scheme getter for field scheme.
@@ -53,6 +111,12 @@ func (s Conf) DatabaseDSN() string {
 	return s.databaseDSN
 }
 
+// SQLitePath getter for field sqlitePath.
+// It is set instead of databaseDSN when DSN has [SQLiteScheme].
+func (s Conf) SQLitePath() string {
+	return s.sqlitePath
+}
+
 // EnableHTTPS getter for field enableHTTPS.
 func (s Conf) EnableHTTPS() bool {
 	return s.enableHTTPS
@@ -63,11 +127,340 @@ func (s Conf) TrustedSubnet() string {
 	return s.trustedSubnet
 }
 
+// AliasPattern getter for field aliasPattern.
+func (s Conf) AliasPattern() string {
+	return s.aliasPattern
+}
+
+// ReaperInterval getter for field reaperInterval.
+func (s Conf) ReaperInterval() time.Duration {
+	return s.reaperInterval
+}
+
+// IDGenerator getter for field idGenerator.
+func (s Conf) IDGenerator() string {
+	return s.idGenerator
+}
+
+// IDAlphabet getter for field idAlphabet.
+func (s Conf) IDAlphabet() string {
+	return s.idAlphabet
+}
+
+// IDLength getter for field idLength.
+func (s Conf) IDLength() int {
+	return s.idLength
+}
+
+// FileCompactThreshold getter for field fileCompactThreshold.
+func (s Conf) FileCompactThreshold() int64 {
+	return s.fileCompactThreshold
+}
+
+// CacheSize getter for field cacheSize.
+func (s Conf) CacheSize() int {
+	return s.cacheSize
+}
+
+// CacheTTL getter for field cacheTTL.
+func (s Conf) CacheTTL() time.Duration {
+	return s.cacheTTL
+}
+
+// CacheNegativeTTL getter for field cacheNegativeTTL.
+func (s Conf) CacheNegativeTTL() time.Duration {
+	return s.cacheNegativeTTL
+}
+
+// ClickBatchSize getter for field clickBatchSize.
+func (s Conf) ClickBatchSize() int {
+	return s.clickBatchSize
+}
+
+// ClickFlushInterval getter for field clickFlushInterval.
+func (s Conf) ClickFlushInterval() time.Duration {
+	return s.clickFlushInterval
+}
+
+// DeleteWorkers getter for field deleteWorkers.
+func (s Conf) DeleteWorkers() int {
+	return s.deleteWorkers
+}
+
+// DeleteMaxAttempts getter for field deleteMaxAttempts.
+func (s Conf) DeleteMaxAttempts() int {
+	return s.deleteMaxAttempts
+}
+
+// DeleteRetryBackoff getter for field deleteRetryBackoff.
+func (s Conf) DeleteRetryBackoff() time.Duration {
+	return s.deleteRetryBackoff
+}
+
+// JWTSecret getter for field jwtSecret.
+func (s Conf) JWTSecret() string {
+	return s.jwtSecret
+}
+
+// JWTKeysFile getter for field jwtKeysFile.
+func (s Conf) JWTKeysFile() string {
+	return s.jwtKeysFile
+}
+
+// AccessTokenTTL getter for field accessTokenTTL.
+func (s Conf) AccessTokenTTL() time.Duration {
+	return s.accessTokenTTL
+}
+
+// RefreshTokenTTL getter for field refreshTokenTTL.
+func (s Conf) RefreshTokenTTL() time.Duration {
+	return s.refreshTokenTTL
+}
+
+// CookieSecure getter for field cookieSecure.
+func (s Conf) CookieSecure() bool {
+	return s.cookieSecure
+}
+
+// CookieSameSite getter for field cookieSameSite.
+func (s Conf) CookieSameSite() http.SameSite {
+	return s.cookieSameSite
+}
+
+// CookieDomain getter for field cookieDomain, empty value means host of request.
+func (s Conf) CookieDomain() string {
+	return s.cookieDomain
+}
+
+// CookiePath getter for field cookiePath.
+func (s Conf) CookiePath() string {
+	return s.cookiePath
+}
+
+// RateLimitCreate getter for field rateLimitCreate.
+func (s Conf) RateLimitCreate() ratelimit.Limit {
+	return s.rateLimitCreate
+}
+
+// RateLimitRedirect getter for field rateLimitRedirect.
+func (s Conf) RateLimitRedirect() ratelimit.Limit {
+	return s.rateLimitRedirect
+}
+
+// RateLimitList getter for field rateLimitList.
+func (s Conf) RateLimitList() ratelimit.Limit {
+	return s.rateLimitList
+}
+
+// RateLimitAuth getter for field rateLimitAuth, it's limit per client IP.
+func (s Conf) RateLimitAuth() ratelimit.Limit {
+	return s.rateLimitAuth
+}
+
+// RateLimitIPFactor getter for field rateLimitIPFactor, 0 means that client IP is not limited.
+func (s Conf) RateLimitIPFactor() int {
+	return s.rateLimitIPFactor
+}
+
+// RateLimitStore getter for field rateLimitStore.
+func (s Conf) RateLimitStore() string {
+	return s.rateLimitStore
+}
+
+// QuotaMaxActive getter for field quotaMaxActive, 0 means no limit.
+func (s Conf) QuotaMaxActive() int {
+	return s.quotaMaxActive
+}
+
+// QuotaMaxPerDay getter for field quotaMaxPerDay, 0 means no limit.
+func (s Conf) QuotaMaxPerDay() int {
+	return s.quotaMaxPerDay
+}
+
+// QuotaMaxBatch getter for field quotaMaxBatch, 0 means no limit.
+func (s Conf) QuotaMaxBatch() int {
+	return s.quotaMaxBatch
+}
+
+// HostAllowlistFile getter for field hostAllowlistFile.
+func (s Conf) HostAllowlistFile() string {
+	return s.hostAllowlistFile
+}
+
+// HostBlocklistFile getter for field hostBlocklistFile.
+func (s Conf) HostBlocklistFile() string {
+	return s.hostBlocklistFile
+}
+
+// HostListsCheckInterval getter for field hostListsCheckInterval, 0 means that files are not watched.
+func (s Conf) HostListsCheckInterval() time.Duration {
+	return s.hostListsCheckInterval
+}
+
+// CanonicalStripParams getter for field canonicalStripParams.
+func (s Conf) CanonicalStripParams() []string {
+	return s.canonicalStripParams
+}
+
+// CanonicalSortQuery getter for field canonicalSortQuery.
+func (s Conf) CanonicalSortQuery() bool {
+	return s.canonicalSortQuery
+}
+
+// URLAllowedSchemes getter for field urlAllowedSchemes.
+func (s Conf) URLAllowedSchemes() []string {
+	return s.urlAllowedSchemes
+}
+
+// URLAllowPrivate getter for field urlAllowPrivate.
+func (s Conf) URLAllowPrivate() bool {
+	return s.urlAllowPrivate
+}
+
+// URLMaxLength getter for field urlMaxLength, 0 means no limit.
+func (s Conf) URLMaxLength() int {
+	return s.urlMaxLength
+}
+
+// redacted returns copy of configuration without secrets to log it.
+func (s Conf) redacted() Conf {
+	if s.jwtSecret != "" {
+		s.jwtSecret = "***"
+	}
+	return s
+}
+
+// EnableHTTP getter for field enableHTTP.
+func (s Conf) EnableHTTP() bool {
+	return s.enableHTTP
+}
+
+// EnableGRPC getter for field enableGRPC.
+func (s Conf) EnableGRPC() bool {
+	return s.enableGRPC
+}
+
+// GRPCMultiplex getter for field grpcMultiplex.
+// If true gRPC is served on HTTP server address, client CA, connection limit
+// and keepalive settings of gRPC server are not allowed then.
+func (s Conf) GRPCMultiplex() bool {
+	return s.grpcMultiplex
+}
+
+// TLSCertFile getter for field tlsCertFile.
+func (s Conf) TLSCertFile() string {
+	return s.tlsCertFile
+}
+
+// TLSKeyFile getter for field tlsKeyFile.
+func (s Conf) TLSKeyFile() string {
+	return s.tlsKeyFile
+}
+
+// GRPCAddress getter for field grpcAddress.
+func (s Conf) GRPCAddress() string {
+	return s.grpcAddress
+}
+
+// GRPCClientCAFile getter for field grpcClientCAFile.
+// Non-empty value means that gRPC clients must present certificate signed by this CA.
+func (s Conf) GRPCClientCAFile() string {
+	return s.grpcClientCAFile
+}
+
+// GRPCMaxMsgSize getter for field grpcMaxMsgSize.
+func (s Conf) GRPCMaxMsgSize() int {
+	return s.grpcMaxMsgSize
+}
+
+// GRPCMaxConcurrentStreams getter for field grpcMaxConcurrentStreams.
+func (s Conf) GRPCMaxConcurrentStreams() int {
+	return s.grpcMaxConcurrentStreams
+}
+
+// GRPCMaxConnections getter for field grpcMaxConnections, 0 means unlimited.
+func (s Conf) GRPCMaxConnections() int {
+	return s.grpcMaxConnections
+}
+
+// GRPCKeepaliveTime getter for field grpcKeepaliveTime.
+func (s Conf) GRPCKeepaliveTime() time.Duration {
+	return s.grpcKeepaliveTime
+}
+
+// GRPCKeepaliveTimeout getter for field grpcKeepaliveTimeout.
+func (s Conf) GRPCKeepaliveTimeout() time.Duration {
+	return s.grpcKeepaliveTimeout
+}
+
+// GRPCKeepaliveMinTime getter for field grpcKeepaliveMinTime.
+func (s Conf) GRPCKeepaliveMinTime() time.Duration {
+	return s.grpcKeepaliveMinTime
+}
+
+// GRPCMaxConnectionIdle getter for field grpcMaxConnectionIdle, 0 means infinity.
+func (s Conf) GRPCMaxConnectionIdle() time.Duration {
+	return s.grpcMaxConnectionIdle
+}
+
 type confJSON struct {
-	ServerAddress string `json:"server_address"`
-	BaseURL       string `json:"base_url"`
-	FsPath        string `json:"file_storage_pat"`
-	DatabaseDSN   string `json:"database_dsn"`
-	EnableHTTPS   string `json:"enable_https"`
-	TrustedSubnet string `json:"trusted_subnet"`
+	ServerAddress            string `json:"server_address"`
+	BaseURL                  string `json:"base_url"`
+	FsPath                   string `json:"file_storage_pat"`
+	DatabaseDSN              string `json:"database_dsn"`
+	EnableHTTPS              string `json:"enable_https"`
+	TrustedSubnet            string `json:"trusted_subnet"`
+	AliasPattern             string `json:"alias_pattern"`
+	ReaperInterval           string `json:"reaper_interval"`
+	IDGenerator              string `json:"id_generator"`
+	IDAlphabet               string `json:"id_alphabet"`
+	IDLength                 string `json:"id_length"`
+	FileCompactThreshold     string `json:"file_compact_threshold"`
+	CacheSize                string `json:"cache_size"`
+	CacheTTL                 string `json:"cache_ttl"`
+	CacheNegativeTTL         string `json:"cache_negative_ttl"`
+	ClickBatchSize           string `json:"click_batch_size"`
+	ClickFlushInterval       string `json:"click_flush_interval"`
+	DeleteWorkers            string `json:"delete_workers"`
+	DeleteMaxAttempts        string `json:"delete_max_attempts"`
+	DeleteRetryBackoff       string `json:"delete_retry_backoff"`
+	JWTSecret                string `json:"jwt_secret"`
+	JWTKeysFile              string `json:"jwt_keys_file"`
+	AccessTokenTTL           string `json:"access_token_ttl"`
+	RefreshTokenTTL          string `json:"refresh_token_ttl"`
+	CookieSecure             string `json:"cookie_secure"`
+	CookieSameSite           string `json:"cookie_samesite"`
+	CookieDomain             string `json:"cookie_domain"`
+	CookiePath               string `json:"cookie_path"`
+	RateLimitCreate          string `json:"rate_limit_create"`
+	RateLimitRedirect        string `json:"rate_limit_redirect"`
+	RateLimitList            string `json:"rate_limit_list"`
+	RateLimitAuth            string `json:"rate_limit_auth"`
+	RateLimitIPFactor        string `json:"rate_limit_ip_factor"`
+	RateLimitStore           string `json:"rate_limit_store"`
+	QuotaMaxActive           string `json:"quota_max_active"`
+	QuotaMaxPerDay           string `json:"quota_max_per_day"`
+	QuotaMaxBatch            string `json:"quota_max_batch"`
+	HostAllowlistFile        string `json:"host_allowlist_file"`
+	HostBlocklistFile        string `json:"host_blocklist_file"`
+	HostListsCheckInterval   string `json:"host_lists_check_interval"`
+	CanonicalStripParams     string `json:"canonical_strip_params"`
+	CanonicalSortQuery       string `json:"canonical_sort_query"`
+	URLAllowedSchemes        string `json:"url_allowed_schemes"`
+	URLAllowPrivate          string `json:"url_allow_private"`
+	URLMaxLength             string `json:"url_max_length"`
+	EnableHTTP               string `json:"enable_http"`
+	EnableGRPC               string `json:"enable_grpc"`
+	GRPCMultiplex            string `json:"grpc_multiplex"`
+	TLSCertFile              string `json:"tls_cert_file"`
+	TLSKeyFile               string `json:"tls_key_file"`
+	GRPCAddress              string `json:"grpc_address"`
+	GRPCClientCAFile         string `json:"grpc_client_ca_file"`
+	GRPCMaxMsgSize           string `json:"grpc_max_msg_size"`
+	GRPCMaxConcurrentStreams string `json:"grpc_max_concurrent_streams"`
+	GRPCMaxConnections       string `json:"grpc_max_connections"`
+	GRPCKeepaliveTime        string `json:"grpc_keepalive_time"`
+	GRPCKeepaliveTimeout     string `json:"grpc_keepalive_timeout"`
+	GRPCKeepaliveMinTime     string `json:"grpc_keepalive_min_time"`
+	GRPCMaxConnectionIdle    string `json:"grpc_max_connection_idle"`
 }
@@ -0,0 +1,143 @@
+// Package metrics holds Prometheus collectors of the service.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const namespace = "shortener"
+
+// statsTimeout limits time of business gauges calculation on scrape.
+const statsTimeout = 3 * time.Second
+
+// Registry registry of all service metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Amount of HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	grpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_requests_total",
+		Help:      "Amount of gRPC requests by method and code.",
+	}, []string{"method", "code"})
+
+	grpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "Latency of gRPC requests by method and code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	storageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Latency of storage operations by operation and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "result"})
+
+	urlsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "urls"),
+		"Amount of saved URLs.", nil, nil)
+
+	usersDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "users"),
+		"Amount of users that saved URLs.", nil, nil)
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		grpcRequests,
+		grpcDuration,
+		storageDuration,
+	)
+}
+
+// Handler returns HTTP handler that exposes metrics in Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTP records HTTP request.
+func ObserveHTTP(route string, method string, status int, d time.Duration) {
+	s := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, s).Inc()
+	httpDuration.WithLabelValues(route, method, s).Observe(d.Seconds())
+}
+
+// ObserveGRPC records gRPC request.
+func ObserveGRPC(method string, code string, d time.Duration) {
+	grpcRequests.WithLabelValues(method, code).Inc()
+	grpcDuration.WithLabelValues(method, code).Observe(d.Seconds())
+}
+
+// ObserveStorage records storage operation.
+func ObserveStorage(operation string, d time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	storageDuration.WithLabelValues(operation, result).Observe(d.Seconds())
+}
+
+// RegisterQueueDepth registers gauge with current length of the named queue.
+func RegisterQueueDepth(name string, length func() int) error {
+	return Registry.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "queue_depth",
+		Help:        "Amount of items waiting in the queue.",
+		ConstLabels: prometheus.Labels{"queue": name},
+	}, func() float64 {
+		return float64(length())
+	}))
+}
+
+// RegisterStats registers business gauges that are calculated by find on every scrape.
+func RegisterStats(find func(ctx context.Context) (model.Stat, error)) error {
+	return Registry.Register(statsCollector(find))
+}
+
+type statsCollector func(ctx context.Context) (model.Stat, error)
+
+// Describe implements [prometheus.Collector].
+func (sc statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- urlsDesc
+	ch <- usersDesc
+}
+
+// Collect implements [prometheus.Collector].
+func (sc statsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+	stat, err := sc(ctx)
+	if err != nil {
+		logger.Log.Error("collect stats", zap.Error(err))
+		ch <- prometheus.NewInvalidMetric(urlsDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(urlsDesc, prometheus.GaugeValue, float64(stat.URLs))
+	ch <- prometheus.MustNewConstMetric(usersDesc, prometheus.GaugeValue, float64(stat.Users))
+}
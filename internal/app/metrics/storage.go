@@ -0,0 +1,305 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+)
+
+// InstrumentedStorage decorator that measures latency of storage operations.
+type InstrumentedStorage struct {
+	st storage.Storage
+}
+
+var _ storage.Storage = (*InstrumentedStorage)(nil)
+
+var _ storage.Compactor = (*InstrumentedStorage)(nil)
+
+var _ storage.HealthChecker = (*InstrumentedStorage)(nil)
+
+var _ storage.RateLimitStore = (*InstrumentedStorage)(nil)
+
+// NewInstrumentedStorage creates new [*InstrumentedStorage].
+func NewInstrumentedStorage(st storage.Storage) *InstrumentedStorage {
+	return &InstrumentedStorage{
+		st: st,
+	}
+}
+
+// SaveURL saves original URL and returns short URL.
+func (is *InstrumentedStorage) SaveURL(ctx context.Context, userID string, url string, canonical string,
+	expiresAt time.Time) (string, error) {
+	start := time.Now()
+	res, err := is.st.SaveURL(ctx, userID, url, canonical, expiresAt)
+	ObserveStorage("SaveURL", time.Since(start), err)
+	return res, err
+}
+
+// SaveURLWithID saves original URL under provided short ID.
+func (is *InstrumentedStorage) SaveURLWithID(ctx context.Context, userID string,
+	id string, url string, canonical string, expiresAt time.Time, createdAt time.Time) (string, error) {
+	start := time.Now()
+	res, err := is.st.SaveURLWithID(ctx, userID, id, url, canonical, expiresAt, createdAt)
+	ObserveStorage("SaveURLWithID", time.Since(start), err)
+	return res, err
+}
+
+// SaveURLBatch saves many URLs and return [[]model.BatchRespEntry] back.
+func (is *InstrumentedStorage) SaveURLBatch(ctx context.Context, userID string,
+	batch []model.BatchReqEntry) ([]model.BatchRespEntry, error) {
+	start := time.Now()
+	res, err := is.st.SaveURLBatch(ctx, userID, batch)
+	ObserveStorage("SaveURLBatch", time.Since(start), err)
+	return res, err
+}
+
+// FindURL finds original URL by short ID.
+// Not found, deleted and expired results are not counted as errors.
+func (is *InstrumentedStorage) FindURL(ctx context.Context, id string) (*storage.OrigURL, error) {
+	start := time.Now()
+	res, err := is.st.FindURL(ctx, id)
+	ObserveStorage("FindURL", time.Since(start), unexpected(err))
+	return res, err
+}
+
+// FindUserURLs finds user's URLs.
+func (is *InstrumentedStorage) FindUserURLs(ctx context.Context, userID string) ([]model.URLPair, error) {
+	start := time.Now()
+	res, err := is.st.FindUserURLs(ctx, userID)
+	ObserveStorage("FindUserURLs", time.Since(start), err)
+	return res, err
+}
+
+// DeleteUserURLs deletes user's URLs.
+func (is *InstrumentedStorage) DeleteUserURLs(ctx context.Context,
+	bde model.BatchDeleteEntry) ([]model.DeleteResult, error) {
+	start := time.Now()
+	res, err := is.st.DeleteUserURLs(ctx, bde)
+	ObserveStorage("DeleteUserURLs", time.Since(start), err)
+	return res, err
+}
+
+// DeleteExpiredURLs deletes expired URLs.
+func (is *InstrumentedStorage) DeleteExpiredURLs(ctx context.Context, now time.Time) (int64, error) {
+	start := time.Now()
+	res, err := is.st.DeleteExpiredURLs(ctx, now)
+	ObserveStorage("DeleteExpiredURLs", time.Since(start), err)
+	return res, err
+}
+
+// CountUserURLs counts user's URLs.
+func (is *InstrumentedStorage) CountUserURLs(ctx context.Context, userID string,
+	now time.Time, since time.Time) (model.URLCount, error) {
+	start := time.Now()
+	res, err := is.st.CountUserURLs(ctx, userID, now, since)
+	ObserveStorage("CountUserURLs", time.Since(start), err)
+	return res, err
+}
+
+// FindStats finds statistic by saved requests.
+func (is *InstrumentedStorage) FindStats(ctx context.Context) (model.Stat, error) {
+	start := time.Now()
+	res, err := is.st.FindStats(ctx)
+	ObserveStorage("FindStats", time.Since(start), err)
+	return res, err
+}
+
+// FindUserURLsPage returns page of user's URLs ordered by short ID.
+func (is *InstrumentedStorage) FindUserURLsPage(ctx context.Context, userID string,
+	after string, limit int) ([]model.URLPair, error) {
+	start := time.Now()
+	res, err := is.st.FindUserURLsPage(ctx, userID, after, limit)
+	ObserveStorage("FindUserURLsPage", time.Since(start), err)
+	return res, err
+}
+
+// ExportURLs returns page of records ordered by short ID.
+func (is *InstrumentedStorage) ExportURLs(ctx context.Context, after string,
+	limit int) ([]storage.ExportRecord, error) {
+	start := time.Now()
+	res, err := is.st.ExportURLs(ctx, after, limit)
+	ObserveStorage("ExportURLs", time.Since(start), err)
+	return res, err
+}
+
+// ImportURL saves exported record under its short ID.
+func (is *InstrumentedStorage) ImportURL(ctx context.Context, rec storage.ExportRecord) (string, error) {
+	start := time.Now()
+	res, err := is.st.ImportURL(ctx, rec)
+	ObserveStorage("ImportURL", time.Since(start), err)
+	return res, err
+}
+
+// SaveClicks saves clicks.
+func (is *InstrumentedStorage) SaveClicks(ctx context.Context, clicks []model.Click) error {
+	start := time.Now()
+	err := is.st.SaveClicks(ctx, clicks)
+	ObserveStorage("SaveClicks", time.Since(start), err)
+	return err
+}
+
+// FindClickStats returns click statistic of user's short URL.
+func (is *InstrumentedStorage) FindClickStats(ctx context.Context, userID string,
+	id string, top int) (model.ClickStats, error) {
+	start := time.Now()
+	res, err := is.st.FindClickStats(ctx, userID, id, top)
+	ObserveStorage("FindClickStats", time.Since(start), unexpected(err))
+	return res, err
+}
+
+// SaveDeleteJob saves delete job.
+func (is *InstrumentedStorage) SaveDeleteJob(ctx context.Context, job model.DeleteJob) error {
+	start := time.Now()
+	err := is.st.SaveDeleteJob(ctx, job)
+	ObserveStorage("SaveDeleteJob", time.Since(start), err)
+	return err
+}
+
+// FindDeleteJob returns user's delete job.
+func (is *InstrumentedStorage) FindDeleteJob(ctx context.Context, userID string,
+	id string) (model.DeleteJob, error) {
+	start := time.Now()
+	res, err := is.st.FindDeleteJob(ctx, userID, id)
+	ObserveStorage("FindDeleteJob", time.Since(start), unexpected(err))
+	return res, err
+}
+
+// FindPendingDeleteJobs returns jobs that are not finished yet.
+func (is *InstrumentedStorage) FindPendingDeleteJobs(ctx context.Context) ([]model.DeleteJob, error) {
+	start := time.Now()
+	res, err := is.st.FindPendingDeleteJobs(ctx)
+	ObserveStorage("FindPendingDeleteJobs", time.Since(start), err)
+	return res, err
+}
+
+// SaveAPIKey saves API key.
+func (is *InstrumentedStorage) SaveAPIKey(ctx context.Context, key model.APIKey) error {
+	start := time.Now()
+	err := is.st.SaveAPIKey(ctx, key)
+	ObserveStorage("SaveAPIKey", time.Since(start), err)
+	return err
+}
+
+// FindAPIKeyByHash returns API key by hash of the key.
+func (is *InstrumentedStorage) FindAPIKeyByHash(ctx context.Context, hash string) (model.APIKey, error) {
+	start := time.Now()
+	res, err := is.st.FindAPIKeyByHash(ctx, hash)
+	ObserveStorage("FindAPIKeyByHash", time.Since(start), unexpected(err))
+	return res, err
+}
+
+// FindUserAPIKeys returns user's API keys.
+func (is *InstrumentedStorage) FindUserAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error) {
+	start := time.Now()
+	res, err := is.st.FindUserAPIKeys(ctx, userID)
+	ObserveStorage("FindUserAPIKeys", time.Since(start), err)
+	return res, err
+}
+
+// DeleteAPIKey revokes user's API key.
+func (is *InstrumentedStorage) DeleteAPIKey(ctx context.Context, userID string, id string) error {
+	start := time.Now()
+	err := is.st.DeleteAPIKey(ctx, userID, id)
+	ObserveStorage("DeleteAPIKey", time.Since(start), unexpected(err))
+	return err
+}
+
+// SaveUser saves registered user.
+func (is *InstrumentedStorage) SaveUser(ctx context.Context, user model.User) error {
+	start := time.Now()
+	err := is.st.SaveUser(ctx, user)
+	ObserveStorage("SaveUser", time.Since(start), unexpected(err))
+	return err
+}
+
+// FindUserByEmail returns registered user by email.
+func (is *InstrumentedStorage) FindUserByEmail(ctx context.Context, email string) (model.User, error) {
+	start := time.Now()
+	res, err := is.st.FindUserByEmail(ctx, email)
+	ObserveStorage("FindUserByEmail", time.Since(start), unexpected(err))
+	return res, err
+}
+
+// ReassignUser moves URLs, API keys and delete jobs of user from to user to.
+func (is *InstrumentedStorage) ReassignUser(ctx context.Context, from string,
+	to string) (model.Reassigned, error) {
+	start := time.Now()
+	res, err := is.st.ReassignUser(ctx, from, to)
+	ObserveStorage("ReassignUser", time.Since(start), err)
+	return res, err
+}
+
+// RevokeToken adds JWT ID to the denylist.
+func (is *InstrumentedStorage) RevokeToken(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	start := time.Now()
+	res, err := is.st.RevokeToken(ctx, id, expiresAt)
+	ObserveStorage("RevokeToken", time.Since(start), err)
+	return res, err
+}
+
+// IsTokenRevoked checks whether JWT ID is in the denylist.
+func (is *InstrumentedStorage) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	start := time.Now()
+	res, err := is.st.IsTokenRevoked(ctx, id)
+	ObserveStorage("IsTokenRevoked", time.Since(start), err)
+	return res, err
+}
+
+// DeleteExpiredRevokedTokens removes expired tokens from the denylist.
+func (is *InstrumentedStorage) DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	start := time.Now()
+	res, err := is.st.DeleteExpiredRevokedTokens(ctx, now)
+	ObserveStorage("DeleteExpiredRevokedTokens", time.Since(start), err)
+	return res, err
+}
+
+// TakeRateLimit advances rate limit bucket if underlying storage keeps them.
+func (is *InstrumentedStorage) TakeRateLimit(ctx context.Context, key string, now time.Time,
+	interval time.Duration, tolerance time.Duration) (time.Time, bool, error) {
+	start := time.Now()
+	tat, allowed, err := storage.TakeRateLimit(ctx, is.st, key, now, interval, tolerance)
+	ObserveStorage("TakeRateLimit", time.Since(start), unexpected(err))
+	return tat, allowed, err
+}
+
+// DeleteExpiredRateLimits removes full rate limit buckets if underlying storage keeps them.
+func (is *InstrumentedStorage) DeleteExpiredRateLimits(ctx context.Context, now time.Time) (int64, error) {
+	start := time.Now()
+	res, err := storage.DeleteExpiredRateLimits(ctx, is.st, now)
+	ObserveStorage("DeleteExpiredRateLimits", time.Since(start), unexpected(err))
+	return res, err
+}
+
+// Compact compacts underlying storage if it supports compaction.
+func (is *InstrumentedStorage) Compact(ctx context.Context) error {
+	start := time.Now()
+	err := storage.Compact(ctx, is.st)
+	ObserveStorage("Compact", time.Since(start), err)
+	return err
+}
+
+// CheckHealth checks health of underlying storage.
+func (is *InstrumentedStorage) CheckHealth(ctx context.Context) []model.HealthCheck {
+	return storage.CheckHealth(ctx, is.st)
+}
+
+// Ping pings underlying storage.
+func (is *InstrumentedStorage) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := is.st.Ping(ctx)
+	ObserveStorage("Ping", time.Since(start), err)
+	return err
+}
+
+// unexpected filters out errors that are part of normal flow.
+func unexpected(err error) error {
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrResultIsDeleted) ||
+		errors.Is(err, storage.ErrResultIsExpired) || errors.Is(err, storage.ErrEmailTaken) ||
+		errors.Is(err, storage.ErrRateLimitNotSupported) {
+		return nil
+	}
+	return err
+}
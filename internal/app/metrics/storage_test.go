@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentedStorage_FindURL(t *testing.T) {
+	ctx := context.Background()
+	orig := storage.NewOrigURL("http://localhost:30000/", "user", false)
+	errDB := errors.New("connection refused")
+
+	tests := []struct {
+		name   string
+		id     string
+		result *storage.OrigURL
+		err    error
+		label  string
+	}{
+		{
+			name:   "found is ok #1",
+			id:     "AAAAAAAA",
+			result: &orig,
+			label:  "ok",
+		},
+		{
+			name:  "not found is ok #2",
+			id:    "BBBBBBBB",
+			err:   storage.ErrNotFound,
+			label: "ok",
+		},
+		{
+			name:  "deleted is ok #3",
+			id:    "CCCCCCCC",
+			err:   storage.ErrResultIsDeleted,
+			label: "ok",
+		},
+		{
+			name:  "storage error is error #4",
+			id:    "DDDDDDDD",
+			err:   errDB,
+			label: "error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := new(storage.MockedStorage)
+			st.On("FindURL", mock.Anything, tt.id).Return(tt.result, tt.err)
+			is := NewInstrumentedStorage(st)
+
+			before := sampleCount(t, "FindURL", tt.label)
+			res, err := is.FindURL(ctx, tt.id)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.result, res)
+			assert.Equal(t, before+1, sampleCount(t, "FindURL", tt.label))
+		})
+	}
+}
+
+func sampleCount(t *testing.T, operation string, result string) uint64 {
+	t.Helper()
+	o, err := storageDuration.GetMetricWithLabelValues(operation, result)
+	require.NoError(t, err)
+	var m dto.Metric
+	require.NoError(t, o.(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+// Scopes of API key. Key without scopes is allowed to do everything except managing keys.
+const (
+	ScopeRead   = "read"
+	ScopeCreate = "create"
+	ScopeDelete = "delete"
+)
+
+// ValidScope reports whether scope is known.
+func ValidScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeCreate || scope == ScopeDelete
+}
+
+// APIKey model represents long-lived key of programmatic client.
+// Only hash of the key is stored, the key itself is shown once on creation.
+type APIKey struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	Hash      string    `json:"-"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewAPIKey creates new [APIKey].
+func NewAPIKey(id string, userID string, name string, prefix string, hash string,
+	scopes []string, now time.Time) APIKey {
+	return APIKey{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      hash,
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+}
+
+// HasScope reports whether key is allowed to act in scope.
+func (k APIKey) HasScope(scope string) bool {
+	if len(k.Scopes) == 0 {
+		return true
+	}
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -2,21 +2,28 @@ package model
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/denis-oreshkevich/shortener/internal/app/config"
 )
 
 // BatchReqEntry model that represents single entry of batch request.
+// ExpiresAt and TTL (in seconds) are optional, TTL is used if both are present.
+// CanonicalURL is set by shortener before entry is saved.
 type BatchReqEntry struct {
-	CorrelationID string `json:"correlation_id"`
-	OriginalURL   string `json:"original_url"`
+	CorrelationID string     `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	CanonicalURL  string     `json:"-"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	TTL           int64      `json:"ttl,omitempty"`
 }
 
-// NewBatchReqEntry creates new [BatchReqEntry].
+// NewBatchReqEntry creates new [BatchReqEntry], original URL is its own canonical form.
 func NewBatchReqEntry(corID string, originalURL string) BatchReqEntry {
 	return BatchReqEntry{
 		CorrelationID: corID,
 		OriginalURL:   originalURL,
+		CanonicalURL:  originalURL,
 	}
 }
 
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"sort"
+	"time"
+)
+
+// ClickDayLayout layout of the day in click statistic.
+const ClickDayLayout = "2006-01-02"
+
+// Click model represents single redirect by short URL.
+// IP is expected to be anonymised before the click is stored.
+type Click struct {
+	ShortURL  string    `json:"short_url"`
+	At        time.Time `json:"at"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+}
+
+// NewClick creates new [Click].
+func NewClick(shortURL string, at time.Time, referrer string, userAgent string, ip string) Click {
+	return Click{
+		ShortURL:  shortURL,
+		At:        at,
+		Referrer:  referrer,
+		UserAgent: userAgent,
+		IP:        ip,
+	}
+}
+
+// DayClicks amount of clicks during the day (UTC).
+type DayClicks struct {
+	Day    string `json:"day"`
+	Clicks int    `json:"clicks"`
+}
+
+// ValueCount amount of clicks with the same value, e.g. referrer.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// ClickStats model to return click statistic of short URL.
+type ClickStats struct {
+	ShortURL      string       `json:"short_url"`
+	Total         int          `json:"total"`
+	Days          []DayClicks  `json:"days"`
+	TopReferrers  []ValueCount `json:"top_referrers"`
+	TopUserAgents []ValueCount `json:"top_user_agents"`
+}
+
+// NewClickStats aggregates clicks of short URL in memory.
+// Days are sorted ascending, top lists hold at most top values sorted by count.
+func NewClickStats(shortURL string, clicks []Click, top int) ClickStats {
+	counts := NewClickCounts()
+	for _, c := range clicks {
+		counts.Add(c)
+	}
+	return counts.Stats(shortURL, top)
+}
+
+// ClickCounts counts of clicks of single short URL by day, referrer and user agent,
+// so statistic can be kept up to date without storing every click.
+type ClickCounts struct {
+	total     int
+	days      map[string]int
+	referrers map[string]int
+	agents    map[string]int
+}
+
+// NewClickCounts creates new empty [*ClickCounts].
+func NewClickCounts() *ClickCounts {
+	return &ClickCounts{
+		days:      make(map[string]int),
+		referrers: make(map[string]int),
+		agents:    make(map[string]int),
+	}
+}
+
+// Add counts click.
+func (cc *ClickCounts) Add(c Click) {
+	cc.total++
+	cc.days[c.At.UTC().Format(ClickDayLayout)]++
+	if c.Referrer != "" {
+		cc.referrers[c.Referrer]++
+	}
+	if c.UserAgent != "" {
+		cc.agents[c.UserAgent]++
+	}
+}
+
+// Stats returns statistic of counted clicks, it is sorted the same way as in [NewClickStats].
+func (cc *ClickCounts) Stats(shortURL string, top int) ClickStats {
+	stats := ClickStats{
+		ShortURL:      shortURL,
+		Total:         cc.total,
+		Days:          make([]DayClicks, 0, len(cc.days)),
+		TopReferrers:  topValues(cc.referrers, top),
+		TopUserAgents: topValues(cc.agents, top),
+	}
+	for d, n := range cc.days {
+		stats.Days = append(stats.Days, DayClicks{Day: d, Clicks: n})
+	}
+	sort.Slice(stats.Days, func(i, j int) bool {
+		return stats.Days[i].Day < stats.Days[j].Day
+	})
+	return stats
+}
+
+func topValues(counts map[string]int, top int) []ValueCount {
+	res := make([]ValueCount, 0, len(counts))
+	for v, n := range counts {
+		res = append(res, ValueCount{Value: v, Count: n})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Value < res[j].Value
+	})
+	if len(res) > top {
+		res = res[:top]
+	}
+	return res
+}
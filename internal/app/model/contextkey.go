@@ -5,3 +5,10 @@ type UserIDKey struct{}
 
 // IsUserNew context key to indicate is user new or not.
 type IsUserNew struct{}
+
+// IsAccount context key to indicate that user is registered, not anonymous.
+type IsAccount struct{}
+
+// APIKeyKey context key for [APIKey] that authenticated request.
+// It's absent if request is authenticated by JWT.
+type APIKeyKey struct{}
@@ -0,0 +1,74 @@
+package model
+
+import "time"
+
+// Outcomes of deletion of single short URL.
+const (
+	DeleteOutcomePending  = "pending"
+	DeleteOutcomeDeleted  = "deleted"
+	DeleteOutcomeNotFound = "not_found"
+	DeleteOutcomeNotOwner = "not_owner"
+)
+
+// Statuses of delete job.
+const (
+	DeleteJobPending = "pending"
+	DeleteJobDone    = "done"
+	DeleteJobFailed  = "failed"
+)
+
+// DeleteResult model represents outcome of deletion of single short URL.
+type DeleteResult struct {
+	ShortURL string `json:"short_url"`
+	Outcome  string `json:"outcome"`
+}
+
+// NewDeleteResult creates new [DeleteResult].
+func NewDeleteResult(shortURL string, outcome string) DeleteResult {
+	return DeleteResult{
+		ShortURL: shortURL,
+		Outcome:  outcome,
+	}
+}
+
+// DeleteJob model represents accepted request to delete user's URLs.
+type DeleteJob struct {
+	ID        string         `json:"id"`
+	UserID    string         `json:"-"`
+	Status    string         `json:"status"`
+	Attempts  int            `json:"attempts"`
+	Error     string         `json:"error,omitempty"`
+	Results   []DeleteResult `json:"results"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// NewDeleteJob creates new pending [DeleteJob], outcome of every short URL is pending.
+func NewDeleteJob(id string, userID string, shortIDs []string, now time.Time) DeleteJob {
+	results := make([]DeleteResult, 0, len(shortIDs))
+	for _, shID := range shortIDs {
+		results = append(results, NewDeleteResult(shID, DeleteOutcomePending))
+	}
+	return DeleteJob{
+		ID:        id,
+		UserID:    userID,
+		Status:    DeleteJobPending,
+		Results:   results,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// ShortIDs returns short URLs requested to delete.
+func (j DeleteJob) ShortIDs() []string {
+	ids := make([]string, 0, len(j.Results))
+	for _, r := range j.Results {
+		ids = append(ids, r.ShortURL)
+	}
+	return ids
+}
+
+// IsFinished reports whether job won't be processed anymore.
+func (j DeleteJob) IsFinished() bool {
+	return j.Status == DeleteJobDone || j.Status == DeleteJobFailed
+}
@@ -0,0 +1,46 @@
+package model
+
+// Health statuses.
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusFail = "fail"
+)
+
+// HealthCheck model represents result of single component check.
+type HealthCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// NewHealthCheck creates new [HealthCheck].
+// Check fails if err is not nil, the error is reported in detail then.
+func NewHealthCheck(name string, detail string, err error) HealthCheck {
+	if err != nil {
+		return HealthCheck{Name: name, Status: HealthStatusFail, Detail: err.Error()}
+	}
+	return HealthCheck{Name: name, Status: HealthStatusOK, Detail: detail}
+}
+
+// Health model to return result of health probe.
+type Health struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// NewHealth creates new [Health]. It fails if any of checks failed.
+func NewHealth(checks []HealthCheck) Health {
+	status := HealthStatusOK
+	for _, c := range checks {
+		if c.Status != HealthStatusOK {
+			status = HealthStatusFail
+			break
+		}
+	}
+	return Health{Status: status, Checks: checks}
+}
+
+// OK reports whether all checks passed.
+func (h Health) OK() bool {
+	return h.Status == HealthStatusOK
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// URLCount amounts of user's URLs that quotas are checked against.
+type URLCount struct {
+	// Active URLs that are neither deleted nor expired.
+	Active int
+	// Created URLs created since requested time, deleted ones are counted too.
+	Created int
+}
+
+// QuotaValue used amount and limit of quota, zero limit means no limit.
+type QuotaValue struct {
+	Used  int `json:"used"`
+	Limit int `json:"limit"`
+}
+
+// QuotaUsage usage of user's quotas.
+// Daily quota counts URLs created during the last 24 hours.
+type QuotaUsage struct {
+	Active   QuotaValue `json:"active"`
+	Daily    QuotaValue `json:"daily"`
+	MaxBatch int        `json:"max_batch"`
+}
+
+// URLLimitKey context key of [URLLimit] that storage enforces when user's URLs are saved.
+type URLLimitKey struct{}
+
+// URLLimit limits of user's URLs, zero limit means no limit.
+type URLLimit struct {
+	// MaxActive amount of URLs that are neither deleted nor expired.
+	MaxActive int
+	// MaxPerDay amount of URLs created since Since, deleted ones are counted too.
+	MaxPerDay int
+	Since     time.Time
+}
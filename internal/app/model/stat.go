@@ -13,3 +13,9 @@ func NewStat(urls, users int) Stat {
 		Users: users,
 	}
 }
+
+// RecheckResult model to return outcome of existing URLs recheck.
+type RecheckResult struct {
+	Checked  int `json:"checked"`
+	Disabled int `json:"disabled"`
+}
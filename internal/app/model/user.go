@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// User model represents registered account.
+// ID of the account is used as subject of its sessions.
+type User struct {
+	ID           string    `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NewUser creates new [User].
+func NewUser(id string, email string, passwordHash string, now time.Time) User {
+	return User{
+		ID:           id,
+		Email:        email,
+		PasswordHash: passwordHash,
+		CreatedAt:    now,
+	}
+}
+
+// Reassigned amounts of records moved from one user to another.
+type Reassigned struct {
+	URLs       int64
+	APIKeys    int64
+	DeleteJobs int64
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http/httptest"
+	"time"
 
 	"github.com/denis-oreshkevich/shortener/internal/app/config"
 	"github.com/denis-oreshkevich/shortener/internal/app/model"
@@ -15,25 +16,24 @@ import (
 
 func ExampleServer_Get() {
 	//Initializing storage
-	s := storage.NewMapStorage()
+	s := storage.NewMapStorage(generator.DefaultIDGenerator())
 	ctx := context.Background()
 	userID := generator.UUIDString()
 	ctx = context.WithValue(ctx, model.UserIDKey{}, userID)
 
-	shortURL, err := s.SaveURL(ctx, userID, "http://localhost:30000")
+	shortURL, err := s.SaveURL(ctx, userID, "http://localhost:30000", "http://localhost:30000", time.Time{})
 	if err != nil {
 		fmt.Println(fmt.Errorf("SaveURL : %w", err))
 		return
 	}
 	//Initializing channel to delete URLs
-	delChannel := make(chan model.BatchDeleteEntry, 3)
 	//Initializing shortener
 	sh := shortener.New(s)
 	//Initializing config
 	conf := config.Get()
 
 	//Initializing sever entity
-	srv := New(conf, sh, delChannel)
+	srv := New(conf, sh)
 
 	//Initializing Gin server
 	r := gin.New()
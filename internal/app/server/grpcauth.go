@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	pb "github.com/denis-oreshkevich/shortener/internal/app/server/proto"
+	"github.com/denis-oreshkevich/shortener/internal/app/shortener"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/auth"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AuthorizationMD metadata key with bearer JWT or API key, new users receive access token
+// in response header with this key.
+const AuthorizationMD = "authorization"
+
+// RefreshTokenMD metadata key with refresh JWT. It is sent to new users next to access token
+// and renews the session if access token is absent or not valid.
+const RefreshTokenMD = "x-refresh-token"
+
+const bearerPrefix = "Bearer "
+
+// methodScopes scopes of API key required by methods of the shortener service,
+// methods that are not listed are allowed to every key.
+var methodScopes = map[string]string{
+	pb.Shortener_CreateShortURL_FullMethodName:       model.ScopeCreate,
+	pb.Shortener_BatchCreateShortURL_FullMethodName:  model.ScopeCreate,
+	pb.Shortener_StreamCreateShortURL_FullMethodName: model.ScopeCreate,
+	pb.Shortener_GetUserURLs_FullMethodName:          model.ScopeRead,
+	pb.Shortener_StreamUserURLs_FullMethodName:       model.ScopeRead,
+	pb.Shortener_GetDeleteJob_FullMethodName:         model.ScopeRead,
+	pb.Shortener_GetURLStats_FullMethodName:          model.ScopeRead,
+	pb.Shortener_DeleteUserURLsBatch_FullMethodName:  model.ScopeDelete,
+}
+
+// GRPCAuth authenticates calls of the shortener service like [Server.Auth] authenticates HTTP requests.
+type GRPCAuth struct {
+	sh *shortener.Shortener
+}
+
+// NewGRPCAuth creates new [*GRPCAuth].
+func NewGRPCAuth(sh *shortener.Shortener) *GRPCAuth {
+	return &GRPCAuth{sh: sh}
+}
+
+// UnaryInterceptor authenticates unary calls of the shortener service.
+// If credentials are absent new anonymous session is started and its tokens are sent back in response header.
+func (a *GRPCAuth) UnaryInterceptor(ctx context.Context, req any,
+	info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !isShortenerMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	ctx, err := a.authenticate(ctx, info.FullMethod, func(md metadata.MD) error {
+		return grpc.SetHeader(ctx, md)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor authenticates streaming calls of the shortener service like [GRPCAuth.UnaryInterceptor].
+func (a *GRPCAuth) StreamInterceptor(srv any, ss grpc.ServerStream,
+	info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !isShortenerMethod(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	ctx, err := a.authenticate(ss.Context(), info.FullMethod, ss.SetHeader)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authServerStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticate puts user ID from bearer token or API key to context.
+// Missing or invalid access token is renewed by refresh token, the session is rotated then.
+// setHeader is used to send tokens of new or rotated session.
+func (a *GRPCAuth) authenticate(ctx context.Context, method string,
+	setHeader func(md metadata.MD) error) (context.Context, error) {
+	log := logger.Log.With(zap.String("cat", "auth"))
+	tokenString, ok := bearerToken(ctx)
+	if ok && auth.IsAPIKey(tokenString) {
+		return a.apiKeyAuth(ctx, method, tokenString)
+	}
+	var claims *auth.Claims
+	if ok {
+		var err error
+		if claims, err = auth.ParseClaims(tokenString); err != nil {
+			log.Debug("parse token", zap.Error(err))
+		}
+	}
+	if claims == nil {
+		var sess auth.Session
+		var err error
+		if refresh := metadataValue(ctx, RefreshTokenMD); refresh != "" {
+			sess, err = a.sh.RefreshSession(ctx, refresh)
+			if errors.Is(err, shortener.ErrInvalidSession) {
+				log.Debug("refresh session", zap.Error(err))
+				return ctx, status.Error(codes.Unauthenticated, "invalid session")
+			}
+		} else if ok {
+			return ctx, status.Error(codes.Unauthenticated, "invalid token")
+		} else {
+			log.Debug("bearer token not found in metadata")
+			sess, err = auth.NewAnonymousSession()
+			ctx = context.WithValue(ctx, model.IsUserNew{}, true)
+		}
+		if err != nil {
+			log.Error("issue session", zap.Error(err))
+			return ctx, status.Error(codes.Internal, "issue session")
+		}
+		if err = setHeader(metadata.Pairs(AuthorizationMD, bearerPrefix+sess.Access,
+			RefreshTokenMD, sess.Refresh)); err != nil {
+			log.Error("set header", zap.Error(err))
+			return ctx, status.Error(codes.Internal, "send token")
+		}
+		claims = sess.AccessClaims
+	} else if err := a.sh.CheckToken(ctx, claims); err != nil {
+		if errors.Is(err, shortener.ErrTokenRevoked) {
+			log.Debug("token is revoked", zap.String("jti", claims.ID))
+			return ctx, status.Error(codes.Unauthenticated, "token is revoked")
+		}
+		log.Error("checkToken", zap.Error(err))
+		return ctx, status.Error(codes.Internal, "check token")
+	}
+	if claims.Account {
+		ctx = context.WithValue(ctx, model.IsAccount{}, true)
+	}
+	log.Debug(fmt.Sprintf("request with user sub = %s", claims.Subject))
+	return context.WithValue(ctx, model.UserIDKey{}, claims.Subject), nil
+}
+
+// apiKeyAuth puts owner of API key and the key to context like [Server.Auth],
+// key without scope required by method is rejected like by [RequireScope].
+func (a *GRPCAuth) apiKeyAuth(ctx context.Context, method string, key string) (context.Context, error) {
+	apiKey, err := a.sh.AuthenticateAPIKey(ctx, key)
+	if err != nil {
+		if errors.Is(err, shortener.ErrInvalidAPIKey) {
+			logger.Log.Debug("API key is not valid")
+			return ctx, status.Error(codes.Unauthenticated, "invalid API key")
+		}
+		logger.Log.Error("authenticateAPIKey", zap.Error(err))
+		return ctx, status.Error(codes.Internal, "authenticate API key")
+	}
+	if scope, ok := methodScopes[method]; ok && !apiKey.HasScope(scope) {
+		logger.Log.Debug(fmt.Sprintf("API key %s has no scope %s", apiKey.ID, scope))
+		return ctx, status.Errorf(codes.PermissionDenied, "API key has no scope %s", scope)
+	}
+	ctx = context.WithValue(ctx, model.UserIDKey{}, apiKey.UserID)
+	return context.WithValue(ctx, model.APIKeyKey{}, apiKey), nil
+}
+
+// metadataValue returns first value of incoming metadata key.
+func metadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	return firstValue(md, key)
+}
+
+// bearerToken returns token from authorization metadata and whether metadata is present.
+// Value without bearer prefix is returned as is and fails validation.
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	v := firstValue(md, AuthorizationMD)
+	if v == "" {
+		return "", false
+	}
+	if token, ok := cutBearer(v); ok {
+		return token, true
+	}
+	return v, true
+}
+
+// cutBearer returns token from authorization value with case-insensitive bearer scheme.
+func cutBearer(v string) (string, bool) {
+	if len(v) >= len(bearerPrefix) && strings.EqualFold(v[:len(bearerPrefix)], bearerPrefix) {
+		return v[len(bearerPrefix):], true
+	}
+	return "", false
+}
+
+// isShortenerMethod reports whether method belongs to shortener service,
+// health and reflection services don't need authentication.
+func isShortenerMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+pb.Shortener_ServiceDesc.ServiceName+"/")
+}
+
+// authServerStream overrides context of the stream with authenticated one.
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns authenticated context.
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
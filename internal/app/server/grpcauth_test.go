@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/shortener"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/auth"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// headerStream collects response headers set by interceptor.
+type headerStream struct {
+	grpc.ServerTransportStream
+	header metadata.MD
+}
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestGRPCAuth_UnaryInterceptor(t *testing.T) {
+	sh := shortener.New(storage.NewMapStorage(generator.DefaultIDGenerator()))
+	a := NewGRPCAuth(sh)
+	token, err := auth.GenerateToken()
+	require.NoError(t, err)
+	userID, err := auth.ParseToken(token)
+	require.NoError(t, err)
+	sess, err := auth.NewAnonymousSession()
+	require.NoError(t, err)
+	revoked, err := auth.NewAnonymousSession()
+	require.NoError(t, err)
+	require.NoError(t, sh.Logout(context.Background(), revoked.AccessClaims, ""))
+
+	ownerCtx := context.WithValue(context.Background(), model.UserIDKey{}, userID)
+	_, readKey, err := sh.CreateAPIKey(ownerCtx, "reader", []string{model.ScopeRead})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		method     string
+		md         metadata.MD
+		wantCode   codes.Code
+		wantUser   string
+		wantNew    bool
+		wantIssued bool
+	}{
+		{
+			name:     "valid token #1",
+			method:   "/shortener.Shortener/GetUserURLs",
+			md:       metadata.Pairs(AuthorizationMD, "Bearer "+token),
+			wantCode: codes.OK,
+			wantUser: userID,
+		},
+		{
+			name:     "invalid token #2",
+			method:   "/shortener.Shortener/GetUserURLs",
+			md:       metadata.Pairs(AuthorizationMD, "Bearer invalid"),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "not bearer #3",
+			method:   "/shortener.Shortener/GetUserURLs",
+			md:       metadata.Pairs(AuthorizationMD, "Basic "+token),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:       "new user #4",
+			method:     "/shortener.Shortener/CreateShortURL",
+			md:         metadata.MD{},
+			wantCode:   codes.OK,
+			wantNew:    true,
+			wantIssued: true,
+		},
+		{
+			name:     "health check #5",
+			method:   "/grpc.health.v1.Health/Check",
+			md:       metadata.MD{},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "API key #6",
+			method:   "/shortener.Shortener/GetUserURLs",
+			md:       metadata.Pairs(AuthorizationMD, "Bearer "+readKey),
+			wantCode: codes.OK,
+			wantUser: userID,
+		},
+		{
+			name:     "API key without scope #7",
+			method:   "/shortener.Shortener/CreateShortURL",
+			md:       metadata.Pairs(AuthorizationMD, "Bearer "+readKey),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "unknown API key #8",
+			method:   "/shortener.Shortener/GetUserURLs",
+			md:       metadata.Pairs(AuthorizationMD, "Bearer "+readKey+"x"),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:       "refresh token #9",
+			method:     "/shortener.Shortener/GetUserURLs",
+			md:         metadata.Pairs(RefreshTokenMD, sess.Refresh),
+			wantCode:   codes.OK,
+			wantUser:   sess.AccessClaims.Subject,
+			wantIssued: true,
+		},
+		{
+			name:     "access token as refresh token #10",
+			method:   "/shortener.Shortener/GetUserURLs",
+			md:       metadata.Pairs(RefreshTokenMD, sess.Access),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "revoked token #11",
+			method:   "/shortener.Shortener/GetUserURLs",
+			md:       metadata.Pairs(AuthorizationMD, "Bearer "+revoked.Access),
+			wantCode: codes.Unauthenticated,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &headerStream{}
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+
+			var handlerCtx context.Context
+			handler := func(ctx context.Context, req any) (any, error) {
+				handlerCtx = ctx
+				return nil, nil
+			}
+			_, err := a.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if err != nil {
+				return
+			}
+			gotUser, _ := handlerCtx.Value(model.UserIDKey{}).(string)
+			if tt.wantUser != "" {
+				assert.Equal(t, tt.wantUser, gotUser)
+			}
+			isNew, _ := handlerCtx.Value(model.IsUserNew{}).(bool)
+			assert.Equal(t, tt.wantNew, isNew)
+			if tt.wantIssued {
+				issued := stream.header.Get(AuthorizationMD)
+				require.Len(t, issued, 1)
+				claims, err := auth.ParseClaims(issued[0][len("Bearer "):])
+				require.NoError(t, err)
+				assert.Equal(t, claims.Subject, gotUser)
+				refresh := stream.header.Get(RefreshTokenMD)
+				require.Len(t, refresh, 1)
+				_, err = auth.ParseRefreshClaims(refresh[0])
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/denis-oreshkevich/shortener/internal/app/server/proto"
+	"github.com/denis-oreshkevich/shortener/internal/app/shortener"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// SyncGRPCHealth keeps grpc.health.v1 status of the whole server and of the Shortener service
+// in sync with readiness of sh until ctx is done. Status is refreshed every interval.
+func SyncGRPCHealth(ctx context.Context, sh *shortener.Shortener, hs *health.Server,
+	interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		setGRPCHealth(ctx, sh, hs)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func setGRPCHealth(ctx context.Context, sh *shortener.Shortener, hs *health.Server) {
+	status := healthpb.HealthCheckResponse_SERVING
+	h := sh.Readiness(ctx)
+	if !h.OK() {
+		logger.Log.Warn("health check failed", zap.Any("checks", h.Checks))
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	hs.SetServingStatus("", status)
+	hs.SetServingStatus(pb.Shortener_ServiceDesc.ServiceName, status)
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/config"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// MuxGRPC routes HTTP/2 gRPC requests to grpcHandler and others to httpHandler,
+// so both APIs are served on the same address.
+// Plaintext HTTP/2 (h2c) is accepted with h2 settings unless tlsEnabled, gRPC clients don't use TLS then.
+// With TLS h2 must be configured on HTTP server by [ConfigureMuxHTTP2].
+func MuxGRPC(grpcHandler http.Handler, httpHandler http.Handler, h2 *http2.Server,
+	tlsEnabled bool) http.Handler {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get(ContentType), ApplicationGRPC) {
+			grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+	if tlsEnabled {
+		return h
+	}
+	return h2c.NewHandler(h, h2)
+}
+
+// MuxHTTP2Server returns HTTP/2 settings of server that multiplexes gRPC,
+// stream limit and max connection idle of gRPC server are applied to all HTTP/2 connections.
+func MuxHTTP2Server(conf config.Conf) *http2.Server {
+	return &http2.Server{
+		MaxConcurrentStreams: uint32(conf.GRPCMaxConcurrentStreams()),
+		IdleTimeout:          conf.GRPCMaxConnectionIdle(),
+	}
+}
+
+// ConfigureMuxHTTP2 applies h2 settings to HTTPS server that multiplexes gRPC.
+func ConfigureMuxHTTP2(srv *http.Server, h2 *http2.Server) error {
+	if err := http2.ConfigureServer(srv, h2); err != nil {
+		return fmt.Errorf("http2.ConfigureServer: %w", err)
+	}
+	return nil
+}
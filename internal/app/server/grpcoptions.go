@@ -0,0 +1,90 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/config"
+	"golang.org/x/net/netutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+)
+
+// ErrNoClientCA indicates that client CA file has no certificates.
+var ErrNoClientCA = errors.New("no certificates found in client CA file")
+
+// GRPCServerOptions returns options of gRPC server from configuration: message size,
+// stream and keepalive limits and TLS credentials if HTTPS is enabled.
+func GRPCServerOptions(conf config.Conf) ([]grpc.ServerOption, error) {
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(conf.GRPCMaxMsgSize()),
+		grpc.MaxSendMsgSize(conf.GRPCMaxMsgSize()),
+		grpc.MaxConcurrentStreams(uint32(conf.GRPCMaxConcurrentStreams())),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle: conf.GRPCMaxConnectionIdle(),
+			Time:              conf.GRPCKeepaliveTime(),
+			Timeout:           conf.GRPCKeepaliveTimeout(),
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             conf.GRPCKeepaliveMinTime(),
+			PermitWithoutStream: true,
+		}),
+	}
+	if !conf.EnableHTTPS() {
+		return opts, nil
+	}
+	manager, err := NewCertManager(conf.TLSCertFile(), conf.TLSKeyFile())
+	if err != nil {
+		return nil, fmt.Errorf("NewCertManager: %w", err)
+	}
+	tlsConf, err := NewServerTLSConfig(manager, conf.GRPCClientCAFile())
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, grpc.Creds(credentials.NewTLS(tlsConf))), nil
+}
+
+// NewServerTLSConfig creates TLS configuration with certificate of manager.
+// If clientCAFile is not empty clients must present certificate signed by this CA (mTLS).
+func NewServerTLSConfig(manager *CertManager, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(manager.CertPath, manager.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("tls.LoadX509KeyPair: %w", err)
+	}
+	tlsConf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile == "" {
+		return tlsConf, nil
+	}
+	caPEM, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile %s: %w", clientCAFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("%s: %w", clientCAFile, ErrNoClientCA)
+	}
+	tlsConf.ClientCAs = pool
+	tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
+	return tlsConf, nil
+}
+
+// GRPCListener listens gRPC address, amount of accepted connections is limited
+// if max connections is configured.
+func GRPCListener(conf config.Conf) (net.Listener, error) {
+	lis, err := net.Listen("tcp", conf.GRPCAddress())
+	if err != nil {
+		return nil, fmt.Errorf("net.Listen: %w", err)
+	}
+	if conf.GRPCMaxConnections() > 0 {
+		lis = netutil.LimitListener(lis, conf.GRPCMaxConnections())
+	}
+	return lis, nil
+}
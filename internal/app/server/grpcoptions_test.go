@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestNewServerTLSConfig_mTLS(t *testing.T) {
+	dir := t.TempDir()
+	manager, err := NewCertManager(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	require.NoError(t, err)
+
+	badCA := filepath.Join(dir, "bad.pem")
+	require.NoError(t, os.WriteFile(badCA, []byte("not a certificate"), 0644))
+	_, err = NewServerTLSConfig(manager, badCA)
+	assert.ErrorIs(t, err, ErrNoClientCA)
+
+	// self-signed certificate is used as server certificate, client certificate and CA
+	tlsConf, err := NewServerTLSConfig(manager, manager.CertPath)
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, tlsConf.ClientAuth)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConf)))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	caPEM, err := os.ReadFile(manager.CertPath)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caPEM))
+	clientCert, err := tls.LoadX509KeyPair(manager.CertPath, manager.KeyPath)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		certs   []tls.Certificate
+		wantErr bool
+	}{
+		{
+			name:  "client certificate #1",
+			certs: []tls.Certificate{clientCert},
+		},
+		{
+			name:    "no client certificate #2",
+			wantErr: true,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			creds := credentials.NewTLS(&tls.Config{
+				RootCAs:      roots,
+				Certificates: tt.certs,
+				MinVersion:   tls.VersionTLS12,
+			})
+			conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(creds))
+			require.NoError(t, err)
+			defer conn.Close()
+
+			_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
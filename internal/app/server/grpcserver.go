@@ -2,40 +2,90 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/denis-oreshkevich/shortener/internal/app/config"
 	"github.com/denis-oreshkevich/shortener/internal/app/model"
 	pb "github.com/denis-oreshkevich/shortener/internal/app/server/proto"
 	"github.com/denis-oreshkevich/shortener/internal/app/shortener"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/validator"
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// streamChunkSize amount of streamed records saved at once.
+	streamChunkSize = 500
+
+	// maxStreamPageSize max amount of user's URLs in single streamed message.
+	maxStreamPageSize = 1000
 )
 
 type GRPCServer struct {
 	pb.UnimplementedShortenerServer
-	sh         *shortener.Shortener
-	conf       config.Conf
-	delChannel chan model.BatchDeleteEntry
+	sh   *shortener.Shortener
+	conf config.Conf
 }
 
-func NewGRPCServer(sh *shortener.Shortener, conf config.Conf,
-	delChannel chan model.BatchDeleteEntry) *GRPCServer {
+func NewGRPCServer(sh *shortener.Shortener, conf config.Conf) *GRPCServer {
 	return &GRPCServer{
-		sh:         sh,
-		conf:       conf,
-		delChannel: delChannel,
+		sh:   sh,
+		conf: conf,
 	}
 }
 
 func (gs *GRPCServer) CreateShortURL(ctx context.Context,
 	req *pb.CreateShortURLRequest) (*pb.CreateShortURLResponse, error) {
-	ctx = context.WithValue(ctx, model.UserIDKey{}, req.GetUserId())
-	id, err := gs.sh.SaveURL(ctx, req.GetUrl())
+	ctx, err := withUserID(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	u, err := validator.URL(req.GetUrl())
+	if err != nil {
+		return nil, urlError(err)
+	}
+	ttl, err := ttlSeconds(req.GetTtl())
 	if err != nil {
-		logger.Log.Error("sh.SaveURL", zap.Error(err))
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	expiresAt, err := shortener.ExpiresAt(time.Now(), ttl, timestampOrNil(req.GetExpiresAt()))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var id string
+	if alias := req.GetAlias(); alias != "" {
+		if !validator.Alias(alias) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid alias %s", alias)
+		}
+		id, err = gs.sh.SaveURLWithID(ctx, alias, u, expiresAt)
+	} else {
+		id, err = gs.sh.SaveURL(ctx, u, expiresAt)
+	}
+	if err != nil {
+		if errors.Is(err, shortener.ErrAliasNotCreated) {
+			logger.Log.Info(fmt.Sprintf("alias %s is not created for shortened url = %s", req.GetAlias(), u))
+			return nil, conflictError(fmt.Sprintf("%s/%s", gs.conf.BaseURL(), id), req.GetAlias())
+		}
+		if errors.Is(err, storage.ErrDBConflict) {
+			logger.Log.Info(fmt.Sprintf("saveURL conflict on original url = %s", u))
+			return nil, conflictError(fmt.Sprintf("%s/%s", gs.conf.BaseURL(), id), "")
+		}
+		if errors.Is(err, storage.ErrIDConflict) {
+			return nil, status.Errorf(codes.AlreadyExists, "alias %s is already taken", req.GetAlias())
+		}
+		return nil, statusError("sh.SaveURL", err)
 	}
 	url := fmt.Sprintf("%s/%s", gs.conf.BaseURL(), id)
 	return &pb.CreateShortURLResponse{Result: url}, nil
@@ -43,15 +93,33 @@ func (gs *GRPCServer) CreateShortURL(ctx context.Context,
 
 func (gs *GRPCServer) BatchCreateShortURL(ctx context.Context,
 	req *pb.BatchCreateShortURLRequest) (*pb.BatchCreateShortURLResponse, error) {
+	ctx, err := withUserID(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	if len(req.GetRecords()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "batch is empty")
+	}
 	var items []model.BatchReqEntry
 	for _, item := range req.GetRecords() {
-		items = append(items, model.BatchReqEntry{OriginalURL: item.OriginalUrl, CorrelationID: item.CorrelationId})
+		u, uErr := validator.URL(item.GetOriginalUrl())
+		if uErr != nil {
+			return nil, urlError(fmt.Errorf("entry %s: %w", item.GetCorrelationId(), uErr))
+		}
+		ttl, tErr := ttlSeconds(item.GetTtl())
+		if tErr != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "entry %s: %v", item.GetCorrelationId(), tErr)
+		}
+		items = append(items, model.BatchReqEntry{
+			OriginalURL:   u,
+			CorrelationID: item.CorrelationId,
+			ExpiresAt:     timestampOrNil(item.GetExpiresAt()),
+			TTL:           ttl,
+		})
 	}
-	ctx = context.WithValue(ctx, model.UserIDKey{}, req.GetUserId())
 	res, err := gs.sh.SaveURLBatch(ctx, items)
 	if err != nil {
-		logger.Log.Error("sh.SaveURLBatch", zap.Error(err))
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, statusError("sh.SaveURLBatch", err)
 	}
 	var result []*pb.BatchCreateShortURLResponseData
 	for _, item := range res {
@@ -65,23 +133,28 @@ func (gs *GRPCServer) BatchCreateShortURL(ctx context.Context,
 	return &pb.BatchCreateShortURLResponse{Records: result}, nil
 }
 
-func (gs *GRPCServer) GetByShort(ctx context.Context,
+func (gs *GRPCServer) GetOriginalURL(ctx context.Context,
 	req *pb.GetOriginalURLRequest) (*pb.GetOriginalURLResponse, error) {
+	if !validator.ID(req.GetUrl()) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid short url %s", req.GetUrl())
+	}
 	originalURL, err := gs.sh.FindURL(ctx, req.GetUrl())
 	if err != nil {
-		logger.Log.Error("sh.FindURL", zap.Error(err))
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, statusError("sh.FindURL", err)
 	}
+	gs.sh.TrackClick(newClick(ctx, req.GetUrl()))
 	return &pb.GetOriginalURLResponse{OriginalUrl: originalURL}, nil
 }
 
 func (gs *GRPCServer) GetUserURLs(ctx context.Context,
 	req *pb.GetUserURLsRequest) (*pb.GetUserURLsResponse, error) {
-	ctx = context.WithValue(ctx, model.UserIDKey{}, req.GetUserId())
-	urls, err := gs.sh.FindUserURLs(ctx)
+	ctx, err := withUserID(ctx, req.GetUserId())
 	if err != nil {
-		logger.Log.Error("sh.FindUserURLs", zap.Error(err))
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, err
+	}
+	urls, err := gs.sh.FindUserURLs(ctx)
+	if err != nil && !errors.Is(err, shortener.ErrUserItemsNotFound) {
+		return nil, statusError("sh.FindUserURLs", err)
 	}
 	var result []*pb.ShortenData
 	for _, item := range urls {
@@ -90,21 +163,398 @@ func (gs *GRPCServer) GetUserURLs(ctx context.Context,
 	return &pb.GetUserURLsResponse{Records: result}, nil
 }
 
+// StreamCreateShortURL saves records in chunks of [streamChunkSize], or of max batch quota
+// if it is smaller, as they are received.
+// Rejected records are answered with error, stream is aborted if storage fails or quota is exceeded.
+func (gs *GRPCServer) StreamCreateShortURL(stream pb.Shortener_StreamCreateShortURLServer) error {
+	ctx, err := withUserID(stream.Context(), "")
+	if err != nil {
+		return err
+	}
+	chunkSize := streamChunkSize
+	if maxBatch := gs.sh.Quota().MaxBatch; maxBatch > 0 && maxBatch < chunkSize {
+		chunkSize = maxBatch
+	}
+	chunk := make([]model.BatchReqEntry, 0, chunkSize)
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		res, err := gs.sh.SaveURLBatch(ctx, chunk)
+		if err != nil {
+			return statusError("sh.SaveURLBatch", err)
+		}
+		for _, item := range res {
+			err = stream.Send(&pb.StreamCreateShortURLResponse{
+				CorrelationId: item.CorrelationID,
+				ShortUrl:      item.ShortURL,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		chunk = chunk[:0]
+		return nil
+	}
+	for {
+		item, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return flush()
+		}
+		if err != nil {
+			return err
+		}
+		entry, reason := gs.streamEntry(item)
+		if reason != "" {
+			err = stream.Send(&pb.StreamCreateShortURLResponse{
+				CorrelationId: item.GetCorrelationId(),
+				Error:         reason,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		chunk = append(chunk, entry)
+		if len(chunk) == chunkSize {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// streamEntry validates record and converts it to entry to save,
+// reason of rejection is returned if record is not valid or its host is rejected.
+// TTL is passed to entry as is, so it counts from the moment the chunk is saved
+// however long the stream has been running.
+func (gs *GRPCServer) streamEntry(item *pb.BatchCreateShortURLRequestData) (model.BatchReqEntry, string) {
+	u, err := validator.URL(item.GetOriginalUrl())
+	if err != nil {
+		return model.BatchReqEntry{}, err.Error()
+	}
+	if err = gs.sh.CheckHost(u); err != nil {
+		return model.BatchReqEntry{}, err.Error()
+	}
+	entry := model.NewBatchReqEntry(item.GetCorrelationId(), u)
+	if entry.TTL, err = ttlSeconds(item.GetTtl()); err != nil {
+		return model.BatchReqEntry{}, err.Error()
+	}
+	entry.ExpiresAt = timestampOrNil(item.GetExpiresAt())
+	if _, err = shortener.ExpiresAt(time.Now(), entry.TTL, entry.ExpiresAt); err != nil {
+		return model.BatchReqEntry{}, err.Error()
+	}
+	return entry, ""
+}
+
+// StreamUserURLs sends user's URLs by pages of requested size, at most [maxStreamPageSize].
+func (gs *GRPCServer) StreamUserURLs(req *pb.StreamUserURLsRequest,
+	stream pb.Shortener_StreamUserURLsServer) error {
+	ctx, err := withUserID(stream.Context(), "")
+	if err != nil {
+		return err
+	}
+	size := int(req.GetPageSize())
+	if size <= 0 || size > maxStreamPageSize {
+		size = maxStreamPageSize
+	}
+	prefix := gs.conf.BaseURL() + "/"
+	after := strings.TrimPrefix(req.GetAfter(), prefix)
+	for {
+		urls, err := gs.sh.FindUserURLsPage(ctx, after, size)
+		if err != nil {
+			return statusError("sh.FindUserURLsPage", err)
+		}
+		if len(urls) == 0 {
+			return nil
+		}
+		records := make([]*pb.ShortenData, 0, len(urls))
+		for _, item := range urls {
+			records = append(records, &pb.ShortenData{ShortUrl: item.ShortURL, OriginalUrl: item.OriginalURL})
+		}
+		after = strings.TrimPrefix(urls[len(urls)-1].ShortURL, prefix)
+		if err = stream.Send(&pb.StreamUserURLsResponse{Records: records, NextAfter: after}); err != nil {
+			return err
+		}
+		if len(urls) < size {
+			return nil
+		}
+	}
+}
+
+// DeleteUserURLsBatch accepts request to delete user's URLs and returns ID of the delete job.
+// Deletion is done asynchronously by delete workers, status is available by [GRPCServer.GetDeleteJob].
 func (gs *GRPCServer) DeleteUserURLsBatch(ctx context.Context,
 	req *pb.DeleteUserURLsBatchRequest) (*pb.DeleteUserURLsBatchResponse, error) {
-	ctx = context.WithValue(ctx, model.UserIDKey{}, req.GetUserId())
-	entry := model.NewBatchDeleteEntry(req.GetUserId(), req.Urls)
-	gs.delChannel <- entry
-	gs.sh.DeleteUserURLs(ctx, gs.delChannel)
-	return &pb.DeleteUserURLsBatchResponse{}, nil
+	ctx, err := withUserID(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	job, err := gs.sh.SubmitDelete(ctx, req.GetUrls())
+	if err != nil {
+		return nil, statusError("sh.SubmitDelete", err)
+	}
+	return &pb.DeleteUserURLsBatchResponse{JobId: job.ID}, nil
+}
+
+func (gs *GRPCServer) GetDeleteJob(ctx context.Context,
+	req *pb.GetDeleteJobRequest) (*pb.GetDeleteJobResponse, error) {
+	ctx, err := withUserID(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	job, err := gs.sh.FindDeleteJob(ctx, req.GetJobId())
+	if err != nil {
+		return nil, statusError("sh.FindDeleteJob", err)
+	}
+	results := make([]*pb.DeleteResult, 0, len(job.Results))
+	for _, r := range job.Results {
+		results = append(results, &pb.DeleteResult{ShortUrl: r.ShortURL, Outcome: r.Outcome})
+	}
+	return &pb.GetDeleteJobResponse{
+		Id:        job.ID,
+		Status:    job.Status,
+		Attempts:  int64(job.Attempts),
+		Error:     job.Error,
+		Results:   results,
+		CreatedAt: timestamppb.New(job.CreatedAt),
+		UpdatedAt: timestamppb.New(job.UpdatedAt),
+	}, nil
+}
+
+func (gs *GRPCServer) GetURLStats(ctx context.Context,
+	req *pb.GetURLStatsRequest) (*pb.GetURLStatsResponse, error) {
+	ctx, err := withUserID(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	if !validator.ID(req.GetUrl()) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid short url %s", req.GetUrl())
+	}
+	stats, err := gs.sh.FindClickStats(ctx, req.GetUrl())
+	if err != nil {
+		return nil, statusError("sh.FindClickStats", err)
+	}
+	days := make([]*pb.DayClicks, 0, len(stats.Days))
+	for _, d := range stats.Days {
+		days = append(days, &pb.DayClicks{Day: d.Day, Clicks: int64(d.Clicks)})
+	}
+	return &pb.GetURLStatsResponse{
+		ShortUrl:      stats.ShortURL,
+		Total:         int64(stats.Total),
+		Days:          days,
+		TopReferrers:  valueCounts(stats.TopReferrers),
+		TopUserAgents: valueCounts(stats.TopUserAgents),
+	}, nil
 }
 
 func (gs *GRPCServer) GetStats(ctx context.Context,
 	req *pb.ServiceStatsRequest) (*pb.ServiceStatsResponse, error) {
+	if !gs.isTrusted(ctx) {
+		return nil, status.Error(codes.PermissionDenied, "client is not in trusted subnet")
+	}
 	stats, err := gs.sh.FindStats(ctx)
 	if err != nil {
-		logger.Log.Error("sh.FindStats", zap.Error(err))
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, statusError("sh.FindStats", err)
 	}
 	return &pb.ServiceStatsResponse{Urls: int64(stats.URLs), Users: int64(stats.Users)}, nil
 }
+
+// Ping checks storage connection. Returns Unavailable if storage isn't reachable.
+func (gs *GRPCServer) Ping(ctx context.Context, req *pb.PingRequest) (*pb.PingResponse, error) {
+	if err := gs.sh.Ping(ctx); err != nil {
+		logger.Log.Error("shortener ping", zap.Error(err))
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &pb.PingResponse{}, nil
+}
+
+// withUserID checks that request is authenticated by [GRPCAuth.UnaryInterceptor].
+// Deprecated user_id of request is only accepted if it matches authenticated user.
+func withUserID(ctx context.Context, userID string) (context.Context, error) {
+	authUserID, ok := ctx.Value(model.UserIDKey{}).(string)
+	if !ok || authUserID == "" {
+		return ctx, status.Error(codes.Unauthenticated, "request is not authenticated")
+	}
+	if userID != "" && userID != authUserID {
+		return ctx, status.Error(codes.PermissionDenied, "user_id doesn't match token")
+	}
+	return ctx, nil
+}
+
+// statusError maps domain errors to gRPC status codes, unexpected errors are logged
+// and returned as Internal.
+func statusError(op string, err error) error {
+	var qe *shortener.QuotaError
+	if errors.As(err, &qe) {
+		logger.Log.Info(op, zap.Error(err))
+		return quotaError(qe)
+	}
+	if errors.Is(err, shortener.ErrHostBlocked) || errors.Is(err, shortener.ErrHostNotAllowed) {
+		logger.Log.Info(op, zap.Error(err))
+		return hostError(err)
+	}
+	var code codes.Code
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, storage.ErrDBConflict), errors.Is(err, storage.ErrIDConflict):
+		code = codes.AlreadyExists
+	case errors.Is(err, storage.ErrResultIsDeleted), errors.Is(err, storage.ErrResultIsExpired):
+		code = codes.FailedPrecondition
+	case errors.Is(err, shortener.ErrInvalidExpiration), errors.Is(err, shortener.ErrEmptyDeleteBatch),
+		errors.Is(err, shortener.ErrDeleteBatchTooLarge):
+		code = codes.InvalidArgument
+	case errors.Is(err, shortener.ErrUserIsNew):
+		code = codes.Unauthenticated
+	default:
+		logger.Log.Error(op, zap.Error(err))
+		return status.Error(codes.Internal, err.Error())
+	}
+	logger.Log.Debug(op, zap.Error(err))
+	return status.Error(code, err.Error())
+}
+
+// conflictError returns AlreadyExists status with the existing short URL
+// in [errdetails.ResourceInfo] details. Non-empty alias is reported as not created.
+func conflictError(shortURL string, alias string) error {
+	st := status.Newf(codes.AlreadyExists, "url is already shortened as %s", shortURL)
+	if alias != "" {
+		st = status.Newf(codes.AlreadyExists, "url is already shortened as %s, alias %s is not created",
+			shortURL, alias)
+	}
+	withDetails, err := st.WithDetails(&errdetails.ResourceInfo{
+		ResourceType: "short_url",
+		ResourceName: shortURL,
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// quotaError returns ResourceExhausted status with exceeded quota
+// in [errdetails.QuotaFailure] details.
+func quotaError(qe *shortener.QuotaError) error {
+	st := status.New(codes.ResourceExhausted, qe.Error())
+	withDetails, err := st.WithDetails(&errdetails.QuotaFailure{
+		Violations: []*errdetails.QuotaFailure_Violation{{
+			Subject:     qe.Quota,
+			Description: qe.Error(),
+		}},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// urlError returns InvalidArgument status with reason of rejection of URL
+// in [errdetails.ErrorInfo] details, see [validator.URLError].
+func urlError(err error) error {
+	reason := validator.ReasonSyntax
+	var urlErr *validator.URLError
+	if errors.As(err, &urlErr) {
+		reason = urlErr.Reason
+	}
+	st := status.New(codes.InvalidArgument, err.Error())
+	withDetails, detailsErr := st.WithDetails(&errdetails.ErrorInfo{Reason: reason})
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// hostError returns PermissionDenied status with the same error code as HTTP API
+// in [errdetails.ErrorInfo] details.
+func hostError(err error) error {
+	reason := ErrorCodeHostNotAllowed
+	if errors.Is(err, shortener.ErrHostBlocked) {
+		reason = ErrorCodeHostBlocked
+	}
+	st := status.New(codes.PermissionDenied, err.Error())
+	withDetails, detailsErr := st.WithDetails(&errdetails.ErrorInfo{Reason: reason})
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+func valueCounts(values []model.ValueCount) []*pb.ValueCount {
+	res := make([]*pb.ValueCount, 0, len(values))
+	for _, v := range values {
+		res = append(res, &pb.ValueCount{Value: v.Value, Count: int64(v.Count)})
+	}
+	return res
+}
+
+// ttlSeconds converts TTL to whole seconds. TTL shorter than second is rejected,
+// it would become zero that means URL never expires.
+func ttlSeconds(ttl *durationpb.Duration) (int64, error) {
+	d := ttl.AsDuration()
+	if d < 0 {
+		return 0, fmt.Errorf("ttl %s is negative. %w", d, shortener.ErrInvalidExpiration)
+	}
+	if d > 0 && d < time.Second {
+		return 0, fmt.Errorf("ttl %s is shorter than second. %w", d, shortener.ErrInvalidExpiration)
+	}
+	return int64(d / time.Second), nil
+}
+
+func timestampOrNil(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+// newClick creates click from the request metadata and peer address.
+func newClick(ctx context.Context, id string) model.Click {
+	var referrer, userAgent string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		referrer = firstValue(md, "referer")
+		userAgent = firstValue(md, "user-agent")
+	}
+	return model.NewClick(id, time.Now(), referrer, userAgent, peerIP(ctx))
+}
+
+// peerIP returns IP address of the client connection, empty if it is unknown.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	ip := p.Addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return ip
+}
+
+// isTrusted checks that client IP belongs to trusted subnet like [Server.isTrusted].
+// IP is taken from [RealIPHeader] metadata, or from the connection if metadata is absent.
+func (gs *GRPCServer) isTrusted(ctx context.Context) bool {
+	v := metadataValue(ctx, RealIPHeader)
+	if v == "" {
+		v = peerIP(ctx)
+	}
+	ip := net.ParseIP(v)
+	if ip == nil {
+		logger.Log.Debug(fmt.Sprintf("Bad client IP %s", v))
+		return false
+	}
+	ipNet := gs.conf.TrustedSubnetCIDR
+	if ipNet == nil {
+		logger.Log.Debug("SubNet param is empty")
+		return false
+	}
+	return ipNet.Contains(ip)
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) != 0 {
+		return v[0]
+	}
+	return ""
+}
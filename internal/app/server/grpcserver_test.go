@@ -9,14 +9,23 @@ import (
 	"github.com/denis-oreshkevich/shortener/internal/app/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestGRPCServer_CreateShortURL(t *testing.T) {
 	st := new(storage.MockedStorage)
 	sh := shortener.New(st)
-	delChannel := make(chan model.BatchDeleteEntry, 3)
-	server := NewGRPCServer(sh, config.Get(), delChannel)
+	server := NewGRPCServer(sh, config.Get())
+	userCtx := context.WithValue(context.Background(), model.UserIDKey{}, "Denis")
 
 	testCases := []struct {
 		name   string
@@ -31,8 +40,8 @@ func TestGRPCServer_CreateShortURL(t *testing.T) {
 				Url:    "http://testik.test",
 			},
 			mockOn: func(m *storage.MockedStorage) *mock.Call {
-				return m.On("SaveURL", mock.Anything, mock.Anything,
-					mock.Anything).Return("AAAAAAAA", nil)
+				return m.On("SaveURL", mock.Anything, mock.Anything, mock.Anything,
+					mock.Anything, mock.Anything).Return("AAAAAAAA", nil)
 			},
 			assert: func(resp *pb.CreateShortURLResponse, err error) {
 				assert.NoError(t, err)
@@ -46,34 +55,93 @@ func TestGRPCServer_CreateShortURL(t *testing.T) {
 				Url:    "http://testik.test",
 			},
 			mockOn: func(m *storage.MockedStorage) *mock.Call {
-				return m.On("SaveURL", mock.Anything, mock.Anything,
-					mock.Anything).Return("", storage.ErrDBConflict)
+				return m.On("SaveURL", mock.Anything, mock.Anything, mock.Anything,
+					mock.Anything, mock.Anything).Return("AAAAAAAA", storage.ErrDBConflict)
 			},
 			assert: func(resp *pb.CreateShortURLResponse, err error) {
-				assert.Error(t, err)
+				st, _ := status.FromError(err)
+				assert.Equal(t, codes.AlreadyExists, st.Code())
+				require.Len(t, st.Details(), 1)
+				info, ok := st.Details()[0].(*errdetails.ResourceInfo)
+				require.True(t, ok)
+				assert.Equal(t, "/AAAAAAAA", info.GetResourceName())
+			},
+		},
+		{
+			name: "Invalid url #3",
+			input: &pb.CreateShortURLRequest{
+				UserId: "Denis",
+				Url:    "testik",
+			},
+			assert: func(resp *pb.CreateShortURLResponse, err error) {
+				assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+		{
+			name: "Another user #4",
+			input: &pb.CreateShortURLRequest{
+				UserId: "Ivan",
+				Url:    "http://testik.test",
+			},
+			assert: func(resp *pb.CreateShortURLResponse, err error) {
+				assert.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+		{
+			name: "Sub-second TTL #5",
+			input: &pb.CreateShortURLRequest{
+				UserId: "Denis",
+				Url:    "http://testik.test",
+				Ttl:    durationpb.New(500 * time.Millisecond),
+			},
+			assert: func(resp *pb.CreateShortURLResponse, err error) {
+				assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+		{
+			name: "Alias of shortened url #6",
+			input: &pb.CreateShortURLRequest{
+				UserId: "Denis",
+				Url:    "http://testik.test",
+				Alias:  "late-alias",
+			},
+			mockOn: func(m *storage.MockedStorage) *mock.Call {
+				return m.On("SaveURLWithID", mock.Anything, mock.Anything, "late-alias", mock.Anything,
+					mock.Anything, mock.Anything, mock.Anything).Return("AAAAAAAA", storage.ErrDBConflict)
+			},
+			assert: func(resp *pb.CreateShortURLResponse, err error) {
+				st, _ := status.FromError(err)
+				assert.Equal(t, codes.AlreadyExists, st.Code())
+				assert.Contains(t, st.Message(), "alias late-alias is not created")
+				require.Len(t, st.Details(), 1)
+				info, ok := st.Details()[0].(*errdetails.ResourceInfo)
+				require.True(t, ok)
+				assert.Equal(t, "/AAAAAAAA", info.GetResourceName())
 			},
 		},
 	}
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
 
-			mockCall := tt.mockOn(st)
-			resp, err := server.CreateShortURL(context.Background(), tt.input)
+			if tt.mockOn != nil {
+				mockCall := tt.mockOn(st)
+				defer mockCall.Unset()
+			}
+			resp, err := server.CreateShortURL(userCtx, tt.input)
 			st.AssertExpectations(t)
-			mockCall.Unset()
 
 			tt.assert(resp, err)
 		})
 	}
 }
 
-func TestGRPCServer_GetByShort(t *testing.T) {
+func TestGRPCServer_GetOriginalURL(t *testing.T) {
 	st := new(storage.MockedStorage)
 	sh := shortener.New(st)
-	delChannel := make(chan model.BatchDeleteEntry, 3)
-	server := NewGRPCServer(sh, config.Get(), delChannel)
+	server := NewGRPCServer(sh, config.Get())
+	userCtx := context.WithValue(context.Background(), model.UserIDKey{}, "Denis")
 
-	origURL := &storage.OrigURL{OriginalURL: "BBBBBBBB"}
+	origURL := &storage.OrigURL{OriginalURL: "http://testik.test"}
 
 	testCases := []struct {
 		name   string
@@ -93,7 +161,7 @@ func TestGRPCServer_GetByShort(t *testing.T) {
 			},
 			assert: func(resp *pb.GetOriginalURLResponse, err error) {
 				assert.NoError(t, err)
-				assert.Equal(t, origURL, resp.OriginalUrl)
+				assert.Equal(t, origURL.OriginalURL, resp.OriginalUrl)
 			},
 		},
 		{
@@ -107,7 +175,20 @@ func TestGRPCServer_GetByShort(t *testing.T) {
 					Return(origURL, storage.ErrResultIsDeleted)
 			},
 			assert: func(resp *pb.GetOriginalURLResponse, err error) {
-				assert.Error(t, err)
+				assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+			},
+		},
+		{
+			name: "Not found #3",
+			input: &pb.GetOriginalURLRequest{
+				Url: "AAAAAAAA",
+			},
+			mockOn: func(m *storage.MockedStorage) *mock.Call {
+				return m.On("FindURL", mock.Anything, mock.Anything).
+					Return((*storage.OrigURL)(nil), storage.ErrNotFound)
+			},
+			assert: func(resp *pb.GetOriginalURLResponse, err error) {
+				assert.Equal(t, codes.NotFound, status.Code(err))
 			},
 		},
 	}
@@ -115,7 +196,7 @@ func TestGRPCServer_GetByShort(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 
 			mockCall := tt.mockOn(st)
-			resp, err := server.GetByShort(context.Background(), tt.input)
+			resp, err := server.GetOriginalURL(userCtx, tt.input)
 			st.AssertExpectations(t)
 			mockCall.Unset()
 
@@ -123,3 +204,151 @@ func TestGRPCServer_GetByShort(t *testing.T) {
 		})
 	}
 }
+
+func TestGRPCServer_DeleteUserURLsBatch(t *testing.T) {
+	st := new(storage.MockedStorage)
+	sh := shortener.New(st)
+	server := NewGRPCServer(sh, config.Get())
+	userCtx := context.WithValue(context.Background(), model.UserIDKey{}, "Denis")
+
+	testCases := []struct {
+		name   string
+		input  *pb.DeleteUserURLsBatchRequest
+		mockOn func(m *storage.MockedStorage) *mock.Call
+		assert func(resp *pb.DeleteUserURLsBatchResponse, err error)
+	}{
+		{
+			name: "Accepted #1",
+			input: &pb.DeleteUserURLsBatchRequest{
+				UserId: "Denis",
+				Urls:   []string{"AAAAAAAA"},
+			},
+			mockOn: func(m *storage.MockedStorage) *mock.Call {
+				return m.On("SaveDeleteJob", mock.Anything, mock.Anything).Return(nil)
+			},
+			assert: func(resp *pb.DeleteUserURLsBatchResponse, err error) {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, resp.GetJobId())
+			},
+		},
+		{
+			name: "Empty batch #2",
+			input: &pb.DeleteUserURLsBatchRequest{
+				UserId: "Denis",
+			},
+			assert: func(resp *pb.DeleteUserURLsBatchResponse, err error) {
+				assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mockOn != nil {
+				mockCall := tt.mockOn(st)
+				defer mockCall.Unset()
+			}
+			resp, err := server.DeleteUserURLsBatch(userCtx, tt.input)
+			st.AssertExpectations(t)
+
+			tt.assert(resp, err)
+		})
+	}
+}
+
+func TestGRPCServer_BatchCreateShortURL_Quota(t *testing.T) {
+	st := new(storage.MockedStorage)
+	sh := shortener.New(st)
+	sh.SetQuota(shortener.Quota{MaxActive: 2, MaxBatch: 2})
+	server := NewGRPCServer(sh, config.Get())
+	userCtx := context.WithValue(context.Background(), model.UserIDKey{}, "Denis")
+	st.On("SaveURLBatch", mock.Anything, "Denis", mock.Anything).
+		Return([]model.BatchRespEntry(nil), &storage.LimitError{Limit: 2, Used: 1, Requested: 2})
+
+	testCases := []struct {
+		name    string
+		records int
+		subject string
+	}{
+		{name: "batch too large #1", records: 3, subject: shortener.QuotaBatch},
+		{name: "active exceeded #2", records: 2, subject: shortener.QuotaActive},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &pb.BatchCreateShortURLRequest{UserId: "Denis"}
+			for i := 0; i < tt.records; i++ {
+				req.Records = append(req.Records, &pb.BatchCreateShortURLRequestData{
+					CorrelationId: "id",
+					OriginalUrl:   "http://testik.test",
+				})
+			}
+			_, err := server.BatchCreateShortURL(userCtx, req)
+			s, _ := status.FromError(err)
+			assert.Equal(t, codes.ResourceExhausted, s.Code())
+			require.Len(t, s.Details(), 1)
+			failure, ok := s.Details()[0].(*errdetails.QuotaFailure)
+			require.True(t, ok)
+			assert.Equal(t, tt.subject, failure.GetViolations()[0].GetSubject())
+		})
+	}
+	st.AssertNumberOfCalls(t, "SaveURLBatch", 1)
+}
+
+func TestTTLSeconds(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     *durationpb.Duration
+		want    int64
+		wantErr bool
+	}{
+		{name: "absent #1", ttl: nil, want: 0},
+		{name: "whole seconds #2", ttl: durationpb.New(time.Minute), want: 60},
+		{name: "fraction is dropped #3", ttl: durationpb.New(1500 * time.Millisecond), want: 1},
+		{name: "sub-second #4", ttl: durationpb.New(500 * time.Millisecond), wantErr: true},
+		{name: "negative sub-second #5", ttl: durationpb.New(-500 * time.Millisecond), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ttlSeconds(tt.ttl)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, shortener.ErrInvalidExpiration)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGRPCServer_GetStats(t *testing.T) {
+	st := new(storage.MockedStorage)
+	st.On("FindStats", mock.Anything).Return(model.Stat{URLs: 3, Users: 2}, nil)
+	conf := config.Get()
+	_, conf.TrustedSubnetCIDR, _ = net.ParseCIDR("10.0.0.0/8")
+	server := NewGRPCServer(shortener.New(st), conf)
+	fromPeer := func(ip string) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1}})
+	}
+
+	testCases := []struct {
+		name     string
+		ctx      context.Context
+		wantCode codes.Code
+	}{
+		{name: "trusted peer #1", ctx: fromPeer("10.1.2.3"), wantCode: codes.OK},
+		{name: "untrusted peer #2", ctx: fromPeer("192.168.1.1"), wantCode: codes.PermissionDenied},
+		{name: "trusted real IP #3", ctx: metadata.NewIncomingContext(fromPeer("192.168.1.1"),
+			metadata.Pairs(RealIPHeader, "10.0.0.1")), wantCode: codes.OK},
+		{name: "untrusted real IP #4", ctx: metadata.NewIncomingContext(fromPeer("10.1.2.3"),
+			metadata.Pairs(RealIPHeader, "192.168.1.1")), wantCode: codes.PermissionDenied},
+		{name: "unknown client #5", ctx: context.Background(), wantCode: codes.PermissionDenied},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := server.GetStats(tt.ctx, &pb.ServiceStatsRequest{})
+			require.Equal(t, tt.wantCode, status.Code(err))
+			if err == nil {
+				assert.Equal(t, int64(3), resp.GetUrls())
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/config"
+	pb "github.com/denis-oreshkevich/shortener/internal/app/server/proto"
+	"github.com/denis-oreshkevich/shortener/internal/app/shortener"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/auth"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func newStreamTestClient(t *testing.T) pb.ShortenerClient {
+	lis := bufconn.Listen(1 << 20)
+	sh := shortener.New(storage.NewMapStorage(generator.DefaultIDGenerator()))
+	gAuth := NewGRPCAuth(sh)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(gAuth.UnaryInterceptor),
+		grpc.ChainStreamInterceptor(gAuth.StreamInterceptor),
+	)
+	pb.RegisterShortenerServer(srv, NewGRPCServer(sh, config.Get()))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewShortenerClient(conn)
+}
+
+func TestGRPCServer_Streams(t *testing.T) {
+	client := newStreamTestClient(t)
+	token, err := auth.GenerateToken()
+	require.NoError(t, err)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), AuthorizationMD, "Bearer "+token)
+
+	const total = streamChunkSize + 10
+	create, err := client.StreamCreateShortURL(ctx)
+	require.NoError(t, err)
+	for i := 0; i < total; i++ {
+		err = create.Send(&pb.BatchCreateShortURLRequestData{
+			CorrelationId: fmt.Sprint(i),
+			OriginalUrl:   fmt.Sprintf("http://testik%d.test", i),
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, create.Send(&pb.BatchCreateShortURLRequestData{
+		CorrelationId: "invalid",
+		OriginalUrl:   "not a url",
+	}))
+	require.NoError(t, create.CloseSend())
+
+	created := make(map[string]bool)
+	var rejected []string
+	for {
+		res, err := create.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if res.GetError() != "" {
+			rejected = append(rejected, res.GetCorrelationId())
+			continue
+		}
+		created[res.GetShortUrl()] = true
+	}
+	assert.Len(t, created, total)
+	assert.Equal(t, []string{"invalid"}, rejected)
+
+	list, err := client.StreamUserURLs(ctx, &pb.StreamUserURLsRequest{PageSize: 200})
+	require.NoError(t, err)
+	var pages int
+	listed := make(map[string]bool)
+	for {
+		res, err := list.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		pages++
+		assert.LessOrEqual(t, len(res.GetRecords()), 200)
+		for _, r := range res.GetRecords() {
+			listed[r.GetShortUrl()] = true
+		}
+	}
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, created, listed)
+}
+
+func TestGRPCServer_streamEntry(t *testing.T) {
+	gs := NewGRPCServer(shortener.New(storage.NewMapStorage(generator.DefaultIDGenerator())), config.Get())
+
+	entry, reason := gs.streamEntry(&pb.BatchCreateShortURLRequestData{
+		CorrelationId: "1",
+		OriginalUrl:   "http://ttl.test",
+		Ttl:           durationpb.New(time.Minute),
+	})
+	require.Empty(t, reason)
+	assert.Equal(t, int64(60), entry.TTL, "TTL counts from the moment chunk is saved")
+	assert.Nil(t, entry.ExpiresAt)
+
+	_, reason = gs.streamEntry(&pb.BatchCreateShortURLRequestData{
+		CorrelationId: "2",
+		OriginalUrl:   "http://ttl.test",
+		ExpiresAt:     timestamppb.New(time.Now().Add(-time.Minute)),
+	})
+	assert.NotEmpty(t, reason, "expiration in the past")
+}
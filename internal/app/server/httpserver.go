@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/denis-oreshkevich/shortener/internal/app/config"
+	"github.com/denis-oreshkevich/shortener/internal/app/metrics"
 	"github.com/denis-oreshkevich/shortener/internal/app/model"
 	"github.com/denis-oreshkevich/shortener/internal/app/shortener"
 	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/auth"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/validator"
 	"github.com/gin-gonic/gin"
@@ -15,6 +17,8 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // Content-type constants
@@ -22,29 +26,50 @@ const (
 	ContentType     = "Content-type"
 	TextPlain       = "text/plain; charset=utf-8"
 	ApplicationJSON = "application/json; charset=utf-8"
+	ApplicationGRPC = "application/grpc"
 
 	RealIPHeader = "X-REAL-IP"
 )
 
+// Codes of errors returned in [ErrorModel]. Rejected URLs are described
+// by reasons of [validator.URLError].
+const (
+	ErrorCodeHostBlocked    = "host_blocked"
+	ErrorCodeHostNotAllowed = "host_not_allowed"
+	// ErrorCodeAliasNotCreated alias is not created because URL is already shortened,
+	// see [AliasConflictModel].
+	ErrorCodeAliasNotCreated = "alias_not_created"
+)
+
 // Server structure represents holder for all handlers.
 type Server struct {
-	conf       config.Conf
-	sh         *shortener.Shortener
-	delChannel chan model.BatchDeleteEntry
+	conf    config.Conf
+	sh      *shortener.Shortener
+	limiter *RateLimiter
 }
 
 // New creates new [Server].
-func New(conf config.Conf, sh *shortener.Shortener,
-	delChannel chan model.BatchDeleteEntry) *Server {
+func New(conf config.Conf, sh *shortener.Shortener) *Server {
 	inst := &Server{
-		conf:       conf,
-		sh:         sh,
-		delChannel: delChannel,
+		conf:    conf,
+		sh:      sh,
+		limiter: NewRateLimiter(conf, sh),
 	}
 	return inst
 }
 
+// RateLimiter returns rate limiter of the server, gRPC server should share it.
+func (s Server) RateLimiter() *RateLimiter {
+	return s.limiter
+}
+
+// RateLimit rejects requests of route class over the limit, see [RateLimiter.Limit].
+func (s Server) RateLimit(class string) gin.HandlerFunc {
+	return s.limiter.Limit(class)
+}
+
 // Post used method to save URL and returns short URL.
+// Optional query parameters ttl (in seconds) and expires_at (RFC 3339) set URL expiration.
 func (s Server) Post(c *gin.Context) {
 	req := c.Request
 	body, err := io.ReadAll(req.Body)
@@ -53,14 +78,19 @@ func (s Server) Post(c *gin.Context) {
 		c.String(http.StatusBadRequest, "Ошибка при чтении тела запроса")
 		return
 	}
-	bodyURL := string(body)
-	if !validator.URL(bodyURL) {
-		logger.Log.Warn(fmt.Sprintf("validate URL %s", bodyURL))
-		c.String(http.StatusBadRequest, "Ошибка при валидации тела запроса")
+	bodyURL, err := validator.URL(string(body))
+	if err != nil {
+		abortURLError(c, err)
+		return
+	}
+	expiresAt, err := queryExpiresAt(c)
+	if err != nil {
+		logger.Log.Warn("validate expiration", zap.Error(err))
+		c.String(http.StatusBadRequest, "Ошибка при валидации срока действия")
 		return
 	}
 	ctx := c.Request.Context()
-	id, err := s.sh.SaveURL(ctx, bodyURL)
+	id, err := s.sh.SaveURL(ctx, bodyURL, expiresAt)
 	if err != nil {
 		if errors.Is(err, storage.ErrDBConflict) {
 			logger.Log.Info(fmt.Sprintf("saveURL conflict on original url = %s", bodyURL))
@@ -68,6 +98,9 @@ func (s Server) Post(c *gin.Context) {
 			c.String(http.StatusConflict, url)
 			return
 		}
+		if abortQuotaError(c, err) || abortHostError(c, err) {
+			return
+		}
 		logger.Log.Error("saveURL", zap.Error(err))
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
@@ -78,6 +111,7 @@ func (s Server) Post(c *gin.Context) {
 
 // Get method used to get original URL by short URL.
 // If short URL is not valid returns Bad Request status (400).
+// If URL is deleted or expired returns Gone status (410).
 // If everything is fine redirects the request with Temporary Redirect status (307).
 func (s Server) Get(c *gin.Context) {
 	id := c.Param("id")
@@ -95,10 +129,17 @@ func (s Server) Get(c *gin.Context) {
 			c.AbortWithStatus(http.StatusGone)
 			return
 		}
+		if errors.Is(err, storage.ErrResultIsExpired) {
+			log.Debug("record is expired", zap.Error(err))
+			c.AbortWithStatus(http.StatusGone)
+			return
+		}
 		log.Error("findURL", zap.Error(err))
 		c.String(http.StatusBadRequest, "Не найдено сохраненного URL")
 		return
 	}
+	s.sh.TrackClick(model.NewClick(id, time.Now(), c.Request.Referer(),
+		c.Request.UserAgent(), c.ClientIP()))
 	c.Header(ContentType, TextPlain)
 	c.Redirect(http.StatusTemporaryRedirect, url)
 }
@@ -135,8 +176,45 @@ func (s Server) GetUsersURLs(c *gin.Context) {
 	c.Data(http.StatusOK, ApplicationJSON, resp)
 }
 
+// GetURLStats returns click statistic of user's short URL.
+// If user is new returns Unauthorized status (401).
+// If URL doesn't exist or belongs to another user returns Not Found status (404).
+func (s Server) GetURLStats(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	if !validator.ID(id) {
+		logger.Log.Debug(fmt.Sprintf("validate ID %s", id))
+		c.String(http.StatusBadRequest, "Ошибка при валидации параметра id")
+		return
+	}
+	stats, err := s.sh.FindClickStats(ctx, id)
+	if err != nil {
+		if errors.Is(err, shortener.ErrUserIsNew) {
+			logger.Log.Debug("user is new")
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, storage.ErrNotFound) {
+			logger.Log.Debug("URL is not found", zap.String("id", id))
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		logger.Log.Error("findClickStats", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	resp, err := json.Marshal(stats)
+	if err != nil {
+		logger.Log.Error("marshal response", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Data(http.StatusOK, ApplicationJSON, resp)
+}
+
 // ShortenPost saves the URL and return result in JSON format with status OK (200).
-// Returns status Conflict (409) if URL already exist.
+// Returns status Conflict (409) if URL already exist or requested alias is taken.
+// If alias is present in request it's used as short ID.
 // This method is similar in purpose with [Server.Post].
 func (s Server) ShortenPost(c *gin.Context) {
 	req := c.Request
@@ -152,18 +230,46 @@ func (s Server) ShortenPost(c *gin.Context) {
 		c.String(http.StatusBadRequest, "Ошибка при десериализации из json")
 		return
 	}
-	if !validator.URL(um.URL) {
-		logger.Log.Warn(fmt.Sprintf("validate URL %s", um.URL))
-		c.String(http.StatusBadRequest, "Ошибка при валидации url")
+	if um.URL, err = validator.URL(um.URL); err != nil {
+		abortURLError(c, err)
 		return
 	}
-	id, err := s.sh.SaveURL(req.Context(), um.URL)
+	expiresAt, err := shortener.ExpiresAt(time.Now(), um.TTL, um.ExpiresAt)
 	if err != nil {
+		logger.Log.Warn("validate expiration", zap.Error(err))
+		c.String(http.StatusBadRequest, "Ошибка при валидации срока действия")
+		return
+	}
+	var id string
+	if um.Alias != "" {
+		if !validator.Alias(um.Alias) {
+			logger.Log.Warn(fmt.Sprintf("validate alias %s", um.Alias))
+			c.String(http.StatusBadRequest, "Ошибка при валидации alias")
+			return
+		}
+		id, err = s.sh.SaveURLWithID(req.Context(), um.Alias, um.URL, expiresAt)
+	} else {
+		id, err = s.sh.SaveURL(req.Context(), um.URL, expiresAt)
+	}
+	if err != nil {
+		if errors.Is(err, shortener.ErrAliasNotCreated) {
+			logger.Log.Info(fmt.Sprintf("alias %s is not created for shortened url = %s", um.Alias, um.URL))
+			s.sendAliasConflictResp(c, id, um.Alias)
+			return
+		}
 		if errors.Is(err, storage.ErrDBConflict) {
 			logger.Log.Info(fmt.Sprintf("saveURL conflict on original url = %s", um.URL))
 			s.sendJSONResultResp(c, id, http.StatusConflict)
 			return
 		}
+		if errors.Is(err, storage.ErrIDConflict) {
+			logger.Log.Info(fmt.Sprintf("saveURL conflict on alias = %s", um.Alias))
+			c.String(http.StatusConflict, "Alias уже занят")
+			return
+		}
+		if abortQuotaError(c, err) || abortHostError(c, err) {
+			return
+		}
 		logger.Log.Error("saveURL", zap.Error(err))
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
@@ -184,6 +290,33 @@ func (s Server) Ping(c *gin.Context) {
 	c.AbortWithStatus(http.StatusOK)
 }
 
+// Healthz liveness probe. Returns status OK (200) if background workers are running
+// and Service Unavailable (503) otherwise.
+func (s Server) Healthz(c *gin.Context) {
+	writeHealth(c, s.sh.Liveness(c.Request.Context()))
+}
+
+// Readyz readiness probe. Returns status OK (200) if service can serve requests
+// and Service Unavailable (503) otherwise, e.g. when shutdown has begun.
+func (s Server) Readyz(c *gin.Context) {
+	writeHealth(c, s.sh.Readiness(c.Request.Context()))
+}
+
+func writeHealth(c *gin.Context, h model.Health) {
+	resp, err := json.Marshal(h)
+	if err != nil {
+		logger.Log.Error("json.Marshal", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	status := http.StatusOK
+	if !h.OK() {
+		logger.Log.Warn("health check failed", zap.Any("checks", h.Checks))
+		status = http.StatusServiceUnavailable
+	}
+	c.Data(status, ApplicationJSON, resp)
+}
+
 // NoRoute method used when no routes with this path or method were foundЮ
 func (s Server) NoRoute(c *gin.Context) {
 	c.Data(http.StatusBadRequest, TextPlain, []byte("Роут не найден"))
@@ -210,8 +343,17 @@ func (s Server) ShortenBatch(c *gin.Context) {
 		c.String(http.StatusBadRequest, "Длина батча равна 0")
 		return
 	}
+	for i, e := range batch {
+		if batch[i].OriginalURL, err = validator.URL(e.OriginalURL); err != nil {
+			abortURLError(c, fmt.Errorf("entry %s: %w", e.CorrelationID, err))
+			return
+		}
+	}
 	respEntries, err := s.sh.SaveURLBatch(req.Context(), batch)
 	if err != nil {
+		if abortQuotaError(c, err) || abortHostError(c, err) {
+			return
+		}
 		logger.Log.Error("saveURLBatch", zap.Error(err))
 		c.String(http.StatusBadRequest, "Ошибка при сохранении данных")
 		return
@@ -225,58 +367,431 @@ func (s Server) ShortenBatch(c *gin.Context) {
 	c.Data(http.StatusCreated, ApplicationJSON, resp)
 }
 
-// DeleteURLs method works async. So the values are not removed instantly.
-// It sets delete status for URL.
+// DeleteURLs accepts request to delete URLs of current user.
+// Deletion is done asynchronously, returns status Accepted (202) with ID of the delete job
+// and URL to check its status.
 func (s Server) DeleteURLs(c *gin.Context) {
 	req := c.Request
 	ctx := c.Request.Context()
-	userID, userErr := s.sh.GetUserID(ctx)
-	body, bodyErr := io.ReadAll(req.Body)
-	f := func() {
-		if userErr != nil {
-			logger.Log.Error("get userID", zap.Error(userErr))
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		logger.Log.Error("readAll", zap.Error(err))
+		c.String(http.StatusBadRequest, "Ошибка при чтении тела запроса")
+		return
+	}
+	var batch []string
+	if err = json.Unmarshal(body, &batch); err != nil {
+		logger.Log.Error("unmarshal", zap.Error(err))
+		c.String(http.StatusBadRequest, "Ошибка при десериализации из json")
+		return
+	}
+	job, err := s.sh.SubmitDelete(ctx, batch)
+	if err != nil {
+		if errors.Is(err, shortener.ErrEmptyDeleteBatch) {
+			logger.Log.Warn("batch len = 0")
+			c.String(http.StatusBadRequest, "Пустой список для удаления")
+			return
+		}
+		if errors.Is(err, shortener.ErrDeleteBatchTooLarge) {
+			logger.Log.Warn("submitDelete", zap.Error(err))
+			c.String(http.StatusBadRequest, "Слишком большой список для удаления")
 			return
 		}
+		logger.Log.Error("submitDelete", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	statusURL := fmt.Sprintf("%s/api/user/urls/delete-jobs/%s", s.conf.BaseURL(), job.ID)
+	resp, err := json.Marshal(NewDeleteAccepted(job.ID, statusURL))
+	if err != nil {
+		logger.Log.Error("marshal response", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Header("Location", statusURL)
+	c.Data(http.StatusAccepted, ApplicationJSON, resp)
+}
 
-		if bodyErr != nil {
-			logger.Log.Error("readAll", zap.Error(bodyErr))
+// GetDeleteJob returns status of delete job with outcome of every short URL.
+// If user is new returns Unauthorized status (401).
+// If job doesn't exist or belongs to another user returns Not Found status (404).
+func (s Server) GetDeleteJob(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	job, err := s.sh.FindDeleteJob(ctx, id)
+	if err != nil {
+		if errors.Is(err, shortener.ErrUserIsNew) {
+			logger.Log.Debug("user is new")
+			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
-		var batch []string
-		if err := json.Unmarshal(body, &batch); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			logger.Log.Debug("delete job is not found", zap.String("id", id))
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		logger.Log.Error("findDeleteJob", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	resp, err := json.Marshal(job)
+	if err != nil {
+		logger.Log.Error("marshal response", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Data(http.StatusOK, ApplicationJSON, resp)
+}
+
+// GetQuota returns usage of current user's quotas, zero limit means no limit.
+func (s Server) GetQuota(c *gin.Context) {
+	usage, err := s.sh.FindQuotaUsage(c.Request.Context())
+	if err != nil {
+		logger.Log.Error("findQuotaUsage", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	resp, err := json.Marshal(usage)
+	if err != nil {
+		logger.Log.Error("marshal response", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Data(http.StatusOK, ApplicationJSON, resp)
+}
+
+// abortURLError responds with Bad Request status (400) and reason of rejection of URL
+// as error code, see [validator.URLError].
+func abortURLError(c *gin.Context, err error) {
+	logger.Log.Info("URL is rejected", zap.Error(err))
+	code := validator.ReasonSyntax
+	var urlErr *validator.URLError
+	if errors.As(err, &urlErr) {
+		code = urlErr.Reason
+	}
+	resp, err := json.Marshal(NewError(err.Error(), code))
+	if err != nil {
+		logger.Log.Error("marshal response", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Data(http.StatusBadRequest, ApplicationJSON, resp)
+}
+
+// abortHostError responds with Unprocessable Entity status (422) and error code
+// if host of URL is blocked or not allowed.
+func abortHostError(c *gin.Context, err error) bool {
+	var code string
+	switch {
+	case errors.Is(err, shortener.ErrHostBlocked):
+		code = ErrorCodeHostBlocked
+	case errors.Is(err, shortener.ErrHostNotAllowed):
+		code = ErrorCodeHostNotAllowed
+	default:
+		return false
+	}
+	logger.Log.Info("host is rejected", zap.Error(err))
+	resp, err := json.Marshal(NewError(err.Error(), code))
+	if err != nil {
+		logger.Log.Error("marshal response", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return true
+	}
+	c.Data(http.StatusUnprocessableEntity, ApplicationJSON, resp)
+	return true
+}
+
+// abortQuotaError responds with description of exceeded quota if err is [*shortener.QuotaError].
+// Too large batch is rejected with Forbidden status (403), other quotas with Too Many Requests (429).
+func abortQuotaError(c *gin.Context, err error) bool {
+	var qe *shortener.QuotaError
+	if !errors.As(err, &qe) {
+		return false
+	}
+	logger.Log.Info("quota exceeded", zap.Error(err))
+	status := http.StatusTooManyRequests
+	if errors.Is(err, shortener.ErrBatchTooLarge) {
+		status = http.StatusForbidden
+	}
+	resp, err := json.Marshal(NewQuotaError(qe))
+	if err != nil {
+		logger.Log.Error("marshal response", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return true
+	}
+	c.Data(status, ApplicationJSON, resp)
+	return true
+}
+
+// CreateAPIKey creates API key of current user and returns it with status Created (201).
+// The key is shown only in this response.
+// If user is new returns Unauthorized status (401),
+// if request is authenticated by API key returns Forbidden status (403).
+func (s Server) CreateAPIKey(c *gin.Context) {
+	ctx := c.Request.Context()
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		logger.Log.Error("readAll", zap.Error(err))
+		c.String(http.StatusBadRequest, "Ошибка при чтении тела запроса")
+		return
+	}
+	var req APIKeyRequestModel
+	if len(body) != 0 {
+		if err = json.Unmarshal(body, &req); err != nil {
 			logger.Log.Error("unmarshal", zap.Error(err))
+			c.String(http.StatusBadRequest, "Ошибка при десериализации из json")
 			return
 		}
-		if len(batch) == 0 {
-			logger.Log.Warn("batch len = 0")
+	}
+	apiKey, key, err := s.sh.CreateAPIKey(ctx, req.Name, req.Scopes)
+	if err != nil {
+		if errors.Is(err, shortener.ErrInvalidAPIKeyRequest) {
+			logger.Log.Debug("validate API key request", zap.Error(err))
+			c.String(http.StatusBadRequest, "Ошибка при валидации тела запроса")
 			return
 		}
-		entry := model.NewBatchDeleteEntry(userID, batch)
-		logger.Log.Debug("send to delChannel")
-		s.delChannel <- entry
+		s.abortAPIKeyError(c, "createAPIKey", err)
+		return
 	}
-	go f()
-	c.AbortWithStatus(http.StatusAccepted)
+	resp, err := json.Marshal(NewAPIKeyCreated(apiKey, key))
+	if err != nil {
+		logger.Log.Error("marshal response", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Data(http.StatusCreated, ApplicationJSON, resp)
 }
 
-// GetAPIInternalStats get statistics by shorten request and users.
-func (s Server) GetAPIInternalStats(c *gin.Context) {
+// GetAPIKeys returns API keys of current user without the keys themselves.
+// If user has no keys returns No Content status (204).
+func (s Server) GetAPIKeys(c *gin.Context) {
 	ctx := c.Request.Context()
-	h := c.Request.Header.Get(RealIPHeader)
-	ip := net.ParseIP(h)
-	if ip == nil {
-		logger.Log.Debug(fmt.Sprintf("Bad IP header %s", h))
-		c.AbortWithStatus(http.StatusForbidden)
+	keys, err := s.sh.FindUserAPIKeys(ctx)
+	if err != nil {
+		s.abortAPIKeyError(c, "findUserAPIKeys", err)
 		return
 	}
-	ipNet := s.conf.TrustedSubnetCIDR
-	if ipNet == nil {
-		logger.Log.Debug("SubNet param is empty")
+	if len(keys) == 0 {
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	resp, err := json.Marshal(keys)
+	if err != nil {
+		logger.Log.Error("marshal response", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Data(http.StatusOK, ApplicationJSON, resp)
+}
+
+// DeleteAPIKey revokes API key of current user and returns No Content status (204).
+// If key doesn't exist or belongs to another user returns Not Found status (404).
+func (s Server) DeleteAPIKey(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	err := s.sh.DeleteAPIKey(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			logger.Log.Debug("API key is not found", zap.String("id", id))
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		s.abortAPIKeyError(c, "deleteAPIKey", err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// abortAPIKeyError aborts request to manage API keys with status matching err.
+func (s Server) abortAPIKeyError(c *gin.Context, op string, err error) {
+	switch {
+	case errors.Is(err, shortener.ErrUserIsNew):
+		logger.Log.Debug("user is new")
+		c.AbortWithStatus(http.StatusUnauthorized)
+	case errors.Is(err, shortener.ErrSessionRequired):
+		logger.Log.Debug("API keys are managed only with session")
 		c.AbortWithStatus(http.StatusForbidden)
+	default:
+		logger.Log.Error(op, zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+	}
+}
+
+// Register creates account and starts its session, returns status Created (201).
+// URLs of current anonymous user are moved to the account.
+// If email is already registered returns Conflict status (409).
+func (s Server) Register(c *gin.Context) {
+	creds, ok := bindCredentials(c)
+	if !ok {
 		return
 	}
-	if !ipNet.Contains(ip) {
-		logger.Log.Debug(fmt.Sprintf("SubNet not contains this ip %v", ip))
+	user, err := s.sh.Register(c.Request.Context(), creds.Email, creds.Password)
+	if err != nil {
+		if errors.Is(err, shortener.ErrInvalidAccount) {
+			logger.Log.Debug("validate account", zap.Error(err))
+			c.String(http.StatusBadRequest, "Ошибка при валидации тела запроса")
+			return
+		}
+		if errors.Is(err, storage.ErrEmailTaken) {
+			logger.Log.Debug("email is taken")
+			c.AbortWithStatus(http.StatusConflict)
+			return
+		}
+		logger.Log.Error("register", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	s.startSession(c, user, http.StatusCreated)
+}
+
+// Login starts session of account, returns status OK (200).
+// URLs of current anonymous user are moved to the account.
+// If email or password is wrong returns Unauthorized status (401).
+func (s Server) Login(c *gin.Context) {
+	creds, ok := bindCredentials(c)
+	if !ok {
+		return
+	}
+	user, err := s.sh.Login(c.Request.Context(), creds.Email, creds.Password)
+	if err != nil {
+		if errors.Is(err, shortener.ErrInvalidCredentials) {
+			logger.Log.Debug("invalid credentials")
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		logger.Log.Error("login", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	s.startSession(c, user, http.StatusOK)
+}
+
+func bindCredentials(c *gin.Context) (CredentialsModel, bool) {
+	var creds CredentialsModel
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		logger.Log.Error("readAll", zap.Error(err))
+		c.String(http.StatusBadRequest, "Ошибка при чтении тела запроса")
+		return creds, false
+	}
+	if err = json.Unmarshal(body, &creds); err != nil {
+		logger.Log.Error("unmarshal", zap.Error(err))
+		c.String(http.StatusBadRequest, "Ошибка при десериализации из json")
+		return creds, false
+	}
+	return creds, true
+}
+
+// startSession issues session of the account in cookies and in response body.
+func (s Server) startSession(c *gin.Context, user model.User, status int) {
+	sess, err := auth.NewSession(user.ID, true)
+	if err != nil {
+		logger.Log.Error("newSession", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	resp, err := json.Marshal(NewAccount(user, sess.Access, sess.Refresh))
+	if err != nil {
+		logger.Log.Error("marshal response", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	s.setSessionCookies(c, sess)
+	c.Data(status, ApplicationJSON, resp)
+}
+
+// Refresh exchanges refresh token for new session tokens, returns status OK (200).
+// Refresh token is taken from request body or from refresh cookie and can be used only once.
+// If refresh token is absent, invalid or already used returns Unauthorized status (401).
+func (s Server) Refresh(c *gin.Context) {
+	token, ok := bindRefreshToken(c)
+	if !ok {
+		return
+	}
+	var sess auth.Session
+	if v, rotated := c.Get(rotatedSessionKey); rotated && token == "" {
+		// refresh cookie is already exchanged by Auth middleware
+		sess = v.(auth.Session)
+	} else {
+		if token == "" {
+			token, _ = c.Cookie(RefreshCookieName)
+		}
+		var err error
+		sess, err = s.sh.RefreshSession(c.Request.Context(), token)
+		if err != nil {
+			if errors.Is(err, shortener.ErrInvalidSession) {
+				logger.Log.Debug("refresh session", zap.Error(err))
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+			logger.Log.Error("refreshSession", zap.Error(err))
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+	resp, err := json.Marshal(NewSession(sess.Access, sess.Refresh))
+	if err != nil {
+		logger.Log.Error("marshal response", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	s.setSessionCookies(c, sess)
+	c.Data(http.StatusOK, ApplicationJSON, resp)
+}
+
+// Logout revokes access token of the request and refresh token from request body
+// or from refresh cookie, clears session cookies and returns status No Content (204).
+// Requests authenticated by API key are rejected with Forbidden status (403).
+func (s Server) Logout(c *gin.Context) {
+	token, ok := bindRefreshToken(c)
+	if !ok {
+		return
+	}
+	if v, rotated := c.Get(rotatedSessionKey); rotated && token == "" {
+		token = v.(auth.Session).Refresh
+	} else if token == "" {
+		token, _ = c.Cookie(RefreshCookieName)
+	}
+	claims, _ := c.Get(claimsKey)
+	access, _ := claims.(*auth.Claims)
+	if err := s.sh.Logout(c.Request.Context(), access, token); err != nil {
+		if errors.Is(err, shortener.ErrSessionRequired) {
+			logger.Log.Debug("logout with API key")
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		logger.Log.Error("logout", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	s.clearSessionCookies(c)
+	c.Status(http.StatusNoContent)
+}
+
+// bindRefreshToken returns refresh token from optional request body.
+func bindRefreshToken(c *gin.Context) (string, bool) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		logger.Log.Error("readAll", zap.Error(err))
+		c.String(http.StatusBadRequest, "Ошибка при чтении тела запроса")
+		return "", false
+	}
+	if len(body) == 0 {
+		return "", true
+	}
+	var req RefreshRequestModel
+	if err = json.Unmarshal(body, &req); err != nil {
+		logger.Log.Error("unmarshal", zap.Error(err))
+		c.String(http.StatusBadRequest, "Ошибка при десериализации из json")
+		return "", false
+	}
+	return req.RefreshToken, true
+}
+
+// GetAPIInternalStats get statistics by shorten request and users.
+func (s Server) GetAPIInternalStats(c *gin.Context) {
+	ctx := c.Request.Context()
+	if !s.isTrusted(c) {
 		c.AbortWithStatus(http.StatusForbidden)
 		return
 	}
@@ -295,6 +810,123 @@ func (s Server) GetAPIInternalStats(c *gin.Context) {
 	c.Data(http.StatusOK, ApplicationJSON, resp)
 }
 
+// Compact compacts storage on demand.
+func (s Server) Compact(c *gin.Context) {
+	ctx := c.Request.Context()
+	if !s.isTrusted(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	err := s.sh.Compact(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrCompactNotSupported) {
+			logger.Log.Debug("storage is not compactable")
+			c.AbortWithStatus(http.StatusNotImplemented)
+			return
+		}
+		logger.Log.Error("sh.Compact", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// RecheckURLs disables saved URLs whose hosts are in the current blocklist
+// and returns amount of checked and disabled URLs. Allowed for trusted subnet only.
+func (s Server) RecheckURLs(c *gin.Context) {
+	if !s.isTrusted(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	res, err := s.sh.RecheckBlockedURLs(c.Request.Context())
+	if err != nil {
+		logger.Log.Error("sh.RecheckBlockedURLs", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	resp, err := json.Marshal(res)
+	if err != nil {
+		logger.Log.Error("marshal response", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Data(http.StatusOK, ApplicationJSON, resp)
+}
+
+// Metrics exposes service metrics in Prometheus format to trusted subnet.
+func (s Server) Metrics(c *gin.Context) {
+	if !s.isTrusted(c) {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	metrics.Handler().ServeHTTP(c.Writer, c.Request)
+}
+
+// JWKS publishes public keys that verify issued JWT, so other services can validate them.
+func (s Server) JWKS(c *gin.Context) {
+	resp, err := json.Marshal(auth.Keys().JWKS())
+	if err != nil {
+		logger.Log.Error("json.Marshal", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Data(http.StatusOK, ApplicationJSON, resp)
+}
+
+// isTrusted checks that client IP from [RealIPHeader] belongs to trusted subnet.
+func (s Server) isTrusted(c *gin.Context) bool {
+	h := c.Request.Header.Get(RealIPHeader)
+	ip := net.ParseIP(h)
+	if ip == nil {
+		logger.Log.Debug(fmt.Sprintf("Bad IP header %s", h))
+		return false
+	}
+	ipNet := s.conf.TrustedSubnetCIDR
+	if ipNet == nil {
+		logger.Log.Debug("SubNet param is empty")
+		return false
+	}
+	if !ipNet.Contains(ip) {
+		logger.Log.Debug(fmt.Sprintf("SubNet not contains this ip %v", ip))
+		return false
+	}
+	return true
+}
+
+func queryExpiresAt(c *gin.Context) (time.Time, error) {
+	var ttl int64
+	if v := c.Query("ttl"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("strconv.ParseInt: %w", err)
+		}
+		ttl = parsed
+	}
+	var at *time.Time
+	if v := c.Query("expires_at"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("time.Parse: %w", err)
+		}
+		at = &parsed
+	}
+	return shortener.ExpiresAt(time.Now(), ttl, at)
+}
+
+// sendAliasConflictResp responds with Conflict status (409) and short URL
+// that URL is already shortened as instead of requested alias.
+func (s Server) sendAliasConflictResp(c *gin.Context, id string, alias string) {
+	url := fmt.Sprintf("%s/%s", s.conf.BaseURL(), id)
+	msg := fmt.Sprintf("alias %s is not created, URL is already shortened as %s", alias, url)
+	resp, err := json.Marshal(NewAliasConflict(msg, url))
+	if err != nil {
+		logger.Log.Error("marshal response", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Data(http.StatusConflict, ApplicationJSON, resp)
+}
+
 func (s Server) sendJSONResultResp(c *gin.Context, id string, status int) {
 	url := fmt.Sprintf("%s/%s", s.conf.BaseURL(), id)
 	resp, err := json.Marshal(NewResult(url))
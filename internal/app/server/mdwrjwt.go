@@ -2,69 +2,201 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/shortener"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/auth"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 	"go.uber.org/zap"
 )
 
-// UserCookieName cookie name for JWT.
+// UserCookieName cookie name for access JWT.
 const UserCookieName = `SESSION`
 
-// JWTAuth func to check user's authentication.
-// If user is not authenticated this func will authenticate it.
-func JWTAuth(c *gin.Context) {
+// RefreshCookieName cookie name for refresh JWT.
+const RefreshCookieName = `REFRESH`
+
+// AuthorizationHeader header with bearer JWT or API key.
+const AuthorizationHeader = "Authorization"
+
+// Keys of values that [Server.Auth] puts to gin context.
+const (
+	// claimsKey claims of access JWT that authenticated request.
+	claimsKey = "claims"
+	// rotatedSessionKey session issued by refresh cookie while authenticating request.
+	rotatedSessionKey = "rotatedSession"
+)
+
+// Auth func to check user's authentication.
+// Request is authenticated by bearer JWT or API key in [AuthorizationHeader] or by JWT in cookie.
+// Missing or invalid session cookie is renewed by refresh cookie.
+// If none of them is present user is authenticated as new anonymous user.
+// Invalid or revoked credentials are rejected with Unauthorized status (401), new user is never created then.
+func (s Server) Auth(c *gin.Context) {
 	log := logger.Log.With(zap.String("cat", "auth"))
 	ctx := c.Request.Context()
-	tokenString, err := c.Cookie(UserCookieName)
-	if err != nil {
-		log.Debug("session cookie not found in request")
-		tokenString, err = login(c)
+	var claims *auth.Claims
+	// issued whether session is issued by this request, it can't be revoked yet.
+	var issued bool
+	var err error
+	if h := c.GetHeader(AuthorizationHeader); h != "" {
+		token, ok := cutBearer(h)
+		if !ok {
+			log.Debug("unsupported authorization scheme")
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if auth.IsAPIKey(token) {
+			s.apiKeyAuth(c, token)
+			return
+		}
+		claims, err = auth.ParseClaims(token)
 		if err != nil {
-			log.Error("login", zap.Error(err))
-			c.AbortWithError(http.StatusInternalServerError, err)
+			log.Debug("parse token", zap.Error(err))
+			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
-		ctx = context.WithValue(ctx, model.IsUserNew{}, true)
-	}
-	claims := &jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	} else {
+		var isNew, ok bool
+		claims, isNew, ok = s.cookieAuth(c)
+		if !ok {
+			return
+		}
+		if isNew {
+			ctx = context.WithValue(ctx, model.IsUserNew{}, true)
 		}
-		return []byte(auth.SecretKey), nil
-	})
+		_, rotated := c.Get(rotatedSessionKey)
+		issued = isNew || rotated
+	}
+	if !issued {
+		err = s.sh.CheckToken(ctx, claims)
+	}
 	if err != nil {
-		log.Debug("parsing jwt with claims", zap.Error(err))
-		c.AbortWithStatus(http.StatusUnauthorized)
+		if errors.Is(err, shortener.ErrTokenRevoked) {
+			log.Debug("token is revoked", zap.String("jti", claims.ID))
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		log.Error("checkToken", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
-	if !token.Valid {
-		log.Debug("token is not valid")
-		c.AbortWithStatus(http.StatusUnauthorized)
-		return
+	userID := claims.Subject
+	log.Debug(fmt.Sprintf("user id from token = %s", userID))
+	if claims.Account {
+		ctx = context.WithValue(ctx, model.IsAccount{}, true)
 	}
-	log.Debug(fmt.Sprintf("user id from token = %s", claims.Subject))
 
-	newCtx := context.WithValue(ctx, model.UserIDKey{}, claims.Subject)
+	newCtx := context.WithValue(ctx, model.UserIDKey{}, userID)
 	req := c.Request.WithContext(newCtx)
 	c.Request = req
+	c.Set(claimsKey, claims)
 
-	log.Debug(fmt.Sprintf("request with user sub = %s", claims.Subject))
+	log.Debug(fmt.Sprintf("request with user sub = %s", userID))
 	c.Next()
 }
 
-func login(c *gin.Context) (string, error) {
-	tokenString, err := auth.GenerateToken()
+// cookieAuth returns claims of access JWT from session cookie and whether user is new.
+// Missing or invalid session cookie is renewed by refresh cookie, refresh cookie is rotated then.
+// New anonymous session is started if there are no cookies at all.
+// If request is aborted false is returned.
+func (s Server) cookieAuth(c *gin.Context) (*auth.Claims, bool, bool) {
+	log := logger.Log.With(zap.String("cat", "auth"))
+	access, accessErr := c.Cookie(UserCookieName)
+	if accessErr == nil {
+		claims, err := auth.ParseClaims(access)
+		if err == nil {
+			return claims, false, true
+		}
+		log.Debug("parse token", zap.Error(err))
+	}
+	if refresh, err := c.Cookie(RefreshCookieName); err == nil {
+		sess, err := s.sh.RefreshSession(c.Request.Context(), refresh)
+		if err != nil {
+			if errors.Is(err, shortener.ErrInvalidSession) {
+				log.Debug("refresh session", zap.Error(err))
+				s.clearSessionCookies(c)
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return nil, false, false
+			}
+			log.Error("refreshSession", zap.Error(err))
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return nil, false, false
+		}
+		s.setSessionCookies(c, sess)
+		c.Set(rotatedSessionKey, sess)
+		return sess.AccessClaims, false, true
+	}
+	if accessErr == nil {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return nil, false, false
+	}
+	log.Debug("session cookie not found in request")
+	sess, err := auth.NewAnonymousSession()
+	if err != nil {
+		log.Error("newAnonymousSession", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return nil, false, false
+	}
+	s.setSessionCookies(c, sess)
+	return sess.AccessClaims, true, true
+}
+
+// apiKeyAuth authenticates request by API key, the key is put to the context next to user ID.
+func (s Server) apiKeyAuth(c *gin.Context, key string) {
+	ctx := c.Request.Context()
+	apiKey, err := s.sh.AuthenticateAPIKey(ctx, key)
 	if err != nil {
-		return "", fmt.Errorf("generate token. %w", err)
+		if errors.Is(err, shortener.ErrInvalidAPIKey) {
+			logger.Log.Debug("API key is not valid")
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		logger.Log.Error("authenticateAPIKey", zap.Error(err))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
 	}
-	c.SetCookie(UserCookieName, tokenString, int(auth.TokenExp.Seconds()), "",
-		"", false, true)
-	return tokenString, nil
+	ctx = context.WithValue(ctx, model.UserIDKey{}, apiKey.UserID)
+	ctx = context.WithValue(ctx, model.APIKeyKey{}, apiKey)
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+}
+
+// RequireScope rejects requests authenticated by API key without scope with Forbidden status (403).
+// Requests authenticated by JWT are allowed to act in any scope.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey, ok := c.Request.Context().Value(model.APIKeyKey{}).(model.APIKey)
+		if ok && !apiKey.HasScope(scope) {
+			logger.Log.Debug(fmt.Sprintf("API key %s has no scope %s", apiKey.ID, scope))
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+// setSessionCookies sets session and refresh cookies, cookies set earlier in the same response are replaced.
+func (s Server) setSessionCookies(c *gin.Context, sess auth.Session) {
+	c.Writer.Header().Del("Set-Cookie")
+	s.setCookie(c, UserCookieName, sess.Access, int(auth.AccessTokenTTL().Seconds()))
+	s.setCookie(c, RefreshCookieName, sess.Refresh, int(auth.RefreshTokenTTL().Seconds()))
+}
+
+// clearSessionCookies tells client to delete session and refresh cookies.
+func (s Server) clearSessionCookies(c *gin.Context) {
+	c.Writer.Header().Del("Set-Cookie")
+	s.setCookie(c, UserCookieName, "", -1)
+	s.setCookie(c, RefreshCookieName, "", -1)
+}
+
+// setCookie sets HTTP only cookie with attributes from configuration.
+func (s Server) setCookie(c *gin.Context, name string, value string, maxAge int) {
+	c.SetSameSite(s.conf.CookieSameSite())
+	c.SetCookie(name, value, maxAge, s.conf.CookiePath(), s.conf.CookieDomain(),
+		s.conf.CookieSecure(), true)
 }
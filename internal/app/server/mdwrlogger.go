@@ -3,12 +3,17 @@ package server
 import (
 	"time"
 
+	"github.com/denis-oreshkevich/shortener/internal/app/metrics"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+// unmatchedRoute route label of requests that didn't match any route.
+const unmatchedRoute = "unmatched"
+
 // Logging func to log the request details and it's execution time.
+// Also records request in HTTP metrics labeled by route template.
 func Logging(c *gin.Context) {
 	r := c.Request
 	start := time.Now()
@@ -22,4 +27,10 @@ func Logging(c *gin.Context) {
 		zap.Int("status", c.Writer.Status()),
 		zap.Duration("duration", duration),
 		zap.Int("size", c.Writer.Size()))
+
+	route := c.FullPath()
+	if route == "" {
+		route = unmatchedRoute
+	}
+	metrics.ObserveHTTP(route, r.Method, c.Writer.Status(), duration)
 }
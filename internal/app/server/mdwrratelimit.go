@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/config"
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	pb "github.com/denis-oreshkevich/shortener/internal/app/server/proto"
+	"github.com/denis-oreshkevich/shortener/internal/app/shortener"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/ratelimit"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Route classes that have separate rate limits.
+const (
+	RateClassCreate   = "create"
+	RateClassRedirect = "redirect"
+	RateClassList     = "list"
+	// RateClassAuth is limited only by client IP, its limit is not multiplied by IP factor.
+	RateClassAuth = "auth"
+)
+
+// Rate limit headers, gRPC sends them in lower case metadata.
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+	RetryAfterHeader         = "Retry-After"
+)
+
+// rateLimitBuckets max amount of buckets kept in memory, the least recently used are dropped.
+const rateLimitBuckets = 100_000
+
+// rateLimitErrorLogInterval min interval between logged errors of buckets store.
+const rateLimitErrorLogInterval = 10 * time.Second
+
+// grpcRateClasses route classes of shortener methods, other methods are not limited.
+var grpcRateClasses = map[string]string{
+	pb.Shortener_CreateShortURL_FullMethodName:       RateClassCreate,
+	pb.Shortener_BatchCreateShortURL_FullMethodName:  RateClassCreate,
+	pb.Shortener_StreamCreateShortURL_FullMethodName: RateClassCreate,
+	pb.Shortener_GetOriginalURL_FullMethodName:       RateClassRedirect,
+	pb.Shortener_GetUserURLs_FullMethodName:          RateClassList,
+	pb.Shortener_StreamUserURLs_FullMethodName:       RateClassList,
+}
+
+// RateLimiter limits requests of every route class by user ID and by client IP.
+// Limits of client IP are limits of user multiplied by IP factor, so users behind NAT
+// don't block each other but script that drops cookies to get new user is still limited.
+type RateLimiter struct {
+	limiter *ratelimit.Limiter
+	// fallback keeps buckets in memory while shared store fails, nil if limiter is in memory already.
+	fallback *ratelimit.Limiter
+	limits   map[string]ratelimit.Limit
+	ipFactor int
+	// nextErrorLog unix nanoseconds when next error of store is logged.
+	nextErrorLog atomic.Int64
+}
+
+// NewRateLimiter creates new [*RateLimiter] with limits from configuration.
+// Buckets are kept in storage of sh if it's configured, so instances share them,
+// while storage fails they are kept in memory of the instance.
+func NewRateLimiter(conf config.Conf, sh *shortener.Shortener) *RateLimiter {
+	rl := &RateLimiter{
+		limiter: ratelimit.New(ratelimit.NewMemoryStore(rateLimitBuckets)),
+		limits: map[string]ratelimit.Limit{
+			RateClassCreate:   conf.RateLimitCreate(),
+			RateClassRedirect: conf.RateLimitRedirect(),
+			RateClassList:     conf.RateLimitList(),
+			RateClassAuth:     conf.RateLimitAuth(),
+		},
+		ipFactor: conf.RateLimitIPFactor(),
+	}
+	if conf.RateLimitStore() == config.RateLimitStoreStorage {
+		rl.fallback = rl.limiter
+		rl.limiter = ratelimit.New(ratelimit.StoreFunc(sh.TakeRateLimit))
+	}
+	return rl
+}
+
+// Limit rejects requests of route class over the limit with Too Many Requests status (429).
+// It must be used after [Server.Auth]. Request is allowed if buckets can't be read.
+func (rl *RateLimiter) Limit(class string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, err := rl.allow(c.Request.Context(), class, c.RemoteIP())
+		if err != nil {
+			rl.logError(err)
+			c.Next()
+			return
+		}
+		if res.Limit > 0 {
+			h := c.Writer.Header()
+			h.Set(RateLimitLimitHeader, strconv.Itoa(res.Limit))
+			h.Set(RateLimitRemainingHeader, strconv.Itoa(res.Remaining))
+			h.Set(RateLimitResetHeader, strconv.FormatInt(ratelimit.Seconds(res.Reset), 10))
+		}
+		if !res.Allowed {
+			logger.Log.Debug("rate limit exceeded", zap.String("class", class))
+			c.Header(RetryAfterHeader, strconv.FormatInt(ratelimit.Seconds(res.RetryAfter), 10))
+			c.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		c.Next()
+	}
+}
+
+// UnaryInterceptor limits unary calls like [RateLimiter.Limit], rejected calls
+// end with ResourceExhausted code. It must be chained after [GRPCAuth.UnaryInterceptor].
+func (rl *RateLimiter) UnaryInterceptor(ctx context.Context, req any,
+	info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	err := rl.limitGRPC(ctx, info.FullMethod, func(md metadata.MD) error {
+		return grpc.SetHeader(ctx, md)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor limits streaming calls like [RateLimiter.UnaryInterceptor].
+// Stream takes single token however many messages it carries.
+func (rl *RateLimiter) StreamInterceptor(srv any, ss grpc.ServerStream,
+	info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := rl.limitGRPC(ss.Context(), info.FullMethod, ss.SetHeader); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func (rl *RateLimiter) limitGRPC(ctx context.Context, method string,
+	setHeader func(md metadata.MD) error) error {
+	class, ok := grpcRateClasses[method]
+	if !ok {
+		return nil
+	}
+	res, err := rl.allow(ctx, class, peerIP(ctx))
+	if err != nil {
+		rl.logError(err)
+		return nil
+	}
+	if res.Limit > 0 {
+		md := metadata.Pairs(
+			RateLimitLimitHeader, strconv.Itoa(res.Limit),
+			RateLimitRemainingHeader, strconv.Itoa(res.Remaining),
+			RateLimitResetHeader, strconv.FormatInt(ratelimit.Seconds(res.Reset), 10),
+		)
+		if !res.Allowed {
+			md.Set(RetryAfterHeader, strconv.FormatInt(ratelimit.Seconds(res.RetryAfter), 10))
+		}
+		if err = setHeader(md); err != nil {
+			logger.Log.Error("set header", zap.Error(err))
+		}
+	}
+	if !res.Allowed {
+		logger.Log.Debug("rate limit exceeded", zap.String("class", class))
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return nil
+}
+
+// allow takes token from bucket of user and from bucket of client IP and returns stricter result.
+// New user has empty bucket anyway, so only client IP is limited then.
+// [RateClassAuth] is limited only by client IP with its own limit.
+func (rl *RateLimiter) allow(ctx context.Context, class string, ip string) (ratelimit.Result, error) {
+	limit := rl.limits[class]
+	res := ratelimit.Result{Allowed: true}
+	if !limit.Enabled() {
+		return res, nil
+	}
+	if class == RateClassAuth {
+		if ip == "" {
+			return res, nil
+		}
+		return rl.take(ctx, class+":ip:"+ip, limit)
+	}
+	isNew, _ := ctx.Value(model.IsUserNew{}).(bool)
+	if userID, ok := ctx.Value(model.UserIDKey{}).(string); ok && !isNew {
+		r, err := rl.take(ctx, class+":user:"+userID, limit)
+		if err != nil {
+			return res, err
+		}
+		res = r
+	}
+	if rl.ipFactor > 0 && ip != "" {
+		r, err := rl.take(ctx, class+":ip:"+ip, limit.Scale(rl.ipFactor))
+		if err != nil {
+			return res, err
+		}
+		res = res.Stricter(r)
+	}
+	return res, nil
+}
+
+// take takes token from bucket of key, buckets are kept in memory while shared store fails.
+func (rl *RateLimiter) take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	res, err := rl.limiter.Allow(ctx, key, limit)
+	if err == nil || rl.fallback == nil {
+		return res, err
+	}
+	rl.logError(err)
+	return rl.fallback.Allow(ctx, key, limit)
+}
+
+// logError logs error of buckets store at most once per [rateLimitErrorLogInterval],
+// the store is likely down for every request then.
+func (rl *RateLimiter) logError(err error) {
+	now := time.Now().UnixNano()
+	next := rl.nextErrorLog.Load()
+	if now < next || !rl.nextErrorLog.CompareAndSwap(next, now+int64(rateLimitErrorLogInterval)) {
+		logger.Log.Debug("rateLimit", zap.Error(err))
+		return
+	}
+	logger.Log.Error("rateLimit", zap.Error(err))
+}
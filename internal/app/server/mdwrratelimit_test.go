@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	pb "github.com/denis-oreshkevich/shortener/internal/app/server/proto"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func newTestRateLimiter(ipFactor int) *RateLimiter {
+	return &RateLimiter{
+		limiter: ratelimit.New(ratelimit.NewMemoryStore(100)),
+		limits: map[string]ratelimit.Limit{
+			RateClassCreate: {Rate: 0.001, Burst: 2},
+			RateClassAuth:   {Rate: 0.001, Burst: 1},
+		},
+		ipFactor: ipFactor,
+	}
+}
+
+func TestRateLimiter_Limit(t *testing.T) {
+	rl := newTestRateLimiter(2)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		ctx := context.WithValue(c.Request.Context(), model.UserIDKey{}, c.GetHeader("X-User"))
+		if c.GetHeader("X-User") == "" {
+			ctx = context.WithValue(ctx, model.IsUserNew{}, true)
+		}
+		c.Request = c.Request.WithContext(ctx)
+	})
+	r.POST("/create", rl.Limit(RateClassCreate), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+	r.GET("/list", rl.Limit(RateClassList), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	do := func(method string, path string, user string, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":12345"
+		req.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/create", "first", "10.0.0.1")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "2", w.Header().Get(RateLimitLimitHeader))
+	assert.Equal(t, "1", w.Header().Get(RateLimitRemainingHeader))
+	w = do(http.MethodPost, "/create", "first", "10.0.0.1")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = do(http.MethodPost, "/create", "first", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "user limit is exceeded")
+	assert.NotEmpty(t, w.Header().Get(RetryAfterHeader))
+	assert.Equal(t, "0", w.Header().Get(RateLimitRemainingHeader))
+
+	assert.Equal(t, http.StatusCreated, do(http.MethodPost, "/create", "second", "10.0.0.1").Code,
+		"another user has own bucket")
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "/create", "", "10.0.0.1").Code,
+		"new users are limited by client IP")
+	assert.Equal(t, http.StatusCreated, do(http.MethodPost, "/create", "", "10.0.0.2").Code)
+
+	w = do(http.MethodGet, "/list", "first", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code, "class without limit")
+	assert.Empty(t, w.Header().Get(RateLimitLimitHeader))
+}
+
+func TestRateLimiter_LimitAuth(t *testing.T) {
+	rl := newTestRateLimiter(2)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		ctx := context.WithValue(c.Request.Context(), model.UserIDKey{}, c.GetHeader("X-User"))
+		c.Request = c.Request.WithContext(ctx)
+	})
+	r.POST("/login", rl.Limit(RateClassAuth), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	do := func(user string, ip string) int {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = ip + ":12345"
+		req.Header.Set("X-User", user)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, do("first", "10.0.0.1"))
+	assert.Equal(t, http.StatusTooManyRequests, do("second", "10.0.0.1"),
+		"limit of client IP is not multiplied and is shared by users")
+	assert.Equal(t, http.StatusOK, do("first", "10.0.0.2"))
+}
+
+func TestRateLimiter_Fallback(t *testing.T) {
+	errStore := errors.New("connection refused")
+	rl := newTestRateLimiter(0)
+	rl.fallback = rl.limiter
+	rl.limiter = ratelimit.New(ratelimit.StoreFunc(func(ctx context.Context, key string, now time.Time,
+		interval time.Duration, tolerance time.Duration) (time.Time, bool, error) {
+		return time.Time{}, false, errStore
+	}))
+	ctx := context.WithValue(context.Background(), model.UserIDKey{}, "user")
+
+	for i := 0; i < 2; i++ {
+		res, err := rl.allow(ctx, RateClassCreate, "10.0.0.1")
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+	res, err := rl.allow(ctx, RateClassCreate, "10.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed, "buckets are kept in memory while store fails")
+}
+
+func TestRateLimiter_UnaryInterceptor(t *testing.T) {
+	rl := newTestRateLimiter(0)
+	ctx := context.WithValue(context.Background(), model.UserIDKey{}, "user")
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1}})
+	stream := &headerStream{}
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+	handler := func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	}
+	call := func(method string) error {
+		_, err := rl.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	require.NoError(t, call(pb.Shortener_CreateShortURL_FullMethodName))
+	require.NoError(t, call(pb.Shortener_BatchCreateShortURL_FullMethodName))
+	err := call(pb.Shortener_CreateShortURL_FullMethodName)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.NotEmpty(t, stream.header.Get(RetryAfterHeader))
+	assert.NoError(t, call(pb.Shortener_GetStats_FullMethodName), "method without class")
+}
@@ -1,8 +1,20 @@
 package server
 
+import (
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/shortener"
+)
+
 // URLModel model represents the URL in JSON format.
+// Alias is optional and used as short ID if present.
+// ExpiresAt and TTL (in seconds) are optional, TTL is used if both are present.
 type URLModel struct {
-	URL string `json:"url"`
+	URL       string     `json:"url"`
+	Alias     string     `json:"alias,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       int64      `json:"ttl,omitempty"`
 }
 
 // NewURL creates new [URLModel].
@@ -19,3 +31,109 @@ type ResultModel struct {
 func NewResult(res string) ResultModel {
 	return ResultModel{Result: res}
 }
+
+// DeleteAcceptedModel model represents accepted delete job in JSON format.
+type DeleteAcceptedModel struct {
+	JobID     string `json:"job_id"`
+	StatusURL string `json:"status_url"`
+}
+
+// NewDeleteAccepted creates new [DeleteAcceptedModel].
+func NewDeleteAccepted(jobID string, statusURL string) DeleteAcceptedModel {
+	return DeleteAcceptedModel{JobID: jobID, StatusURL: statusURL}
+}
+
+// APIKeyRequestModel model represents request to create API key in JSON format.
+// Key without scopes is allowed to do everything except managing keys.
+type APIKeyRequestModel struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// APIKeyCreatedModel model represents created API key with the key itself in JSON format.
+type APIKeyCreatedModel struct {
+	model.APIKey
+	Key string `json:"key"`
+}
+
+// NewAPIKeyCreated creates new [APIKeyCreatedModel].
+func NewAPIKeyCreated(apiKey model.APIKey, key string) APIKeyCreatedModel {
+	return APIKeyCreatedModel{APIKey: apiKey, Key: key}
+}
+
+// CredentialsModel model represents email and password in JSON format.
+type CredentialsModel struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// AccountModel model represents registered user with session tokens in JSON format.
+type AccountModel struct {
+	model.User
+	SessionModel
+}
+
+// NewAccount creates new [AccountModel].
+func NewAccount(user model.User, token string, refreshToken string) AccountModel {
+	return AccountModel{User: user, SessionModel: NewSession(token, refreshToken)}
+}
+
+// SessionModel model represents access and refresh tokens in JSON format.
+type SessionModel struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// NewSession creates new [SessionModel].
+func NewSession(token string, refreshToken string) SessionModel {
+	return SessionModel{Token: token, RefreshToken: refreshToken}
+}
+
+// RefreshRequestModel model represents refresh token in JSON format.
+type RefreshRequestModel struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// QuotaErrorModel model represents exceeded quota in JSON format.
+type QuotaErrorModel struct {
+	Error     string `json:"error"`
+	Quota     string `json:"quota"`
+	Limit     int    `json:"limit"`
+	Used      int    `json:"used"`
+	Requested int    `json:"requested"`
+}
+
+// NewQuotaError creates new [QuotaErrorModel].
+func NewQuotaError(qe *shortener.QuotaError) QuotaErrorModel {
+	return QuotaErrorModel{
+		Error:     qe.Error(),
+		Quota:     qe.Quota,
+		Limit:     qe.Limit,
+		Used:      qe.Used,
+		Requested: qe.Requested,
+	}
+}
+
+// ErrorModel model represents error with machine readable code in JSON format.
+type ErrorModel struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// NewError creates new [ErrorModel].
+func NewError(err string, code string) ErrorModel {
+	return ErrorModel{Error: err, Code: code}
+}
+
+// AliasConflictModel model represents alias that is not created because URL
+// is already shortened as Result in JSON format.
+type AliasConflictModel struct {
+	Error  string `json:"error"`
+	Code   string `json:"code"`
+	Result string `json:"result"`
+}
+
+// NewAliasConflict creates new [AliasConflictModel] with [ErrorCodeAliasNotCreated] code.
+func NewAliasConflict(err string, result string) AliasConflictModel {
+	return AliasConflictModel{Error: err, Code: ErrorCodeAliasNotCreated, Result: result}
+}
@@ -19,12 +19,17 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	Shortener_CreateShortURL_FullMethodName      = "/shortener.Shortener/CreateShortURL"
-	Shortener_GetOriginalURL_FullMethodName      = "/shortener.Shortener/GetOriginalURL"
-	Shortener_GetUserURLs_FullMethodName         = "/shortener.Shortener/GetUserURLs"
-	Shortener_BatchCreateShortURL_FullMethodName = "/shortener.Shortener/BatchCreateShortURL"
-	Shortener_DeleteUserURLsBatch_FullMethodName = "/shortener.Shortener/DeleteUserURLsBatch"
-	Shortener_GetStats_FullMethodName            = "/shortener.Shortener/GetStats"
+	Shortener_CreateShortURL_FullMethodName       = "/shortener.Shortener/CreateShortURL"
+	Shortener_GetOriginalURL_FullMethodName       = "/shortener.Shortener/GetOriginalURL"
+	Shortener_GetUserURLs_FullMethodName          = "/shortener.Shortener/GetUserURLs"
+	Shortener_BatchCreateShortURL_FullMethodName  = "/shortener.Shortener/BatchCreateShortURL"
+	Shortener_StreamCreateShortURL_FullMethodName = "/shortener.Shortener/StreamCreateShortURL"
+	Shortener_StreamUserURLs_FullMethodName       = "/shortener.Shortener/StreamUserURLs"
+	Shortener_DeleteUserURLsBatch_FullMethodName  = "/shortener.Shortener/DeleteUserURLsBatch"
+	Shortener_GetDeleteJob_FullMethodName         = "/shortener.Shortener/GetDeleteJob"
+	Shortener_GetURLStats_FullMethodName          = "/shortener.Shortener/GetURLStats"
+	Shortener_GetStats_FullMethodName             = "/shortener.Shortener/GetStats"
+	Shortener_Ping_FullMethodName                 = "/shortener.Shortener/Ping"
 )
 
 // ShortenerClient is the client API for Shortener service.
@@ -35,8 +40,16 @@ type ShortenerClient interface {
 	GetOriginalURL(ctx context.Context, in *GetOriginalURLRequest, opts ...grpc.CallOption) (*GetOriginalURLResponse, error)
 	GetUserURLs(ctx context.Context, in *GetUserURLsRequest, opts ...grpc.CallOption) (*GetUserURLsResponse, error)
 	BatchCreateShortURL(ctx context.Context, in *BatchCreateShortURLRequest, opts ...grpc.CallOption) (*BatchCreateShortURLResponse, error)
+	// StreamCreateShortURL saves records as they arrive in chunks and streams back result of every record,
+	// so neither side holds the whole batch in memory.
+	StreamCreateShortURL(ctx context.Context, opts ...grpc.CallOption) (Shortener_StreamCreateShortURLClient, error)
+	// StreamUserURLs streams user's URLs page by page ordered by short URL.
+	StreamUserURLs(ctx context.Context, in *StreamUserURLsRequest, opts ...grpc.CallOption) (Shortener_StreamUserURLsClient, error)
 	DeleteUserURLsBatch(ctx context.Context, in *DeleteUserURLsBatchRequest, opts ...grpc.CallOption) (*DeleteUserURLsBatchResponse, error)
+	GetDeleteJob(ctx context.Context, in *GetDeleteJobRequest, opts ...grpc.CallOption) (*GetDeleteJobResponse, error)
+	GetURLStats(ctx context.Context, in *GetURLStatsRequest, opts ...grpc.CallOption) (*GetURLStatsResponse, error)
 	GetStats(ctx context.Context, in *ServiceStatsRequest, opts ...grpc.CallOption) (*ServiceStatsResponse, error)
+	Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error)
 }
 
 type shortenerClient struct {
@@ -83,6 +96,69 @@ func (c *shortenerClient) BatchCreateShortURL(ctx context.Context, in *BatchCrea
 	return out, nil
 }
 
+func (c *shortenerClient) StreamCreateShortURL(ctx context.Context, opts ...grpc.CallOption) (Shortener_StreamCreateShortURLClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Shortener_ServiceDesc.Streams[0], Shortener_StreamCreateShortURL_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shortenerStreamCreateShortURLClient{stream}
+	return x, nil
+}
+
+type Shortener_StreamCreateShortURLClient interface {
+	Send(*BatchCreateShortURLRequestData) error
+	Recv() (*StreamCreateShortURLResponse, error)
+	grpc.ClientStream
+}
+
+type shortenerStreamCreateShortURLClient struct {
+	grpc.ClientStream
+}
+
+func (x *shortenerStreamCreateShortURLClient) Send(m *BatchCreateShortURLRequestData) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *shortenerStreamCreateShortURLClient) Recv() (*StreamCreateShortURLResponse, error) {
+	m := new(StreamCreateShortURLResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *shortenerClient) StreamUserURLs(ctx context.Context, in *StreamUserURLsRequest, opts ...grpc.CallOption) (Shortener_StreamUserURLsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Shortener_ServiceDesc.Streams[1], Shortener_StreamUserURLs_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shortenerStreamUserURLsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Shortener_StreamUserURLsClient interface {
+	Recv() (*StreamUserURLsResponse, error)
+	grpc.ClientStream
+}
+
+type shortenerStreamUserURLsClient struct {
+	grpc.ClientStream
+}
+
+func (x *shortenerStreamUserURLsClient) Recv() (*StreamUserURLsResponse, error) {
+	m := new(StreamUserURLsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *shortenerClient) DeleteUserURLsBatch(ctx context.Context, in *DeleteUserURLsBatchRequest, opts ...grpc.CallOption) (*DeleteUserURLsBatchResponse, error) {
 	out := new(DeleteUserURLsBatchResponse)
 	err := c.cc.Invoke(ctx, Shortener_DeleteUserURLsBatch_FullMethodName, in, out, opts...)
@@ -92,6 +168,24 @@ func (c *shortenerClient) DeleteUserURLsBatch(ctx context.Context, in *DeleteUse
 	return out, nil
 }
 
+func (c *shortenerClient) GetDeleteJob(ctx context.Context, in *GetDeleteJobRequest, opts ...grpc.CallOption) (*GetDeleteJobResponse, error) {
+	out := new(GetDeleteJobResponse)
+	err := c.cc.Invoke(ctx, Shortener_GetDeleteJob_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetURLStats(ctx context.Context, in *GetURLStatsRequest, opts ...grpc.CallOption) (*GetURLStatsResponse, error) {
+	out := new(GetURLStatsResponse)
+	err := c.cc.Invoke(ctx, Shortener_GetURLStats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *shortenerClient) GetStats(ctx context.Context, in *ServiceStatsRequest, opts ...grpc.CallOption) (*ServiceStatsResponse, error) {
 	out := new(ServiceStatsResponse)
 	err := c.cc.Invoke(ctx, Shortener_GetStats_FullMethodName, in, out, opts...)
@@ -101,6 +195,15 @@ func (c *shortenerClient) GetStats(ctx context.Context, in *ServiceStatsRequest,
 	return out, nil
 }
 
+func (c *shortenerClient) Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error) {
+	out := new(PingResponse)
+	err := c.cc.Invoke(ctx, Shortener_Ping_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ShortenerServer is the server API for Shortener service.
 // All implementations must embed UnimplementedShortenerServer
 // for forward compatibility
@@ -109,8 +212,16 @@ type ShortenerServer interface {
 	GetOriginalURL(context.Context, *GetOriginalURLRequest) (*GetOriginalURLResponse, error)
 	GetUserURLs(context.Context, *GetUserURLsRequest) (*GetUserURLsResponse, error)
 	BatchCreateShortURL(context.Context, *BatchCreateShortURLRequest) (*BatchCreateShortURLResponse, error)
+	// StreamCreateShortURL saves records as they arrive in chunks and streams back result of every record,
+	// so neither side holds the whole batch in memory.
+	StreamCreateShortURL(Shortener_StreamCreateShortURLServer) error
+	// StreamUserURLs streams user's URLs page by page ordered by short URL.
+	StreamUserURLs(*StreamUserURLsRequest, Shortener_StreamUserURLsServer) error
 	DeleteUserURLsBatch(context.Context, *DeleteUserURLsBatchRequest) (*DeleteUserURLsBatchResponse, error)
+	GetDeleteJob(context.Context, *GetDeleteJobRequest) (*GetDeleteJobResponse, error)
+	GetURLStats(context.Context, *GetURLStatsRequest) (*GetURLStatsResponse, error)
 	GetStats(context.Context, *ServiceStatsRequest) (*ServiceStatsResponse, error)
+	Ping(context.Context, *PingRequest) (*PingResponse, error)
 	mustEmbedUnimplementedShortenerServer()
 }
 
@@ -130,12 +241,27 @@ func (UnimplementedShortenerServer) GetUserURLs(context.Context, *GetUserURLsReq
 func (UnimplementedShortenerServer) BatchCreateShortURL(context.Context, *BatchCreateShortURLRequest) (*BatchCreateShortURLResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method BatchCreateShortURL not implemented")
 }
+func (UnimplementedShortenerServer) StreamCreateShortURL(Shortener_StreamCreateShortURLServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamCreateShortURL not implemented")
+}
+func (UnimplementedShortenerServer) StreamUserURLs(*StreamUserURLsRequest, Shortener_StreamUserURLsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamUserURLs not implemented")
+}
 func (UnimplementedShortenerServer) DeleteUserURLsBatch(context.Context, *DeleteUserURLsBatchRequest) (*DeleteUserURLsBatchResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteUserURLsBatch not implemented")
 }
+func (UnimplementedShortenerServer) GetDeleteJob(context.Context, *GetDeleteJobRequest) (*GetDeleteJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDeleteJob not implemented")
+}
+func (UnimplementedShortenerServer) GetURLStats(context.Context, *GetURLStatsRequest) (*GetURLStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetURLStats not implemented")
+}
 func (UnimplementedShortenerServer) GetStats(context.Context, *ServiceStatsRequest) (*ServiceStatsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
 }
+func (UnimplementedShortenerServer) Ping(context.Context, *PingRequest) (*PingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
+}
 func (UnimplementedShortenerServer) mustEmbedUnimplementedShortenerServer() {}
 
 // UnsafeShortenerServer may be embedded to opt out of forward compatibility for this service.
@@ -221,6 +347,53 @@ func _Shortener_BatchCreateShortURL_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_StreamCreateShortURL_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ShortenerServer).StreamCreateShortURL(&shortenerStreamCreateShortURLServer{stream})
+}
+
+type Shortener_StreamCreateShortURLServer interface {
+	Send(*StreamCreateShortURLResponse) error
+	Recv() (*BatchCreateShortURLRequestData, error)
+	grpc.ServerStream
+}
+
+type shortenerStreamCreateShortURLServer struct {
+	grpc.ServerStream
+}
+
+func (x *shortenerStreamCreateShortURLServer) Send(m *StreamCreateShortURLResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *shortenerStreamCreateShortURLServer) Recv() (*BatchCreateShortURLRequestData, error) {
+	m := new(BatchCreateShortURLRequestData)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Shortener_StreamUserURLs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamUserURLsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ShortenerServer).StreamUserURLs(m, &shortenerStreamUserURLsServer{stream})
+}
+
+type Shortener_StreamUserURLsServer interface {
+	Send(*StreamUserURLsResponse) error
+	grpc.ServerStream
+}
+
+type shortenerStreamUserURLsServer struct {
+	grpc.ServerStream
+}
+
+func (x *shortenerStreamUserURLsServer) Send(m *StreamUserURLsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _Shortener_DeleteUserURLsBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(DeleteUserURLsBatchRequest)
 	if err := dec(in); err != nil {
@@ -239,6 +412,42 @@ func _Shortener_DeleteUserURLsBatch_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_GetDeleteJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDeleteJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetDeleteJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_GetDeleteJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetDeleteJob(ctx, req.(*GetDeleteJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetURLStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetURLStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetURLStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_GetURLStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetURLStats(ctx, req.(*GetURLStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Shortener_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ServiceStatsRequest)
 	if err := dec(in); err != nil {
@@ -257,6 +466,24 @@ func _Shortener_GetStats_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).Ping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Shortener_Ping_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).Ping(ctx, req.(*PingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Shortener_ServiceDesc is the grpc.ServiceDesc for Shortener service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -284,11 +511,35 @@ var Shortener_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteUserURLsBatch",
 			Handler:    _Shortener_DeleteUserURLsBatch_Handler,
 		},
+		{
+			MethodName: "GetDeleteJob",
+			Handler:    _Shortener_GetDeleteJob_Handler,
+		},
+		{
+			MethodName: "GetURLStats",
+			Handler:    _Shortener_GetURLStats_Handler,
+		},
 		{
 			MethodName: "GetStats",
 			Handler:    _Shortener_GetStats_Handler,
 		},
+		{
+			MethodName: "Ping",
+			Handler:    _Shortener_Ping_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamCreateShortURL",
+			Handler:       _Shortener_StreamCreateShortURL_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "StreamUserURLs",
+			Handler:       _Shortener_StreamUserURLs_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/shortener.proto",
 }
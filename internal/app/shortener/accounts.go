@@ -0,0 +1,125 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password length limits, bcrypt ignores bytes after 72nd.
+const (
+	minPasswordLen = 8
+	maxPasswordLen = 72
+)
+
+// ErrInvalidCredentials indicates that email is not registered or password doesn't match.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// ErrInvalidAccount indicates that email is malformed or password length is out of limits.
+var ErrInvalidAccount = errors.New("invalid account")
+
+// dummyHash is compared with password of unknown email,
+// so response time doesn't tell whether email is registered.
+// It is computed on first use, see [getDummyHash].
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+// getDummyHash returns dummyHash, computing it once.
+func getDummyHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	})
+	return dummyHash
+}
+
+// Register creates account with email and password.
+// URLs, API keys and delete jobs of current anonymous user are moved to the account.
+func (sh *Shortener) Register(ctx context.Context, email string, password string) (model.User, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return model.User{}, err
+	}
+	if len(password) < minPasswordLen || len(password) > maxPasswordLen {
+		return model.User{}, fmt.Errorf("password length must be from %d to %d. %w",
+			minPasswordLen, maxPasswordLen, ErrInvalidAccount)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return model.User{}, fmt.Errorf("bcrypt.GenerateFromPassword. %w", err)
+	}
+	user := model.NewUser(generator.UUIDString(), email, string(hash),
+		time.Now().UTC().Truncate(time.Millisecond))
+	if err = sh.storage.SaveUser(ctx, user); err != nil {
+		return model.User{}, fmt.Errorf("storage.SaveUser. %w", err)
+	}
+	sh.adoptAnonymousUser(ctx, user.ID)
+	return user, nil
+}
+
+// Login checks email and password of account.
+// URLs, API keys and delete jobs of current anonymous user are moved to the account.
+func (sh *Shortener) Login(ctx context.Context, email string, password string) (model.User, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return model.User{}, ErrInvalidCredentials
+	}
+	user, err := sh.storage.FindUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			bcrypt.CompareHashAndPassword(getDummyHash(), []byte(password))
+			return model.User{}, ErrInvalidCredentials
+		}
+		return model.User{}, fmt.Errorf("storage.FindUserByEmail. %w", err)
+	}
+	if err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return model.User{}, ErrInvalidCredentials
+	}
+	sh.adoptAnonymousUser(ctx, user.ID)
+	return user, nil
+}
+
+// adoptAnonymousUser moves URLs, API keys and delete jobs of current user to account
+// if current user is anonymous. Failure doesn't fail login, they stay with anonymous user then.
+// Adopted URLs are not limited by [Quota.MaxActive], they are already saved and can't be rejected,
+// so account over the limit can't create new URLs until it deletes some.
+func (sh *Shortener) adoptAnonymousUser(ctx context.Context, accountID string) {
+	if isAccount, _ := ctx.Value(model.IsAccount{}).(bool); isAccount {
+		return
+	}
+	if _, ok := ctx.Value(model.APIKeyKey{}).(model.APIKey); ok {
+		return
+	}
+	anonID, err := sh.GetUserID(ctx)
+	if err != nil {
+		return
+	}
+	n, err := sh.storage.ReassignUser(ctx, anonID, accountID)
+	if err != nil {
+		logger.Log.Error("reassignUser", zap.Error(err))
+		return
+	}
+	logger.Log.Debug(fmt.Sprintf("reassigned %d URLs, %d API keys and %d delete jobs of %s to %s",
+		n.URLs, n.APIKeys, n.DeleteJobs, anonID, accountID))
+}
+
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", fmt.Errorf("email %q. %w", email, ErrInvalidAccount)
+	}
+	return email, nil
+}
@@ -0,0 +1,114 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/auth"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+)
+
+// maxAPIKeyNameLen limits length of API key name.
+const maxAPIKeyNameLen = 100
+
+// ErrInvalidAPIKey indicates that API key is unknown or revoked.
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// ErrInvalidAPIKeyRequest indicates that API key name is too long or scope is unknown.
+var ErrInvalidAPIKeyRequest = errors.New("invalid API key request")
+
+// ErrSessionRequired indicates that operation is not allowed to requests authenticated by API key.
+var ErrSessionRequired = errors.New("session is required")
+
+// CreateAPIKey creates API key of current user and returns it with the key itself.
+// The key is not stored, so it can't be shown again.
+func (sh *Shortener) CreateAPIKey(ctx context.Context, name string,
+	scopes []string) (model.APIKey, string, error) {
+	if err := checkSession(ctx); err != nil {
+		return model.APIKey{}, "", err
+	}
+	userID, err := sh.GetUserID(ctx)
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+	if len(name) > maxAPIKeyNameLen {
+		return model.APIKey{}, "", fmt.Errorf("name is longer than %d. %w", maxAPIKeyNameLen, ErrInvalidAPIKeyRequest)
+	}
+	uniq := make([]string, 0, len(scopes))
+	seen := make(map[string]bool, len(scopes))
+	for _, s := range scopes {
+		if !model.ValidScope(s) {
+			return model.APIKey{}, "", fmt.Errorf("scope %q. %w", s, ErrInvalidAPIKeyRequest)
+		}
+		if !seen[s] {
+			seen[s] = true
+			uniq = append(uniq, s)
+		}
+	}
+	secret, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		return model.APIKey{}, "", fmt.Errorf("auth.NewAPIKey. %w", err)
+	}
+	key := model.NewAPIKey(generator.UUIDString(), userID, name, prefix, auth.HashAPIKey(secret),
+		uniq, time.Now().UTC().Truncate(time.Millisecond))
+	if err = sh.storage.SaveAPIKey(ctx, key); err != nil {
+		return model.APIKey{}, "", fmt.Errorf("storage.SaveAPIKey. %w", err)
+	}
+	return key, secret, nil
+}
+
+// FindUserAPIKeys returns API keys of current user.
+func (sh *Shortener) FindUserAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	if err := checkSession(ctx); err != nil {
+		return nil, err
+	}
+	userID, err := sh.GetUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := sh.storage.FindUserAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("storage.FindUserAPIKeys. %w", err)
+	}
+	return keys, nil
+}
+
+// DeleteAPIKey revokes API key of current user.
+func (sh *Shortener) DeleteAPIKey(ctx context.Context, id string) error {
+	if err := checkSession(ctx); err != nil {
+		return err
+	}
+	userID, err := sh.GetUserID(ctx)
+	if err != nil {
+		return err
+	}
+	if err = sh.storage.DeleteAPIKey(ctx, userID, id); err != nil {
+		return fmt.Errorf("storage.DeleteAPIKey. %w", err)
+	}
+	return nil
+}
+
+// AuthenticateAPIKey returns stored API key that matches key.
+func (sh *Shortener) AuthenticateAPIKey(ctx context.Context, key string) (model.APIKey, error) {
+	apiKey, err := sh.storage.FindAPIKeyByHash(ctx, auth.HashAPIKey(key))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return model.APIKey{}, ErrInvalidAPIKey
+		}
+		return model.APIKey{}, fmt.Errorf("storage.FindAPIKeyByHash. %w", err)
+	}
+	return apiKey, nil
+}
+
+// checkSession returns [ErrSessionRequired] if request is authenticated by API key,
+// so key can't be used to create keys with wider scopes, and [ErrUserIsNew] for new user.
+func checkSession(ctx context.Context) error {
+	if _, ok := ctx.Value(model.APIKeyKey{}).(model.APIKey); ok {
+		return ErrSessionRequired
+	}
+	return checkUserIsNew(ctx)
+}
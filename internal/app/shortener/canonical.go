@@ -0,0 +1,155 @@
+package shortener
+
+import (
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// defaultPorts ports that are dropped from URLs of the scheme.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// Canonical options of URL canonicalization. Scheme and host are always lowercased,
+// default port is dropped and percent-encoding is normalized.
+type Canonical struct {
+	// StripParams names of query parameters that are removed, name ending with * is a prefix.
+	StripParams []string
+	// SortQuery sorts query parameters by name, values of repeated parameter keep their order.
+	SortQuery bool
+}
+
+// SetCanonical sets options of URL canonicalization,
+// it must be called before requests are served.
+func (sh *Shortener) SetCanonical(c Canonical) {
+	sh.canonical = c
+}
+
+// Canonicalize returns canonical form of URL, equivalent URLs have the same canonical form.
+// URL that can't be parsed is canonical form of itself.
+func (c Canonical) Canonicalize(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Opaque != "" {
+		return u.String()
+	}
+	u.Host = canonicalHost(u)
+
+	path := normalizePercent(u.EscapedPath())
+	if path == "" && u.Host != "" {
+		path = "/"
+	}
+	if u.Path, err = url.PathUnescape(path); err == nil {
+		u.RawPath = path
+	}
+	u.RawQuery = c.canonicalQuery(u.RawQuery)
+	fragment := normalizePercent(u.EscapedFragment())
+	if u.Fragment, err = url.PathUnescape(fragment); err == nil {
+		u.RawFragment = fragment
+	}
+	return u.String()
+}
+
+// canonicalHost returns lowercased host of URL without default port of its scheme.
+func canonicalHost(u *url.URL) string {
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+	return host
+}
+
+// canonicalQuery normalizes percent-encoding of query parameters,
+// removes empty and stripped ones and sorts them if needed.
+func (c Canonical) canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	type param struct {
+		name string
+		raw  string
+	}
+	var params []param
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		raw = normalizePercent(raw)
+		name, _, _ := strings.Cut(raw, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if c.stripped(name) {
+			continue
+		}
+		params = append(params, param{name: name, raw: raw})
+	}
+	if c.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool {
+			return params[i].name < params[j].name
+		})
+	}
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		parts = append(parts, p.raw)
+	}
+	return strings.Join(parts, "&")
+}
+
+func (c Canonical) stripped(name string) bool {
+	for _, s := range c.StripParams {
+		if prefix, ok := strings.CutSuffix(s, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == s {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePercent uppercases hex digits of percent-encoded octets
+// and decodes octets of unreserved characters, see RFC 3986 section 6.2.2.
+func normalizePercent(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		octet, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			b.WriteByte(s[i])
+			continue
+		}
+		if isUnreserved(octet[0]) {
+			b.WriteByte(octet[0])
+		} else {
+			b.WriteString("%" + strings.ToUpper(s[i+1:i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
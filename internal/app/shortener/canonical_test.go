@@ -0,0 +1,67 @@
+package shortener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonical_Canonicalize(t *testing.T) {
+	tracking := Canonical{StripParams: []string{"utm_*", "fbclid"}, SortQuery: true}
+	tests := []struct {
+		name      string
+		canonical Canonical
+		url       string
+		want      string
+	}{
+		{name: "scheme and host #1", url: "HTTP://Example.COM/Path", want: "http://example.com/Path"},
+		{name: "default port #2", url: "https://example.com:443/a", want: "https://example.com/a"},
+		{name: "other port #3", url: "http://example.com:8080/a", want: "http://example.com:8080/a"},
+		{name: "empty path #4", url: "http://example.com", want: "http://example.com/"},
+		{name: "IPv6 default port #5", url: "http://[2001:DB8::1]:80/", want: "http://[2001:db8::1]/"},
+		{name: "unreserved decoded #6", url: "http://example.com/%7Euser/%61", want: "http://example.com/~user/a"},
+		{name: "hex uppercased #7", url: "http://example.com/a%2fb?q=%c3%a9#%2f",
+			want: "http://example.com/a%2Fb?q=%C3%A9#%2F"},
+		{name: "query kept by default #8", url: "http://example.com/?b=1&utm_source=x&a=2",
+			want: "http://example.com/?b=1&utm_source=x&a=2"},
+		{name: "tracking stripped and sorted #9", canonical: tracking,
+			url:  "http://example.com/?utm_source=x&b=1&fbclid=y&a=2&b=0&utm_medium=z",
+			want: "http://example.com/?a=2&b=1&b=0"},
+		{name: "only tracking #10", canonical: tracking, url: "http://example.com/a?utm_source=x&&",
+			want: "http://example.com/a"},
+		{name: "prefix needs star #11", canonical: Canonical{StripParams: []string{"utm"}},
+			url: "http://example.com/?utm_source=x&utm=y", want: "http://example.com/?utm_source=x"},
+		{name: "unparsable #12", url: "http://example.com/%zz", want: "http://example.com/%zz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.canonical.Canonicalize(tt.url))
+		})
+	}
+}
+
+func TestShortener_SaveURLCanonical(t *testing.T) {
+	sh := New(storage.NewMapStorage(generator.DefaultIDGenerator()))
+	sh.SetCanonical(Canonical{StripParams: []string{"utm_*"}})
+	ctx := context.WithValue(context.Background(), model.UserIDKey{}, generator.UUIDString())
+
+	id, err := sh.SaveURL(ctx, "HTTP://Example.com:80/a?utm_source=mail", time.Time{})
+	require.NoError(t, err)
+	existing, err := sh.SaveURL(ctx, "http://example.com/a", time.Time{})
+	assert.ErrorIs(t, err, storage.ErrDBConflict)
+	assert.Equal(t, id, existing)
+
+	resp, err := sh.SaveURLBatch(ctx, []model.BatchReqEntry{model.NewBatchReqEntry("1", "http://EXAMPLE.com/%61")})
+	require.NoError(t, err)
+	assert.Equal(t, model.NewBatchRespEntry("1", id), resp[0])
+
+	orig, err := sh.FindURL(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP://Example.com:80/a?utm_source=mail", orig, "original URL is redirected to")
+}
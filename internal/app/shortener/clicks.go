@@ -0,0 +1,98 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"go.uber.org/zap"
+)
+
+// clicksBufferSize capacity of the clicks channel. Clicks are dropped when it is full,
+// so redirects never wait for the storage.
+const clicksBufferSize = 4096
+
+// clickStatsTop amount of top referrers and user agents in click statistic.
+const clickStatsTop = 10
+
+// TrackClick queues click to be saved by [Shortener.RecordClicks].
+// Client IP is anonymised before queueing. It never blocks.
+func (sh *Shortener) TrackClick(click model.Click) {
+	click.IP = AnonymizeIP(click.IP)
+	select {
+	case sh.clicks <- click:
+	default:
+		logger.Log.Warn("clicks buffer is full, click is dropped",
+			zap.String("id", click.ShortURL))
+	}
+}
+
+// RecordClicks saves queued clicks in batches of batchSize or every flushInterval.
+// Queued clicks are flushed when ctx is done.
+func (sh *Shortener) RecordClicks(ctx context.Context, batchSize int, flushInterval time.Duration) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	batch := make([]model.Click, 0, batchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := sh.storage.SaveClicks(ctx, batch); err != nil {
+			logger.Log.Error("save clicks.", zap.Error(err), zap.Int("count", len(batch)))
+		}
+		batch = make([]model.Click, 0, batchSize)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case c := <-sh.clicks:
+					batch = append(batch, c)
+				default:
+					flush(context.Background())
+					return
+				}
+			}
+		case c := <-sh.clicks:
+			batch = append(batch, c)
+			if len(batch) >= batchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+// FindClickStats returns click statistic of current user's short URL.
+func (sh *Shortener) FindClickStats(ctx context.Context, id string) (model.ClickStats, error) {
+	if err := checkUserIsNew(ctx); err != nil {
+		return model.ClickStats{}, err
+	}
+	userID, err := sh.GetUserID(ctx)
+	if err != nil {
+		return model.ClickStats{}, err
+	}
+	stats, err := sh.storage.FindClickStats(ctx, userID, id, clickStatsTop)
+	if err != nil {
+		return model.ClickStats{}, fmt.Errorf("storage.FindClickStats. %w", err)
+	}
+	return stats, nil
+}
+
+// AnonymizeIP removes host part of IP address: last octet of IPv4
+// and last 80 bits of IPv6. Unparsable address is dropped.
+func AnonymizeIP(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
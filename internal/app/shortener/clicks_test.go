@@ -0,0 +1,62 @@
+package shortener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{name: "IPv4 #1", ip: "192.168.1.42", want: "192.168.1.0"},
+		{name: "IPv6 #2", ip: "2001:db8:85a3:8d3:1319:8a2e:370:7348", want: "2001:db8:85a3::"},
+		{name: "IPv4 mapped IPv6 #3", ip: "::ffff:10.1.2.3", want: "10.1.2.0"},
+		{name: "not IP #4", ip: "localhost", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, AnonymizeIP(tt.ip))
+		})
+	}
+}
+
+func TestShortener_RecordClicks(t *testing.T) {
+	saved := make(chan []model.Click, 2)
+	st := new(storage.MockedStorage)
+	st.On("SaveClicks", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		saved <- args.Get(1).([]model.Click)
+	})
+	sh := New(st)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sh.RecordClicks(ctx, 2, time.Hour)
+	}()
+	for _, id := range []string{"AAAAAAAA", "BBBBBBBB", "CCCCCCCC"} {
+		sh.TrackClick(model.NewClick(id, time.Now(), "", "", "192.168.1.42"))
+	}
+	select {
+	case first := <-saved:
+		assert.Len(t, first, 2, "full batch must be saved without waiting for flush")
+		assert.Equal(t, "192.168.1.0", first[0].IP)
+	case <-time.After(time.Second):
+		t.Fatal("full batch is not saved")
+	}
+	cancel()
+	<-done
+
+	last := <-saved
+	assert.Equal(t, "CCCCCCCC", last[0].ShortURL)
+	st.AssertNumberOfCalls(t, "SaveClicks", 2)
+}
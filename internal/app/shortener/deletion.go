@@ -0,0 +1,207 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"go.uber.org/zap"
+)
+
+// ErrEmptyDeleteBatch indicates that no short URLs are requested to delete.
+var ErrEmptyDeleteBatch = errors.New("delete batch is empty")
+
+// ErrDeleteBatchTooLarge indicates that more than [MaxDeleteBatch] short URLs are requested to delete.
+var ErrDeleteBatchTooLarge = errors.New("delete batch is too large")
+
+const (
+	// MaxDeleteBatch max amount of short URLs in single delete job,
+	// it keeps job results small and delete query below the limit of SQL parameters.
+	MaxDeleteBatch = 10000
+
+	// deleteQueueSize capacity of in-memory queue, jobs that don't fit
+	// stay pending in storage until the next rescan.
+	deleteQueueSize = 1024
+
+	// deleteRescanInterval how often pending jobs are loaded from storage.
+	deleteRescanInterval = 30 * time.Second
+
+	// maxDeleteRetryBackoff limits delay between attempts of delete job.
+	maxDeleteRetryBackoff = time.Minute
+)
+
+// DeleteRetryPolicy how failed delete jobs are retried.
+type DeleteRetryPolicy struct {
+	// MaxAttempts job fails after this amount of unsuccessful attempts.
+	MaxAttempts int
+	// Backoff delay before the first retry, doubled on every next retry.
+	Backoff time.Duration
+}
+
+// delay returns pause after attempt.
+func (p DeleteRetryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < maxDeleteRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxDeleteRetryBackoff {
+		d = maxDeleteRetryBackoff
+	}
+	return d
+}
+
+// SubmitDelete saves delete job of current user's short URLs and queues it.
+// Job is persisted before it's returned, so it's processed even if service restarts.
+func (sh *Shortener) SubmitDelete(ctx context.Context, ids []string) (model.DeleteJob, error) {
+	if len(ids) == 0 {
+		return model.DeleteJob{}, ErrEmptyDeleteBatch
+	}
+	if len(ids) > MaxDeleteBatch {
+		return model.DeleteJob{}, fmt.Errorf("%w: %d short URLs, max is %d",
+			ErrDeleteBatchTooLarge, len(ids), MaxDeleteBatch)
+	}
+	userID, err := sh.GetUserID(ctx)
+	if err != nil {
+		return model.DeleteJob{}, err
+	}
+	job := model.NewDeleteJob(generator.UUIDString(), userID, ids, time.Now().UTC())
+	if err = sh.storage.SaveDeleteJob(ctx, job); err != nil {
+		return model.DeleteJob{}, fmt.Errorf("storage.SaveDeleteJob. %w", err)
+	}
+	sh.enqueueDelete(job)
+	return job, nil
+}
+
+// FindDeleteJob returns current user's delete job.
+func (sh *Shortener) FindDeleteJob(ctx context.Context, id string) (model.DeleteJob, error) {
+	if err := checkUserIsNew(ctx); err != nil {
+		return model.DeleteJob{}, err
+	}
+	userID, err := sh.GetUserID(ctx)
+	if err != nil {
+		return model.DeleteJob{}, err
+	}
+	job, err := sh.storage.FindDeleteJob(ctx, userID, id)
+	if err != nil {
+		return model.DeleteJob{}, fmt.Errorf("storage.FindDeleteJob. %w", err)
+	}
+	return job, nil
+}
+
+// DeleteQueueLen returns amount of jobs waiting in the in-memory queue.
+func (sh *Shortener) DeleteQueueLen() int {
+	return len(sh.deleteQueue)
+}
+
+// RunDeleteWorkers processes delete jobs by the pool of workers until ctx is done.
+// Pending jobs are loaded from storage on start and periodically after that,
+// so jobs accepted before restart or dropped from the full queue are not lost.
+func (sh *Shortener) RunDeleteWorkers(ctx context.Context, workers int, policy DeleteRetryPolicy) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sh.deleteWorker(ctx, policy)
+		}()
+	}
+
+	ticker := time.NewTicker(deleteRescanInterval)
+	defer ticker.Stop()
+	for {
+		sh.requeuePendingDeletes(ctx)
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (sh *Shortener) requeuePendingDeletes(ctx context.Context) {
+	jobs, err := sh.storage.FindPendingDeleteJobs(ctx)
+	if err != nil {
+		logger.Log.Error("find pending delete jobs", zap.Error(err))
+		return
+	}
+	for _, job := range jobs {
+		sh.enqueueDelete(job)
+	}
+}
+
+// enqueueDelete puts job to the queue unless it's already queued or in progress.
+func (sh *Shortener) enqueueDelete(job model.DeleteJob) {
+	if _, loaded := sh.deleteInFlight.LoadOrStore(job.ID, struct{}{}); loaded {
+		return
+	}
+	select {
+	case sh.deleteQueue <- job:
+	default:
+		sh.deleteInFlight.Delete(job.ID)
+		logger.Log.Warn("delete queue is full, job is left for rescan", zap.String("job", job.ID))
+	}
+}
+
+func (sh *Shortener) deleteWorker(ctx context.Context, policy DeleteRetryPolicy) {
+	sh.deleteWorkers.Add(1)
+	defer sh.deleteWorkers.Add(-1)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-sh.deleteQueue:
+			sh.processDeleteJob(ctx, job, policy)
+			sh.deleteInFlight.Delete(job.ID)
+		}
+	}
+}
+
+// processDeleteJob deletes URLs of the job retrying with backoff.
+// Job interrupted by shutdown stays pending and is resumed after restart.
+func (sh *Shortener) processDeleteJob(ctx context.Context, job model.DeleteJob, policy DeleteRetryPolicy) {
+	log := logger.Log.With(zap.String("job", job.ID))
+	for {
+		res, err := sh.storage.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(job.UserID, job.ShortIDs()))
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+		job.Attempts++
+		job.UpdatedAt = time.Now().UTC()
+		if err == nil {
+			job.Status = model.DeleteJobDone
+			job.Results = res
+			job.Error = ""
+			sh.saveDeleteJob(ctx, job)
+			log.Debug("delete job is done")
+			return
+		}
+		job.Error = err.Error()
+		if job.Attempts >= policy.MaxAttempts {
+			job.Status = model.DeleteJobFailed
+			sh.saveDeleteJob(ctx, job)
+			log.Error("delete job failed", zap.Int("attempts", job.Attempts), zap.Error(err))
+			return
+		}
+		sh.saveDeleteJob(ctx, job)
+		log.Warn("delete job attempt failed", zap.Int("attempts", job.Attempts), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(policy.delay(job.Attempts)):
+		}
+	}
+}
+
+// saveDeleteJob saves job progress. Job that failed to be saved as finished
+// stays pending and is processed once again after rescan, deletion is idempotent.
+func (sh *Shortener) saveDeleteJob(ctx context.Context, job model.DeleteJob) {
+	if err := sh.storage.SaveDeleteJob(ctx, job); err != nil {
+		logger.Log.Error("save delete job", zap.String("job", job.ID), zap.Error(err))
+	}
+}
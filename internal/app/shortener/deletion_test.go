@@ -0,0 +1,127 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortener_RunDeleteWorkers(t *testing.T) {
+	errDB := errors.New("connection refused")
+	results := []model.DeleteResult{
+		model.NewDeleteResult("AAAAAAAA", model.DeleteOutcomeDeleted),
+		model.NewDeleteResult("BBBBBBBB", model.DeleteOutcomeNotOwner),
+	}
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantStatus   string
+		wantAttempts int
+		wantResults  []model.DeleteResult
+	}{
+		{
+			name:         "done at first attempt #1",
+			errs:         []error{nil},
+			wantStatus:   model.DeleteJobDone,
+			wantAttempts: 1,
+			wantResults:  results,
+		},
+		{
+			name:         "done after retry #2",
+			errs:         []error{errDB, nil},
+			wantStatus:   model.DeleteJobDone,
+			wantAttempts: 2,
+			wantResults:  results,
+		},
+		{
+			name:         "failed after max attempts #3",
+			errs:         []error{errDB, errDB, errDB},
+			wantStatus:   model.DeleteJobFailed,
+			wantAttempts: 3,
+			wantResults: []model.DeleteResult{
+				model.NewDeleteResult("AAAAAAAA", model.DeleteOutcomePending),
+				model.NewDeleteResult("BBBBBBBB", model.DeleteOutcomePending),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := model.NewDeleteJob("job", "user", []string{"AAAAAAAA", "BBBBBBBB"}, time.Now())
+			bde := model.NewBatchDeleteEntry("user", []string{"AAAAAAAA", "BBBBBBBB"})
+			saved := make(chan model.DeleteJob, 10)
+
+			st := new(storage.MockedStorage)
+			st.On("FindPendingDeleteJobs", mock.Anything).Return([]model.DeleteJob{job}, nil)
+			for _, err := range tt.errs {
+				res := results
+				if err != nil {
+					res = nil
+				}
+				st.On("DeleteUserURLs", mock.Anything, bde).Return(res, err).Once()
+			}
+			st.On("SaveDeleteJob", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+				saved <- args.Get(1).(model.DeleteJob)
+			})
+			sh := New(st)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				sh.RunDeleteWorkers(ctx, 2, DeleteRetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+			}()
+
+			var last model.DeleteJob
+			for i := 0; i < len(tt.errs); i++ {
+				select {
+				case last = <-saved:
+				case <-time.After(time.Second):
+					require.FailNow(t, "job is not saved")
+				}
+			}
+			cancel()
+			<-done
+
+			assert.Equal(t, tt.wantStatus, last.Status)
+			assert.Equal(t, tt.wantAttempts, last.Attempts)
+			assert.Equal(t, tt.wantResults, last.Results)
+			st.AssertNumberOfCalls(t, "DeleteUserURLs", len(tt.errs))
+		})
+	}
+}
+
+func TestShortener_SubmitDelete(t *testing.T) {
+	st := new(storage.MockedStorage)
+	st.On("SaveDeleteJob", mock.Anything, mock.Anything).Return(nil)
+	sh := New(st)
+	ctx := context.WithValue(context.Background(), model.UserIDKey{}, "user")
+
+	_, err := sh.SubmitDelete(ctx, nil)
+	assert.ErrorIs(t, err, ErrEmptyDeleteBatch)
+
+	_, err = sh.SubmitDelete(ctx, make([]string, MaxDeleteBatch+1))
+	assert.ErrorIs(t, err, ErrDeleteBatchTooLarge)
+	st.AssertNotCalled(t, "SaveDeleteJob", mock.Anything, mock.Anything)
+
+	job, err := sh.SubmitDelete(ctx, []string{"AAAAAAAA"})
+	require.NoError(t, err)
+	assert.Equal(t, model.DeleteJobPending, job.Status)
+	assert.Equal(t, "user", job.UserID)
+	assert.Equal(t, 1, sh.DeleteQueueLen())
+	st.AssertCalled(t, "SaveDeleteJob", mock.Anything, job)
+}
+
+func TestDeleteRetryPolicy_delay(t *testing.T) {
+	p := DeleteRetryPolicy{MaxAttempts: 10, Backoff: time.Second}
+	assert.Equal(t, time.Second, p.delay(1))
+	assert.Equal(t, 4*time.Second, p.delay(3))
+	assert.Equal(t, maxDeleteRetryBackoff, p.delay(20))
+}
@@ -0,0 +1,52 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+)
+
+// Names of shortener health checks.
+const (
+	checkDeleteWorkers = "delete_workers"
+	checkShutdown      = "shutdown"
+)
+
+var errDeleteWorkersStopped = errors.New("delete workers are not running")
+
+var errShuttingDown = errors.New("shutdown in progress")
+
+// BeginShutdown marks shortener as shutting down, readiness fails since then.
+func (sh *Shortener) BeginShutdown() {
+	sh.shuttingDown.Store(true)
+}
+
+// Liveness checks that background workers are running.
+func (sh *Shortener) Liveness(ctx context.Context) model.Health {
+	return model.NewHealth([]model.HealthCheck{sh.checkDeleteWorkers()})
+}
+
+// Readiness checks that shortener can serve requests:
+// it is not shutting down, storage is healthy and background workers are running.
+func (sh *Shortener) Readiness(ctx context.Context) model.Health {
+	var err error
+	if sh.shuttingDown.Load() {
+		err = errShuttingDown
+	}
+	checks := []model.HealthCheck{model.NewHealthCheck(checkShutdown, "", err)}
+	checks = append(checks, storage.CheckHealth(ctx, sh.storage)...)
+	checks = append(checks, sh.checkDeleteWorkers())
+	return model.NewHealth(checks)
+}
+
+func (sh *Shortener) checkDeleteWorkers() model.HealthCheck {
+	n := sh.deleteWorkers.Load()
+	var err error
+	if n == 0 {
+		err = errDeleteWorkersStopped
+	}
+	return model.NewHealthCheck(checkDeleteWorkers, fmt.Sprintf("%d workers", n), err)
+}
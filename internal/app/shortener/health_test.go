@@ -0,0 +1,42 @@
+package shortener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestShortener_Readiness(t *testing.T) {
+	st := new(storage.MockedStorage)
+	st.On("Ping", mock.Anything).Return(storage.ErrPingNotDB)
+	st.On("FindPendingDeleteJobs", mock.Anything).Return([]model.DeleteJob(nil), nil)
+	sh := New(st)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	assert.False(t, sh.Liveness(ctx).OK(), "delete workers are not started")
+	assert.False(t, sh.Readiness(ctx).OK(), "delete workers are not started")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sh.RunDeleteWorkers(ctx, 2, DeleteRetryPolicy{MaxAttempts: 1})
+	}()
+	assert.Eventually(t, func() bool {
+		return sh.Readiness(ctx).OK()
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, sh.Liveness(ctx).OK())
+
+	sh.BeginShutdown()
+	assert.False(t, sh.Readiness(ctx).OK(), "shutdown has begun")
+	assert.True(t, sh.Liveness(ctx).OK())
+
+	cancel()
+	<-done
+	assert.False(t, sh.Liveness(context.Background()).OK(), "delete workers are stopped")
+}
@@ -0,0 +1,81 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/hostlist"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"go.uber.org/zap"
+)
+
+// ErrHostBlocked indicates that host of URL is in the blocklist.
+var ErrHostBlocked = errors.New("host is blocked")
+
+// ErrHostNotAllowed indicates that allowlist is configured and host of URL is not in it.
+var ErrHostNotAllowed = errors.New("host is not allowed")
+
+// recheckPageSize amount of URLs read at once while existing URLs are rechecked.
+const recheckPageSize = 1000
+
+// SetHostFilter sets allowlist and blocklist of URL hosts,
+// it must be called before requests are served. Nil filter allows every host.
+func (sh *Shortener) SetHostFilter(f *hostlist.Filter) {
+	sh.hosts = f
+}
+
+// CheckHost returns [ErrHostBlocked] or [ErrHostNotAllowed] if URL can't be shortened
+// because of its host.
+func (sh *Shortener) CheckHost(rawURL string) error {
+	host := hostOf(rawURL)
+	if sh.hosts.Blocked(host) {
+		return fmt.Errorf("%s: %w", host, ErrHostBlocked)
+	}
+	if !sh.hosts.Allowed(host) {
+		return fmt.Errorf("%s: %w", host, ErrHostNotAllowed)
+	}
+	return nil
+}
+
+// RecheckBlockedURLs disables saved URLs whose hosts are in the current blocklist.
+// Disabled URLs are deleted on behalf of their owners, so they answer Gone like deleted ones.
+func (sh *Shortener) RecheckBlockedURLs(ctx context.Context) (model.RecheckResult, error) {
+	var res model.RecheckResult
+	after := ""
+	for {
+		page, err := sh.storage.ExportURLs(ctx, after, recheckPageSize)
+		if err != nil {
+			return res, fmt.Errorf("storage.ExportURLs. %w", err)
+		}
+		blocked := make(map[string][]string)
+		for _, rec := range page {
+			res.Checked++
+			if !rec.DeletedFlag && sh.hosts.Blocked(hostOf(rec.OriginalURL)) {
+				blocked[rec.UserID] = append(blocked[rec.UserID], rec.ShortURL)
+			}
+		}
+		for userID, ids := range blocked {
+			if _, err = sh.storage.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(userID, ids)); err != nil {
+				return res, fmt.Errorf("storage.DeleteUserURLs. %w", err)
+			}
+			res.Disabled += len(ids)
+			logger.Log.Info("blocked URLs disabled", zap.String("userID", userID), zap.Strings("ids", ids))
+		}
+		if len(page) < recheckPageSize {
+			return res, nil
+		}
+		after = page[len(page)-1].ShortURL
+	}
+}
+
+// hostOf returns host of URL without port, invalid URL has empty host.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return hostlist.Normalize(u.Hostname())
+}
@@ -0,0 +1,91 @@
+package shortener
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/hostlist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHostFilter(t *testing.T, allow string, block string) *hostlist.Filter {
+	t.Helper()
+	dir := t.TempDir()
+	allowPath := filepath.Join(dir, "allow.txt")
+	blockPath := filepath.Join(dir, "block.txt")
+	require.NoError(t, os.WriteFile(allowPath, []byte(allow), 0o600))
+	require.NoError(t, os.WriteFile(blockPath, []byte(block), 0o600))
+	f, err := hostlist.NewFilter(allowPath, blockPath)
+	require.NoError(t, err)
+	return f
+}
+
+func TestShortener_CheckHost(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   string
+		block   string
+		url     string
+		wantErr error
+	}{
+		{name: "no lists #1", url: "http://evil.com/"},
+		{name: "blocked exact #2", block: "evil.com", url: "https://EVIL.com:8080/a", wantErr: ErrHostBlocked},
+		{name: "blocked wildcard #3", block: "*.evil.com", url: "http://a.evil.com/", wantErr: ErrHostBlocked},
+		{name: "blocked CIDR #4", block: "10.0.0.0/8", url: "http://10.0.0.1/", wantErr: ErrHostBlocked},
+		{name: "allowed #5", allow: "*.example.com", url: "http://www.example.com/"},
+		{name: "not allowed #6", allow: "*.example.com", url: "http://example.org/", wantErr: ErrHostNotAllowed},
+		{name: "blocklist wins #7", allow: "*.example.com", block: "bad.example.com",
+			url: "http://bad.example.com/", wantErr: ErrHostBlocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh := New(storage.NewMapStorage(generator.DefaultIDGenerator()))
+			sh.SetHostFilter(newHostFilter(t, tt.allow, tt.block))
+			err := sh.CheckHost(tt.url)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+
+			ctx := context.WithValue(context.Background(), model.UserIDKey{}, generator.UUIDString())
+			_, err = sh.SaveURL(ctx, tt.url, time.Time{})
+			assert.ErrorIs(t, err, tt.wantErr, "URL is not saved")
+		})
+	}
+}
+
+func TestShortener_RecheckBlockedURLs(t *testing.T) {
+	sh := New(storage.NewMapStorage(generator.DefaultIDGenerator()))
+	ctx := context.WithValue(context.Background(), model.UserIDKey{}, generator.UUIDString())
+	ok, err := sh.SaveURL(ctx, "http://example.com/", time.Time{})
+	require.NoError(t, err)
+	bad, err := sh.SaveURL(ctx, "http://a.evil.com/", time.Time{})
+	require.NoError(t, err)
+	otherCtx := context.WithValue(context.Background(), model.UserIDKey{}, generator.UUIDString())
+	otherBad, err := sh.SaveURL(otherCtx, "http://evil.com/", time.Time{})
+	require.NoError(t, err)
+
+	sh.SetHostFilter(newHostFilter(t, "", "evil.com\n*.evil.com\n"))
+	res, err := sh.RecheckBlockedURLs(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, model.RecheckResult{Checked: 3, Disabled: 2}, res)
+
+	_, err = sh.FindURL(ctx, ok)
+	assert.NoError(t, err)
+	for _, id := range []string{bad, otherBad} {
+		_, err = sh.FindURL(ctx, id)
+		assert.ErrorIs(t, err, storage.ErrResultIsDeleted, id)
+	}
+
+	res, err = sh.RecheckBlockedURLs(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, model.RecheckResult{Checked: 3}, res, "disabled URLs are not disabled again")
+}
@@ -0,0 +1,138 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+)
+
+// ErrQuotaExceeded indicates that user has reached limit of active URLs or URLs created per day.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// ErrBatchTooLarge indicates that batch has more entries than user is allowed to save at once.
+var ErrBatchTooLarge = errors.New("batch is too large")
+
+// Names of quotas reported in [QuotaError].
+const (
+	QuotaActive = "active"
+	QuotaDaily  = "daily"
+	QuotaBatch  = "batch"
+)
+
+// quotaWindow period that daily quota counts created URLs in.
+const quotaWindow = 24 * time.Hour
+
+// Quota limits of every user, zero limit means no limit.
+type Quota struct {
+	// MaxActive amount of URLs that are neither deleted nor expired.
+	// URLs adopted by account on signup or login are not limited.
+	MaxActive int
+	// MaxPerDay amount of URLs created during the last 24 hours, deleted ones are counted too.
+	MaxPerDay int
+	// MaxBatch amount of URLs saved by single batch request.
+	MaxBatch int
+}
+
+// QuotaError describes quota that request exceeds.
+// It wraps [ErrBatchTooLarge] for batch quota and [ErrQuotaExceeded] for others.
+type QuotaError struct {
+	Quota     string
+	Limit     int
+	Used      int
+	Requested int
+}
+
+// Error returns description of exceeded quota.
+func (e *QuotaError) Error() string {
+	if e.Quota == QuotaBatch {
+		return fmt.Sprintf("batch of %d URLs is larger than limit %d", e.Requested, e.Limit)
+	}
+	return fmt.Sprintf("%s URLs quota exceeded: %d of %d used, %d requested",
+		e.Quota, e.Used, e.Limit, e.Requested)
+}
+
+// Unwrap returns sentinel error of the quota.
+func (e *QuotaError) Unwrap() error {
+	if e.Quota == QuotaBatch {
+		return ErrBatchTooLarge
+	}
+	return ErrQuotaExceeded
+}
+
+// SetQuota sets limits of every user, it must be called before requests are served.
+func (sh *Shortener) SetQuota(q Quota) {
+	sh.quota = q
+}
+
+// Quota returns limits of every user.
+func (sh *Shortener) Quota() Quota {
+	return sh.quota
+}
+
+// FindQuotaUsage returns usage of current user's quotas.
+func (sh *Shortener) FindQuotaUsage(ctx context.Context) (model.QuotaUsage, error) {
+	userID, err := sh.GetUserID(ctx)
+	if err != nil {
+		return model.QuotaUsage{}, err
+	}
+	count, err := sh.countUserURLs(ctx, userID, time.Now())
+	if err != nil {
+		return model.QuotaUsage{}, err
+	}
+	return model.QuotaUsage{
+		Active:   model.QuotaValue{Used: count.Active, Limit: sh.quota.MaxActive},
+		Daily:    model.QuotaValue{Used: count.Created, Limit: sh.quota.MaxPerDay},
+		MaxBatch: sh.quota.MaxBatch,
+	}, nil
+}
+
+// limitContext returns ctx with limits of user's URLs that storage checks atomically with the save,
+// so URL that is already saved is reported as conflict even if user has reached quota.
+func (sh *Shortener) limitContext(ctx context.Context) context.Context {
+	if sh.quota.MaxActive == 0 && sh.quota.MaxPerDay == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, model.URLLimitKey{}, model.URLLimit{
+		MaxActive: sh.quota.MaxActive,
+		MaxPerDay: sh.quota.MaxPerDay,
+		Since:     time.Now().Add(-quotaWindow),
+	})
+}
+
+// quotaError converts [*storage.LimitError] to [*QuotaError], other errors are returned as is.
+func quotaError(err error) error {
+	var le *storage.LimitError
+	if !errors.As(err, &le) {
+		return err
+	}
+	qe := &QuotaError{Quota: QuotaActive, Limit: le.Limit, Used: le.Used, Requested: le.Requested}
+	if le.Daily {
+		qe.Quota = QuotaDaily
+	}
+	return qe
+}
+
+// checkBatchQuota returns [*QuotaError] if batch of n URLs is too large.
+func (sh *Shortener) checkBatchQuota(n int) error {
+	if limit := sh.quota.MaxBatch; limit > 0 && n > limit {
+		return &QuotaError{Quota: QuotaBatch, Limit: limit, Requested: n}
+	}
+	return nil
+}
+
+// countUserURLs counts URLs of user, new user has no URLs yet.
+func (sh *Shortener) countUserURLs(ctx context.Context, userID string,
+	now time.Time) (model.URLCount, error) {
+	if errors.Is(checkUserIsNew(ctx), ErrUserIsNew) {
+		return model.URLCount{}, nil
+	}
+	count, err := sh.storage.CountUserURLs(ctx, userID, now, now.Add(-quotaWindow))
+	if err != nil {
+		return model.URLCount{}, fmt.Errorf("storage.CountUserURLs. %w", err)
+	}
+	return count, nil
+}
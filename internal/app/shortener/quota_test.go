@@ -0,0 +1,131 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortener_Quota(t *testing.T) {
+	tests := []struct {
+		name      string
+		quota     Quota
+		saved     int
+		batch     int
+		wantQuota string
+		wantErr   error
+	}{
+		{name: "no limits #1", quota: Quota{}, saved: 5, batch: 5},
+		{name: "within limits #2", quota: Quota{MaxActive: 5, MaxPerDay: 5, MaxBatch: 2}, saved: 3, batch: 2},
+		{name: "batch too large #3", quota: Quota{MaxBatch: 2}, batch: 3,
+			wantQuota: QuotaBatch, wantErr: ErrBatchTooLarge},
+		{name: "active exceeded #4", quota: Quota{MaxActive: 4, MaxPerDay: 10}, saved: 3, batch: 2,
+			wantQuota: QuotaActive, wantErr: ErrQuotaExceeded},
+		{name: "daily exceeded #5", quota: Quota{MaxActive: 10, MaxPerDay: 3}, saved: 3, batch: 1,
+			wantQuota: QuotaDaily, wantErr: ErrQuotaExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh := New(storage.NewMapStorage(generator.DefaultIDGenerator()))
+			sh.SetQuota(tt.quota)
+			ctx := context.WithValue(context.Background(), model.UserIDKey{}, generator.UUIDString())
+			for i := 0; i < tt.saved; i++ {
+				_, err := sh.SaveURL(ctx, fmt.Sprintf("http://localhost:30000/%d", i), time.Time{})
+				require.NoError(t, err)
+			}
+			batch := make([]model.BatchReqEntry, 0, tt.batch)
+			for i := 0; i < tt.batch; i++ {
+				batch = append(batch, model.NewBatchReqEntry(fmt.Sprint(i),
+					fmt.Sprintf("http://localhost:30001/%d", i)))
+			}
+			_, err := sh.SaveURLBatch(ctx, batch)
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+			var qe *QuotaError
+			require.ErrorAs(t, err, &qe)
+			assert.Equal(t, tt.wantQuota, qe.Quota)
+			assert.Equal(t, tt.batch, qe.Requested)
+		})
+	}
+}
+
+func TestShortener_FindQuotaUsage(t *testing.T) {
+	st := storage.NewMapStorage(generator.DefaultIDGenerator())
+	sh := New(st)
+	sh.SetQuota(Quota{MaxActive: 2, MaxPerDay: 3, MaxBatch: 10})
+	userID := generator.UUIDString()
+	ctx := context.WithValue(context.Background(), model.UserIDKey{}, userID)
+
+	first, err := sh.SaveURL(ctx, "http://localhost:30000/", time.Time{})
+	require.NoError(t, err)
+	_, err = sh.SaveURLWithID(ctx, "alias", "http://localhost:30001/", time.Time{})
+	require.NoError(t, err)
+	_, err = sh.SaveURL(ctx, "http://localhost:30002/", time.Time{})
+	assert.ErrorIs(t, err, ErrQuotaExceeded, "active quota is reached")
+
+	_, err = st.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(userID, []string{first}))
+	require.NoError(t, err)
+	usage, err := sh.FindQuotaUsage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, model.QuotaUsage{
+		Active:   model.QuotaValue{Used: 1, Limit: 2},
+		Daily:    model.QuotaValue{Used: 2, Limit: 3},
+		MaxBatch: 10,
+	}, usage, "deleted URL frees active quota but not daily one")
+
+	newCtx := context.WithValue(ctx, model.IsUserNew{}, true)
+	usage, err = sh.FindQuotaUsage(newCtx)
+	require.NoError(t, err)
+	assert.Zero(t, usage.Active.Used)
+}
+
+func TestShortener_QuotaConflict(t *testing.T) {
+	sh := New(storage.NewMapStorage(generator.DefaultIDGenerator()))
+	sh.SetQuota(Quota{MaxActive: 1})
+	ctx := context.WithValue(context.Background(), model.UserIDKey{}, generator.UUIDString())
+
+	id, err := sh.SaveURL(ctx, "http://localhost:30000/", time.Time{})
+	require.NoError(t, err)
+	existing, err := sh.SaveURL(ctx, "http://localhost:30000/", time.Time{})
+	assert.ErrorIs(t, err, storage.ErrDBConflict, "resubmitted URL is conflict, not quota error")
+	assert.Equal(t, id, existing)
+	_, err = sh.SaveURLWithID(ctx, "alias", "http://localhost:30001/", time.Time{})
+	var qe *QuotaError
+	require.ErrorAs(t, err, &qe)
+	assert.Equal(t, QuotaError{Quota: QuotaActive, Limit: 1, Used: 1, Requested: 1}, *qe)
+}
+
+func TestShortener_QuotaConcurrent(t *testing.T) {
+	st := storage.NewMapStorage(generator.DefaultIDGenerator())
+	sh := New(st)
+	sh.SetQuota(Quota{MaxActive: 5})
+	userID := generator.UUIDString()
+	ctx := context.WithValue(context.Background(), model.UserIDKey{}, userID)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := sh.SaveURL(ctx, fmt.Sprintf("http://localhost:30000/%d", i), time.Time{})
+			if err != nil {
+				assert.ErrorIs(t, err, ErrQuotaExceeded)
+			}
+		}(i)
+	}
+	wg.Wait()
+	count, err := st.CountUserURLs(ctx, userID, time.Now(), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 5, count.Active, "concurrent requests don't exceed quota")
+}
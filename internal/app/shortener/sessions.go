@@ -0,0 +1,127 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/auth"
+)
+
+// ErrInvalidSession indicates that refresh token is malformed, expired, revoked or already used.
+var ErrInvalidSession = errors.New("invalid session")
+
+// ErrTokenRevoked indicates that access token is revoked by logout.
+var ErrTokenRevoked = errors.New("token is revoked")
+
+const (
+	// refreshReuseGrace how long used refresh token returns the session it was rotated to.
+	refreshReuseGrace = 30 * time.Second
+
+	// rotatedSessionsSize max amount of remembered rotated sessions.
+	rotatedSessionsSize = 10000
+
+	// revokedTokensSize max amount of cached lookups of the token denylist.
+	revokedTokensSize = 100_000
+
+	// notRevokedTTL how long token that is not revoked is trusted without the denylist lookup,
+	// token revoked by other instance is accepted by this one at most so long.
+	notRevokedTTL = 5 * time.Second
+)
+
+// CheckToken returns [ErrTokenRevoked] if access token is in the denylist.
+// Tokens issued without ID can't be revoked, they are short-lived anyway.
+// Lookups are cached in memory: revoked token until it expires, other tokens for [notRevokedTTL].
+func (sh *Shortener) CheckToken(ctx context.Context, claims *auth.Claims) error {
+	if claims.ID == "" {
+		return nil
+	}
+	revoked, ok := sh.revokedTokens.Get(claims.ID)
+	if !ok {
+		var err error
+		revoked, err = sh.storage.IsTokenRevoked(ctx, claims.ID)
+		if err != nil {
+			return fmt.Errorf("storage.IsTokenRevoked. %w", err)
+		}
+		ttl := notRevokedTTL
+		if revoked && claims.ExpiresAt != nil {
+			ttl = time.Until(claims.ExpiresAt.Time)
+		}
+		sh.revokedTokens.Add(claims.ID, revoked, ttl)
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// RefreshSession revokes refresh token and issues new session of the same user,
+// so every refresh token can be used only once.
+// Parallel requests of the same client race to refresh with the same token, so during
+// [refreshReuseGrace] after rotation the token returns the session it was rotated to.
+// Rotated sessions are remembered in memory of the instance that rotated them,
+// the session revoked by logout is not returned.
+func (sh *Shortener) RefreshSession(ctx context.Context, refreshToken string) (auth.Session, error) {
+	claims, err := auth.ParseRefreshClaims(refreshToken)
+	if err != nil {
+		return auth.Session{}, fmt.Errorf("auth.ParseRefreshClaims: %v. %w", err, ErrInvalidSession)
+	}
+	res, err, _ := sh.refreshGroup.Do(claims.ID, func() (any, error) {
+		if sess, ok := sh.rotated.Get(claims.ID); ok {
+			revoked, err := sh.storage.IsTokenRevoked(ctx, sess.RefreshClaims.ID)
+			if err != nil {
+				return auth.Session{}, fmt.Errorf("storage.IsTokenRevoked. %w", err)
+			}
+			if revoked {
+				return auth.Session{}, fmt.Errorf("rotated session is revoked. %w", ErrInvalidSession)
+			}
+			return sess, nil
+		}
+		revoked, err := sh.storage.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time)
+		if err != nil {
+			return auth.Session{}, fmt.Errorf("storage.RevokeToken. %w", err)
+		}
+		if !revoked {
+			return auth.Session{}, fmt.Errorf("refresh token is already used. %w", ErrInvalidSession)
+		}
+		sess, err := auth.NewSession(claims.Subject, claims.Account)
+		if err != nil {
+			return auth.Session{}, fmt.Errorf("auth.NewSession. %w", err)
+		}
+		sh.rotated.Add(claims.ID, sess, refreshReuseGrace)
+		return sess, nil
+	})
+	return res.(auth.Session), err
+}
+
+// Logout revokes access token and refresh token of the same user.
+// Refresh token is optional, invalid one is ignored.
+func (sh *Shortener) Logout(ctx context.Context, access *auth.Claims, refreshToken string) error {
+	if _, ok := ctx.Value(model.APIKeyKey{}).(model.APIKey); ok {
+		return ErrSessionRequired
+	}
+	if err := sh.revokeToken(ctx, access); err != nil {
+		return err
+	}
+	if refreshToken == "" {
+		return nil
+	}
+	refresh, err := auth.ParseRefreshClaims(refreshToken)
+	if err != nil || access == nil || refresh.Subject != access.Subject {
+		return nil
+	}
+	return sh.revokeToken(ctx, refresh)
+}
+
+func (sh *Shortener) revokeToken(ctx context.Context, claims *auth.Claims) error {
+	if claims == nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	if _, err := sh.storage.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return fmt.Errorf("storage.RevokeToken. %w", err)
+	}
+	sh.revokedTokens.Add(claims.ID, true, time.Until(claims.ExpiresAt.Time))
+	return nil
+}
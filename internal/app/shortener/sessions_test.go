@@ -0,0 +1,81 @@
+package shortener
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/auth"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortener_RefreshSession(t *testing.T) {
+	sh := New(storage.NewMapStorage(generator.DefaultIDGenerator()))
+	ctx := context.Background()
+	sess, err := auth.NewAnonymousSession()
+	require.NoError(t, err)
+
+	const parallel = 8
+	var wg sync.WaitGroup
+	rotated := make([]auth.Session, parallel)
+	errs := make([]error, parallel)
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rotated[i], errs[i] = sh.RefreshSession(ctx, sess.Refresh)
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < parallel; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, rotated[0].Refresh, rotated[i].Refresh, "parallel refresh returns the same session")
+	}
+	assert.Equal(t, sess.AccessClaims.Subject, rotated[0].AccessClaims.Subject)
+	assert.NotEqual(t, sess.Refresh, rotated[0].Refresh)
+
+	again, err := sh.RefreshSession(ctx, sess.Refresh)
+	require.NoError(t, err)
+	assert.Equal(t, rotated[0].Access, again.Access, "reuse within grace window")
+
+	next, err := sh.RefreshSession(ctx, rotated[0].Refresh)
+	require.NoError(t, err)
+	assert.NotEqual(t, rotated[0].Refresh, next.Refresh)
+
+	require.NoError(t, sh.Logout(ctx, next.AccessClaims, next.Refresh))
+	_, err = sh.RefreshSession(ctx, rotated[0].Refresh)
+	assert.ErrorIs(t, err, ErrInvalidSession, "rotated session is revoked by logout")
+	_, err = sh.RefreshSession(ctx, next.Refresh)
+	assert.ErrorIs(t, err, ErrInvalidSession)
+
+	_, err = sh.RefreshSession(ctx, sess.Access)
+	assert.ErrorIs(t, err, ErrInvalidSession, "access token is used as refresh token")
+}
+
+func TestShortener_CheckToken(t *testing.T) {
+	st := new(storage.MockedStorage)
+	sh := New(st)
+	ctx := context.Background()
+	active, err := auth.NewAnonymousSession()
+	require.NoError(t, err)
+	revoked, err := auth.NewAnonymousSession()
+	require.NoError(t, err)
+	loggedOut, err := auth.NewAnonymousSession()
+	require.NoError(t, err)
+	st.On("IsTokenRevoked", mock.Anything, active.AccessClaims.ID).Return(false, nil).Once()
+	st.On("IsTokenRevoked", mock.Anything, revoked.AccessClaims.ID).Return(true, nil).Once()
+	st.On("RevokeToken", mock.Anything, loggedOut.AccessClaims.ID, mock.Anything).Return(true, nil).Once()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, sh.CheckToken(ctx, active.AccessClaims))
+		assert.ErrorIs(t, sh.CheckToken(ctx, revoked.AccessClaims), ErrTokenRevoked)
+	}
+	require.NoError(t, sh.Logout(ctx, loggedOut.AccessClaims, ""))
+	assert.ErrorIs(t, sh.CheckToken(ctx, loggedOut.AccessClaims), ErrTokenRevoked,
+		"token revoked by this instance is cached")
+	st.AssertExpectations(t)
+}
@@ -4,11 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/denis-oreshkevich/shortener/internal/app/model"
 	"github.com/denis-oreshkevich/shortener/internal/app/storage"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/auth"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/hostlist"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/lru"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
 // ErrUserIsNew indicates that user is new.
@@ -17,37 +24,123 @@ var ErrUserIsNew = errors.New("user is new")
 // ErrUserItemsNotFound indicates that user URLs not found.
 var ErrUserItemsNotFound = errors.New("user items not found")
 
+// ErrAliasNotCreated indicates that alias is not created because URL is already shortened
+// under another short ID.
+var ErrAliasNotCreated = errors.New("URL is already shortened, alias is not created")
+
+// ErrInvalidExpiration indicates that requested expiration is in the past or TTL is negative or above [MaxTTL].
+var ErrInvalidExpiration = errors.New("invalid expiration")
+
 // TODO think about transactions on this level
 
 // Shortener model represents business logic layer.
 type Shortener struct {
-	storage storage.Storage
+	storage     storage.Storage
+	clicks      chan model.Click
+	deleteQueue chan model.DeleteJob
+	// deleteInFlight holds IDs of jobs that are queued or being processed.
+	deleteInFlight sync.Map
+	// deleteWorkers amount of running delete workers.
+	deleteWorkers atomic.Int32
+	shuttingDown  atomic.Bool
+	quota         Quota
+	hosts         *hostlist.Filter
+	canonical     Canonical
+	// rotated sessions issued by refresh tokens recently, see [Shortener.RefreshSession].
+	rotated      *lru.Cache[string, auth.Session]
+	refreshGroup singleflight.Group
+	// revokedTokens cached lookups of the token denylist, see [Shortener.CheckToken].
+	revokedTokens *lru.Cache[string, bool]
 }
 
 // New creates new [*Shortener].
 func New(st storage.Storage) *Shortener {
 	return &Shortener{
-		storage: st,
+		storage:     st,
+		clicks:      make(chan model.Click, clicksBufferSize),
+		deleteQueue: make(chan model.DeleteJob, deleteQueueSize),
+		rotated:     lru.New[string, auth.Session](rotatedSessionsSize),
+
+		revokedTokens: lru.New[string, bool](revokedTokensSize),
 	}
 }
 
 // SaveURL saves URL to storage and returns back short ID.
-func (sh *Shortener) SaveURL(ctx context.Context, url string) (string, error) {
+// Zero expiresAt means that URL never expires. If URL with the same canonical form
+// is already saved, its short ID and [storage.ErrDBConflict] are returned.
+// Returns [*QuotaError] if user has reached quota and [ErrHostBlocked] or [ErrHostNotAllowed]
+// if host of URL is rejected.
+func (sh *Shortener) SaveURL(ctx context.Context, url string, expiresAt time.Time) (string, error) {
+	userID, err := sh.GetUserID(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err = sh.CheckHost(url); err != nil {
+		return "", err
+	}
+	id, err := sh.storage.SaveURL(sh.limitContext(ctx), userID, url, sh.canonical.Canonicalize(url), expiresAt)
+	return id, quotaError(err)
+}
+
+// SaveURLWithID saves URL to storage under short ID chosen by user.
+// Zero expiresAt means that URL never expires. If URL with the same canonical form
+// is already saved under another short ID, that short ID and error wrapping both
+// [ErrAliasNotCreated] and [storage.ErrDBConflict] are returned.
+// Returns [*QuotaError] if user has reached quota and [ErrHostBlocked] or [ErrHostNotAllowed]
+// if host of URL is rejected.
+func (sh *Shortener) SaveURLWithID(ctx context.Context, id string, url string,
+	expiresAt time.Time) (string, error) {
 	userID, err := sh.GetUserID(ctx)
 	if err != nil {
 		return "", err
 	}
-	return sh.storage.SaveURL(ctx, userID, url)
+	if err = sh.CheckHost(url); err != nil {
+		return "", err
+	}
+	res, err := sh.storage.SaveURLWithID(sh.limitContext(ctx), userID, id, url,
+		sh.canonical.Canonicalize(url), expiresAt, time.Now())
+	if errors.Is(err, storage.ErrDBConflict) && res != id {
+		return res, fmt.Errorf("alias %s. %w. %w", id, ErrAliasNotCreated, err)
+	}
+	return res, quotaError(err)
 }
 
 // SaveURLBatch saves many URLs to storage and return [[]model.BatchRespEntry] back.
+// TTL of every entry is converted to ExpiresAt before saving. Entry whose canonical form
+// is already saved gets existing short ID.
+// Returns [*QuotaError] if batch is too large or user has no room for its entries that are not deduplicated.
+// Whole batch is rejected if host of any entry is rejected.
 func (sh *Shortener) SaveURLBatch(ctx context.Context,
 	batch []model.BatchReqEntry) ([]model.BatchRespEntry, error) {
 	userID, err := sh.GetUserID(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return sh.storage.SaveURLBatch(ctx, userID, batch)
+	if err = sh.checkBatchQuota(len(batch)); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	entries := make([]model.BatchReqEntry, 0, len(batch))
+	for _, b := range batch {
+		if hostErr := sh.CheckHost(b.OriginalURL); hostErr != nil {
+			return nil, fmt.Errorf("entry %s: %w", b.CorrelationID, hostErr)
+		}
+		expiresAt, expErr := ExpiresAt(now, b.TTL, b.ExpiresAt)
+		if expErr != nil {
+			return nil, fmt.Errorf("entry %s: %w", b.CorrelationID, expErr)
+		}
+		entry := model.NewBatchReqEntry(b.CorrelationID, b.OriginalURL)
+		entry.CanonicalURL = sh.canonical.Canonicalize(b.OriginalURL)
+		if !expiresAt.IsZero() {
+			entry.ExpiresAt = &expiresAt
+		}
+		entries = append(entries, entry)
+	}
+	resp, err := sh.storage.SaveURLBatch(sh.limitContext(ctx), userID, entries)
+	if err != nil {
+		return nil, quotaError(err)
+	}
+	return resp, nil
 }
 
 // FindURL finds original URL by short ID.
@@ -61,15 +154,8 @@ func (sh *Shortener) FindURL(ctx context.Context, id string) (string, error) {
 
 // FindUserURLs finds user's URLs.
 func (sh *Shortener) FindUserURLs(ctx context.Context) ([]model.URLPair, error) {
-	value := ctx.Value(model.IsUserNew{})
-	if value != nil {
-		b, ok := value.(bool)
-		if !ok {
-			return nil, errors.New("IsUserNew is not bool")
-		}
-		if b {
-			return nil, ErrUserIsNew
-		}
+	if err := checkUserIsNew(ctx); err != nil {
+		return nil, err
 	}
 
 	userID, err := sh.GetUserID(ctx)
@@ -87,28 +173,114 @@ func (sh *Shortener) FindUserURLs(ctx context.Context) ([]model.URLPair, error)
 	return pairs, nil
 }
 
-// DeleteUserURLs deletes user's URLs.
-func (sh *Shortener) DeleteUserURLs(ctx context.Context, in <-chan model.BatchDeleteEntry) {
-	for del := range in {
-		logger.Log.Debug("received from channel DeleteUserURLs")
-		err := sh.storage.DeleteUserURLs(ctx, del)
-		if err != nil {
-			logger.Log.Error("delete user URLs.", zap.Error(err))
+// FindUserURLsPage finds up to limit user's URLs with short ID greater than after.
+func (sh *Shortener) FindUserURLsPage(ctx context.Context, after string,
+	limit int) ([]model.URLPair, error) {
+	if err := checkUserIsNew(ctx); err != nil {
+		return nil, err
+	}
+	userID, err := sh.GetUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := sh.storage.FindUserURLsPage(ctx, userID, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("storage.FindUserURLsPage. %w", err)
+	}
+	return pairs, nil
+}
+
+// ReapExpiredURLs periodically sets delete status for expired URLs,
+// drops expired tokens from the denylist and full rate limit buckets until ctx is done.
+func (sh *Shortener) ReapExpiredURLs(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case now := <-ticker.C:
+			count, err := sh.storage.DeleteExpiredURLs(ctx, now)
+			if err != nil {
+				logger.Log.Error("delete expired URLs.", zap.Error(err))
+			} else if count > 0 {
+				logger.Log.Info(fmt.Sprintf("expired URLs deleted count = %d", count))
+			}
+			count, err = sh.storage.DeleteExpiredRevokedTokens(ctx, now)
+			if err != nil {
+				logger.Log.Error("delete expired revoked tokens.", zap.Error(err))
+			} else if count > 0 {
+				logger.Log.Debug(fmt.Sprintf("expired revoked tokens deleted count = %d", count))
+			}
+			count, err = storage.DeleteExpiredRateLimits(ctx, sh.storage, now)
+			if err != nil && !errors.Is(err, storage.ErrRateLimitNotSupported) {
+				logger.Log.Error("delete expired rate limits.", zap.Error(err))
+			} else if count > 0 {
+				logger.Log.Debug(fmt.Sprintf("expired rate limits deleted count = %d", count))
+			}
 		}
 	}
 }
 
+// TakeRateLimit takes token from rate limit bucket kept in storage,
+// it returns [storage.ErrRateLimitNotSupported] if storage can't keep buckets.
+func (sh *Shortener) TakeRateLimit(ctx context.Context, key string, now time.Time,
+	interval time.Duration, tolerance time.Duration) (time.Time, bool, error) {
+	return storage.TakeRateLimit(ctx, sh.storage, key, now, interval, tolerance)
+}
+
+// MaxTTL max TTL in seconds, longer TTL would overflow [time.Duration].
+const MaxTTL int64 = 100 * 365 * 24 * 60 * 60
+
+// ExpiresAt calculates expiration time from TTL in seconds or exact time.
+// TTL is used if both are present. Zero result means that URL never expires.
+func ExpiresAt(now time.Time, ttl int64, at *time.Time) (time.Time, error) {
+	if ttl < 0 || ttl > MaxTTL {
+		return time.Time{}, ErrInvalidExpiration
+	}
+	if ttl > 0 {
+		return now.Add(time.Duration(ttl) * time.Second), nil
+	}
+	if at == nil || at.IsZero() {
+		return time.Time{}, nil
+	}
+	if !at.After(now) {
+		return time.Time{}, ErrInvalidExpiration
+	}
+	return *at, nil
+}
+
 // FindStats find statistic by stored values
 func (sh *Shortener) FindStats(ctx context.Context) (model.Stat, error) {
 	return sh.storage.FindStats(ctx)
 }
 
+// Compact compacts storage if it supports compaction.
+func (sh *Shortener) Compact(ctx context.Context) error {
+	return storage.Compact(ctx, sh.storage)
+}
+
 // Ping pings storage.
 func (sh *Shortener) Ping(ctx context.Context) error {
 	return sh.storage.Ping(ctx)
 }
 
+// checkUserIsNew returns [ErrUserIsNew] if user got ID in current request.
+func checkUserIsNew(ctx context.Context) error {
+	value := ctx.Value(model.IsUserNew{})
+	if value == nil {
+		return nil
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return errors.New("IsUserNew is not bool")
+	}
+	if b {
+		return ErrUserIsNew
+	}
+	return nil
+}
+
 // GetUserID gets user ID from context.
 func (sh *Shortener) GetUserID(ctx context.Context) (string, error) {
 	value := ctx.Value(model.UserIDKey{})
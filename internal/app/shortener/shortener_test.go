@@ -0,0 +1,44 @@
+package shortener
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiresAt(t *testing.T) {
+	now := time.Now()
+	future := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+	tests := []struct {
+		name    string
+		ttl     int64
+		at      *time.Time
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "never expires #1", want: time.Time{}},
+		{name: "TTL #2", ttl: 60, want: now.Add(time.Minute)},
+		{name: "TTL over exact time #3", ttl: 60, at: &future, want: now.Add(time.Minute)},
+		{name: "exact time #4", at: &future, want: future},
+		{name: "exact time in the past #5", at: &past, wantErr: true},
+		{name: "negative TTL #6", ttl: -1, wantErr: true},
+		{name: "max TTL #7", ttl: MaxTTL, want: now.Add(time.Duration(MaxTTL) * time.Second)},
+		{name: "TTL above max #8", ttl: MaxTTL + 1, wantErr: true},
+		{name: "TTL overflows duration #9", ttl: math.MaxInt64 / 1000, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpiresAt(now, tt.ttl, tt.at)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidExpiration)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(got), "got %s", got)
+		})
+	}
+}
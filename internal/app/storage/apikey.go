@@ -0,0 +1,17 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+)
+
+// sortAPIKeys sorts keys by creation time, key ID breaks ties.
+func sortAPIKeys(keys []model.APIKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+}
@@ -0,0 +1,319 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/lru"
+	"golang.org/x/sync/singleflight"
+)
+
+// CachingStorage decorator that caches results of [Storage.FindURL].
+// Concurrent misses of the same short ID are coalesced into single lookup.
+// Not found and deleted results are cached too, but for shorter time.
+type CachingStorage struct {
+	st          Storage
+	cache       *lru.Cache[string, cachedURL]
+	group       singleflight.Group
+	ttl         time.Duration
+	negativeTTL time.Duration
+	// epoch is incremented on every invalidation, so lookup that started
+	// before it doesn't put stale value to the cache.
+	epoch atomic.Uint64
+	mx    sync.Mutex
+}
+
+// findURLTimeout limits shared lookup of [CachingStorage.FindURL].
+const findURLTimeout = 5 * time.Second
+
+var _ Storage = (*CachingStorage)(nil)
+
+var _ HealthChecker = (*CachingStorage)(nil)
+
+var _ RateLimitStore = (*CachingStorage)(nil)
+
+type cachedURL struct {
+	orig OrigURL
+	err  error
+}
+
+// NewCachingStorage creates new [*CachingStorage] that holds at most size URLs.
+func NewCachingStorage(st Storage, size int, ttl time.Duration,
+	negativeTTL time.Duration) *CachingStorage {
+	return &CachingStorage{
+		st:          st,
+		cache:       lru.New[string, cachedURL](size),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+	}
+}
+
+// SaveURL saves original URL and returns short URL.
+func (cs *CachingStorage) SaveURL(ctx context.Context, userID string, url string, canonical string,
+	expiresAt time.Time) (string, error) {
+	id, err := cs.st.SaveURL(ctx, userID, url, canonical, expiresAt)
+	cs.invalidate(id)
+	return id, err
+}
+
+// SaveURLWithID saves original URL under provided short ID.
+func (cs *CachingStorage) SaveURLWithID(ctx context.Context, userID string,
+	id string, url string, canonical string, expiresAt time.Time, createdAt time.Time) (string, error) {
+	res, err := cs.st.SaveURLWithID(ctx, userID, id, url, canonical, expiresAt, createdAt)
+	cs.invalidate(id)
+	return res, err
+}
+
+// SaveURLBatch saves many URLs and return [[]model.BatchRespEntry] back.
+func (cs *CachingStorage) SaveURLBatch(ctx context.Context, userID string,
+	batch []model.BatchReqEntry) ([]model.BatchRespEntry, error) {
+	resp, err := cs.st.SaveURLBatch(ctx, userID, batch)
+	ids := make([]string, 0, len(resp))
+	for _, r := range resp {
+		ids = append(ids, path.Base(r.ShortURL))
+	}
+	cs.invalidate(ids...)
+	return resp, err
+}
+
+// FindURL finds original URL in the cache and falls back to the storage.
+func (cs *CachingStorage) FindURL(ctx context.Context, id string) (*OrigURL, error) {
+	if c, ok := cs.cache.Get(id); ok {
+		return c.result()
+	}
+	epoch := cs.epoch.Load()
+	ch := cs.group.DoChan(id, func() (any, error) {
+		// lookup is shared by all coalesced callers, so it must not fail when the first one goes away.
+		loadCtx, cancel := context.WithTimeout(withoutCancel{ctx}, findURLTimeout)
+		defer cancel()
+		orig, err := cs.st.FindURL(loadCtx, id)
+		c := cachedURL{err: err}
+		if orig != nil {
+			c.orig = *orig
+		}
+		switch {
+		case err == nil:
+			cs.add(epoch, id, c, cs.ttl)
+		case errors.Is(err, ErrNotFound), errors.Is(err, ErrResultIsDeleted):
+			cs.add(epoch, id, c, cs.negativeTTL)
+		default:
+			return nil, err
+		}
+		return c, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(cachedURL).result()
+	}
+}
+
+// withoutCancel context that keeps values of parent but is never canceled with it.
+type withoutCancel struct {
+	parent context.Context
+}
+
+func (withoutCancel) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (withoutCancel) Done() <-chan struct{} { return nil }
+
+func (withoutCancel) Err() error { return nil }
+
+func (c withoutCancel) Value(key any) any { return c.parent.Value(key) }
+
+// FindUserURLs finds user's URLs.
+func (cs *CachingStorage) FindUserURLs(ctx context.Context, userID string) ([]model.URLPair, error) {
+	return cs.st.FindUserURLs(ctx, userID)
+}
+
+// FindUserURLsPage returns page of user's URLs ordered by short ID.
+func (cs *CachingStorage) FindUserURLsPage(ctx context.Context, userID string,
+	after string, limit int) ([]model.URLPair, error) {
+	return cs.st.FindUserURLsPage(ctx, userID, after, limit)
+}
+
+// DeleteUserURLs deletes user's URLs and removes them from the cache.
+func (cs *CachingStorage) DeleteUserURLs(ctx context.Context,
+	bde model.BatchDeleteEntry) ([]model.DeleteResult, error) {
+	res, err := cs.st.DeleteUserURLs(ctx, bde)
+	cs.invalidate(bde.ShortIDs...)
+	return res, err
+}
+
+// DeleteExpiredURLs deletes expired URLs.
+// Cached URLs don't need invalidation because expiration is checked on every cache hit.
+func (cs *CachingStorage) DeleteExpiredURLs(ctx context.Context, now time.Time) (int64, error) {
+	return cs.st.DeleteExpiredURLs(ctx, now)
+}
+
+// CountUserURLs counts user's URLs.
+func (cs *CachingStorage) CountUserURLs(ctx context.Context, userID string,
+	now time.Time, since time.Time) (model.URLCount, error) {
+	return cs.st.CountUserURLs(ctx, userID, now, since)
+}
+
+// ImportURL saves exported record under its short ID.
+func (cs *CachingStorage) ImportURL(ctx context.Context, rec ExportRecord) (string, error) {
+	res, err := cs.st.ImportURL(ctx, rec)
+	cs.invalidate(rec.ShortURL)
+	return res, err
+}
+
+// FindStats finds statistic by saved requests.
+func (cs *CachingStorage) FindStats(ctx context.Context) (model.Stat, error) {
+	return cs.st.FindStats(ctx)
+}
+
+// ExportURLs returns page of records ordered by short ID.
+func (cs *CachingStorage) ExportURLs(ctx context.Context, after string,
+	limit int) ([]ExportRecord, error) {
+	return cs.st.ExportURLs(ctx, after, limit)
+}
+
+// SaveClicks saves clicks.
+func (cs *CachingStorage) SaveClicks(ctx context.Context, clicks []model.Click) error {
+	return cs.st.SaveClicks(ctx, clicks)
+}
+
+// FindClickStats returns click statistic of user's short URL.
+func (cs *CachingStorage) FindClickStats(ctx context.Context, userID string,
+	id string, top int) (model.ClickStats, error) {
+	return cs.st.FindClickStats(ctx, userID, id, top)
+}
+
+// SaveDeleteJob saves delete job.
+func (cs *CachingStorage) SaveDeleteJob(ctx context.Context, job model.DeleteJob) error {
+	return cs.st.SaveDeleteJob(ctx, job)
+}
+
+// FindDeleteJob returns user's delete job.
+func (cs *CachingStorage) FindDeleteJob(ctx context.Context, userID string,
+	id string) (model.DeleteJob, error) {
+	return cs.st.FindDeleteJob(ctx, userID, id)
+}
+
+// FindPendingDeleteJobs returns jobs that are not finished yet.
+func (cs *CachingStorage) FindPendingDeleteJobs(ctx context.Context) ([]model.DeleteJob, error) {
+	return cs.st.FindPendingDeleteJobs(ctx)
+}
+
+// SaveAPIKey saves API key.
+func (cs *CachingStorage) SaveAPIKey(ctx context.Context, key model.APIKey) error {
+	return cs.st.SaveAPIKey(ctx, key)
+}
+
+// FindAPIKeyByHash returns API key by hash of the key.
+// Keys are not cached, so revoked key stops working immediately.
+func (cs *CachingStorage) FindAPIKeyByHash(ctx context.Context, hash string) (model.APIKey, error) {
+	return cs.st.FindAPIKeyByHash(ctx, hash)
+}
+
+// FindUserAPIKeys returns user's API keys.
+func (cs *CachingStorage) FindUserAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error) {
+	return cs.st.FindUserAPIKeys(ctx, userID)
+}
+
+// DeleteAPIKey revokes user's API key.
+func (cs *CachingStorage) DeleteAPIKey(ctx context.Context, userID string, id string) error {
+	return cs.st.DeleteAPIKey(ctx, userID, id)
+}
+
+// SaveUser saves registered user.
+func (cs *CachingStorage) SaveUser(ctx context.Context, user model.User) error {
+	return cs.st.SaveUser(ctx, user)
+}
+
+// FindUserByEmail returns registered user by email.
+func (cs *CachingStorage) FindUserByEmail(ctx context.Context, email string) (model.User, error) {
+	return cs.st.FindUserByEmail(ctx, email)
+}
+
+// ReassignUser moves URLs, API keys and delete jobs of user from to user to.
+// Cached URLs don't need invalidation because redirect doesn't depend on the owner.
+func (cs *CachingStorage) ReassignUser(ctx context.Context, from string, to string) (model.Reassigned, error) {
+	return cs.st.ReassignUser(ctx, from, to)
+}
+
+// RevokeToken adds JWT ID to the denylist.
+func (cs *CachingStorage) RevokeToken(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	return cs.st.RevokeToken(ctx, id, expiresAt)
+}
+
+// IsTokenRevoked checks whether JWT ID is in the denylist.
+// Result is not cached, so revoked token stops working immediately.
+func (cs *CachingStorage) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	return cs.st.IsTokenRevoked(ctx, id)
+}
+
+// DeleteExpiredRevokedTokens removes expired tokens from the denylist.
+func (cs *CachingStorage) DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	return cs.st.DeleteExpiredRevokedTokens(ctx, now)
+}
+
+// TakeRateLimit advances rate limit bucket if underlying storage keeps them.
+func (cs *CachingStorage) TakeRateLimit(ctx context.Context, key string, now time.Time,
+	interval time.Duration, tolerance time.Duration) (time.Time, bool, error) {
+	return TakeRateLimit(ctx, cs.st, key, now, interval, tolerance)
+}
+
+// DeleteExpiredRateLimits removes full rate limit buckets if underlying storage keeps them.
+func (cs *CachingStorage) DeleteExpiredRateLimits(ctx context.Context, now time.Time) (int64, error) {
+	return DeleteExpiredRateLimits(ctx, cs.st, now)
+}
+
+// Compact compacts underlying storage if it supports compaction.
+func (cs *CachingStorage) Compact(ctx context.Context) error {
+	return Compact(ctx, cs.st)
+}
+
+// CheckHealth checks health of underlying storage.
+func (cs *CachingStorage) CheckHealth(ctx context.Context) []model.HealthCheck {
+	return CheckHealth(ctx, cs.st)
+}
+
+// Ping pings underlying storage.
+func (cs *CachingStorage) Ping(ctx context.Context) error {
+	return cs.st.Ping(ctx)
+}
+
+func (cs *CachingStorage) add(epoch uint64, id string, c cachedURL, ttl time.Duration) {
+	cs.mx.Lock()
+	defer cs.mx.Unlock()
+	if ttl <= 0 || cs.epoch.Load() != epoch {
+		return
+	}
+	cs.cache.Add(id, c, ttl)
+}
+
+func (cs *CachingStorage) invalidate(ids ...string) {
+	cs.mx.Lock()
+	defer cs.mx.Unlock()
+	cs.epoch.Add(1)
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		cs.cache.Remove(id)
+		cs.group.Forget(id)
+	}
+}
+
+func (c cachedURL) result() (*OrigURL, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.orig.IsExpired(time.Now()) {
+		return nil, ErrResultIsExpired
+	}
+	orig := c.orig
+	return &orig, nil
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingStorage_FindURL(t *testing.T) {
+	ctx := context.Background()
+	orig := NewOrigURL("http://localhost:30000/", "user", false)
+	expired := newExpiringOrigURL("http://localhost:30001/", "user", time.Now().Add(-time.Second))
+	errDB := errors.New("connection refused")
+
+	tests := []struct {
+		name    string
+		id      string
+		result  *OrigURL
+		err     error
+		calls   int
+		wantErr error
+	}{
+		{
+			name:   "positive result is cached #1",
+			id:     "AAAAAAAA",
+			result: &orig,
+			calls:  1,
+		},
+		{
+			name:    "not found result is cached #2",
+			id:      "BBBBBBBB",
+			err:     ErrNotFound,
+			calls:   1,
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "deleted result is cached #3",
+			id:      "CCCCCCCC",
+			err:     ErrResultIsDeleted,
+			calls:   1,
+			wantErr: ErrResultIsDeleted,
+		},
+		{
+			name:    "storage errors are not cached #4",
+			id:      "DDDDDDDD",
+			err:     errDB,
+			calls:   3,
+			wantErr: errDB,
+		},
+		{
+			name:    "expiration is checked on cache hit #5",
+			id:      "EEEEEEEE",
+			result:  &expired,
+			calls:   1,
+			wantErr: ErrResultIsExpired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := new(MockedStorage)
+			st.On("FindURL", mock.Anything, tt.id).Return(tt.result, tt.err)
+			cs := NewCachingStorage(st, 10, time.Minute, time.Minute)
+			for i := 0; i < 3; i++ {
+				res, err := cs.FindURL(ctx, tt.id)
+				if tt.wantErr != nil {
+					assert.ErrorIs(t, err, tt.wantErr)
+					continue
+				}
+				require.NoError(t, err)
+				assert.Equal(t, tt.result, res)
+			}
+			st.AssertNumberOfCalls(t, "FindURL", tt.calls)
+		})
+	}
+}
+
+func TestCachingStorage_Invalidate(t *testing.T) {
+	ctx := context.Background()
+	id := "AAAAAAAA"
+	orig := NewOrigURL("http://localhost:30000/", "user", false)
+	bde := model.NewBatchDeleteEntry("user", []string{id})
+
+	st := new(MockedStorage)
+	st.On("FindURL", mock.Anything, id).Return(&orig, nil).Once()
+	st.On("DeleteUserURLs", mock.Anything, bde).Return([]model.DeleteResult{
+		model.NewDeleteResult(id, model.DeleteOutcomeDeleted),
+	}, nil)
+	st.On("FindURL", mock.Anything, id).Return((*OrigURL)(nil), ErrResultIsDeleted)
+	cs := NewCachingStorage(st, 10, time.Minute, time.Minute)
+
+	_, err := cs.FindURL(ctx, id)
+	require.NoError(t, err)
+	_, err = cs.DeleteUserURLs(ctx, bde)
+	require.NoError(t, err)
+	_, err = cs.FindURL(ctx, id)
+	assert.ErrorIs(t, err, ErrResultIsDeleted)
+	st.AssertNumberOfCalls(t, "FindURL", 2)
+}
+
+func TestCachingStorage_Singleflight(t *testing.T) {
+	ctx := context.Background()
+	id := "AAAAAAAA"
+	orig := NewOrigURL("http://localhost:30000/", "user", false)
+	release := make(chan time.Time)
+
+	st := new(MockedStorage)
+	st.On("FindURL", mock.Anything, id).WaitUntil(release).Return(&orig, nil)
+	cs := NewCachingStorage(st, 10, time.Minute, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := cs.FindURL(ctx, id)
+			assert.NoError(t, err)
+			assert.Equal(t, orig.OriginalURL, res.OriginalURL)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	st.AssertNumberOfCalls(t, "FindURL", 1)
+}
+
+func TestCachingStorage_SingleflightCanceled(t *testing.T) {
+	id := "AAAAAAAA"
+	orig := NewOrigURL("http://localhost:30000/", "user", false)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var loadErr error
+
+	st := new(MockedStorage)
+	st.On("FindURL", mock.Anything, id).Run(func(args mock.Arguments) {
+		close(started)
+		<-release
+		loadErr = args.Get(0).(context.Context).Err()
+	}).Return(&orig, nil)
+	cs := NewCachingStorage(st, 10, time.Minute, time.Minute)
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := cs.FindURL(first, id)
+		firstErr <- err
+	}()
+	<-started
+	second := make(chan *OrigURL)
+	go func() {
+		res, err := cs.FindURL(context.Background(), id)
+		assert.NoError(t, err)
+		second <- res
+	}()
+	cancel()
+	assert.ErrorIs(t, <-firstErr, context.Canceled)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	res := <-second
+	require.NotNil(t, res)
+	assert.Equal(t, orig.OriginalURL, res.OriginalURL)
+	assert.NoError(t, loadErr, "shared lookup is not canceled with the first caller")
+	st.AssertNumberOfCalls(t, "FindURL", 1)
+}
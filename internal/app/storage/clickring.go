@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"sync"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+)
+
+// clickRing in-memory buffer that holds at most size latest clicks.
+type clickRing struct {
+	mx    sync.RWMutex
+	size  int
+	items []model.Click
+	next  int
+}
+
+func newClickRing(size int) *clickRing {
+	return &clickRing{
+		size: size,
+	}
+}
+
+func (r *clickRing) add(clicks ...model.Click) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	for _, c := range clicks {
+		if len(r.items) < r.size {
+			r.items = append(r.items, c)
+			continue
+		}
+		r.items[r.next] = c
+		r.next = (r.next + 1) % r.size
+	}
+}
+
+func (r *clickRing) find(shortURL string) []model.Click {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	var res []model.Click
+	for _, c := range r.items {
+		if c.ShortURL == shortURL {
+			res = append(res, c)
+		}
+	}
+	return res
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+)
+
+// clickQueries dialect specific queries of click statistic.
+// Top query is a format string where column name is substituted.
+type clickQueries struct {
+	owner string
+	days  string
+	top   string
+}
+
+// findClickStats aggregates clicks of user's short URL in SQL storage.
+func findClickStats(ctx context.Context, db *sql.DB, q clickQueries, userID string,
+	id string, top int) (model.ClickStats, error) {
+	var owned int
+	if err := db.QueryRowContext(ctx, q.owner, id, userID).Scan(&owned); err != nil {
+		return model.ClickStats{}, fmt.Errorf("cannot scan value. %w", err)
+	}
+	if owned == 0 {
+		return model.ClickStats{}, ErrNotFound
+	}
+	stats := model.ClickStats{ShortURL: id}
+	rows, err := db.QueryContext(ctx, q.days, id)
+	if err != nil {
+		return stats, fmt.Errorf("query days. %w", err)
+	}
+	defer rows.Close()
+	stats.Days = make([]model.DayClicks, 0)
+	for rows.Next() {
+		var d model.DayClicks
+		if err = rows.Scan(&d.Day, &d.Clicks); err != nil {
+			return stats, fmt.Errorf("cannot scan value. %w", err)
+		}
+		stats.Total += d.Clicks
+		stats.Days = append(stats.Days, d)
+	}
+	if err = rows.Err(); err != nil {
+		return stats, fmt.Errorf("rows.Err(). %w", err)
+	}
+	if stats.TopReferrers, err = findTopValues(ctx, db, fmt.Sprintf(q.top, "referrer"), id, top); err != nil {
+		return stats, err
+	}
+	if stats.TopUserAgents, err = findTopValues(ctx, db, fmt.Sprintf(q.top, "user_agent"), id, top); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+func findTopValues(ctx context.Context, db *sql.DB, query string,
+	id string, top int) ([]model.ValueCount, error) {
+	rows, err := db.QueryContext(ctx, query, id, top)
+	if err != nil {
+		return nil, fmt.Errorf("query top values. %w", err)
+	}
+	defer rows.Close()
+	res := make([]model.ValueCount, 0, top)
+	for rows.Next() {
+		var v model.ValueCount
+		if err = rows.Scan(&v.Value, &v.Count); err != nil {
+			return nil, fmt.Errorf("cannot scan value. %w", err)
+		}
+		res = append(res, v)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err(). %w", err)
+	}
+	return res, nil
+}
@@ -9,22 +9,31 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/denis-oreshkevich/shortener/migration"
 
 	"github.com/denis-oreshkevich/shortener/internal/app/model"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/pressly/goose/v3"
 )
 
 // DBStorage database storage.
 type DBStorage struct {
-	db *sql.DB
+	db  *sql.DB
+	gen generator.IDGenerator
+	// findURLStmt is prepared once because FindURL is called on every redirect.
+	findURLStmt *sql.Stmt
 }
 
 var _ Storage = (*DBStorage)(nil)
 
+var _ HealthChecker = (*DBStorage)(nil)
+
+var _ RateLimitStore = (*DBStorage)(nil)
+
 var (
 	db     *sql.DB
 	pgOnce sync.Once
@@ -32,17 +41,24 @@ var (
 	dbErr error
 )
 
-// ErrDBConflict error happens on DB conflict.
+// ErrDBConflict error happens when URL with the same canonical form is already saved.
 var ErrDBConflict = errors.New("db conflict while executing sql query")
 
 // NewDBStorage creates new [*DBStorage].
-func NewDBStorage(dbDSN string) (*DBStorage, error) {
+func NewDBStorage(dbDSN string, gen generator.IDGenerator) (*DBStorage, error) {
 	pool, err := initDatasource(dbDSN)
 	if err != nil {
 		return nil, fmt.Errorf("initPool: %w", err)
 	}
+	findURLStmt, err := pool.Prepare("SELECT original_url, user_id, is_deleted, expires_at " +
+		"FROM courses.shortener sh WHERE sh.short_url = $1")
+	if err != nil {
+		return nil, fmt.Errorf("prepare find URL statement: %w", err)
+	}
 	return &DBStorage{
-		db: pool,
+		db:          pool,
+		gen:         gen,
+		findURLStmt: findURLStmt,
 	}, nil
 }
 
@@ -57,7 +73,7 @@ func initDatasource(dbDSN string) (*sql.DB, error) {
 			dbErr = fmt.Errorf("pool.Ping: %w", err)
 			return
 		}
-		if err = applyMigration(pool, migration.SQLFiles); err != nil {
+		if err = applyMigration(pool, migration.SQLFiles, "postgres", migration.PostgresDir); err != nil {
 			dbErr = fmt.Errorf("applyMigration: %w", err)
 			return
 		}
@@ -67,28 +83,56 @@ func initDatasource(dbDSN string) (*sql.DB, error) {
 }
 
 // SaveURL saves original URL to DB and returns short URL.
-func (ds *DBStorage) SaveURL(ctx context.Context, userID string, url string) (string, error) {
-	stmt, err := ds.db.PrepareContext(ctx, "WITH new_row AS ("+
-		"INSERT INTO courses.shortener(short_url, original_url, user_id) VALUES ($1, $2, $3) "+
-		"ON CONFLICT (original_url) DO NOTHING RETURNING short_url) "+
-		"SELECT short_url FROM new_row UNION SELECT short_url FROM courses.shortener "+
-		"WHERE courses.shortener.original_url = $2")
-	if err != nil {
-		return "", fmt.Errorf("prepare context. %w", err)
-	}
-	defer stmt.Close()
+// Returns existing short URL and [ErrDBConflict] if canonical URL is already saved.
+func (ds *DBStorage) SaveURL(ctx context.Context, userID string, url string, canonical string,
+	expiresAt time.Time) (string, error) {
+	return saveLimited(ctx, ds.db, pgURLCountQueries, userID, func(q queryRower) (string, error) {
+		for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+			sh, err := ds.gen.Generate(canonical, attempt)
+			if err != nil {
+				return "", fmt.Errorf("generate ID. %w", err)
+			}
+			res, err := insertURL(ctx, q, sh, url, canonical, userID, expiresAt, time.Now())
+			if errors.Is(err, ErrIDConflict) {
+				logger.Log.Debug(fmt.Sprintf("short ID collision id = %s, attempt = %d", sh, attempt))
+				continue
+			}
+			return res, err
+		}
+		return "", ErrIDGeneration
+	})
+}
 
-	sh := generator.RandString()
-	row := stmt.QueryRowContext(ctx, sh, url, userID)
+// SaveURLWithID saves original URL to DB under provided short ID.
+// Returns existing short URL and [ErrDBConflict] if canonical URL is already saved
+// and [ErrIDConflict] if short ID is already taken by another URL.
+func (ds *DBStorage) SaveURLWithID(ctx context.Context, userID string,
+	id string, url string, canonical string, expiresAt time.Time, createdAt time.Time) (string, error) {
+	return saveLimited(ctx, ds.db, pgURLCountQueries, userID, func(q queryRower) (string, error) {
+		return insertURL(ctx, q, id, url, canonical, userID, expiresAt, createdAt)
+	})
+}
+
+// ImportURL saves exported record to DB under its short ID in single insert.
+// Returns [ErrIDConflict] if short ID is already taken and existing short URL
+// and [ErrDBConflict] if record is live and its canonical URL is already saved.
+func (ds *DBStorage) ImportURL(ctx context.Context, rec ExportRecord) (string, error) {
+	if !rec.DeletedFlag {
+		return insertURL(ctx, ds.db, rec.ShortURL, rec.OriginalURL, rec.CanonicalURL, rec.UserID,
+			rec.ExpiresAt, rec.CreatedAt)
+	}
+	row := ds.db.QueryRowContext(ctx, "INSERT INTO courses.shortener(short_url, original_url, canonical_url, "+
+		"user_id, is_deleted, expires_at, created_at) VALUES ($1, $2, $3, $4, true, $5, $6) "+
+		"ON CONFLICT DO NOTHING RETURNING short_url", rec.ShortURL, rec.OriginalURL, rec.CanonicalURL,
+		rec.UserID, nullTime(rec.ExpiresAt), nullTime(rec.CreatedAt))
 	var res string
-	if err = row.Scan(&res); err != nil {
+	if err := row.Scan(&res); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrIDConflict
+		}
 		return "", fmt.Errorf("cannot scan value. %w", err)
 	}
-	if sh != res {
-		err = ErrDBConflict
-	}
-
-	return res, err
+	return res, nil
 }
 
 // SaveURLBatch saves many URLs to DB and return [[]model.BatchRespEntry] back.
@@ -99,27 +143,24 @@ func (ds *DBStorage) SaveURLBatch(ctx context.Context, userID string,
 		return nil, fmt.Errorf("begin tx. %w", err)
 	}
 	defer tx.Rollback()
-	stmt, err := tx.PrepareContext(ctx, "WITH new_row AS ("+
-		"INSERT INTO courses.shortener(short_url, original_url, user_id) VALUES ($1, $2, $3) "+
-		"ON CONFLICT (original_url) DO NOTHING RETURNING short_url) "+
-		"SELECT short_url FROM new_row UNION SELECT short_url FROM courses.shortener "+
-		"WHERE courses.shortener.original_url = $2")
-
-	if err != nil {
-		return nil, fmt.Errorf("prepare context. %w", err)
+	if err = lockUserURLs(ctx, tx, pgURLCountQueries, userID); err != nil {
+		return nil, err
 	}
-	defer stmt.Close()
 	var bResp []model.BatchRespEntry
-	var sh string
+	var saved int
 	for _, b := range batch {
-		sh = generator.RandString()
-		row := stmt.QueryRowContext(ctx, sh, b.OriginalURL, userID)
-		if errScan := row.Scan(&sh); errScan != nil {
-			return nil, fmt.Errorf("cannot scan value. %w", errScan)
+		sh, errSave := ds.saveBatchEntry(ctx, tx, userID, b)
+		if errSave == nil {
+			saved++
+		} else if !errors.Is(errSave, ErrDBConflict) {
+			return nil, errSave
 		}
 		var resp = model.NewBatchRespEntry(b.CorrelationID, sh)
 		bResp = append(bResp, resp)
 	}
+	if err = checkSavedURLLimit(ctx, tx, pgURLCountQueries, userID, saved); err != nil {
+		return nil, err
+	}
 
 	err = tx.Commit()
 	if err != nil {
@@ -128,22 +169,91 @@ func (ds *DBStorage) SaveURLBatch(ctx context.Context, userID string,
 	return bResp, nil
 }
 
+// saveBatchEntry saves entry of batch in tx, it returns existing short URL
+// and [ErrDBConflict] if canonical URL is already saved.
+func (ds *DBStorage) saveBatchEntry(ctx context.Context, tx *sql.Tx, userID string,
+	b model.BatchReqEntry) (string, error) {
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		sh, err := ds.gen.Generate(b.CanonicalURL, attempt)
+		if err != nil {
+			return "", fmt.Errorf("generate ID. %w", err)
+		}
+		res, err := insertURL(ctx, tx, sh, b.OriginalURL, b.CanonicalURL, userID, timeOrZero(b.ExpiresAt),
+			time.Now())
+		if errors.Is(err, ErrIDConflict) {
+			continue
+		}
+		return res, err
+	}
+	return "", ErrIDGeneration
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// insertURL inserts new row and returns short URL.
+// Returns existing short URL and [ErrDBConflict] if canonical URL is already saved
+// and [ErrIDConflict] if short URL is already taken by another URL.
+// Deleted URLs are not deduplicated, expired URL is marked deleted and the row is inserted again.
+func insertURL(ctx context.Context, q queryRower, id string, url string, canonical string,
+	userID string, expiresAt time.Time, createdAt time.Time) (string, error) {
+	res, err := insertURLOnce(ctx, q, id, url, canonical, userID, expiresAt, createdAt)
+	if !errors.Is(err, ErrDBConflict) {
+		return res, err
+	}
+	row := q.QueryRowContext(ctx, "UPDATE courses.shortener SET is_deleted = true "+
+		"WHERE short_url = $1 AND expires_at <= $2 AND NOT is_deleted RETURNING short_url", res, time.Now())
+	var expired string
+	if errScan := row.Scan(&expired); errScan != nil {
+		if errors.Is(errScan, sql.ErrNoRows) {
+			return res, err
+		}
+		return "", fmt.Errorf("cannot scan value. %w", errScan)
+	}
+	logger.Log.Debug(fmt.Sprintf("expired URL with the same canonical form is deleted id = %s", expired))
+	return insertURLOnce(ctx, q, id, url, canonical, userID, expiresAt, createdAt)
+}
+
+func insertURLOnce(ctx context.Context, q queryRower, id string, url string, canonical string,
+	userID string, expiresAt time.Time, createdAt time.Time) (string, error) {
+	row := q.QueryRowContext(ctx, "WITH new_row AS ("+
+		"INSERT INTO courses.shortener(short_url, original_url, canonical_url, user_id, expires_at, created_at) "+
+		"VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING RETURNING short_url) "+
+		"SELECT short_url FROM new_row UNION SELECT short_url FROM courses.shortener "+
+		"WHERE courses.shortener.canonical_url = $3 AND NOT courses.shortener.is_deleted",
+		id, url, canonical, userID, nullTime(expiresAt), nullTime(createdAt))
+	var res string
+	if err := row.Scan(&res); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrIDConflict
+		}
+		return "", fmt.Errorf("cannot scan value. %w", err)
+	}
+	if res != id {
+		return res, ErrDBConflict
+	}
+	return res, nil
+}
+
 // FindURL finds original URL in DB by short ID.
 func (ds *DBStorage) FindURL(ctx context.Context, shortURL string) (*OrigURL, error) {
-	stmt, err := ds.db.PrepareContext(ctx, "SELECT original_url, is_deleted "+
-		"FROM courses.shortener sh WHERE sh.short_url = $1")
-	if err != nil {
-		return nil, fmt.Errorf("prepare context. %w", err)
-	}
-	defer stmt.Close()
-	row := stmt.QueryRowContext(ctx, shortURL)
+	row := ds.findURLStmt.QueryRowContext(ctx, shortURL)
 	orig := &OrigURL{}
-	if err := row.Scan(&orig.OriginalURL, &orig.DeletedFlag); err != nil {
+	var expiresAt sql.NullTime
+	if err := row.Scan(&orig.OriginalURL, &orig.UserID, &orig.DeletedFlag, &expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
 		return nil, fmt.Errorf("cannot scan value. %w", err)
 	}
+	orig.ExpiresAt = expiresAt.Time
 	if orig.DeletedFlag {
 		return nil, ErrResultIsDeleted
 	}
+	if orig.IsExpired(time.Now()) {
+		return nil, ErrResultIsExpired
+	}
 	return orig, nil
 }
 
@@ -177,37 +287,63 @@ func (ds *DBStorage) FindUserURLs(ctx context.Context, userID string) ([]model.U
 	return res, nil
 }
 
+// FindUserURLsPage returns page of user's URLs ordered by short ID.
+func (ds *DBStorage) FindUserURLsPage(ctx context.Context, userID string,
+	after string, limit int) ([]model.URLPair, error) {
+	rows, err := ds.db.QueryContext(ctx, "SELECT short_url, original_url FROM courses.shortener "+
+		"WHERE user_id = $1 AND short_url > $2 ORDER BY short_url LIMIT $3", userID, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query context. %w", err)
+	}
+	return scanURLPairs(rows, limit)
+}
+
+// scanURLPairs reads short_url and original_url columns and closes rows.
+func scanURLPairs(rows *sql.Rows, capacity int) ([]model.URLPair, error) {
+	defer rows.Close()
+	res := make([]model.URLPair, 0, capacity)
+	for rows.Next() {
+		var sh string
+		var orig string
+		if errScan := rows.Scan(&sh, &orig); errScan != nil {
+			return nil, fmt.Errorf("cannot scan value. %w", errScan)
+		}
+		res = append(res, model.NewURLPair(sh, orig))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err(). %w", err)
+	}
+	return res, nil
+}
+
+// CheckHealth pings DB and checks that all migrations are applied.
+func (ds *DBStorage) CheckHealth(ctx context.Context) []model.HealthCheck {
+	return checkDBHealth(ctx, ds.db, migration.PostgresDir)
+}
+
 // Ping pings DB.
 func (ds *DBStorage) Ping(ctx context.Context) error {
 	return ds.db.PingContext(ctx)
 }
 
 // DeleteUserURLs deletes user's URLs.
-func (ds *DBStorage) DeleteUserURLs(ctx context.Context, bde model.BatchDeleteEntry) error {
-	tx, err := ds.db.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("begin tx. %w", err)
-	}
-	defer tx.Rollback()
-	var errs []error
-	template := "update courses.shortener set is_deleted = true " +
-		"where user_id = $1 and short_url in ($2%s)"
-
-	q := ds.buildDeleteQuery(bde, template)
-	iDs := buildIDs(bde)
-
-	if _, errEx := tx.ExecContext(ctx, q, iDs...); errEx != nil {
-		errs = append(errs, errEx)
-	}
+func (ds *DBStorage) DeleteUserURLs(ctx context.Context,
+	bde model.BatchDeleteEntry) ([]model.DeleteResult, error) {
+	return deleteUserURLs(ctx, ds.db, pgDeleteJobQueries, bde)
+}
 
-	err = tx.Commit()
+// DeleteExpiredURLs sets delete status for URLs that are expired at the moment now.
+func (ds *DBStorage) DeleteExpiredURLs(ctx context.Context, now time.Time) (int64, error) {
+	res, err := ds.db.ExecContext(ctx, "UPDATE courses.shortener SET is_deleted = true "+
+		"WHERE expires_at <= $1 AND NOT is_deleted", now)
 	if err != nil {
-		return fmt.Errorf("tx commit. %w", err)
+		return 0, fmt.Errorf("exec context. %w", err)
 	}
-	if len(errs) != 0 {
-		return errors.Join(errs...)
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected. %w", err)
 	}
-	return nil
+	return count, nil
 }
 
 // FindStats finds statistic by saved requests.
@@ -227,6 +363,219 @@ func (ds *DBStorage) FindStats(ctx context.Context) (model.Stat, error) {
 	return stat, nil
 }
 
+// ExportURLs returns page of records ordered by short ID.
+func (ds *DBStorage) ExportURLs(ctx context.Context, after string,
+	limit int) ([]ExportRecord, error) {
+	rows, err := ds.db.QueryContext(ctx, "SELECT short_url, original_url, canonical_url, user_id, "+
+		"is_deleted, expires_at, created_at FROM courses.shortener WHERE short_url > $1 ORDER BY short_url LIMIT $2",
+		after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query context. %w", err)
+	}
+	defer rows.Close()
+	var res = make([]ExportRecord, 0, limit)
+	for rows.Next() {
+		var rec ExportRecord
+		var expiresAt, createdAt sql.NullTime
+		if errScan := rows.Scan(&rec.ShortURL, &rec.OriginalURL, &rec.CanonicalURL, &rec.UserID,
+			&rec.DeletedFlag, &expiresAt, &createdAt); errScan != nil {
+			return nil, fmt.Errorf("cannot scan value. %w", errScan)
+		}
+		rec.ExpiresAt = expiresAt.Time
+		rec.CreatedAt = createdAt.Time
+		res = append(res, rec)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err(). %w", err)
+	}
+	return res, nil
+}
+
+// SaveClicks saves clicks to DB in single transaction.
+func (ds *DBStorage) SaveClicks(ctx context.Context, clicks []model.Click) error {
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx. %w", err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO courses.shortener_click"+
+		"(short_url, clicked_at, referrer, user_agent, ip) VALUES ($1, $2, $3, $4, $5)")
+	if err != nil {
+		return fmt.Errorf("prepare context. %w", err)
+	}
+	defer stmt.Close()
+	for _, c := range clicks {
+		if _, err = stmt.ExecContext(ctx, c.ShortURL, c.At, c.Referrer, c.UserAgent, c.IP); err != nil {
+			return fmt.Errorf("exec context. %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("tx commit. %w", err)
+	}
+	return nil
+}
+
+// FindClickStats returns click statistic of user's short URL.
+func (ds *DBStorage) FindClickStats(ctx context.Context, userID string,
+	id string, top int) (model.ClickStats, error) {
+	return findClickStats(ctx, ds.db, clickQueries{
+		owner: "SELECT count(*) FROM courses.shortener WHERE short_url = $1 AND user_id = $2",
+		days: "SELECT to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, count(*) " +
+			"FROM courses.shortener_click WHERE short_url = $1 GROUP BY day ORDER BY day",
+		top: "SELECT %[1]s, count(*) AS cnt FROM courses.shortener_click " +
+			"WHERE short_url = $1 AND %[1]s <> '' GROUP BY %[1]s ORDER BY cnt DESC, %[1]s LIMIT $2",
+	}, userID, id, top)
+}
+
+// SaveDeleteJob upserts delete job.
+func (ds *DBStorage) SaveDeleteJob(ctx context.Context, job model.DeleteJob) error {
+	return saveDeleteJob(ctx, ds.db, pgDeleteJobQueries, job)
+}
+
+// FindDeleteJob returns user's delete job.
+func (ds *DBStorage) FindDeleteJob(ctx context.Context, userID string,
+	id string) (model.DeleteJob, error) {
+	return findDeleteJob(ctx, ds.db, pgDeleteJobQueries, userID, id)
+}
+
+// FindPendingDeleteJobs returns jobs that are not finished yet.
+func (ds *DBStorage) FindPendingDeleteJobs(ctx context.Context) ([]model.DeleteJob, error) {
+	return findPendingDeleteJobs(ctx, ds.db, pgDeleteJobQueries)
+}
+
+// SaveAPIKey inserts API key.
+func (ds *DBStorage) SaveAPIKey(ctx context.Context, key model.APIKey) error {
+	return saveAPIKey(ctx, ds.db, pgAPIKeyQueries, key)
+}
+
+// FindAPIKeyByHash returns API key by hash of the key.
+func (ds *DBStorage) FindAPIKeyByHash(ctx context.Context, hash string) (model.APIKey, error) {
+	return findAPIKeyByHash(ctx, ds.db, pgAPIKeyQueries, hash)
+}
+
+// FindUserAPIKeys returns user's API keys.
+func (ds *DBStorage) FindUserAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error) {
+	return findUserAPIKeys(ctx, ds.db, pgAPIKeyQueries, userID)
+}
+
+// DeleteAPIKey deletes user's API key.
+func (ds *DBStorage) DeleteAPIKey(ctx context.Context, userID string, id string) error {
+	return deleteAPIKey(ctx, ds.db, pgAPIKeyQueries, userID, id)
+}
+
+var pgAPIKeyQueries = apiKeyQueries{
+	save: "INSERT INTO courses.shortener_api_key(id, user_id, name, prefix, hash, scopes, created_at) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7)",
+	findByHash: "SELECT id, user_id, name, prefix, hash, scopes, created_at FROM courses.shortener_api_key " +
+		"WHERE hash = $1",
+	findByUser: "SELECT id, user_id, name, prefix, hash, scopes, created_at FROM courses.shortener_api_key " +
+		"WHERE user_id = $1 ORDER BY created_at, id",
+	delete:  "DELETE FROM courses.shortener_api_key WHERE id = $1 AND user_id = $2",
+	timeArg: func(t time.Time) any { return t },
+	timeDst: func(t *time.Time) any { return t },
+}
+
+// SaveUser inserts registered user.
+func (ds *DBStorage) SaveUser(ctx context.Context, user model.User) error {
+	return saveUser(ctx, ds.db, pgUserQueries, user)
+}
+
+// FindUserByEmail returns registered user by email.
+func (ds *DBStorage) FindUserByEmail(ctx context.Context, email string) (model.User, error) {
+	return findUserByEmail(ctx, ds.db, pgUserQueries, email)
+}
+
+// ReassignUser moves URLs, API keys and delete jobs of user from to user to in single transaction.
+func (ds *DBStorage) ReassignUser(ctx context.Context, from string, to string) (model.Reassigned, error) {
+	return reassignUser(ctx, ds.db, pgUserQueries, from, to)
+}
+
+var pgUserQueries = userQueries{
+	save: "INSERT INTO courses.shortener_user(id, email, password_hash, created_at) " +
+		"VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+	findByEmail:  "SELECT id, email, password_hash, created_at FROM courses.shortener_user WHERE email = $1",
+	reassignURLs: "UPDATE courses.shortener SET user_id = $2 WHERE user_id = $1",
+	reassignKeys: "UPDATE courses.shortener_api_key SET user_id = $2 WHERE user_id = $1",
+	reassignJobs: "UPDATE courses.shortener_delete_job SET user_id = $2 WHERE user_id = $1",
+	timeArg:      func(t time.Time) any { return t },
+	timeDst:      func(t *time.Time) any { return t },
+}
+
+// RevokeToken adds JWT ID to the denylist.
+func (ds *DBStorage) RevokeToken(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	return revokeToken(ctx, ds.db, pgRevokedTokenQueries, id, expiresAt)
+}
+
+// IsTokenRevoked checks whether JWT ID is in the denylist.
+func (ds *DBStorage) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	return isTokenRevoked(ctx, ds.db, pgRevokedTokenQueries, id)
+}
+
+// DeleteExpiredRevokedTokens removes expired tokens from the denylist.
+func (ds *DBStorage) DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	return deleteExpiredRevokedTokens(ctx, ds.db, pgRevokedTokenQueries, now)
+}
+
+var pgRevokedTokenQueries = revokedTokenQueries{
+	save:          "INSERT INTO courses.shortener_revoked_token(id, expires_at) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+	find:          "SELECT 1 FROM courses.shortener_revoked_token WHERE id = $1",
+	deleteExpired: "DELETE FROM courses.shortener_revoked_token WHERE expires_at <= $1",
+	timeArg:       func(t time.Time) any { return t },
+}
+
+// TakeRateLimit advances rate limit bucket.
+func (ds *DBStorage) TakeRateLimit(ctx context.Context, key string, now time.Time,
+	interval time.Duration, tolerance time.Duration) (time.Time, bool, error) {
+	return takeRateLimit(ctx, ds.db, pgRateLimitQueries, key, now, interval, tolerance)
+}
+
+// DeleteExpiredRateLimits removes full rate limit buckets.
+func (ds *DBStorage) DeleteExpiredRateLimits(ctx context.Context, now time.Time) (int64, error) {
+	return deleteExpiredRateLimits(ctx, ds.db, pgRateLimitQueries, now)
+}
+
+var pgRateLimitQueries = rateLimitQueries{
+	take: "INSERT INTO courses.shortener_rate_limit AS r(key, tat) VALUES ($1, $2::bigint + $3::bigint) " +
+		"ON CONFLICT (key) DO UPDATE SET tat = GREATEST(r.tat, $2::bigint) + $3::bigint " +
+		"WHERE GREATEST(r.tat, $2::bigint) + $3::bigint - $2::bigint <= $4::bigint RETURNING tat",
+	find:          "SELECT tat FROM courses.shortener_rate_limit WHERE key = $1",
+	deleteExpired: "DELETE FROM courses.shortener_rate_limit WHERE tat <= $1",
+}
+
+// CountUserURLs counts user's URLs that are active at now and created since since.
+func (ds *DBStorage) CountUserURLs(ctx context.Context, userID string,
+	now time.Time, since time.Time) (model.URLCount, error) {
+	return countUserURLs(ctx, ds.db, pgURLCountQueries, userID, now, since)
+}
+
+var pgURLCountQueries = urlCountQueries{
+	count: "SELECT count(*) FILTER (WHERE NOT is_deleted AND (expires_at IS NULL OR expires_at > $2)), " +
+		"count(*) FILTER (WHERE created_at >= $3) FROM courses.shortener WHERE user_id = $1",
+	lock:    "SELECT pg_advisory_xact_lock(hashtext($1))",
+	timeArg: func(t time.Time) any { return t },
+}
+
+var pgDeleteJobQueries = deleteJobQueries{
+	owners: "SELECT short_url, user_id = $1 FROM courses.shortener WHERE short_url IN ($2%s)",
+	delete: "UPDATE courses.shortener SET is_deleted = true WHERE user_id = $1 AND short_url IN ($2%s)",
+	save: "INSERT INTO courses.shortener_delete_job" +
+		"(id, user_id, status, attempts, error, results, created_at, updated_at) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (id) DO UPDATE SET " +
+		"status = excluded.status, attempts = excluded.attempts, error = excluded.error, " +
+		"results = excluded.results, updated_at = excluded.updated_at",
+	find: "SELECT id, user_id, status, attempts, error, results, created_at, updated_at " +
+		"FROM courses.shortener_delete_job WHERE id = $1 AND user_id = $2",
+	pending: "SELECT id, user_id, status, attempts, error, results, created_at, updated_at " +
+		"FROM courses.shortener_delete_job WHERE status = '" + model.DeleteJobPending + "' " +
+		"ORDER BY created_at, id",
+	timeArg: func(t time.Time) any { return t },
+	timeDst: func(t *time.Time) any { return t },
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
 func buildIDs(it model.BatchDeleteEntry) []any {
 	var iDs = make([]any, len(it.ShortIDs)+1)
 	iDs[0] = it.UserID
@@ -236,7 +585,7 @@ func buildIDs(it model.BatchDeleteEntry) []any {
 	return iDs
 }
 
-func (ds *DBStorage) buildDeleteQuery(it model.BatchDeleteEntry, template string) string {
+func buildDeleteQuery(it model.BatchDeleteEntry, template string) string {
 	l := len(it.ShortIDs)
 	builder := strings.Builder{}
 	for i := 3; i <= l+1; i++ {
@@ -246,21 +595,22 @@ func (ds *DBStorage) buildDeleteQuery(it model.BatchDeleteEntry, template string
 	return fmt.Sprintf(template, builder.String())
 }
 
-// applyMigration patches DB.
-func applyMigration(db *sql.DB, fsys fs.FS) error {
+// applyMigration patches DB with migrations of the dialect from dir.
+func applyMigration(db *sql.DB, fsys fs.FS, dialect string, dir string) error {
 	goose.SetBaseFS(fsys)
 	goose.SetSequential(true)
 
-	if err := goose.SetDialect("postgres"); err != nil {
+	if err := goose.SetDialect(dialect); err != nil {
 		return fmt.Errorf("goose.SetDialect: %w", err)
 	}
-	if err := goose.Up(db, "."); err != nil {
+	if err := goose.Up(db, dir); err != nil {
 		return fmt.Errorf("goose.Up: %w", err)
 	}
 	return nil
 }
 
-// Close closes connection pool.
+// Close closes prepared statements and connection pool.
 func (ds *DBStorage) Close() error {
+	ds.findURLStmt.Close()
 	return ds.db.Close()
 }
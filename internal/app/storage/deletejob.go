@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+)
+
+// deleteResults builds outcomes of deletion of ids.
+// owned holds existing short IDs, value reports whether short ID belongs to the user.
+func deleteResults(ids []string, owned map[string]bool) []model.DeleteResult {
+	res := make([]model.DeleteResult, 0, len(ids))
+	for _, id := range ids {
+		isOwner, ok := owned[id]
+		switch {
+		case !ok:
+			res = append(res, model.NewDeleteResult(id, model.DeleteOutcomeNotFound))
+		case !isOwner:
+			res = append(res, model.NewDeleteResult(id, model.DeleteOutcomeNotOwner))
+		default:
+			res = append(res, model.NewDeleteResult(id, model.DeleteOutcomeDeleted))
+		}
+	}
+	return res
+}
+
+// sortDeleteJobs sorts jobs by creation time, job ID breaks ties.
+func sortDeleteJobs(jobs []model.DeleteJob) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+}
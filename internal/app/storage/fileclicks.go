@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+)
+
+// openClicks counts clicks of the clicks file by short URL and opens it for appending.
+func (fs *FileStorage) openClicks() error {
+	name := fs.filename + ClicksFileSuffix
+	fs.clickCounts = make(map[string]*model.ClickCounts)
+	var total int
+	file, err := os.Open(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("open clicks file %w", err)
+	}
+	if err == nil {
+		defer file.Close()
+		sc := bufio.NewScanner(file)
+		for sc.Scan() {
+			var c model.Click
+			if err = json.Unmarshal(sc.Bytes(), &c); err != nil {
+				logger.Log.Warn(fmt.Sprintf("skip broken click record %s", err))
+				continue
+			}
+			fs.countClickNotSync(c)
+			total++
+		}
+		if err = sc.Err(); err != nil {
+			return fmt.Errorf("read clicks file %w", err)
+		}
+	}
+	fs.clicks, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("open clicks file %w", err)
+	}
+	logger.Log.Info(fmt.Sprintf("Initializing clicks from file count = %d", total))
+	return nil
+}
+
+func (fs *FileStorage) countClickNotSync(c model.Click) {
+	counts, ok := fs.clickCounts[c.ShortURL]
+	if !ok {
+		counts = model.NewClickCounts()
+		fs.clickCounts[c.ShortURL] = counts
+	}
+	counts.Add(c)
+}
+
+// SaveClicks appends clicks to the clicks file and counts them.
+func (fs *FileStorage) SaveClicks(ctx context.Context, clicks []model.Click) error {
+	var buf []byte
+	for _, c := range clicks {
+		marsh, err := json.Marshal(c)
+		if err != nil {
+			return fmt.Errorf("marshal json %w", err)
+		}
+		buf = append(buf, marsh...)
+		buf = append(buf, '\n')
+	}
+	fs.clicksMx.Lock()
+	defer fs.clicksMx.Unlock()
+	if _, err := fs.clicks.Write(buf); err != nil {
+		return fmt.Errorf("write clicks %w", err)
+	}
+	for _, c := range clicks {
+		fs.countClickNotSync(c)
+	}
+	return nil
+}
+
+// FindClickStats returns click statistic of user's short URL from counts kept in memory.
+func (fs *FileStorage) FindClickStats(ctx context.Context, userID string,
+	id string, top int) (model.ClickStats, error) {
+	fs.cache.mx.RLock()
+	url, ok := fs.cache.items[id]
+	fs.cache.mx.RUnlock()
+	if !ok || url.UserID != userID {
+		return model.ClickStats{}, ErrNotFound
+	}
+	fs.clicksMx.Lock()
+	defer fs.clicksMx.Unlock()
+	counts, ok := fs.clickCounts[id]
+	if !ok {
+		return model.NewClickStats(id, nil, top), nil
+	}
+	return counts.Stats(id, top), nil
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+)
+
+// JobsFileSuffix suffix of the file with delete jobs next to storage file.
+const JobsFileSuffix = ".jobs"
+
+// deleteJobRetention finished jobs older than retention are dropped when jobs file is opened.
+const deleteJobRetention = 7 * 24 * time.Hour
+
+// fsDeleteJob record of the jobs file. Every save appends new version of the job.
+type fsDeleteJob struct {
+	model.DeleteJob
+	UserID string `json:"user_id"`
+}
+
+// openJobs loads jobs to the cache, rewrites jobs file with the latest versions
+// of retained jobs and opens it for appending.
+func (fs *FileStorage) openJobs(now time.Time) error {
+	name := fs.filename + JobsFileSuffix
+	jobs, err := readJobs(name)
+	if err != nil {
+		return err
+	}
+	err = replaceFile(name, func(w io.Writer) error {
+		for _, job := range jobs {
+			if job.IsFinished() && now.Sub(job.UpdatedAt) > deleteJobRetention {
+				continue
+			}
+			fs.cache.jobs[job.ID] = job
+			if err := writeJob(w, job); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fs.jobs, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("open jobs file %w", err)
+	}
+	logger.Log.Info(fmt.Sprintf("Initializing delete jobs from file count = %d", len(fs.cache.jobs)))
+	return nil
+}
+
+// replaceFile atomically replaces file name by the file with content written by write.
+func replaceFile(name string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(name)
+	tmp, err := os.CreateTemp(dir, filepath.Base(name)+".compact-*")
+	if err != nil {
+		return fmt.Errorf("create temp file %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	if err = write(w); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("flush temp file %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync temp file %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file %w", err)
+	}
+	if err = os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("rename temp file %w", err)
+	}
+	if err = syncDir(dir); err != nil {
+		return fmt.Errorf("sync dir %w", err)
+	}
+	return nil
+}
+
+// readJobs returns the latest version of every job in file ordered by creation time.
+// Incomplete last record left by crash is skipped.
+func readJobs(name string) ([]model.DeleteJob, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open jobs file %w", err)
+	}
+	defer file.Close()
+	latest := make(map[string]model.DeleteJob)
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("ReadBytes line #%d %w", line, err)
+		}
+		if errors.Is(err, io.EOF) {
+			if len(data) != 0 {
+				logger.Log.Warn(fmt.Sprintf("Skipping incomplete delete job at line #%d", line))
+			}
+			break
+		}
+		var r fsDeleteJob
+		if err = json.Unmarshal(data, &r); err != nil {
+			return nil, fmt.Errorf("Unmarshal line #%d %w", line, err)
+		}
+		r.DeleteJob.UserID = r.UserID
+		latest[r.ID] = r.DeleteJob
+	}
+	jobs := make([]model.DeleteJob, 0, len(latest))
+	for _, job := range latest {
+		jobs = append(jobs, job)
+	}
+	sortDeleteJobs(jobs)
+	return jobs, nil
+}
+
+func writeJob(w io.Writer, job model.DeleteJob) error {
+	marsh, err := json.Marshal(fsDeleteJob{DeleteJob: job, UserID: job.UserID})
+	if err != nil {
+		return fmt.Errorf("marshal json %w", err)
+	}
+	if _, err = w.Write(append(marsh, '\n')); err != nil {
+		return fmt.Errorf("write job %w", err)
+	}
+	return nil
+}
+
+// SaveDeleteJob appends new version of the job to the jobs file and syncs it,
+// so accepted jobs survive restart.
+func (fs *FileStorage) SaveDeleteJob(ctx context.Context, job model.DeleteJob) error {
+	fs.jobsMx.Lock()
+	defer fs.jobsMx.Unlock()
+	if err := writeJob(fs.jobs, job); err != nil {
+		return err
+	}
+	if err := fs.jobs.Sync(); err != nil {
+		return fmt.Errorf("sync jobs file %w", err)
+	}
+	return fs.cache.SaveDeleteJob(ctx, job)
+}
+
+// FindDeleteJob returns user's delete job.
+func (fs *FileStorage) FindDeleteJob(ctx context.Context, userID string,
+	id string) (model.DeleteJob, error) {
+	return fs.cache.FindDeleteJob(ctx, userID, id)
+}
+
+// FindPendingDeleteJobs returns jobs that are not finished yet.
+func (fs *FileStorage) FindPendingDeleteJobs(ctx context.Context) ([]model.DeleteJob, error) {
+	return fs.cache.FindPendingDeleteJobs(ctx)
+}
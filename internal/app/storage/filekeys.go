@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+)
+
+// KeysFileSuffix suffix of the file with API keys next to storage file.
+const KeysFileSuffix = ".keys"
+
+// fsAPIKey record of the keys file. Revoked key is appended once more with Revoked flag.
+type fsAPIKey struct {
+	model.APIKey
+	UserID  string `json:"user_id"`
+	Hash    string `json:"hash"`
+	Revoked bool   `json:"revoked,omitempty"`
+}
+
+// openKeys loads API keys to the cache, rewrites keys file without revoked keys
+// and opens it for appending.
+func (fs *FileStorage) openKeys() error {
+	name := fs.filename + KeysFileSuffix
+	keys, err := readKeys(name)
+	if err != nil {
+		return err
+	}
+	err = replaceFile(name, func(w io.Writer) error {
+		for _, key := range keys {
+			fs.cache.saveAPIKeyNotSync(key)
+			if err := writeKey(w, fsAPIKey{APIKey: key, UserID: key.UserID, Hash: key.Hash}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fs.keys, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open keys file %w", err)
+	}
+	logger.Log.Info(fmt.Sprintf("Initializing API keys from file count = %d", len(keys)))
+	return nil
+}
+
+// readKeys returns keys that are not revoked ordered by creation time.
+// Incomplete last record left by crash is skipped.
+func readKeys(name string) ([]model.APIKey, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open keys file %w", err)
+	}
+	defer file.Close()
+	active := make(map[string]model.APIKey)
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("ReadBytes line #%d %w", line, err)
+		}
+		if errors.Is(err, io.EOF) {
+			if len(data) != 0 {
+				logger.Log.Warn(fmt.Sprintf("Skipping incomplete API key at line #%d", line))
+			}
+			break
+		}
+		var r fsAPIKey
+		if err = json.Unmarshal(data, &r); err != nil {
+			return nil, fmt.Errorf("Unmarshal line #%d %w", line, err)
+		}
+		if r.Revoked {
+			delete(active, r.ID)
+			continue
+		}
+		r.APIKey.UserID = r.UserID
+		r.APIKey.Hash = r.Hash
+		active[r.ID] = r.APIKey
+	}
+	keys := make([]model.APIKey, 0, len(active))
+	for _, key := range active {
+		keys = append(keys, key)
+	}
+	sortAPIKeys(keys)
+	return keys, nil
+}
+
+func writeKey(w io.Writer, r fsAPIKey) error {
+	marsh, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshal json %w", err)
+	}
+	if _, err = w.Write(append(marsh, '\n')); err != nil {
+		return fmt.Errorf("write key %w", err)
+	}
+	return nil
+}
+
+// appendKeyNotSync appends record to the keys file and syncs it.
+func (fs *FileStorage) appendKeyNotSync(r fsAPIKey) error {
+	if err := writeKey(fs.keys, r); err != nil {
+		return err
+	}
+	if err := fs.keys.Sync(); err != nil {
+		return fmt.Errorf("sync keys file %w", err)
+	}
+	return nil
+}
+
+// SaveAPIKey appends API key to the keys file.
+func (fs *FileStorage) SaveAPIKey(ctx context.Context, key model.APIKey) error {
+	fs.keysMx.Lock()
+	defer fs.keysMx.Unlock()
+	if err := fs.appendKeyNotSync(fsAPIKey{APIKey: key, UserID: key.UserID, Hash: key.Hash}); err != nil {
+		return err
+	}
+	return fs.cache.SaveAPIKey(ctx, key)
+}
+
+// FindAPIKeyByHash returns API key by hash of the key.
+func (fs *FileStorage) FindAPIKeyByHash(ctx context.Context, hash string) (model.APIKey, error) {
+	return fs.cache.FindAPIKeyByHash(ctx, hash)
+}
+
+// FindUserAPIKeys returns user's API keys.
+func (fs *FileStorage) FindUserAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error) {
+	return fs.cache.FindUserAPIKeys(ctx, userID)
+}
+
+// DeleteAPIKey appends revoked record of user's API key to the keys file.
+func (fs *FileStorage) DeleteAPIKey(ctx context.Context, userID string, id string) error {
+	fs.keysMx.Lock()
+	defer fs.keysMx.Unlock()
+	fs.cache.mx.Lock()
+	defer fs.cache.mx.Unlock()
+	key, ok := fs.cache.apiKeys[id]
+	if !ok || key.UserID != userID {
+		return fmt.Errorf("DeleteAPIKey by id = %s. %w", id, ErrNotFound)
+	}
+	err := fs.appendKeyNotSync(fsAPIKey{APIKey: model.APIKey{ID: id}, Revoked: true})
+	if err != nil {
+		return err
+	}
+	return fs.cache.deleteAPIKeyNotSync(userID, id)
+}
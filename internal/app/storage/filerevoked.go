@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+)
+
+// RevokedFileSuffix suffix of the file with revoked JWT IDs next to storage file.
+const RevokedFileSuffix = ".revoked"
+
+// fsRevokedToken record of the revoked tokens file.
+type fsRevokedToken struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// openRevoked loads revoked tokens to the cache, rewrites revoked tokens file
+// without tokens expired before now and opens it for appending.
+func (fs *FileStorage) openRevoked(now time.Time) error {
+	name := fs.filename + RevokedFileSuffix
+	tokens, err := readRevoked(name)
+	if err != nil {
+		return err
+	}
+	err = replaceFile(name, func(w io.Writer) error {
+		for _, t := range tokens {
+			if !now.Before(t.ExpiresAt) {
+				continue
+			}
+			fs.cache.revokedTokens[t.ID] = t.ExpiresAt
+			if err := writeRevoked(w, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fs.revoked, err = os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open revoked tokens file %w", err)
+	}
+	logger.Log.Info(fmt.Sprintf("Initializing revoked tokens from file count = %d",
+		len(fs.cache.revokedTokens)))
+	return nil
+}
+
+// readRevoked returns all records of revoked tokens file.
+// Incomplete last record left by crash is skipped.
+func readRevoked(name string) ([]fsRevokedToken, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open revoked tokens file %w", err)
+	}
+	defer file.Close()
+	var tokens []fsRevokedToken
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("ReadBytes line #%d %w", line, err)
+		}
+		if errors.Is(err, io.EOF) {
+			if len(data) != 0 {
+				logger.Log.Warn(fmt.Sprintf("Skipping incomplete revoked token at line #%d", line))
+			}
+			break
+		}
+		var r fsRevokedToken
+		if err = json.Unmarshal(data, &r); err != nil {
+			return nil, fmt.Errorf("Unmarshal line #%d %w", line, err)
+		}
+		tokens = append(tokens, r)
+	}
+	return tokens, nil
+}
+
+func writeRevoked(w io.Writer, r fsRevokedToken) error {
+	marsh, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshal json %w", err)
+	}
+	if _, err = w.Write(append(marsh, '\n')); err != nil {
+		return fmt.Errorf("write revoked token %w", err)
+	}
+	return nil
+}
+
+// RevokeToken appends JWT ID to the revoked tokens file and syncs it,
+// so token stays revoked after restart.
+func (fs *FileStorage) RevokeToken(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	fs.revokedMx.Lock()
+	defer fs.revokedMx.Unlock()
+	if revoked, _ := fs.cache.IsTokenRevoked(ctx, id); revoked {
+		return false, nil
+	}
+	if err := writeRevoked(fs.revoked, fsRevokedToken{ID: id, ExpiresAt: expiresAt}); err != nil {
+		return false, err
+	}
+	if err := fs.revoked.Sync(); err != nil {
+		return false, fmt.Errorf("sync revoked tokens file %w", err)
+	}
+	return fs.cache.RevokeToken(ctx, id, expiresAt)
+}
+
+// IsTokenRevoked checks whether JWT ID is revoked.
+func (fs *FileStorage) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	return fs.cache.IsTokenRevoked(ctx, id)
+}
+
+// DeleteExpiredRevokedTokens removes expired tokens from the cache,
+// the file is rewritten without them on next start.
+func (fs *FileStorage) DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	return fs.cache.DeleteExpiredRevokedTokens(ctx, now)
+}
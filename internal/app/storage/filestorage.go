@@ -8,8 +8,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/denis-oreshkevich/shortener/internal/app/model"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
@@ -17,78 +20,242 @@ import (
 )
 
 // FileStorage file storage.
+// File is an append-only log of JSON records. Deletes are appended as tombstones
+// and the log is compacted when amount of tombstones reaches the threshold.
+// Clicks are appended to the separate file with [ClicksFileSuffix],
+// delete jobs to the file with [JobsFileSuffix], API keys to the file with [KeysFileSuffix],
+// registered users to the file with [UsersFileSuffix] and revoked JWT IDs
+// to the file with [RevokedFileSuffix].
 type FileStorage struct {
-	filename string
-	mx       sync.RWMutex
-	inc      int64
-	cache    *MapStorage
-	file     *os.File
-	rw       *bufio.ReadWriter
+	filename  string
+	mx        sync.RWMutex
+	inc       int64
+	garbage   int64
+	threshold int64
+	cache     *MapStorage
+	file      *os.File
+	w         *bufio.Writer
+	clicksMx  sync.Mutex
+	clicks    *os.File
+	// clickCounts map short URL ID = counts of its clicks, guarded by clicksMx.
+	clickCounts map[string]*model.ClickCounts
+	jobsMx      sync.Mutex
+	jobs        *os.File
+	keysMx      sync.Mutex
+	keys        *os.File
+	usersMx     sync.Mutex
+	users       *os.File
+	revokedMx   sync.Mutex
+	revoked     *os.File
 }
 
+// ClicksFileSuffix suffix of the file with clicks next to storage file.
+const ClicksFileSuffix = ".clicks"
+
 var _ Storage = (*FileStorage)(nil)
 
+var _ Compactor = (*FileStorage)(nil)
+
+var _ HealthChecker = (*FileStorage)(nil)
+
 // NewFileStorage creates new [*FileStorage].
-func NewFileStorage(filename string) (*FileStorage, error) {
+// Log is compacted automatically when it contains compactThreshold tombstones,
+// zero compactThreshold disables automatic compaction.
+func NewFileStorage(filename string, gen generator.IDGenerator,
+	compactThreshold int64) (*FileStorage, error) {
 	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		return nil, fmt.Errorf("NewFileStorage, OpenFile %w", err)
 	}
-	rw := bufio.NewReadWriter(bufio.NewReader(file), bufio.NewWriter(file))
-	cache := NewMapStorage()
-	var shr = &FSModel{}
-	var line int64 = 0
+	fs := &FileStorage{
+		filename:  filename,
+		threshold: compactThreshold,
+		cache:     NewMapStorage(gen),
+		file:      file,
+		w:         bufio.NewWriter(file),
+	}
+	if err = fs.replay(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("NewFileStorage, %w", err)
+	}
+	if err = fs.openClicks(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("NewFileStorage, %w", err)
+	}
+	if err = fs.openJobs(time.Now()); err != nil {
+		file.Close()
+		fs.clicks.Close()
+		return nil, fmt.Errorf("NewFileStorage, %w", err)
+	}
+	if err = fs.openKeys(); err != nil {
+		file.Close()
+		fs.clicks.Close()
+		fs.jobs.Close()
+		return nil, fmt.Errorf("NewFileStorage, %w", err)
+	}
+	if err = fs.openUsers(); err != nil {
+		file.Close()
+		fs.clicks.Close()
+		fs.jobs.Close()
+		fs.keys.Close()
+		return nil, fmt.Errorf("NewFileStorage, %w", err)
+	}
+	if err = fs.openRevoked(time.Now()); err != nil {
+		file.Close()
+		fs.clicks.Close()
+		fs.jobs.Close()
+		fs.keys.Close()
+		fs.users.Close()
+		return nil, fmt.Errorf("NewFileStorage, %w", err)
+	}
+	logger.Log.Info(fmt.Sprintf("Initializing from file count = %d, tombstones = %d",
+		fs.inc, fs.garbage))
+	return fs, nil
+}
+
+// replay restores state from the log.
+// Incomplete last record left by crash is cut off.
+func (fs *FileStorage) replay() error {
+	reader := bufio.NewReader(fs.file)
+	var offset int64
 	for {
-		data, err := rw.ReadBytes('\n')
+		data, err := reader.ReadBytes('\n')
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
+			if !errors.Is(err, io.EOF) {
+				return fmt.Errorf("ReadBytes line #%d %w", fs.inc, err)
+			}
+			if len(data) != 0 {
+				logger.Log.Warn(fmt.Sprintf("Cutting off incomplete record at line #%d", fs.inc))
+				if err = fs.file.Truncate(offset); err != nil {
+					return fmt.Errorf("truncate incomplete record %w", err)
+				}
 			}
-			return nil, fmt.Errorf("NewFileStorage, ReadBytes line #%d %w", line, err)
+			return nil
 		}
-		err = json.Unmarshal(data, shr)
-		if err != nil {
-			return nil, fmt.Errorf("NewFileStorage, Unmarshal line #%d %w", line, err)
+		offset += int64(len(data))
+		shr := &FSModel{}
+		if err = json.Unmarshal(data, shr); err != nil {
+			return fmt.Errorf("Unmarshal line #%d %w", fs.inc, err)
 		}
-		cache.saveURLNotSync(shr.ShortURL, NewOrigURL(shr.OriginalURL, shr.UserID, shr.DeletedFlag))
-		logger.Log.Debug(fmt.Sprintf("Initializied from file with id = %d, shortURL = %s, OriginalURL = %s", shr.ID, shr.ShortURL, shr.OriginalURL))
-		line++
+		fs.applyNotSync(shr)
+		logger.Log.Debug(fmt.Sprintf("Initializied from file with id = %d, op = %s, shortURL = %s",
+			shr.ID, shr.Op, shr.ShortURL))
+		fs.inc++
 	}
-	logger.Log.Info(fmt.Sprintf("Initializing from file count = %d", line))
-	return &FileStorage{
-		filename: filename,
-		inc:      line,
-		cache:    cache,
-		file:     file,
-		rw:       rw,
-	}, nil
+}
+
+// applyNotSync applies log record to the cache.
+func (fs *FileStorage) applyNotSync(shr *FSModel) {
+	if shr.Op == opDelete {
+		fs.garbage++
+		if url, ok := fs.cache.items[shr.ShortURL]; ok {
+			url.DeletedFlag = true
+			fs.cache.items[shr.ShortURL] = url
+		}
+		return
+	}
+	if shr.Op == opReassign {
+		fs.garbage++
+		fs.cache.reassignURLNotSync(shr.ShortURL, shr.UserID)
+		return
+	}
+	canonical := shr.CanonicalURL
+	if canonical == "" {
+		canonical = shr.OriginalURL
+	}
+	orig := newCreatedOrigURL(shr.OriginalURL, canonical, shr.UserID, timeOrZero(shr.ExpiresAt),
+		timeOrZero(shr.CreatedAt))
+	orig.DeletedFlag = shr.DeletedFlag
+	fs.cache.saveURLNotSync(shr.ShortURL, orig)
 }
 
 // SaveURL saves original URL to file and map and returns short URL.
-func (fs *FileStorage) SaveURL(ctx context.Context, userID string, url string) (string, error) {
-	id := atomic.AddInt64(&fs.inc, 1)
-	shURL := generator.RandString()
-	shorten := NewFSModel(id, shURL, url, userID, false)
-	marsh, err := json.Marshal(shorten)
+// Returns existing short URL and [ErrDBConflict] if canonical URL is already saved.
+func (fs *FileStorage) SaveURL(ctx context.Context, userID string, url string, canonical string,
+	expiresAt time.Time) (string, error) {
+	fs.mx.Lock()
+	defer fs.mx.Unlock()
+	now := time.Now()
+	if existing, ok := fs.cache.liveCanonicalNotSync(canonical, now); ok {
+		return existing, ErrDBConflict
+	}
+	if err := fs.cache.checkURLLimitNotSync(ctx, userID, 1, now); err != nil {
+		return "", err
+	}
+	shURL, err := fs.cache.generateIDNotSync(canonical)
 	if err != nil {
-		return "", fmt.Errorf("fileStorage SaveURL, marshal json %w", err)
+		return "", err
 	}
+	if err = fs.saveURLNotSync(shURL, url, canonical, userID, expiresAt, now); err != nil {
+		return "", fmt.Errorf("fileStorage SaveURL, %w", err)
+	}
+	return shURL, nil
+}
+
+// SaveURLWithID saves original URL to file and map under provided short ID.
+// Returns [ErrIDConflict] if short ID is already taken
+// and existing short URL and [ErrDBConflict] if canonical URL is already saved.
+func (fs *FileStorage) SaveURLWithID(ctx context.Context, userID string,
+	id string, url string, canonical string, expiresAt time.Time, createdAt time.Time) (string, error) {
 	fs.mx.Lock()
 	defer fs.mx.Unlock()
+	if _, ok := fs.cache.items[id]; ok {
+		return "", ErrIDConflict
+	}
+	now := time.Now()
+	if existing, ok := fs.cache.liveCanonicalNotSync(canonical, now); ok {
+		return existing, ErrDBConflict
+	}
+	if err := fs.cache.checkURLLimitNotSync(ctx, userID, 1, now); err != nil {
+		return "", err
+	}
+	if err := fs.saveURLNotSync(id, url, canonical, userID, expiresAt, createdAt); err != nil {
+		return "", fmt.Errorf("fileStorage SaveURLWithID, %w", err)
+	}
+	return id, nil
+}
 
-	if _, err = fs.rw.Write(marsh); err != nil {
-		return "", fmt.Errorf("fileStorage SaveURL, save to file %w", err)
+// ImportURL saves exported record to file and map under its short ID, deleted flag
+// is written in the same record. Returns [ErrIDConflict] if short ID is already taken
+// and existing short URL and [ErrDBConflict] if record is live and its canonical URL is already saved.
+func (fs *FileStorage) ImportURL(ctx context.Context, rec ExportRecord) (string, error) {
+	fs.mx.Lock()
+	defer fs.mx.Unlock()
+	if _, ok := fs.cache.items[rec.ShortURL]; ok {
+		return "", ErrIDConflict
 	}
-	if err = fs.rw.WriteByte('\n'); err != nil {
-		return "", fmt.Errorf("fileStorage SaveURL, write byte %w", err)
+	if existing, ok := fs.cache.liveCanonicalNotSync(rec.CanonicalURL, time.Now()); ok && !rec.DeletedFlag {
+		return existing, ErrDBConflict
 	}
-	if err = fs.rw.Flush(); err != nil {
-		return "", fmt.Errorf("fileStorage SaveURL, flush file %w", err)
+	shorten := NewFSModel(atomic.AddInt64(&fs.inc, 1), rec.ShortURL, rec.OriginalURL, rec.UserID, rec.DeletedFlag)
+	shorten.CanonicalURL = rec.CanonicalURL
+	shorten.ExpiresAt = timeOrNil(rec.ExpiresAt)
+	shorten.CreatedAt = timeOrNil(rec.CreatedAt)
+	if err := fs.writeNotSync(shorten); err != nil {
+		return "", fmt.Errorf("fileStorage ImportURL, %w", err)
 	}
+	return rec.ShortURL, nil
+}
 
-	fs.cache.saveURLNotSync(shURL, NewOrigURL(url, userID, false))
+func (fs *FileStorage) saveURLNotSync(shURL string, url string, canonical string, userID string,
+	expiresAt time.Time, createdAt time.Time) error {
+	id := atomic.AddInt64(&fs.inc, 1)
+	shorten := NewFSModel(id, shURL, url, userID, false)
+	shorten.CanonicalURL = canonical
+	shorten.ExpiresAt = timeOrNil(expiresAt)
+	shorten.CreatedAt = timeOrNil(createdAt)
+	return fs.writeNotSync(shorten)
+}
 
-	return shURL, nil
+// writeNotSync appends record to file and applies it to the cache.
+func (fs *FileStorage) writeNotSync(shorten *FSModel) error {
+	if err := fs.appendNotSync(shorten); err != nil {
+		return err
+	}
+	fs.cache.mx.Lock()
+	defer fs.cache.mx.Unlock()
+	fs.applyNotSync(shorten)
+	return nil
 }
 
 // SaveURLBatch saves many URLs to file and map and return [[]model.BatchRespEntry] back.
@@ -97,27 +264,47 @@ func (fs *FileStorage) SaveURLBatch(ctx context.Context, userID string,
 	var bResp []model.BatchRespEntry
 	fs.mx.Lock()
 	defer fs.mx.Unlock()
+	records := make([]*FSModel, 0, len(batch))
+	taken := make(map[string]struct{}, len(batch))
+	//map canonical URL = short URL ID of entries that are not saved yet
+	pending := make(map[string]string, len(batch))
+	now := time.Now()
+	if err := fs.cache.checkURLLimitNotSync(ctx, userID, fs.cache.newURLsNotSync(batch, now), now); err != nil {
+		return nil, err
+	}
 	for _, b := range batch {
-		id := atomic.AddInt64(&fs.inc, 1)
-		shURL := generator.RandString()
-		shorten := NewFSModel(id, shURL, b.OriginalURL, userID, false)
-		marsh, err := json.Marshal(shorten)
-		if err != nil {
-			return nil, fmt.Errorf("fileStorage SaveURLBatch, marshal json %w", err)
+		shURL, ok := fs.cache.liveCanonicalNotSync(b.CanonicalURL, now)
+		if !ok {
+			shURL, ok = pending[b.CanonicalURL]
 		}
-
-		if _, err = fs.rw.Write(marsh); err != nil {
-			return nil, fmt.Errorf("fileStorage SaveURLBatch. save to file %w", err)
+		if ok {
+			bResp = append(bResp, model.NewBatchRespEntry(b.CorrelationID, shURL))
+			continue
+		}
+		shURL, err := fs.cache.generateIDNotSync(b.CanonicalURL)
+		if err != nil {
+			return nil, err
 		}
-		if err = fs.rw.WriteByte('\n'); err != nil {
-			return nil, fmt.Errorf("fileStorage SaveURLBatch. write byte %w", err)
+		if _, ok := taken[shURL]; ok {
+			return nil, fmt.Errorf("fileStorage SaveURLBatch. %w", ErrIDGeneration)
 		}
-		fs.cache.saveURLNotSync(shURL, NewOrigURL(b.OriginalURL, userID, false))
+		taken[shURL] = struct{}{}
+		pending[b.CanonicalURL] = shURL
+		shorten := NewFSModel(atomic.AddInt64(&fs.inc, 1), shURL, b.OriginalURL, userID, false)
+		shorten.CanonicalURL = b.CanonicalURL
+		shorten.ExpiresAt = b.ExpiresAt
+		shorten.CreatedAt = &now
+		records = append(records, shorten)
 		resp := model.NewBatchRespEntry(b.CorrelationID, shURL)
 		bResp = append(bResp, resp)
 	}
-	if err := fs.rw.Flush(); err != nil {
-		return nil, fmt.Errorf("fileStorage SaveURLBatch. flush file %w", err)
+	if err := fs.appendNotSync(records...); err != nil {
+		return nil, fmt.Errorf("fileStorage SaveURLBatch. %w", err)
+	}
+	fs.cache.mx.Lock()
+	defer fs.cache.mx.Unlock()
+	for _, r := range records {
+		fs.applyNotSync(r)
 	}
 	return bResp, nil
 }
@@ -132,100 +319,314 @@ func (fs *FileStorage) FindUserURLs(ctx context.Context, userID string) ([]model
 	return fs.cache.FindUserURLs(ctx, userID)
 }
 
-// DeleteUserURLs deletes user's URLs.
-func (fs *FileStorage) DeleteUserURLs(ctx context.Context, bde model.BatchDeleteEntry) error {
+// FindUserURLsPage returns page of user's URLs ordered by short ID.
+func (fs *FileStorage) FindUserURLsPage(ctx context.Context, userID string,
+	after string, limit int) ([]model.URLPair, error) {
+	return fs.cache.FindUserURLsPage(ctx, userID, after, limit)
+}
+
+// CountUserURLs counts user's URLs that are active at now and created since since.
+func (fs *FileStorage) CountUserURLs(ctx context.Context, userID string,
+	now time.Time, since time.Time) (model.URLCount, error) {
+	return fs.cache.CountUserURLs(ctx, userID, now, since)
+}
+
+// DeleteUserURLs deletes user's URLs by appending tombstones to the file.
+func (fs *FileStorage) DeleteUserURLs(ctx context.Context,
+	bde model.BatchDeleteEntry) ([]model.DeleteResult, error) {
 	fs.mx.Lock()
 	defer fs.mx.Unlock()
-	content := make(map[string]*FSModel)
-	var shr = &FSModel{}
-	err := fs.readFileToMap(shr, content)
-	if err != nil {
-		return fmt.Errorf("read file to map. %w", err)
-	}
-	var errs []error
-	ids := bde.ShortIDs
-	for _, id := range ids {
-		fsm, ok := content[id]
+	owned := make(map[string]bool, len(bde.ShortIDs))
+	var tombstones []*FSModel
+	for _, id := range bde.ShortIDs {
+		url, ok := fs.cache.items[id]
 		if !ok {
-			errs = append(errs, fmt.Errorf("shortID = %s, is not exist", id))
 			continue
 		}
-		if fsm.UserID != bde.UserID {
-			errs = append(errs, fmt.Errorf("shortID = %s is not of userID = %s ",
-				id, bde.UserID))
+		owned[id] = url.UserID == bde.UserID
+		if !owned[id] || url.DeletedFlag {
 			continue
 		}
-		fsm.DeletedFlag = true
+		tombstones = append(tombstones, fs.newTombstone(id, bde.UserID))
 	}
-	err = fs.file.Truncate(0)
-	if err != nil {
-		return fmt.Errorf("truncate file. %w", err)
+	if err := fs.deleteNotSync(tombstones); err != nil {
+		return nil, err
+	}
+	return deleteResults(bde.ShortIDs, owned), nil
+}
+
+// DeleteExpiredURLs deletes URLs that are expired at the moment now by appending tombstones to the file.
+func (fs *FileStorage) DeleteExpiredURLs(ctx context.Context, now time.Time) (int64, error) {
+	fs.mx.Lock()
+	defer fs.mx.Unlock()
+	var tombstones []*FSModel
+	for id, url := range fs.cache.items {
+		if url.DeletedFlag || !url.IsExpired(now) {
+			continue
+		}
+		tombstones = append(tombstones, fs.newTombstone(id, url.UserID))
 	}
-	if _, err = fs.file.Seek(0, 0); err != nil {
-		return fmt.Errorf("seek file. %w", err)
+	if err := fs.deleteNotSync(tombstones); err != nil {
+		return 0, err
 	}
-	fs.cache = NewMapStorage()
-	err = fs.writeContentToCacheAndFile(content)
+	return int64(len(tombstones)), nil
+}
+
+// ReassignUser moves URLs, API keys and delete jobs of user from to user to by appending records
+// with user to to the files. Every file is synced before the next one is written.
+func (fs *FileStorage) ReassignUser(ctx context.Context, from string, to string) (model.Reassigned, error) {
+	fs.mx.Lock()
+	defer fs.mx.Unlock()
+	if from == to {
+		return model.Reassigned{}, nil
+	}
+	urls, err := fs.reassignURLsNotSync(from, to)
 	if err != nil {
-		return fmt.Errorf("write content to cache and file. %w", err)
+		return model.Reassigned{}, err
 	}
-	if len(errs) != 0 {
-		return errors.Join(errs...)
+	fs.keysMx.Lock()
+	defer fs.keysMx.Unlock()
+	fs.jobsMx.Lock()
+	defer fs.jobsMx.Unlock()
+	fs.cache.mx.Lock()
+	defer fs.cache.mx.Unlock()
+	keys, jobs := fs.cache.findUserKeysAndJobsNotSync(from)
+	for _, key := range keys {
+		key.UserID = to
+		if err = fs.appendKeyNotSync(fsAPIKey{APIKey: key, UserID: key.UserID, Hash: key.Hash}); err != nil {
+			return model.Reassigned{}, err
+		}
+		fs.cache.saveAPIKeyNotSync(key)
 	}
-	return nil
+	for i := range jobs {
+		jobs[i].UserID = to
+		if err = writeJob(fs.jobs, jobs[i]); err != nil {
+			return model.Reassigned{}, err
+		}
+	}
+	if len(jobs) > 0 {
+		if err = fs.jobs.Sync(); err != nil {
+			return model.Reassigned{}, fmt.Errorf("sync jobs file %w", err)
+		}
+	}
+	for _, job := range jobs {
+		fs.cache.jobs[job.ID] = job
+	}
+	return model.Reassigned{URLs: urls, APIKeys: int64(len(keys)), DeleteJobs: int64(len(jobs))}, nil
 }
 
-// FindStats finds statistic by saved requests.
-func (fs *FileStorage) FindStats(ctx context.Context) (model.Stat, error) {
-	return fs.cache.FindStats(ctx)
+// reassignURLsNotSync moves URLs of user from to user to by appending reassign records to the file.
+func (fs *FileStorage) reassignURLsNotSync(from string, to string) (int64, error) {
+	fs.cache.mx.RLock()
+	ids := append([]string(nil), fs.cache.userURLs[from]...)
+	fs.cache.mx.RUnlock()
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	records := make([]*FSModel, 0, len(ids))
+	for _, id := range ids {
+		r := NewFSModel(atomic.AddInt64(&fs.inc, 1), id, "", to, false)
+		r.Op = opReassign
+		records = append(records, r)
+	}
+	if err := fs.appendNotSync(records...); err != nil {
+		return 0, fmt.Errorf("append reassign records. %w", err)
+	}
+	if err := fs.file.Sync(); err != nil {
+		return 0, fmt.Errorf("sync file. %w", err)
+	}
+	fs.cache.mx.Lock()
+	defer fs.cache.mx.Unlock()
+	for _, r := range records {
+		fs.applyNotSync(r)
+	}
+	return int64(len(records)), nil
 }
 
-func (fs *FileStorage) readFileToMap(shr *FSModel, content map[string]*FSModel) error {
-	for {
-		data, err := fs.rw.ReadBytes('\n')
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			return fmt.Errorf("can't read file. %w", err)
-		}
-		err = json.Unmarshal(data, shr)
-		if err != nil {
-			return fmt.Errorf("unmarshal JSON from file %w", err)
+func (fs *FileStorage) newTombstone(shortURL string, userID string) *FSModel {
+	tombstone := NewFSModel(atomic.AddInt64(&fs.inc, 1), shortURL, "", userID, true)
+	tombstone.Op = opDelete
+	return tombstone
+}
+
+// deleteNotSync durably appends tombstones, applies them to the cache
+// and compacts the file if needed.
+func (fs *FileStorage) deleteNotSync(tombstones []*FSModel) error {
+	if len(tombstones) == 0 {
+		return nil
+	}
+	if err := fs.appendNotSync(tombstones...); err != nil {
+		return fmt.Errorf("append tombstones. %w", err)
+	}
+	if err := fs.file.Sync(); err != nil {
+		return fmt.Errorf("sync file. %w", err)
+	}
+	fs.cache.mx.Lock()
+	for _, t := range tombstones {
+		fs.applyNotSync(t)
+	}
+	fs.cache.mx.Unlock()
+	if fs.threshold > 0 && fs.garbage >= fs.threshold {
+		if err := fs.compactNotSync(); err != nil {
+			return fmt.Errorf("compact. %w", err)
 		}
-		content[shr.ShortURL] = shr
 	}
 	return nil
 }
 
-func (fs *FileStorage) writeContentToCacheAndFile(content map[string]*FSModel) error {
-	for _, cont := range content {
-		marsh, err := json.Marshal(cont)
+func (fs *FileStorage) appendNotSync(records ...*FSModel) error {
+	for _, r := range records {
+		marsh, err := json.Marshal(r)
 		if err != nil {
 			return fmt.Errorf("marshal json %w", err)
 		}
-
-		if _, err = fs.rw.Write(marsh); err != nil {
+		if _, err = fs.w.Write(marsh); err != nil {
 			return fmt.Errorf("save to file %w", err)
 		}
-		if err = fs.rw.WriteByte('\n'); err != nil {
+		if err = fs.w.WriteByte('\n'); err != nil {
 			return fmt.Errorf("write byte %w", err)
 		}
-		fs.cache.saveURLNotSync(cont.ShortURL, NewOrigURL(cont.OriginalURL,
-			cont.UserID, cont.DeletedFlag))
 	}
-	if err := fs.rw.Flush(); err != nil {
+	if err := fs.w.Flush(); err != nil {
 		return fmt.Errorf("flush file %w", err)
 	}
 	return nil
 }
 
+// Compact rewrites the file so that it contains single record per short URL.
+// New content is written to temporary file which atomically replaces the old one.
+func (fs *FileStorage) Compact(ctx context.Context) error {
+	fs.mx.Lock()
+	defer fs.mx.Unlock()
+	return fs.compactNotSync()
+}
+
+func (fs *FileStorage) compactNotSync() error {
+	dir := filepath.Dir(fs.filename)
+	tmp, err := os.CreateTemp(dir, filepath.Base(fs.filename)+".compact-*")
+	if err != nil {
+		return fmt.Errorf("create temp file %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	ids := make([]string, 0, len(fs.cache.items))
+	for id := range fs.cache.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	w := bufio.NewWriter(tmp)
+	var inc int64
+	for _, id := range ids {
+		url := fs.cache.items[id]
+		inc++
+		shorten := NewFSModel(inc, id, url.OriginalURL, url.UserID, url.DeletedFlag)
+		shorten.CanonicalURL = url.CanonicalURL
+		shorten.ExpiresAt = timeOrNil(url.ExpiresAt)
+		shorten.CreatedAt = timeOrNil(url.CreatedAt)
+		marsh, mErr := json.Marshal(shorten)
+		if mErr != nil {
+			tmp.Close()
+			return fmt.Errorf("marshal json %w", mErr)
+		}
+		w.Write(marsh)
+		w.WriteByte('\n')
+	}
+	if err = w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("flush temp file %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync temp file %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file %w", err)
+	}
+	if err = os.Rename(tmp.Name(), fs.filename); err != nil {
+		return fmt.Errorf("rename temp file %w", err)
+	}
+	if err = syncDir(dir); err != nil {
+		return fmt.Errorf("sync dir %w", err)
+	}
+
+	file, err := os.OpenFile(fs.filename, os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("open compacted file %w", err)
+	}
+	fs.file.Close()
+	fs.file = file
+	fs.w = bufio.NewWriter(file)
+	logger.Log.Info(fmt.Sprintf("File compacted, records before = %d, after = %d", fs.inc, inc))
+	fs.inc = inc
+	fs.garbage = 0
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// FindStats finds statistic by saved requests.
+func (fs *FileStorage) FindStats(ctx context.Context) (model.Stat, error) {
+	return fs.cache.FindStats(ctx)
+}
+
+// ExportURLs returns page of records ordered by short ID.
+func (fs *FileStorage) ExportURLs(ctx context.Context, after string,
+	limit int) ([]ExportRecord, error) {
+	return fs.cache.ExportURLs(ctx, after, limit)
+}
+
 // Ping Returns an error.
 func (fs *FileStorage) Ping(ctx context.Context) error {
 	return ErrPingNotDB
 }
 
-// Close closes file.
+// CheckHealth checks that storage file is still in place and writable, reports its size.
+func (fs *FileStorage) CheckHealth(ctx context.Context) []model.HealthCheck {
+	fs.mx.RLock()
+	defer fs.mx.RUnlock()
+	info, err := fs.file.Stat()
+	if err != nil {
+		return []model.HealthCheck{model.NewHealthCheck(checkFile, "", fmt.Errorf("stat file %w", err))}
+	}
+	f, err := os.OpenFile(fs.filename, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return []model.HealthCheck{model.NewHealthCheck(checkFile, "", fmt.Errorf("open file for write %w", err))}
+	}
+	defer f.Close()
+	onDisk, err := f.Stat()
+	if err != nil {
+		return []model.HealthCheck{model.NewHealthCheck(checkFile, "", fmt.Errorf("stat file %w", err))}
+	}
+	if !os.SameFile(info, onDisk) {
+		return []model.HealthCheck{model.NewHealthCheck(checkFile, "",
+			fmt.Errorf("file %s was replaced", fs.filename))}
+	}
+	detail := fmt.Sprintf("size %d bytes, garbage %d records", info.Size(), fs.garbage)
+	return []model.HealthCheck{model.NewHealthCheck(checkFile, detail, nil)}
+}
+
+// Close closes files.
 func (fs *FileStorage) Close() error {
-	return fs.file.Close()
+	fs.mx.Lock()
+	defer fs.mx.Unlock()
+	fs.clicksMx.Lock()
+	defer fs.clicksMx.Unlock()
+	fs.jobsMx.Lock()
+	defer fs.jobsMx.Unlock()
+	fs.keysMx.Lock()
+	defer fs.keysMx.Unlock()
+	fs.usersMx.Lock()
+	defer fs.usersMx.Unlock()
+	fs.revokedMx.Lock()
+	defer fs.revokedMx.Unlock()
+	return errors.Join(fs.file.Close(), fs.clicks.Close(), fs.jobs.Close(), fs.keys.Close(),
+		fs.users.Close(), fs.revoked.Close())
 }
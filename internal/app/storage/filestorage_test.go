@@ -0,0 +1,364 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorage_DeleteUserURLs(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "storage.json")
+	fs, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+	userID := generator.UUIDString()
+
+	shortURL1, err := fs.SaveURL(ctx, userID, "http://localhost:30000/", "http://localhost:30000/", time.Time{})
+	require.NoError(t, err)
+	shortURL2, err := fs.SaveURL(ctx, userID, "http://localhost:30001/", "http://localhost:30001/", time.Time{})
+	require.NoError(t, err)
+
+	res, err := fs.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(userID, []string{shortURL1, "missing"}))
+	require.NoError(t, err)
+	assert.Equal(t, []model.DeleteResult{
+		model.NewDeleteResult(shortURL1, model.DeleteOutcomeDeleted),
+		model.NewDeleteResult("missing", model.DeleteOutcomeNotFound),
+	}, res)
+	res, err = fs.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(generator.UUIDString(), []string{shortURL2}))
+	require.NoError(t, err)
+	assert.Equal(t, []model.DeleteResult{
+		model.NewDeleteResult(shortURL2, model.DeleteOutcomeNotOwner),
+	}, res)
+	require.NoError(t, fs.Close())
+
+	assert.Equal(t, 3, countLines(t, fn))
+
+	restored, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	defer restored.Close()
+	_, err = restored.FindURL(ctx, shortURL1)
+	assert.ErrorIs(t, err, ErrResultIsDeleted)
+	orig, err := restored.FindURL(ctx, shortURL2)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:30001/", orig.OriginalURL)
+}
+
+func TestFileStorage_Compact(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "storage.json")
+	fs, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 2)
+	require.NoError(t, err)
+	ctx := context.Background()
+	userID := generator.UUIDString()
+
+	var ids []string
+	for _, u := range []string{"http://localhost:30000/", "http://localhost:30001/", "http://localhost:30002/"} {
+		id, sErr := fs.SaveURL(ctx, userID, u, u, time.Time{})
+		require.NoError(t, sErr)
+		ids = append(ids, id)
+	}
+	_, err = fs.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(userID, ids[:1]))
+	require.NoError(t, err)
+	assert.Equal(t, 4, countLines(t, fn))
+
+	_, err = fs.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(userID, ids[1:2]))
+	require.NoError(t, err)
+	assert.Equal(t, 3, countLines(t, fn), "threshold reached, file must be compacted")
+
+	id, err := fs.SaveURL(ctx, userID, "http://localhost:30003/", "http://localhost:30003/", time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, fs.Compact(ctx))
+	require.NoError(t, fs.Close())
+	assert.Equal(t, 4, countLines(t, fn))
+
+	restored, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 2)
+	require.NoError(t, err)
+	defer restored.Close()
+	for _, deleted := range ids[:2] {
+		_, err = restored.FindURL(ctx, deleted)
+		assert.ErrorIs(t, err, ErrResultIsDeleted)
+	}
+	for _, alive := range []string{ids[2], id} {
+		_, err = restored.FindURL(ctx, alive)
+		assert.NoError(t, err)
+	}
+}
+
+func TestFileStorage_CountUserURLs(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "storage.json")
+	fs, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+	userID := generator.UUIDString()
+	now := time.Now()
+
+	deleted, err := fs.SaveURL(ctx, userID, "http://localhost:30000/", "http://localhost:30000/", time.Time{})
+	require.NoError(t, err)
+	_, err = fs.SaveURLBatch(ctx, userID, []model.BatchReqEntry{
+		model.NewBatchReqEntry("1", "http://localhost:30001/"),
+		model.NewBatchReqEntry("2", "http://localhost:30002/"),
+	})
+	require.NoError(t, err)
+	_, err = fs.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(userID, []string{deleted}))
+	require.NoError(t, err)
+	require.NoError(t, fs.Compact(ctx))
+	require.NoError(t, fs.Close())
+
+	restored, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	defer restored.Close()
+	count, err := restored.CountUserURLs(ctx, userID, now, now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, model.URLCount{Active: 2, Created: 3}, count,
+		"creation time must survive compaction")
+}
+
+func TestFileStorage_IncompleteRecord(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "storage.json")
+	fs, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+	id, err := fs.SaveURL(ctx, generator.UUIDString(), "http://localhost:30000/", "http://localhost:30000/", time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, fs.Close())
+
+	f, err := os.OpenFile(fn, os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"uuid":2,"short_url":"abc`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	restored, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	defer restored.Close()
+	_, err = restored.FindURL(ctx, id)
+	assert.NoError(t, err)
+	_, err = restored.SaveURL(ctx, generator.UUIDString(), "http://localhost:30001/", "http://localhost:30001/", time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, countLines(t, fn))
+}
+
+func countLines(t *testing.T, fn string) int {
+	f, err := os.Open(fn)
+	require.NoError(t, err)
+	defer f.Close()
+	var n int
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		n++
+	}
+	require.NoError(t, sc.Err())
+	return n
+}
+
+func TestFileStorage_CheckHealth(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "storage.json")
+	fs, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	defer fs.Close()
+	ctx := context.Background()
+
+	checks := fs.CheckHealth(ctx)
+	require.Len(t, checks, 1)
+	assert.Equal(t, model.HealthStatusOK, checks[0].Status)
+
+	require.NoError(t, os.Remove(fn))
+	checks = fs.CheckHealth(ctx)
+	require.Len(t, checks, 1)
+	assert.Equal(t, model.HealthStatusFail, checks[0].Status)
+}
+
+func TestFileStorage_DeleteJobs(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "storage.json")
+	fs, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	pending := model.NewDeleteJob("job-1", "user", []string{"AAAAAAAA"}, now)
+	require.NoError(t, fs.SaveDeleteJob(ctx, pending))
+	done := model.NewDeleteJob("job-2", "user", []string{"BBBBBBBB"}, now)
+	require.NoError(t, fs.SaveDeleteJob(ctx, done))
+	done.Status = model.DeleteJobDone
+	done.Results = []model.DeleteResult{model.NewDeleteResult("BBBBBBBB", model.DeleteOutcomeNotFound)}
+	require.NoError(t, fs.SaveDeleteJob(ctx, done))
+	old := model.NewDeleteJob("job-3", "user", []string{"CCCCCCCC"}, now.Add(-2*deleteJobRetention))
+	old.Status = model.DeleteJobDone
+	require.NoError(t, fs.SaveDeleteJob(ctx, old))
+	require.NoError(t, fs.Close())
+
+	restored, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	defer restored.Close()
+	assert.Equal(t, 2, countLines(t, fn+JobsFileSuffix))
+
+	jobs, err := restored.FindPendingDeleteJobs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []model.DeleteJob{pending}, jobs)
+	job, err := restored.FindDeleteJob(ctx, "user", "job-2")
+	require.NoError(t, err)
+	assert.Equal(t, done, job)
+	_, err = restored.FindDeleteJob(ctx, "other", "job-2")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = restored.FindDeleteJob(ctx, "user", "job-3")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFileStorage_APIKeys(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "storage.json")
+	fs, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	revoked := model.NewAPIKey("key-1", "user", "old", "shk_aaaaaa", "hash-1", nil, now)
+	require.NoError(t, fs.SaveAPIKey(ctx, revoked))
+	kept := model.NewAPIKey("key-2", "user", "ci", "shk_bbbbbb", "hash-2",
+		[]string{model.ScopeCreate}, now.Add(time.Second))
+	require.NoError(t, fs.SaveAPIKey(ctx, kept))
+	assert.ErrorIs(t, fs.DeleteAPIKey(ctx, "other", "key-1"), ErrNotFound)
+	require.NoError(t, fs.DeleteAPIKey(ctx, "user", "key-1"))
+	require.NoError(t, fs.Close())
+
+	restored, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	defer restored.Close()
+	assert.Equal(t, 1, countLines(t, fn+KeysFileSuffix))
+
+	_, err = restored.FindAPIKeyByHash(ctx, "hash-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	found, err := restored.FindAPIKeyByHash(ctx, "hash-2")
+	require.NoError(t, err)
+	assert.Equal(t, kept, found)
+	keys, err := restored.FindUserAPIKeys(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, []model.APIKey{kept}, keys)
+}
+
+func TestFileStorage_Accounts(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "storage.json")
+	fs, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	user := model.NewUser("account", "user@example.com", "hash", now)
+	require.NoError(t, fs.SaveUser(ctx, user))
+	assert.ErrorIs(t, fs.SaveUser(ctx, model.NewUser("other", "user@example.com", "hash", now)),
+		ErrEmailTaken)
+	id1, err := fs.SaveURL(ctx, "anon", "http://localhost:30000/", "http://localhost:30000/", time.Time{})
+	require.NoError(t, err)
+	id2, err := fs.SaveURL(ctx, "anon", "http://localhost:30001/", "http://localhost:30001/", time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, fs.SaveAPIKey(ctx, model.APIKey{ID: "key", UserID: "anon", Hash: "hash", CreatedAt: now}))
+	require.NoError(t, fs.SaveDeleteJob(ctx, model.DeleteJob{ID: "job", UserID: "anon",
+		Status: model.DeleteJobPending, CreatedAt: now, UpdatedAt: now}))
+	n, err := fs.ReassignUser(ctx, "anon", user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Reassigned{URLs: 2, APIKeys: 1, DeleteJobs: 1}, n)
+	require.NoError(t, fs.Close())
+
+	restored, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	defer restored.Close()
+	found, err := restored.FindUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	assert.Equal(t, user, found)
+	pairs, err := restored.FindUserURLs(ctx, user.ID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []model.URLPair{
+		model.NewURLPair(id1, "http://localhost:30000/"),
+		model.NewURLPair(id2, "http://localhost:30001/"),
+	}, pairs)
+	pairs, err = restored.FindUserURLs(ctx, "anon")
+	require.NoError(t, err)
+	assert.Empty(t, pairs)
+	keys, err := restored.FindUserAPIKeys(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1, "API key is moved")
+	_, err = restored.FindDeleteJob(ctx, user.ID, "job")
+	assert.NoError(t, err, "delete job is moved")
+
+	require.NoError(t, restored.Compact(ctx))
+	pairs, err = restored.FindUserURLs(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, pairs, 2)
+}
+
+func TestFileStorage_RevokedTokens(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "storage.json")
+	fs, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+	now := time.Now()
+
+	revoked, err := fs.RevokeToken(ctx, "active", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, err = fs.RevokeToken(ctx, "active", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, revoked)
+	_, err = fs.RevokeToken(ctx, "expired", now.Add(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, fs.Close())
+
+	restored, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	defer restored.Close()
+	isRevoked, err := restored.IsTokenRevoked(ctx, "active")
+	require.NoError(t, err)
+	assert.True(t, isRevoked)
+	isRevoked, err = restored.IsTokenRevoked(ctx, "unknown")
+	require.NoError(t, err)
+	assert.False(t, isRevoked)
+
+	n, err := restored.DeleteExpiredRevokedTokens(ctx, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	isRevoked, err = restored.IsTokenRevoked(ctx, "expired")
+	require.NoError(t, err)
+	assert.False(t, isRevoked)
+}
+
+func TestFileStorage_FindClickStats(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "storage.json")
+	fs, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+	userID := generator.UUIDString()
+	id, err := fs.SaveURL(ctx, userID, "http://localhost:30000/", "http://localhost:30000/", time.Time{})
+	require.NoError(t, err)
+
+	day := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	clicks := []model.Click{
+		model.NewClick(id, day, "http://a.com/", "curl", "10.0.0.0"),
+		model.NewClick(id, day.Add(30*time.Minute), "http://b.com/", "curl", "10.0.0.0"),
+		model.NewClick("another", day, "http://c.com/", "curl", ""),
+	}
+	require.NoError(t, fs.SaveClicks(ctx, clicks[:2]))
+	require.NoError(t, fs.SaveClicks(ctx, clicks[2:]))
+
+	_, err = fs.FindClickStats(ctx, generator.UUIDString(), id, 10)
+	assert.ErrorIs(t, err, ErrNotFound)
+	stats, err := fs.FindClickStats(ctx, userID, id, 1)
+	require.NoError(t, err)
+	assert.Equal(t, model.NewClickStats(id, clicks[:2], 1), stats)
+	require.NoError(t, fs.Close())
+
+	restored, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	defer restored.Close()
+	later := model.NewClick(id, day.Add(2*time.Hour), "http://a.com/", "firefox", "")
+	require.NoError(t, restored.SaveClicks(ctx, []model.Click{later}))
+	stats, err = restored.FindClickStats(ctx, userID, id, 1)
+	require.NoError(t, err)
+	assert.Equal(t, model.NewClickStats(id, append(clicks[:2:2], later), 1), stats,
+		"counts are restored from file and updated on append")
+}
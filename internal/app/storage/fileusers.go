@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+)
+
+// UsersFileSuffix suffix of the file with registered users next to storage file.
+const UsersFileSuffix = ".users"
+
+// fsUser record of the users file.
+type fsUser struct {
+	model.User
+	PasswordHash string `json:"password_hash"`
+}
+
+// openUsers loads registered users to the cache and opens users file for appending.
+// Incomplete last record left by crash is cut off.
+func (fs *FileStorage) openUsers() error {
+	name := fs.filename + UsersFileSuffix
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open users file %w", err)
+	}
+	reader := bufio.NewReader(file)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			file.Close()
+			return fmt.Errorf("ReadBytes line #%d %w", line, err)
+		}
+		if errors.Is(err, io.EOF) {
+			if len(data) != 0 {
+				logger.Log.Warn(fmt.Sprintf("Cutting off incomplete user at line #%d", line))
+				if err = file.Truncate(offset); err != nil {
+					file.Close()
+					return fmt.Errorf("truncate incomplete user %w", err)
+				}
+			}
+			break
+		}
+		offset += int64(len(data))
+		var r fsUser
+		if err = json.Unmarshal(data, &r); err != nil {
+			file.Close()
+			return fmt.Errorf("Unmarshal line #%d %w", line, err)
+		}
+		r.User.PasswordHash = r.PasswordHash
+		fs.cache.saveUserNotSync(r.User)
+	}
+	fs.users = file
+	logger.Log.Info(fmt.Sprintf("Initializing users from file count = %d", len(fs.cache.users)))
+	return nil
+}
+
+// SaveUser appends registered user to the users file and syncs it.
+func (fs *FileStorage) SaveUser(ctx context.Context, user model.User) error {
+	fs.usersMx.Lock()
+	defer fs.usersMx.Unlock()
+	if _, err := fs.cache.FindUserByEmail(ctx, user.Email); err == nil {
+		return ErrEmailTaken
+	}
+	marsh, err := json.Marshal(fsUser{User: user, PasswordHash: user.PasswordHash})
+	if err != nil {
+		return fmt.Errorf("marshal json %w", err)
+	}
+	if _, err = fs.users.Write(append(marsh, '\n')); err != nil {
+		return fmt.Errorf("write user %w", err)
+	}
+	if err = fs.users.Sync(); err != nil {
+		return fmt.Errorf("sync users file %w", err)
+	}
+	return fs.cache.SaveUser(ctx, user)
+}
+
+// FindUserByEmail returns registered user by email.
+func (fs *FileStorage) FindUserByEmail(ctx context.Context, email string) (model.User, error) {
+	return fs.cache.FindUserByEmail(ctx, email)
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/migration"
+)
+
+// Names of storage health checks.
+const (
+	checkDBPing      = "db_ping"
+	checkDBMigration = "db_migration"
+	checkFile        = "file"
+	checkMemory      = "memory"
+)
+
+// checkDBHealth pings db and compares applied migration version
+// with the newest embedded migration in dir.
+func checkDBHealth(ctx context.Context, db *sql.DB, dir string) []model.HealthCheck {
+	if err := db.PingContext(ctx); err != nil {
+		return []model.HealthCheck{model.NewHealthCheck(checkDBPing, "", err)}
+	}
+	checks := []model.HealthCheck{model.NewHealthCheck(checkDBPing, "", nil)}
+	return append(checks, checkMigration(ctx, db, dir))
+}
+
+func checkMigration(ctx context.Context, db *sql.DB, dir string) model.HealthCheck {
+	want, err := migration.LatestVersion(dir)
+	if err != nil {
+		return model.NewHealthCheck(checkDBMigration, "", err)
+	}
+	var got int64
+	err = db.QueryRowContext(ctx,
+		"SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied").Scan(&got)
+	if err != nil {
+		return model.NewHealthCheck(checkDBMigration, "", fmt.Errorf("select version %w", err))
+	}
+	if got < want {
+		return model.NewHealthCheck(checkDBMigration, "",
+			fmt.Errorf("version %d is behind expected %d", got, want))
+	}
+	return model.NewHealthCheck(checkDBMigration, fmt.Sprintf("version %d", got), nil)
+}
@@ -2,51 +2,141 @@ package storage
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/denis-oreshkevich/shortener/internal/app/model"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
 )
 
+// mapClicksSize capacity of the click ring, the oldest clicks are overwritten.
+const mapClicksSize = 100_000
+
 // MapStorage map based storage.
 type MapStorage struct {
 	mx sync.RWMutex
 	//map userId = slice of URL IDs
 	userURLs map[string][]string
 	items    map[string]OrigURL
+	//map canonical URL = short URL ID, it may point to deleted or expired URL
+	canonical map[string]string
+	gen       generator.IDGenerator
+	clicks    *clickRing
+	jobs      map[string]model.DeleteJob
+	apiKeys   map[string]model.APIKey
+	//map hash of API key = key ID
+	apiKeyHashes map[string]string
+	users        map[string]model.User
+	//map email = user ID
+	userEmails map[string]string
+	//map revoked JWT ID = expiration time
+	revokedTokens map[string]time.Time
 }
 
 var _ Storage = (*MapStorage)(nil)
 
+var _ HealthChecker = (*MapStorage)(nil)
+
 // NewMapStorage creates new [*MapStorage].
-func NewMapStorage() *MapStorage {
+func NewMapStorage(gen generator.IDGenerator) *MapStorage {
 	return &MapStorage{
-		userURLs: make(map[string][]string),
-		items:    make(map[string]OrigURL),
+		userURLs:  make(map[string][]string),
+		items:     make(map[string]OrigURL),
+		canonical: make(map[string]string),
+		gen:       gen,
+		clicks:    newClickRing(mapClicksSize),
+		jobs:      make(map[string]model.DeleteJob),
+
+		apiKeys:      make(map[string]model.APIKey),
+		apiKeyHashes: make(map[string]string),
+		users:        make(map[string]model.User),
+		userEmails:   make(map[string]string),
+
+		revokedTokens: make(map[string]time.Time),
 	}
 }
 
 // SaveURL saves original URL to maps and returns short URL.
-func (ms *MapStorage) SaveURL(ctx context.Context, userID string, url string) (string, error) {
-	id := generator.RandString()
+// Returns existing short URL and [ErrDBConflict] if canonical URL is already saved.
+func (ms *MapStorage) SaveURL(ctx context.Context, userID string, url string, canonical string,
+	expiresAt time.Time) (string, error) {
 	ms.mx.Lock()
 	defer ms.mx.Unlock()
-	ms.saveURLNotSync(id, NewOrigURL(url, userID, false))
+	now := time.Now()
+	if existing, ok := ms.liveCanonicalNotSync(canonical, now); ok {
+		return existing, ErrDBConflict
+	}
+	if err := ms.checkURLLimitNotSync(ctx, userID, 1, now); err != nil {
+		return "", err
+	}
+	id, err := ms.generateIDNotSync(canonical)
+	if err != nil {
+		return "", err
+	}
+	ms.saveURLNotSync(id, newCreatedOrigURL(url, canonical, userID, expiresAt, now))
 	return id, nil
 }
 
+// SaveURLWithID saves original URL to maps under provided short ID.
+// Returns [ErrIDConflict] if short ID is already taken
+// and existing short URL and [ErrDBConflict] if canonical URL is already saved.
+func (ms *MapStorage) SaveURLWithID(ctx context.Context, userID string,
+	id string, url string, canonical string, expiresAt time.Time, createdAt time.Time) (string, error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if _, ok := ms.items[id]; ok {
+		return "", ErrIDConflict
+	}
+	now := time.Now()
+	if existing, ok := ms.liveCanonicalNotSync(canonical, now); ok {
+		return existing, ErrDBConflict
+	}
+	if err := ms.checkURLLimitNotSync(ctx, userID, 1, now); err != nil {
+		return "", err
+	}
+	ms.saveURLNotSync(id, newCreatedOrigURL(url, canonical, userID, expiresAt, createdAt))
+	return id, nil
+}
+
+// ImportURL saves exported record to maps under its short ID.
+// Returns [ErrIDConflict] if short ID is already taken and existing short URL
+// and [ErrDBConflict] if record is live and its canonical URL is already saved.
+func (ms *MapStorage) ImportURL(ctx context.Context, rec ExportRecord) (string, error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if _, ok := ms.items[rec.ShortURL]; ok {
+		return "", ErrIDConflict
+	}
+	if existing, ok := ms.liveCanonicalNotSync(rec.CanonicalURL, time.Now()); ok && !rec.DeletedFlag {
+		return existing, ErrDBConflict
+	}
+	ms.saveURLNotSync(rec.ShortURL, rec.origURL())
+	return rec.ShortURL, nil
+}
+
 // SaveURLBatch saves many URLs to maps and return [[]model.BatchRespEntry] back.
 func (ms *MapStorage) SaveURLBatch(ctx context.Context, userID string,
 	batch []model.BatchReqEntry) ([]model.BatchRespEntry, error) {
 	ms.mx.Lock()
 	defer ms.mx.Unlock()
 	var bResp []model.BatchRespEntry
+	now := time.Now()
+	if err := ms.checkURLLimitNotSync(ctx, userID, ms.newURLsNotSync(batch, now), now); err != nil {
+		return nil, err
+	}
 	for _, b := range batch {
-		sh := generator.RandString()
-		ms.saveURLNotSync(sh, NewOrigURL(b.OriginalURL, userID, false))
+		sh, ok := ms.liveCanonicalNotSync(b.CanonicalURL, now)
+		if !ok {
+			var err error
+			if sh, err = ms.generateIDNotSync(b.CanonicalURL); err != nil {
+				return nil, err
+			}
+			ms.saveURLNotSync(sh, newCreatedOrigURL(b.OriginalURL, b.CanonicalURL, userID,
+				timeOrZero(b.ExpiresAt), now))
+		}
 		bResp = append(bResp, model.NewBatchRespEntry(b.CorrelationID, sh))
 	}
 	return bResp, nil
@@ -59,11 +149,14 @@ func (ms *MapStorage) FindURL(ctx context.Context, id string) (*OrigURL, error)
 	val, ok := ms.items[id]
 	logger.Log.Debug(fmt.Sprintf("Search in cache by id = %s, and isExist = %t", id, ok))
 	if !ok {
-		return nil, fmt.Errorf("FindURL value not found by id = %s", id)
+		return nil, fmt.Errorf("FindURL by id = %s. %w", id, ErrNotFound)
 	}
 	if val.DeletedFlag {
 		return nil, ErrResultIsDeleted
 	}
+	if val.IsExpired(time.Now()) {
+		return nil, ErrResultIsExpired
+	}
 	return &val, nil
 }
 
@@ -88,13 +181,43 @@ func (ms *MapStorage) FindUserURLs(ctx context.Context, userID string) ([]model.
 	return res, nil
 }
 
-// DeleteUserURLs deletes user's URLs.
-func (ms *MapStorage) DeleteUserURLs(ctx context.Context, bde model.BatchDeleteEntry) error {
+// FindUserURLsPage returns page of user's URLs ordered by short ID.
+func (ms *MapStorage) FindUserURLsPage(ctx context.Context, userID string,
+	after string, limit int) ([]model.URLPair, error) {
 	ms.mx.RLock()
 	defer ms.mx.RUnlock()
+	ids := make([]string, 0)
+	for _, id := range ms.userURLs[userID] {
+		if id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	res := make([]model.URLPair, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, model.NewURLPair(id, ms.items[id].OriginalURL))
+	}
+	return res, nil
+}
+
+// DeleteUserURLs deletes user's URLs.
+func (ms *MapStorage) DeleteUserURLs(ctx context.Context,
+	bde model.BatchDeleteEntry) ([]model.DeleteResult, error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
 	return ms.deleteUserURLsNotSync(ctx, bde)
 }
 
+// DeleteExpiredURLs sets delete status for URLs that are expired at the moment now.
+func (ms *MapStorage) DeleteExpiredURLs(ctx context.Context, now time.Time) (int64, error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	return ms.deleteExpiredURLsNotSync(now), nil
+}
+
 // FindStats finds statistic by saved requests.
 func (ms *MapStorage) FindStats(ctx context.Context) (model.Stat, error) {
 	ms.mx.Lock()
@@ -104,40 +227,364 @@ func (ms *MapStorage) FindStats(ctx context.Context) (model.Stat, error) {
 	return model.NewStat(urls, users), nil
 }
 
-func (ms *MapStorage) deleteUserURLsNotSync(ctx context.Context,
-	bde model.BatchDeleteEntry) error {
-	var errs []error
-	_, ok := ms.userURLs[bde.UserID]
-	if !ok {
-		return fmt.Errorf("user URL slice doesnt exist userID = %s", bde.UserID)
+// ExportURLs returns page of records ordered by short ID.
+func (ms *MapStorage) ExportURLs(ctx context.Context, after string,
+	limit int) ([]ExportRecord, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	ids := make([]string, 0, len(ms.items))
+	for id := range ms.items {
+		if id > after {
+			ids = append(ids, id)
+		}
 	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	res := make([]ExportRecord, 0, len(ids))
+	for _, id := range ids {
+		url := ms.items[id]
+		res = append(res, ExportRecord{
+			ShortURL:     id,
+			OriginalURL:  url.OriginalURL,
+			CanonicalURL: url.CanonicalURL,
+			UserID:       url.UserID,
+			DeletedFlag:  url.DeletedFlag,
+			ExpiresAt:    url.ExpiresAt,
+			CreatedAt:    url.CreatedAt,
+		})
+	}
+	return res, nil
+}
+
+// CountUserURLs counts user's URLs that are active at now and created since since.
+func (ms *MapStorage) CountUserURLs(ctx context.Context, userID string,
+	now time.Time, since time.Time) (model.URLCount, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	return ms.countUserURLsNotSync(userID, now, since), nil
+}
+
+func (ms *MapStorage) countUserURLsNotSync(userID string, now time.Time, since time.Time) model.URLCount {
+	var count model.URLCount
+	for _, id := range ms.userURLs[userID] {
+		url := ms.items[id]
+		if !url.DeletedFlag && !url.IsExpired(now) {
+			count.Active++
+		}
+		if !url.CreatedAt.IsZero() && !url.CreatedAt.Before(since) {
+			count.Created++
+		}
+	}
+	return count
+}
+
+// SaveClicks saves clicks to the ring.
+func (ms *MapStorage) SaveClicks(ctx context.Context, clicks []model.Click) error {
+	ms.clicks.add(clicks...)
+	return nil
+}
+
+// FindClickStats returns click statistic of user's short URL.
+func (ms *MapStorage) FindClickStats(ctx context.Context, userID string,
+	id string, top int) (model.ClickStats, error) {
+	ms.mx.RLock()
+	url, ok := ms.items[id]
+	ms.mx.RUnlock()
+	if !ok || url.UserID != userID {
+		return model.ClickStats{}, ErrNotFound
+	}
+	return model.NewClickStats(id, ms.clicks.find(id), top), nil
+}
+
+func (ms *MapStorage) deleteUserURLsNotSync(ctx context.Context,
+	bde model.BatchDeleteEntry) ([]model.DeleteResult, error) {
+	owned := make(map[string]bool, len(bde.ShortIDs))
 	for _, shID := range bde.ShortIDs {
 		url, ok := ms.items[shID]
 		if !ok {
-			errs = append(errs, fmt.Errorf("shortID doesnt exist userID = %s", bde.UserID))
-			logger.Log.Debug(fmt.Sprintf("shortID is not present,"+
-				"shortID = %s", bde.UserID))
+			logger.Log.Debug(fmt.Sprintf("shortID is not present, shortID = %s", shID))
 			continue
 		}
-		if bde.UserID != url.UserID {
-			errs = append(errs, fmt.Errorf("shortID is not of provided user,"+
-				"shortID = %s, userI = %s", bde.UserID, bde.UserID))
+		owned[shID] = url.UserID == bde.UserID
+		if !owned[shID] {
 			continue
 		}
 		url.DeletedFlag = true
 		ms.items[shID] = url
 	}
-	if len(errs) != 0 {
-		return errors.Join(errs...)
+	return deleteResults(bde.ShortIDs, owned), nil
+}
+
+func (ms *MapStorage) deleteExpiredURLsNotSync(now time.Time) int64 {
+	var count int64
+	for id, url := range ms.items {
+		if url.DeletedFlag || !url.IsExpired(now) {
+			continue
+		}
+		url.DeletedFlag = true
+		ms.items[id] = url
+		count++
+	}
+	return count
+}
+
+// SaveDeleteJob saves delete job to map.
+func (ms *MapStorage) SaveDeleteJob(ctx context.Context, job model.DeleteJob) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	ms.jobs[job.ID] = job
+	return nil
+}
+
+// FindDeleteJob returns user's delete job.
+func (ms *MapStorage) FindDeleteJob(ctx context.Context, userID string,
+	id string) (model.DeleteJob, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	job, ok := ms.jobs[id]
+	if !ok || job.UserID != userID {
+		return model.DeleteJob{}, fmt.Errorf("FindDeleteJob by id = %s. %w", id, ErrNotFound)
+	}
+	return job, nil
+}
+
+// FindPendingDeleteJobs returns jobs that are not finished yet.
+func (ms *MapStorage) FindPendingDeleteJobs(ctx context.Context) ([]model.DeleteJob, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	var res []model.DeleteJob
+	for _, job := range ms.jobs {
+		if !job.IsFinished() {
+			res = append(res, job)
+		}
+	}
+	sortDeleteJobs(res)
+	return res, nil
+}
+
+// SaveAPIKey saves API key to map.
+func (ms *MapStorage) SaveAPIKey(ctx context.Context, key model.APIKey) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	ms.saveAPIKeyNotSync(key)
+	return nil
+}
+
+func (ms *MapStorage) saveAPIKeyNotSync(key model.APIKey) {
+	ms.apiKeys[key.ID] = key
+	ms.apiKeyHashes[key.Hash] = key.ID
+}
+
+// FindAPIKeyByHash returns API key by hash of the key.
+func (ms *MapStorage) FindAPIKeyByHash(ctx context.Context, hash string) (model.APIKey, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	id, ok := ms.apiKeyHashes[hash]
+	if !ok {
+		return model.APIKey{}, fmt.Errorf("FindAPIKeyByHash. %w", ErrNotFound)
 	}
+	return ms.apiKeys[id], nil
+}
+
+// FindUserAPIKeys returns user's API keys.
+func (ms *MapStorage) FindUserAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	var res []model.APIKey
+	for _, key := range ms.apiKeys {
+		if key.UserID == userID {
+			res = append(res, key)
+		}
+	}
+	sortAPIKeys(res)
+	return res, nil
+}
+
+// DeleteAPIKey removes user's API key from map.
+func (ms *MapStorage) DeleteAPIKey(ctx context.Context, userID string, id string) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	return ms.deleteAPIKeyNotSync(userID, id)
+}
+
+func (ms *MapStorage) deleteAPIKeyNotSync(userID string, id string) error {
+	key, ok := ms.apiKeys[id]
+	if !ok || key.UserID != userID {
+		return fmt.Errorf("DeleteAPIKey by id = %s. %w", id, ErrNotFound)
+	}
+	delete(ms.apiKeys, id)
+	delete(ms.apiKeyHashes, key.Hash)
 	return nil
 }
 
+// SaveUser saves registered user to map.
+func (ms *MapStorage) SaveUser(ctx context.Context, user model.User) error {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if _, ok := ms.userEmails[user.Email]; ok {
+		return ErrEmailTaken
+	}
+	ms.saveUserNotSync(user)
+	return nil
+}
+
+func (ms *MapStorage) saveUserNotSync(user model.User) {
+	ms.users[user.ID] = user
+	ms.userEmails[user.Email] = user.ID
+}
+
+// FindUserByEmail returns registered user by email.
+func (ms *MapStorage) FindUserByEmail(ctx context.Context, email string) (model.User, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	id, ok := ms.userEmails[email]
+	if !ok {
+		return model.User{}, fmt.Errorf("FindUserByEmail. %w", ErrNotFound)
+	}
+	return ms.users[id], nil
+}
+
+// ReassignUser moves URLs, API keys and delete jobs of user from to user to.
+func (ms *MapStorage) ReassignUser(ctx context.Context, from string, to string) (model.Reassigned, error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if from == to {
+		return model.Reassigned{}, nil
+	}
+	ids := ms.userURLs[from]
+	delete(ms.userURLs, from)
+	for _, id := range ids {
+		url := ms.items[id]
+		url.UserID = to
+		ms.items[id] = url
+	}
+	ms.userURLs[to] = append(ms.userURLs[to], ids...)
+	keys, jobs := ms.findUserKeysAndJobsNotSync(from)
+	for _, key := range keys {
+		key.UserID = to
+		ms.saveAPIKeyNotSync(key)
+	}
+	for _, job := range jobs {
+		job.UserID = to
+		ms.jobs[job.ID] = job
+	}
+	return model.Reassigned{URLs: int64(len(ids)), APIKeys: int64(len(keys)),
+		DeleteJobs: int64(len(jobs))}, nil
+}
+
+// findUserKeysAndJobsNotSync returns API keys and delete jobs of user.
+func (ms *MapStorage) findUserKeysAndJobsNotSync(userID string) ([]model.APIKey, []model.DeleteJob) {
+	var keys []model.APIKey
+	for _, key := range ms.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	var jobs []model.DeleteJob
+	for _, job := range ms.jobs {
+		if job.UserID == userID {
+			jobs = append(jobs, job)
+		}
+	}
+	return keys, jobs
+}
+
+// reassignURLNotSync moves short ID to user to.
+func (ms *MapStorage) reassignURLNotSync(id string, to string) {
+	url, ok := ms.items[id]
+	if !ok || url.UserID == to {
+		return
+	}
+	from := ms.userURLs[url.UserID]
+	for i, v := range from {
+		if v == id {
+			from = append(from[:i], from[i+1:]...)
+			break
+		}
+	}
+	if len(from) == 0 {
+		delete(ms.userURLs, url.UserID)
+	} else {
+		ms.userURLs[url.UserID] = from
+	}
+	url.UserID = to
+	ms.items[id] = url
+	ms.userURLs[to] = append(ms.userURLs[to], id)
+}
+
+// RevokeToken adds JWT ID to the denylist.
+func (ms *MapStorage) RevokeToken(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if _, ok := ms.revokedTokens[id]; ok {
+		return false, nil
+	}
+	ms.revokedTokens[id] = expiresAt
+	return true, nil
+}
+
+// IsTokenRevoked checks whether JWT ID is in the denylist.
+func (ms *MapStorage) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	_, ok := ms.revokedTokens[id]
+	return ok, nil
+}
+
+// DeleteExpiredRevokedTokens removes expired tokens from the denylist.
+func (ms *MapStorage) DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	var count int64
+	for id, expiresAt := range ms.revokedTokens {
+		if !now.Before(expiresAt) {
+			delete(ms.revokedTokens, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CheckHealth reports amount of stored URLs, memory storage is always healthy.
+func (ms *MapStorage) CheckHealth(ctx context.Context) []model.HealthCheck {
+	ms.mx.RLock()
+	defer ms.mx.RUnlock()
+	detail := fmt.Sprintf("%d URLs", len(ms.items))
+	return []model.HealthCheck{model.NewHealthCheck(checkMemory, detail, nil)}
+}
+
 // Ping returns an error.
 func (ms *MapStorage) Ping(ctx context.Context) error {
 	return ErrPingNotDB
 }
 
+// generateIDNotSync generates short ID that is not used yet.
+func (ms *MapStorage) generateIDNotSync(url string) (string, error) {
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		id, err := ms.gen.Generate(url, attempt)
+		if err != nil {
+			return "", fmt.Errorf("generate ID. %w", err)
+		}
+		if _, ok := ms.items[id]; !ok {
+			return id, nil
+		}
+		logger.Log.Debug(fmt.Sprintf("short ID collision id = %s, attempt = %d", id, attempt))
+	}
+	return "", ErrIDGeneration
+}
+
+// liveCanonicalNotSync returns short ID of canonical URL unless the URL is deleted or expired,
+// such URLs are not deduplicated.
+func (ms *MapStorage) liveCanonicalNotSync(canonical string, now time.Time) (string, bool) {
+	id, ok := ms.canonical[canonical]
+	if !ok || !ms.items[id].isLive(now) {
+		return "", false
+	}
+	return id, true
+}
+
 func (ms *MapStorage) saveURLNotSync(id string, orURL OrigURL) {
 	uItems, ok := ms.userURLs[orURL.UserID]
 	if !ok {
@@ -147,6 +594,10 @@ func (ms *MapStorage) saveURLNotSync(id string, orURL OrigURL) {
 	uItems = append(uItems, id)
 	ms.userURLs[orURL.UserID] = uItems
 	ms.items[id] = orURL
+	now := time.Now()
+	if _, ok := ms.liveCanonicalNotSync(orURL.CanonicalURL, now); !ok || orURL.isLive(now) {
+		ms.canonical[orURL.CanonicalURL] = id
+	}
 	logger.Log.Debug(fmt.Sprintf("Saved to cache with userID = %s, id = %s, "+
 		"and value = %s", orURL.UserID, id, orURL.OriginalURL))
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/denis-oreshkevich/shortener/internal/app/model"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
@@ -12,13 +13,13 @@ import (
 )
 
 func TestMapStorage_DeleteUserURLs(t *testing.T) {
-	storage := NewMapStorage()
+	storage := NewMapStorage(generator.DefaultIDGenerator())
 	ctx := context.Background()
 	userID := generator.UUIDString()
 
-	shortURL1, err := storage.SaveURL(ctx, userID, "http://localhost:30000/")
+	shortURL1, err := storage.SaveURL(ctx, userID, "http://localhost:30000/", "http://localhost:30000/", time.Time{})
 	require.NoError(t, err)
-	shortURL2, err := storage.SaveURL(ctx, userID, "http://localhost:30001/")
+	shortURL2, err := storage.SaveURL(ctx, userID, "http://localhost:30001/", "http://localhost:30001/", time.Time{})
 	require.NoError(t, err)
 
 	type args struct {
@@ -29,7 +30,7 @@ func TestMapStorage_DeleteUserURLs(t *testing.T) {
 		name    string
 		storage *MapStorage
 		args    args
-		assert  func(error)
+		assert  func([]model.DeleteResult, error)
 	}{
 		{
 			name:    "simple DeleteUserURLs #1",
@@ -38,8 +39,9 @@ func TestMapStorage_DeleteUserURLs(t *testing.T) {
 				ctx: ctx,
 				bde: model.NewBatchDeleteEntry(userID, []string{shortURL1, shortURL2}),
 			},
-			assert: func(res error) {
+			assert: func(res []model.DeleteResult, err error) {
 				require.NoError(t, err)
+				assert.Len(t, res, 2)
 				assert.Len(t, storage.items, 2)
 				for k, v := range storage.items {
 					assert.True(t, v.DeletedFlag, fmt.Sprintf("element k = %s", k))
@@ -50,18 +52,17 @@ func TestMapStorage_DeleteUserURLs(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := storage.DeleteUserURLs(tt.args.ctx, tt.args.bde)
-			tt.assert(err)
+			tt.assert(storage.DeleteUserURLs(tt.args.ctx, tt.args.bde))
 		})
 	}
 }
 
 func TestMapStorage_FindURL(t *testing.T) {
-	storage := NewMapStorage()
+	storage := NewMapStorage(generator.DefaultIDGenerator())
 	ctx := context.Background()
 	userID := generator.UUIDString()
 
-	shortURL, err := storage.SaveURL(ctx, userID, "http://localhost:30000/")
+	shortURL, err := storage.SaveURL(ctx, userID, "http://localhost:30000/", "http://localhost:30000/", time.Time{})
 	require.NoError(t, err)
 
 	type args struct {
@@ -85,6 +86,9 @@ func TestMapStorage_FindURL(t *testing.T) {
 				require.NoError(t, err)
 				origURL := NewOrigURL("http://localhost:30000/",
 					userID, false)
+				origURL.CanonicalURL = "http://localhost:30000/"
+				assert.WithinDuration(t, time.Now(), res.CreatedAt, time.Minute)
+				origURL.CreatedAt = res.CreatedAt
 				assert.Equal(t, &origURL, res)
 			},
 		},
@@ -98,13 +102,13 @@ func TestMapStorage_FindURL(t *testing.T) {
 }
 
 func TestMapStorage_FindUserURLs(t *testing.T) {
-	storage := NewMapStorage()
+	storage := NewMapStorage(generator.DefaultIDGenerator())
 	ctx := context.Background()
 	userID := generator.UUIDString()
 
-	shortURL1, err := storage.SaveURL(ctx, userID, "http://localhost:30000/")
+	shortURL1, err := storage.SaveURL(ctx, userID, "http://localhost:30000/", "http://localhost:30000/", time.Time{})
 	require.NoError(t, err)
-	shortURL2, err := storage.SaveURL(ctx, userID, "http://localhost:30001/")
+	shortURL2, err := storage.SaveURL(ctx, userID, "http://localhost:30001/", "http://localhost:30001/", time.Time{})
 	require.NoError(t, err)
 
 	type args struct {
@@ -148,7 +152,7 @@ func TestMapStorage_FindUserURLs(t *testing.T) {
 }
 
 func TestMapStorage_SaveURL(t *testing.T) {
-	storage := NewMapStorage()
+	storage := NewMapStorage(generator.DefaultIDGenerator())
 	ctx := context.Background()
 	userID := generator.UUIDString()
 
@@ -179,14 +183,14 @@ func TestMapStorage_SaveURL(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			res, err := storage.SaveURL(tt.args.ctx, tt.args.userID, tt.args.url)
+			res, err := storage.SaveURL(tt.args.ctx, tt.args.userID, tt.args.url, tt.args.url, time.Time{})
 			tt.assert(res, err)
 		})
 	}
 }
 
 func TestMapStorage_SaveURLBatch(t *testing.T) {
-	storage := NewMapStorage()
+	storage := NewMapStorage(generator.DefaultIDGenerator())
 	ctx := context.Background()
 	userID := generator.UUIDString()
 
@@ -223,3 +227,159 @@ func TestMapStorage_SaveURLBatch(t *testing.T) {
 		})
 	}
 }
+
+func TestMapStorage_SaveURLWithID(t *testing.T) {
+	storage := NewMapStorage(generator.DefaultIDGenerator())
+	ctx := context.Background()
+	userID := generator.UUIDString()
+
+	type args struct {
+		ctx    context.Context
+		userID string
+		id     string
+		url    string
+	}
+	tests := []struct {
+		name   string
+		args   args
+		assert func(string, error)
+	}{
+		{
+			name: "simple SaveURLWithID test #1",
+			args: args{
+				ctx:    ctx,
+				userID: userID,
+				id:     "spring-sale",
+				url:    "http://localhost:30000/",
+			},
+			assert: func(shURL string, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "spring-sale", shURL)
+				url, err := storage.FindURL(ctx, shURL)
+				require.NoError(t, err)
+				assert.Equal(t, "http://localhost:30000/", url.OriginalURL)
+			},
+		},
+		{
+			name: "taken id SaveURLWithID test #2",
+			args: args{
+				ctx:    ctx,
+				userID: userID,
+				id:     "spring-sale",
+				url:    "http://localhost:30001/",
+			},
+			assert: func(shURL string, err error) {
+				assert.ErrorIs(t, err, ErrIDConflict)
+				url, err := storage.FindURL(ctx, "spring-sale")
+				require.NoError(t, err)
+				assert.Equal(t, "http://localhost:30000/", url.OriginalURL)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := storage.SaveURLWithID(tt.args.ctx, tt.args.userID, tt.args.id, tt.args.url, tt.args.url, time.Time{}, time.Now())
+			tt.assert(res, err)
+		})
+	}
+}
+
+func TestMapStorage_DeleteExpiredURLs(t *testing.T) {
+	storage := NewMapStorage(generator.DefaultIDGenerator())
+	ctx := context.Background()
+	userID := generator.UUIDString()
+	now := time.Now()
+
+	expired, err := storage.SaveURL(ctx, userID, "http://localhost:30000/", "http://localhost:30000/", now.Add(time.Minute))
+	require.NoError(t, err)
+	alive, err := storage.SaveURL(ctx, userID, "http://localhost:30001/", "http://localhost:30001/", now.Add(time.Hour))
+	require.NoError(t, err)
+	eternal, err := storage.SaveURL(ctx, userID, "http://localhost:30002/", "http://localhost:30002/", time.Time{})
+	require.NoError(t, err)
+
+	type args struct {
+		ctx context.Context
+		now time.Time
+	}
+	tests := []struct {
+		name   string
+		args   args
+		assert func(int64, error)
+	}{
+		{
+			name: "simple DeleteExpiredURLs #1",
+			args: args{
+				ctx: ctx,
+				now: now.Add(2 * time.Minute),
+			},
+			assert: func(count int64, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, int64(1), count)
+				assert.True(t, storage.items[expired].DeletedFlag)
+				assert.False(t, storage.items[alive].DeletedFlag)
+				assert.False(t, storage.items[eternal].DeletedFlag)
+			},
+		},
+		{
+			name: "already deleted DeleteExpiredURLs #2",
+			args: args{
+				ctx: ctx,
+				now: now.Add(2 * time.Minute),
+			},
+			assert: func(count int64, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, int64(0), count)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := storage.DeleteExpiredURLs(tt.args.ctx, tt.args.now)
+			tt.assert(res, err)
+		})
+	}
+}
+
+func TestMapStorage_SaveURLCollision(t *testing.T) {
+	gen := generator.NewCounterGenerator(generator.DefaultAlphabet, generator.DefaultLength, 0)
+	storage := NewMapStorage(gen)
+	ctx := context.Background()
+	userID := generator.UUIDString()
+
+	first, err := storage.SaveURL(ctx, userID, "http://localhost:30000/", "http://localhost:30000/", time.Time{})
+	require.NoError(t, err)
+	gen.Reset(0)
+
+	type args struct {
+		ctx    context.Context
+		userID string
+		url    string
+	}
+	tests := []struct {
+		name   string
+		args   args
+		assert func(string, error)
+	}{
+		{
+			name: "retry on collision SaveURL #1",
+			args: args{
+				ctx:    ctx,
+				userID: userID,
+				url:    "http://localhost:30001/",
+			},
+			assert: func(shURL string, err error) {
+				require.NoError(t, err)
+				assert.NotEqual(t, first, shURL)
+				url, err := storage.FindURL(ctx, first)
+				require.NoError(t, err)
+				assert.Equal(t, "http://localhost:30000/", url.OriginalURL)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := storage.SaveURL(tt.args.ctx, tt.args.userID, tt.args.url, tt.args.url, time.Time{})
+			tt.assert(res, err)
+		})
+	}
+}
@@ -1,14 +1,27 @@
 package storage
 
+import "time"
+
 // FSModel model that stores in file.
+// CanonicalURL is empty in records saved before canonical form was tracked.
 type FSModel struct {
-	ID          int64  `json:"uuid"`
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
-	UserID      string `json:"user_id"`
-	DeletedFlag bool   `db:"is_deleted"`
+	ID           int64      `json:"uuid"`
+	ShortURL     string     `json:"short_url"`
+	OriginalURL  string     `json:"original_url"`
+	CanonicalURL string     `json:"canonical_url,omitempty"`
+	UserID       string     `json:"user_id"`
+	DeletedFlag  bool       `db:"is_deleted"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	Op           string     `json:"op,omitempty"`
 }
 
+// opDelete marks FSModel record as tombstone of previously saved short URL.
+const opDelete = "delete"
+
+// opReassign marks FSModel record that moves previously saved short URL to user UserID.
+const opReassign = "reassign"
+
 // NewFSModel creates new [FSModel].
 func NewFSModel(id int64, shortURL string,
 	originalURL string, userID string, delFlag bool) *FSModel {
@@ -22,10 +35,25 @@ func NewFSModel(id int64, shortURL string,
 }
 
 // OrigURL model.
+// Zero ExpiresAt means that URL never expires.
+// Zero CreatedAt means that URL was saved before creation time was tracked.
 type OrigURL struct {
-	OriginalURL string
-	UserID      string
-	DeletedFlag bool
+	OriginalURL  string
+	CanonicalURL string
+	UserID       string
+	DeletedFlag  bool
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+// IsExpired checks is URL expired at the moment.
+func (o OrigURL) IsExpired(now time.Time) bool {
+	return !o.ExpiresAt.IsZero() && !now.Before(o.ExpiresAt)
+}
+
+// isLive reports whether URL is neither deleted nor expired.
+func (o OrigURL) isLive(now time.Time) bool {
+	return !o.DeletedFlag && !o.IsExpired(now)
 }
 
 // NewOrigURL creates new [OrigURL].
@@ -36,3 +64,50 @@ func NewOrigURL(originalURL string, userID string, delFlag bool) OrigURL {
 		DeletedFlag: delFlag,
 	}
 }
+
+// ExportRecord full state of short URL that is used to move it between storages.
+// Zero CreatedAt means that URL was saved before creation time was tracked.
+type ExportRecord struct {
+	ShortURL     string
+	OriginalURL  string
+	CanonicalURL string
+	UserID       string
+	DeletedFlag  bool
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+// origURL returns stored state of the record.
+func (r ExportRecord) origURL() OrigURL {
+	orig := newCreatedOrigURL(r.OriginalURL, r.CanonicalURL, r.UserID, r.ExpiresAt, r.CreatedAt)
+	orig.DeletedFlag = r.DeletedFlag
+	return orig
+}
+
+func newExpiringOrigURL(originalURL string, userID string, expiresAt time.Time) OrigURL {
+	orig := NewOrigURL(originalURL, userID, false)
+	orig.ExpiresAt = expiresAt
+	return orig
+}
+
+func newCreatedOrigURL(originalURL string, canonicalURL string, userID string,
+	expiresAt time.Time, createdAt time.Time) OrigURL {
+	orig := newExpiringOrigURL(originalURL, userID, expiresAt)
+	orig.CanonicalURL = canonicalURL
+	orig.CreatedAt = createdAt
+	return orig
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+)
+
+// apiKeyQueries dialect specific queries that are shared by SQL storages.
+type apiKeyQueries struct {
+	// save inserts key, arguments are listed in saveAPIKey.
+	save string
+	// findByHash selects key by hash $1.
+	findByHash string
+	// findByUser selects keys of user $1 ordered by creation time.
+	findByUser string
+	// delete deletes key by ID $1 and user ID $2.
+	delete string
+	// timeArg converts time to query argument.
+	timeArg func(t time.Time) any
+	// timeDst returns scan destination that stores column value to t.
+	timeDst func(t *time.Time) any
+}
+
+// scopesSep separator of scopes in scopes column.
+const scopesSep = ","
+
+func saveAPIKey(ctx context.Context, db *sql.DB, q apiKeyQueries, key model.APIKey) error {
+	_, err := db.ExecContext(ctx, q.save, key.ID, key.UserID, key.Name, key.Prefix, key.Hash,
+		strings.Join(key.Scopes, scopesSep), q.timeArg(key.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("exec context. %w", err)
+	}
+	return nil
+}
+
+func findAPIKeyByHash(ctx context.Context, db *sql.DB, q apiKeyQueries, hash string) (model.APIKey, error) {
+	key, err := scanAPIKey(db.QueryRowContext(ctx, q.findByHash, hash), q)
+	if errors.Is(err, sql.ErrNoRows) {
+		return key, fmt.Errorf("FindAPIKeyByHash. %w", ErrNotFound)
+	}
+	return key, err
+}
+
+func findUserAPIKeys(ctx context.Context, db *sql.DB, q apiKeyQueries, userID string) ([]model.APIKey, error) {
+	rows, err := db.QueryContext(ctx, q.findByUser, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query context. %w", err)
+	}
+	defer rows.Close()
+	var res []model.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows, q)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+	return res, nil
+}
+
+func deleteAPIKey(ctx context.Context, db *sql.DB, q apiKeyQueries, userID string, id string) error {
+	res, err := db.ExecContext(ctx, q.delete, id, userID)
+	if err != nil {
+		return fmt.Errorf("exec context. %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected. %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("DeleteAPIKey by id = %s. %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// scanAPIKey scans columns id, user_id, name, prefix, hash, scopes, created_at.
+func scanAPIKey(s scanner, q apiKeyQueries) (model.APIKey, error) {
+	var key model.APIKey
+	var scopes string
+	err := s.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Hash, &scopes,
+		q.timeDst(&key.CreatedAt))
+	if err != nil {
+		return key, fmt.Errorf("scan API key. %w", err)
+	}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, scopesSep)
+	}
+	return key, nil
+}
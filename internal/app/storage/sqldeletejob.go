@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+)
+
+// deleteJobQueries dialect specific queries that are shared by SQL storages.
+type deleteJobQueries struct {
+	// owners selects short_url and whether it belongs to user $1 for short IDs $2, $3...
+	owners string
+	// delete marks short IDs $2, $3... of user $1 deleted.
+	delete string
+	// save upserts job, arguments are listed in saveDeleteJob.
+	save string
+	// find selects job by ID $1 and user ID $2.
+	find string
+	// pending selects unfinished jobs.
+	pending string
+	// timeArg converts time to query argument.
+	timeArg func(t time.Time) any
+	// timeDst returns scan destination that stores column value to t.
+	timeDst func(t *time.Time) any
+}
+
+// deleteUserURLs marks user's URLs deleted in single transaction and returns outcomes.
+func deleteUserURLs(ctx context.Context, db *sql.DB, q deleteJobQueries,
+	bde model.BatchDeleteEntry) ([]model.DeleteResult, error) {
+	if len(bde.ShortIDs) == 0 {
+		return nil, nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx. %w", err)
+	}
+	defer tx.Rollback()
+	args := buildIDs(bde)
+	rows, err := tx.QueryContext(ctx, buildDeleteQuery(bde, q.owners), args...)
+	if err != nil {
+		return nil, fmt.Errorf("select owners. %w", err)
+	}
+	defer rows.Close()
+	owned := make(map[string]bool, len(bde.ShortIDs))
+	for rows.Next() {
+		var id string
+		var isOwner bool
+		if err = rows.Scan(&id, &isOwner); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		owned[id] = isOwner
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, buildDeleteQuery(bde, q.delete), args...); err != nil {
+		return nil, fmt.Errorf("exec context. %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("tx commit. %w", err)
+	}
+	return deleteResults(bde.ShortIDs, owned), nil
+}
+
+func saveDeleteJob(ctx context.Context, db *sql.DB, q deleteJobQueries, job model.DeleteJob) error {
+	results, err := json.Marshal(job.Results)
+	if err != nil {
+		return fmt.Errorf("marshal results %w", err)
+	}
+	_, err = db.ExecContext(ctx, q.save, job.ID, job.UserID, job.Status, job.Attempts,
+		job.Error, string(results), q.timeArg(job.CreatedAt), q.timeArg(job.UpdatedAt))
+	if err != nil {
+		return fmt.Errorf("exec context. %w", err)
+	}
+	return nil
+}
+
+func findDeleteJob(ctx context.Context, db *sql.DB, q deleteJobQueries,
+	userID string, id string) (model.DeleteJob, error) {
+	row := db.QueryRowContext(ctx, q.find, id, userID)
+	job, err := scanDeleteJob(row, q)
+	if errors.Is(err, sql.ErrNoRows) {
+		return job, fmt.Errorf("FindDeleteJob by id = %s. %w", id, ErrNotFound)
+	}
+	return job, err
+}
+
+func findPendingDeleteJobs(ctx context.Context, db *sql.DB, q deleteJobQueries) ([]model.DeleteJob, error) {
+	rows, err := db.QueryContext(ctx, q.pending)
+	if err != nil {
+		return nil, fmt.Errorf("query context. %w", err)
+	}
+	defer rows.Close()
+	var res []model.DeleteJob
+	for rows.Next() {
+		job, err := scanDeleteJob(rows, q)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+	return res, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanDeleteJob scans columns id, user_id, status, attempts, error, results, created_at, updated_at.
+func scanDeleteJob(s scanner, q deleteJobQueries) (model.DeleteJob, error) {
+	var job model.DeleteJob
+	var results string
+	err := s.Scan(&job.ID, &job.UserID, &job.Status, &job.Attempts, &job.Error, &results,
+		q.timeDst(&job.CreatedAt), q.timeDst(&job.UpdatedAt))
+	if err != nil {
+		return job, fmt.Errorf("scan delete job. %w", err)
+	}
+	if err = json.Unmarshal([]byte(results), &job.Results); err != nil {
+		return job, fmt.Errorf("unmarshal results %w", err)
+	}
+	return job, nil
+}
+
+// millisTime scans unix time in milliseconds to t.
+type millisTime struct {
+	t *time.Time
+}
+
+// Scan implements [sql.Scanner].
+func (m millisTime) Scan(src any) error {
+	v, ok := src.(int64)
+	if !ok {
+		return fmt.Errorf("unexpected type %T of unix millis", src)
+	}
+	*m.t = time.UnixMilli(v).UTC()
+	return nil
+}
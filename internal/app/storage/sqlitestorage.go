@@ -0,0 +1,534 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"github.com/denis-oreshkevich/shortener/migration"
+	_ "modernc.org/sqlite"
+)
+
+// sqlitePragmas are applied to every connection.
+// WAL lets readers work concurrently with the writer, immediate transactions
+// together with busy timeout make writers wait for each other instead of failing.
+const sqlitePragmas = "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+
+// SQLiteStorage embedded SQLite storage.
+type SQLiteStorage struct {
+	db  *sql.DB
+	gen generator.IDGenerator
+}
+
+var _ Storage = (*SQLiteStorage)(nil)
+
+var _ HealthChecker = (*SQLiteStorage)(nil)
+
+var _ RateLimitStore = (*SQLiteStorage)(nil)
+
+// NewSQLiteStorage creates new [*SQLiteStorage] backed by database file at path.
+func NewSQLiteStorage(path string, gen generator.IDGenerator) (*SQLiteStorage, error) {
+	dsn := path
+	if strings.Contains(dsn, "?") {
+		dsn += "&" + sqlitePragmas
+	} else {
+		dsn += "?" + sqlitePragmas
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open: %w", err)
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("db.Ping: %w", err)
+	}
+	if err = applyMigration(db, migration.SQLFiles, "sqlite3", migration.SQLiteDir); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("applyMigration: %w", err)
+	}
+	return &SQLiteStorage{
+		db:  db,
+		gen: gen,
+	}, nil
+}
+
+// SaveURL saves original URL to DB and returns short URL.
+// Returns existing short URL and [ErrDBConflict] if canonical URL is already saved.
+func (ss *SQLiteStorage) SaveURL(ctx context.Context, userID string, url string, canonical string,
+	expiresAt time.Time) (string, error) {
+	return saveLimited(ctx, ss.db, sqliteURLCountQueries, userID, func(q queryRower) (string, error) {
+		for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+			sh, err := ss.gen.Generate(canonical, attempt)
+			if err != nil {
+				return "", fmt.Errorf("generate ID. %w", err)
+			}
+			res, err := insertSQLiteURL(ctx, q, sh, url, canonical, userID, expiresAt, time.Now())
+			if errors.Is(err, ErrIDConflict) {
+				logger.Log.Debug(fmt.Sprintf("short ID collision id = %s, attempt = %d", sh, attempt))
+				continue
+			}
+			return res, err
+		}
+		return "", ErrIDGeneration
+	})
+}
+
+// SaveURLWithID saves original URL to DB under provided short ID.
+// Returns existing short URL and [ErrDBConflict] if canonical URL is already saved
+// and [ErrIDConflict] if short ID is already taken by another URL.
+func (ss *SQLiteStorage) SaveURLWithID(ctx context.Context, userID string,
+	id string, url string, canonical string, expiresAt time.Time, createdAt time.Time) (string, error) {
+	return saveLimited(ctx, ss.db, sqliteURLCountQueries, userID, func(q queryRower) (string, error) {
+		return insertSQLiteURL(ctx, q, id, url, canonical, userID, expiresAt, createdAt)
+	})
+}
+
+// ImportURL saves exported record to DB under its short ID in single insert.
+// Returns [ErrIDConflict] if short ID is already taken and existing short URL
+// and [ErrDBConflict] if record is live and its canonical URL is already saved.
+func (ss *SQLiteStorage) ImportURL(ctx context.Context, rec ExportRecord) (string, error) {
+	if !rec.DeletedFlag {
+		return insertSQLiteURL(ctx, ss.db, rec.ShortURL, rec.OriginalURL, rec.CanonicalURL, rec.UserID,
+			rec.ExpiresAt, rec.CreatedAt)
+	}
+	row := ss.db.QueryRowContext(ctx, "INSERT INTO shortener(short_url, original_url, canonical_url, "+
+		"user_id, is_deleted, expires_at, created_at) VALUES ($1, $2, $3, $4, true, $5, $6) "+
+		"ON CONFLICT DO NOTHING RETURNING short_url", rec.ShortURL, rec.OriginalURL, rec.CanonicalURL,
+		rec.UserID, nullMillis(rec.ExpiresAt), nullMillis(rec.CreatedAt))
+	var res string
+	if err := row.Scan(&res); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrIDConflict
+		}
+		return "", fmt.Errorf("cannot scan value. %w", err)
+	}
+	return res, nil
+}
+
+// SaveURLBatch saves many URLs to DB and return [[]model.BatchRespEntry] back.
+func (ss *SQLiteStorage) SaveURLBatch(ctx context.Context, userID string,
+	batch []model.BatchReqEntry) ([]model.BatchRespEntry, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx. %w", err)
+	}
+	defer tx.Rollback()
+	if err = lockUserURLs(ctx, tx, sqliteURLCountQueries, userID); err != nil {
+		return nil, err
+	}
+	var bResp []model.BatchRespEntry
+	var saved int
+	for _, b := range batch {
+		sh, errSave := ss.saveBatchEntry(ctx, tx, userID, b)
+		if errSave == nil {
+			saved++
+		} else if !errors.Is(errSave, ErrDBConflict) {
+			return nil, errSave
+		}
+		var resp = model.NewBatchRespEntry(b.CorrelationID, sh)
+		bResp = append(bResp, resp)
+	}
+	if err = checkSavedURLLimit(ctx, tx, sqliteURLCountQueries, userID, saved); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("tx commit. %w", err)
+	}
+	return bResp, nil
+}
+
+// saveBatchEntry saves entry of batch in tx, it returns existing short URL
+// and [ErrDBConflict] if canonical URL is already saved.
+func (ss *SQLiteStorage) saveBatchEntry(ctx context.Context, tx *sql.Tx, userID string,
+	b model.BatchReqEntry) (string, error) {
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		sh, err := ss.gen.Generate(b.CanonicalURL, attempt)
+		if err != nil {
+			return "", fmt.Errorf("generate ID. %w", err)
+		}
+		res, err := insertSQLiteURL(ctx, tx, sh, b.OriginalURL, b.CanonicalURL, userID,
+			timeOrZero(b.ExpiresAt), time.Now())
+		if errors.Is(err, ErrIDConflict) {
+			continue
+		}
+		return res, err
+	}
+	return "", ErrIDGeneration
+}
+
+// insertSQLiteURL inserts new row and returns short URL.
+// SQLite doesn't allow INSERT inside of WITH clause, so existing row is selected separately.
+// Rows are never removed, so the row that caused conflict is still there.
+// Deleted URLs are not deduplicated, expired URL is marked deleted and the row is inserted again.
+func insertSQLiteURL(ctx context.Context, q queryRower, id string, url string, canonical string,
+	userID string, expiresAt time.Time, createdAt time.Time) (string, error) {
+	res, err := insertSQLiteURLOnce(ctx, q, id, url, canonical, userID, expiresAt, createdAt)
+	if !errors.Is(err, ErrDBConflict) {
+		return res, err
+	}
+	row := q.QueryRowContext(ctx, "UPDATE shortener SET is_deleted = true "+
+		"WHERE short_url = $1 AND expires_at <= $2 AND NOT is_deleted RETURNING short_url",
+		res, time.Now().UnixMilli())
+	var expired string
+	if errScan := row.Scan(&expired); errScan != nil {
+		if errors.Is(errScan, sql.ErrNoRows) {
+			return res, err
+		}
+		return "", fmt.Errorf("cannot scan value. %w", errScan)
+	}
+	logger.Log.Debug(fmt.Sprintf("expired URL with the same canonical form is deleted id = %s", expired))
+	return insertSQLiteURLOnce(ctx, q, id, url, canonical, userID, expiresAt, createdAt)
+}
+
+func insertSQLiteURLOnce(ctx context.Context, q queryRower, id string, url string, canonical string,
+	userID string, expiresAt time.Time, createdAt time.Time) (string, error) {
+	row := q.QueryRowContext(ctx, "INSERT INTO shortener(short_url, original_url, canonical_url, user_id, "+
+		"expires_at, created_at) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING RETURNING short_url",
+		id, url, canonical, userID, nullMillis(expiresAt), nullMillis(createdAt))
+	var res string
+	err := row.Scan(&res)
+	if err == nil {
+		return res, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("cannot scan value. %w", err)
+	}
+	row = q.QueryRowContext(ctx, "SELECT short_url FROM shortener WHERE canonical_url = $1 AND NOT is_deleted",
+		canonical)
+	if err = row.Scan(&res); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrIDConflict
+		}
+		return "", fmt.Errorf("cannot scan value. %w", err)
+	}
+	return res, ErrDBConflict
+}
+
+// FindURL finds original URL in DB by short ID.
+func (ss *SQLiteStorage) FindURL(ctx context.Context, shortURL string) (*OrigURL, error) {
+	row := ss.db.QueryRowContext(ctx, "SELECT original_url, user_id, is_deleted, expires_at "+
+		"FROM shortener WHERE short_url = $1", shortURL)
+	orig := &OrigURL{}
+	var expiresAt sql.NullInt64
+	if err := row.Scan(&orig.OriginalURL, &orig.UserID, &orig.DeletedFlag, &expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("cannot scan value. %w", err)
+	}
+	if expiresAt.Valid {
+		orig.ExpiresAt = time.UnixMilli(expiresAt.Int64)
+	}
+	if orig.DeletedFlag {
+		return nil, ErrResultIsDeleted
+	}
+	if orig.IsExpired(time.Now()) {
+		return nil, ErrResultIsExpired
+	}
+	return orig, nil
+}
+
+// FindUserURLs finds user's URLs in DB.
+func (ss *SQLiteStorage) FindUserURLs(ctx context.Context, userID string) ([]model.URLPair, error) {
+	rows, err := ss.db.QueryContext(ctx, "SELECT short_url, original_url "+
+		"FROM shortener WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, fmt.Errorf("query context. %w", err)
+	}
+	defer rows.Close()
+	var res = make([]model.URLPair, 0)
+	for rows.Next() {
+		var sh string
+		var orig string
+		if errScan := rows.Scan(&sh, &orig); errScan != nil {
+			return nil, fmt.Errorf("cannot scan value. %w", errScan)
+		}
+		res = append(res, model.NewURLPair(sh, orig))
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("rows.Err(). %w", err)
+	}
+	return res, nil
+}
+
+// FindUserURLsPage returns page of user's URLs ordered by short ID.
+func (ss *SQLiteStorage) FindUserURLsPage(ctx context.Context, userID string,
+	after string, limit int) ([]model.URLPair, error) {
+	rows, err := ss.db.QueryContext(ctx, "SELECT short_url, original_url FROM shortener "+
+		"WHERE user_id = $1 AND short_url > $2 ORDER BY short_url LIMIT $3", userID, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query context. %w", err)
+	}
+	return scanURLPairs(rows, limit)
+}
+
+// DeleteUserURLs deletes user's URLs.
+func (ss *SQLiteStorage) DeleteUserURLs(ctx context.Context,
+	bde model.BatchDeleteEntry) ([]model.DeleteResult, error) {
+	return deleteUserURLs(ctx, ss.db, sqliteDeleteJobQueries, bde)
+}
+
+// DeleteExpiredURLs sets delete status for URLs that are expired at the moment now.
+func (ss *SQLiteStorage) DeleteExpiredURLs(ctx context.Context, now time.Time) (int64, error) {
+	res, err := ss.db.ExecContext(ctx, "UPDATE shortener SET is_deleted = true "+
+		"WHERE expires_at <= $1 AND NOT is_deleted", now.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("exec context. %w", err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected. %w", err)
+	}
+	return count, nil
+}
+
+// FindStats finds statistic by saved requests.
+func (ss *SQLiteStorage) FindStats(ctx context.Context) (model.Stat, error) {
+	row := ss.db.QueryRowContext(ctx, "SELECT count(id), count(DISTINCT user_id) FROM shortener")
+	var stat model.Stat
+	if err := row.Scan(&stat.URLs, &stat.Users); err != nil {
+		return stat, fmt.Errorf("row.Scan: %w", err)
+	}
+	return stat, nil
+}
+
+// ExportURLs returns page of records ordered by short ID.
+func (ss *SQLiteStorage) ExportURLs(ctx context.Context, after string,
+	limit int) ([]ExportRecord, error) {
+	rows, err := ss.db.QueryContext(ctx, "SELECT short_url, original_url, canonical_url, user_id, "+
+		"is_deleted, expires_at, created_at FROM shortener WHERE short_url > $1 ORDER BY short_url LIMIT $2",
+		after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query context. %w", err)
+	}
+	defer rows.Close()
+	var res = make([]ExportRecord, 0, limit)
+	for rows.Next() {
+		var rec ExportRecord
+		var expiresAt, createdAt sql.NullInt64
+		if errScan := rows.Scan(&rec.ShortURL, &rec.OriginalURL, &rec.CanonicalURL, &rec.UserID,
+			&rec.DeletedFlag, &expiresAt, &createdAt); errScan != nil {
+			return nil, fmt.Errorf("cannot scan value. %w", errScan)
+		}
+		if expiresAt.Valid {
+			rec.ExpiresAt = time.UnixMilli(expiresAt.Int64)
+		}
+		if createdAt.Valid {
+			rec.CreatedAt = time.UnixMilli(createdAt.Int64)
+		}
+		res = append(res, rec)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err(). %w", err)
+	}
+	return res, nil
+}
+
+// SaveClicks saves clicks to DB in single transaction.
+func (ss *SQLiteStorage) SaveClicks(ctx context.Context, clicks []model.Click) error {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx. %w", err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO shortener_click"+
+		"(short_url, clicked_at, referrer, user_agent, ip) VALUES ($1, $2, $3, $4, $5)")
+	if err != nil {
+		return fmt.Errorf("prepare context. %w", err)
+	}
+	defer stmt.Close()
+	for _, c := range clicks {
+		if _, err = stmt.ExecContext(ctx, c.ShortURL, c.At.UnixMilli(),
+			c.Referrer, c.UserAgent, c.IP); err != nil {
+			return fmt.Errorf("exec context. %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("tx commit. %w", err)
+	}
+	return nil
+}
+
+// FindClickStats returns click statistic of user's short URL.
+func (ss *SQLiteStorage) FindClickStats(ctx context.Context, userID string,
+	id string, top int) (model.ClickStats, error) {
+	return findClickStats(ctx, ss.db, clickQueries{
+		owner: "SELECT count(*) FROM shortener WHERE short_url = $1 AND user_id = $2",
+		days: "SELECT strftime('%Y-%m-%d', clicked_at / 1000, 'unixepoch') AS day, count(*) " +
+			"FROM shortener_click WHERE short_url = $1 GROUP BY day ORDER BY day",
+		top: "SELECT %[1]s, count(*) AS cnt FROM shortener_click " +
+			"WHERE short_url = $1 AND %[1]s <> '' GROUP BY %[1]s ORDER BY cnt DESC, %[1]s LIMIT $2",
+	}, userID, id, top)
+}
+
+// CheckHealth pings DB and checks that all migrations are applied.
+func (ss *SQLiteStorage) CheckHealth(ctx context.Context) []model.HealthCheck {
+	return checkDBHealth(ctx, ss.db, migration.SQLiteDir)
+}
+
+// Ping pings DB.
+func (ss *SQLiteStorage) Ping(ctx context.Context) error {
+	return ss.db.PingContext(ctx)
+}
+
+// Close closes DB.
+func (ss *SQLiteStorage) Close() error {
+	return ss.db.Close()
+}
+
+// SaveDeleteJob upserts delete job.
+func (ss *SQLiteStorage) SaveDeleteJob(ctx context.Context, job model.DeleteJob) error {
+	return saveDeleteJob(ctx, ss.db, sqliteDeleteJobQueries, job)
+}
+
+// FindDeleteJob returns user's delete job.
+func (ss *SQLiteStorage) FindDeleteJob(ctx context.Context, userID string,
+	id string) (model.DeleteJob, error) {
+	return findDeleteJob(ctx, ss.db, sqliteDeleteJobQueries, userID, id)
+}
+
+// FindPendingDeleteJobs returns jobs that are not finished yet.
+func (ss *SQLiteStorage) FindPendingDeleteJobs(ctx context.Context) ([]model.DeleteJob, error) {
+	return findPendingDeleteJobs(ctx, ss.db, sqliteDeleteJobQueries)
+}
+
+// SaveAPIKey inserts API key.
+func (ss *SQLiteStorage) SaveAPIKey(ctx context.Context, key model.APIKey) error {
+	return saveAPIKey(ctx, ss.db, sqliteAPIKeyQueries, key)
+}
+
+// FindAPIKeyByHash returns API key by hash of the key.
+func (ss *SQLiteStorage) FindAPIKeyByHash(ctx context.Context, hash string) (model.APIKey, error) {
+	return findAPIKeyByHash(ctx, ss.db, sqliteAPIKeyQueries, hash)
+}
+
+// FindUserAPIKeys returns user's API keys.
+func (ss *SQLiteStorage) FindUserAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error) {
+	return findUserAPIKeys(ctx, ss.db, sqliteAPIKeyQueries, userID)
+}
+
+// DeleteAPIKey deletes user's API key.
+func (ss *SQLiteStorage) DeleteAPIKey(ctx context.Context, userID string, id string) error {
+	return deleteAPIKey(ctx, ss.db, sqliteAPIKeyQueries, userID, id)
+}
+
+var sqliteAPIKeyQueries = apiKeyQueries{
+	save: "INSERT INTO shortener_api_key(id, user_id, name, prefix, hash, scopes, created_at) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7)",
+	findByHash: "SELECT id, user_id, name, prefix, hash, scopes, created_at FROM shortener_api_key " +
+		"WHERE hash = $1",
+	findByUser: "SELECT id, user_id, name, prefix, hash, scopes, created_at FROM shortener_api_key " +
+		"WHERE user_id = $1 ORDER BY created_at, id",
+	delete:  "DELETE FROM shortener_api_key WHERE id = $1 AND user_id = $2",
+	timeArg: func(t time.Time) any { return t.UnixMilli() },
+	timeDst: func(t *time.Time) any { return millisTime{t: t} },
+}
+
+// SaveUser inserts registered user.
+func (ss *SQLiteStorage) SaveUser(ctx context.Context, user model.User) error {
+	return saveUser(ctx, ss.db, sqliteUserQueries, user)
+}
+
+// FindUserByEmail returns registered user by email.
+func (ss *SQLiteStorage) FindUserByEmail(ctx context.Context, email string) (model.User, error) {
+	return findUserByEmail(ctx, ss.db, sqliteUserQueries, email)
+}
+
+// ReassignUser moves URLs, API keys and delete jobs of user from to user to in single transaction.
+func (ss *SQLiteStorage) ReassignUser(ctx context.Context, from string, to string) (model.Reassigned, error) {
+	return reassignUser(ctx, ss.db, sqliteUserQueries, from, to)
+}
+
+var sqliteUserQueries = userQueries{
+	save: "INSERT INTO shortener_user(id, email, password_hash, created_at) " +
+		"VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+	findByEmail:  "SELECT id, email, password_hash, created_at FROM shortener_user WHERE email = $1",
+	reassignURLs: "UPDATE shortener SET user_id = $2 WHERE user_id = $1",
+	reassignKeys: "UPDATE shortener_api_key SET user_id = $2 WHERE user_id = $1",
+	reassignJobs: "UPDATE shortener_delete_job SET user_id = $2 WHERE user_id = $1",
+	timeArg:      func(t time.Time) any { return t.UnixMilli() },
+	timeDst:      func(t *time.Time) any { return millisTime{t: t} },
+}
+
+// RevokeToken adds JWT ID to the denylist.
+func (ss *SQLiteStorage) RevokeToken(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	return revokeToken(ctx, ss.db, sqliteRevokedTokenQueries, id, expiresAt)
+}
+
+// IsTokenRevoked checks whether JWT ID is in the denylist.
+func (ss *SQLiteStorage) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	return isTokenRevoked(ctx, ss.db, sqliteRevokedTokenQueries, id)
+}
+
+// DeleteExpiredRevokedTokens removes expired tokens from the denylist.
+func (ss *SQLiteStorage) DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	return deleteExpiredRevokedTokens(ctx, ss.db, sqliteRevokedTokenQueries, now)
+}
+
+var sqliteRevokedTokenQueries = revokedTokenQueries{
+	save:          "INSERT INTO shortener_revoked_token(id, expires_at) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+	find:          "SELECT 1 FROM shortener_revoked_token WHERE id = $1",
+	deleteExpired: "DELETE FROM shortener_revoked_token WHERE expires_at <= $1",
+	timeArg:       func(t time.Time) any { return t.UnixMilli() },
+}
+
+// TakeRateLimit advances rate limit bucket.
+func (ss *SQLiteStorage) TakeRateLimit(ctx context.Context, key string, now time.Time,
+	interval time.Duration, tolerance time.Duration) (time.Time, bool, error) {
+	return takeRateLimit(ctx, ss.db, sqliteRateLimitQueries, key, now, interval, tolerance)
+}
+
+// DeleteExpiredRateLimits removes full rate limit buckets.
+func (ss *SQLiteStorage) DeleteExpiredRateLimits(ctx context.Context, now time.Time) (int64, error) {
+	return deleteExpiredRateLimits(ctx, ss.db, sqliteRateLimitQueries, now)
+}
+
+var sqliteRateLimitQueries = rateLimitQueries{
+	take: "INSERT INTO shortener_rate_limit(key, tat) VALUES ($1, $2 + $3) " +
+		"ON CONFLICT (key) DO UPDATE SET tat = MAX(shortener_rate_limit.tat, $2) + $3 " +
+		"WHERE MAX(shortener_rate_limit.tat, $2) + $3 - $2 <= $4 RETURNING tat",
+	find:          "SELECT tat FROM shortener_rate_limit WHERE key = $1",
+	deleteExpired: "DELETE FROM shortener_rate_limit WHERE tat <= $1",
+}
+
+// CountUserURLs counts user's URLs that are active at now and created since since.
+func (ss *SQLiteStorage) CountUserURLs(ctx context.Context, userID string,
+	now time.Time, since time.Time) (model.URLCount, error) {
+	return countUserURLs(ctx, ss.db, sqliteURLCountQueries, userID, now, since)
+}
+
+var sqliteURLCountQueries = urlCountQueries{
+	count: "SELECT count(*) FILTER (WHERE NOT is_deleted AND (expires_at IS NULL OR expires_at > $2)), " +
+		"count(*) FILTER (WHERE created_at >= $3) FROM shortener WHERE user_id = $1",
+	timeArg: func(t time.Time) any { return t.UnixMilli() },
+}
+
+var sqliteDeleteJobQueries = deleteJobQueries{
+	owners: "SELECT short_url, user_id = $1 FROM shortener WHERE short_url IN ($2%s)",
+	delete: "UPDATE shortener SET is_deleted = true WHERE user_id = $1 AND short_url IN ($2%s)",
+	save: "INSERT INTO shortener_delete_job" +
+		"(id, user_id, status, attempts, error, results, created_at, updated_at) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (id) DO UPDATE SET " +
+		"status = excluded.status, attempts = excluded.attempts, error = excluded.error, " +
+		"results = excluded.results, updated_at = excluded.updated_at",
+	find: "SELECT id, user_id, status, attempts, error, results, created_at, updated_at " +
+		"FROM shortener_delete_job WHERE id = $1 AND user_id = $2",
+	pending: "SELECT id, user_id, status, attempts, error, results, created_at, updated_at " +
+		"FROM shortener_delete_job WHERE status = '" + model.DeleteJobPending + "' " +
+		"ORDER BY created_at, id",
+	timeArg: func(t time.Time) any { return t.UnixMilli() },
+	timeDst: func(t *time.Time) any { return millisTime{t: t} },
+}
+
+func nullMillis(t time.Time) sql.NullInt64 {
+	return sql.NullInt64{Int64: t.UnixMilli(), Valid: !t.IsZero()}
+}
@@ -0,0 +1,366 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/config"
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSQLiteStorage(t *testing.T) *SQLiteStorage {
+	ss, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "shortener.db"),
+		generator.DefaultIDGenerator())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		ss.Close()
+	})
+	return ss
+}
+
+func TestSQLiteStorage_SaveURL(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	ctx := context.Background()
+	userID := generator.UUIDString()
+
+	shortURL, err := ss.SaveURL(ctx, userID, "http://localhost:30000/", "http://localhost:30000/", time.Time{})
+	require.NoError(t, err)
+
+	existing, err := ss.SaveURL(ctx, userID, "http://localhost:30000/", "http://localhost:30000/", time.Time{})
+	assert.ErrorIs(t, err, ErrDBConflict)
+	assert.Equal(t, shortURL, existing)
+
+	_, err = ss.SaveURLWithID(ctx, userID, shortURL, "http://localhost:30001/", "http://localhost:30001/", time.Time{}, time.Now())
+	assert.ErrorIs(t, err, ErrIDConflict)
+
+	orig, err := ss.FindURL(ctx, shortURL)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:30000/", orig.OriginalURL)
+	assert.Equal(t, userID, orig.UserID)
+
+	batch := []model.BatchReqEntry{
+		model.NewBatchReqEntry("1", "http://localhost:30000/"),
+		model.NewBatchReqEntry("2", "http://localhost:30002/"),
+	}
+	resp, err := ss.SaveURLBatch(ctx, userID, batch)
+	require.NoError(t, err)
+	require.Len(t, resp, 2)
+	assert.Equal(t, model.NewBatchRespEntry("1", shortURL), resp[0])
+
+	pairs, err := ss.FindUserURLs(ctx, userID)
+	require.NoError(t, err)
+	assert.Len(t, pairs, 2)
+
+	stat, err := ss.FindStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, model.Stat{URLs: 2, Users: 1}, stat)
+}
+
+func TestSQLiteStorage_Delete(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	ctx := context.Background()
+	userID := generator.UUIDString()
+	now := time.Now()
+
+	shortURL1, err := ss.SaveURL(ctx, userID, "http://localhost:30000/", "http://localhost:30000/", time.Time{})
+	require.NoError(t, err)
+	shortURL2, err := ss.SaveURL(ctx, userID, "http://localhost:30001/", "http://localhost:30001/", now.Add(time.Minute))
+	require.NoError(t, err)
+
+	res, err := ss.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(userID, []string{shortURL1, "missing"}))
+	require.NoError(t, err)
+	assert.Equal(t, []model.DeleteResult{
+		model.NewDeleteResult(shortURL1, model.DeleteOutcomeDeleted),
+		model.NewDeleteResult("missing", model.DeleteOutcomeNotFound),
+	}, res)
+	res, err = ss.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(generator.UUIDString(), []string{shortURL2}))
+	require.NoError(t, err)
+	assert.Equal(t, []model.DeleteResult{
+		model.NewDeleteResult(shortURL2, model.DeleteOutcomeNotOwner),
+	}, res)
+	_, err = ss.FindURL(ctx, shortURL1)
+	assert.ErrorIs(t, err, ErrResultIsDeleted)
+
+	orig, err := ss.FindURL(ctx, shortURL2)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute).UnixMilli(), orig.ExpiresAt.UnixMilli())
+
+	count, err := ss.DeleteExpiredURLs(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+	count, err = ss.DeleteExpiredURLs(ctx, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	_, err = ss.FindURL(ctx, shortURL2)
+	assert.ErrorIs(t, err, ErrResultIsDeleted)
+}
+
+func TestSQLiteStorage_ExportURLs(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	ctx := context.Background()
+	userID := generator.UUIDString()
+	createdAt := time.UnixMilli(1700000000000)
+	for _, id := range []string{"id-00003", "id-00001", "id-00002"} {
+		_, err := ss.SaveURLWithID(ctx, userID, id, "http://localhost/"+id, "http://localhost/"+id, time.Time{}, createdAt)
+		require.NoError(t, err)
+	}
+	_, err := ss.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(userID, []string{"id-00002"}))
+	require.NoError(t, err)
+
+	page, err := ss.ExportURLs(ctx, "", 2)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, "id-00001", page[0].ShortURL)
+	assert.Equal(t, "id-00002", page[1].ShortURL)
+	assert.True(t, page[1].DeletedFlag)
+
+	page, err = ss.ExportURLs(ctx, page[1].ShortURL, 2)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, ExportRecord{ShortURL: "id-00003", OriginalURL: "http://localhost/id-00003",
+		CanonicalURL: "http://localhost/id-00003", UserID: userID, CreatedAt: createdAt}, page[0])
+}
+
+func TestSQLiteStorage_FindUserURLsPage(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	ctx := context.Background()
+	userID := generator.UUIDString()
+	for _, id := range []string{"id-00003", "id-00001", "id-00002"} {
+		_, err := ss.SaveURLWithID(ctx, userID, id, "http://localhost/"+id, "http://localhost/"+id, time.Time{}, time.Now())
+		require.NoError(t, err)
+	}
+	_, err := ss.SaveURLWithID(ctx, generator.UUIDString(), "id-00000", "http://localhost/", "http://localhost/", time.Time{}, time.Now())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		after string
+		limit int
+		want  []string
+	}{
+		{name: "first page", after: "", limit: 2, want: []string{"id-00001", "id-00002"}},
+		{name: "last page", after: "id-00002", limit: 2, want: []string{"id-00003"}},
+		{name: "after last", after: "id-00003", limit: 2, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := ss.FindUserURLsPage(ctx, userID, tt.after, tt.limit)
+			require.NoError(t, err)
+			got := make([]string, 0, len(page))
+			for _, p := range page {
+				got = append(got, strings.TrimPrefix(p.ShortURL, config.Get().BaseURL()+"/"))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSQLiteStorage_FindClickStats(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	ctx := context.Background()
+	userID := generator.UUIDString()
+	id, err := ss.SaveURL(ctx, userID, "http://localhost:30000/", "http://localhost:30000/", time.Time{})
+	require.NoError(t, err)
+
+	day := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	clicks := []model.Click{
+		model.NewClick(id, day, "http://a.com/", "curl", "10.0.0.0"),
+		model.NewClick(id, day.Add(30*time.Minute), "http://b.com/", "curl", "10.0.0.0"),
+		model.NewClick(id, day.Add(2*time.Hour), "http://a.com/", "firefox", ""),
+		model.NewClick("another", day, "http://c.com/", "curl", ""),
+	}
+	require.NoError(t, ss.SaveClicks(ctx, clicks))
+
+	_, err = ss.FindClickStats(ctx, generator.UUIDString(), id, 10)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	stats, err := ss.FindClickStats(ctx, userID, id, 1)
+	require.NoError(t, err)
+	assert.Equal(t, model.NewClickStats(id, clicks[:3], 1), stats)
+}
+
+func TestSQLiteStorage_CheckHealth(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	ctx := context.Background()
+
+	checks := ss.CheckHealth(ctx)
+	require.Len(t, checks, 2)
+	for _, c := range checks {
+		assert.Equal(t, model.HealthStatusOK, c.Status, c.Name)
+	}
+
+	_, err := ss.db.ExecContext(ctx, "DELETE FROM goose_db_version WHERE version_id = (SELECT MAX(version_id) FROM goose_db_version)")
+	require.NoError(t, err)
+	checks = ss.CheckHealth(ctx)
+	require.Len(t, checks, 2)
+	assert.Equal(t, model.HealthStatusFail, checks[1].Status)
+}
+
+func TestSQLiteStorage_DeleteJobs(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	job := model.NewDeleteJob("job-1", "user", []string{"AAAAAAAA"}, now)
+	require.NoError(t, ss.SaveDeleteJob(ctx, job))
+	jobs, err := ss.FindPendingDeleteJobs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []model.DeleteJob{job}, jobs)
+
+	job.Status = model.DeleteJobDone
+	job.Attempts = 1
+	job.Results = []model.DeleteResult{model.NewDeleteResult("AAAAAAAA", model.DeleteOutcomeDeleted)}
+	job.UpdatedAt = now.Add(time.Second)
+	require.NoError(t, ss.SaveDeleteJob(ctx, job))
+
+	found, err := ss.FindDeleteJob(ctx, "user", "job-1")
+	require.NoError(t, err)
+	assert.Equal(t, job, found)
+	_, err = ss.FindDeleteJob(ctx, "other", "job-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	jobs, err = ss.FindPendingDeleteJobs(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestSQLiteStorage_APIKeys(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	readOnly := model.NewAPIKey("key-1", "user", "ci", "shk_aaaaaa", "hash-1",
+		[]string{model.ScopeRead}, now)
+	full := model.NewAPIKey("key-2", "user", "", "shk_bbbbbb", "hash-2", nil, now.Add(time.Second))
+	require.NoError(t, ss.SaveAPIKey(ctx, full))
+	require.NoError(t, ss.SaveAPIKey(ctx, readOnly))
+
+	found, err := ss.FindAPIKeyByHash(ctx, "hash-1")
+	require.NoError(t, err)
+	assert.Equal(t, readOnly, found)
+	keys, err := ss.FindUserAPIKeys(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, []model.APIKey{readOnly, full}, keys)
+
+	assert.ErrorIs(t, ss.DeleteAPIKey(ctx, "other", "key-1"), ErrNotFound)
+	require.NoError(t, ss.DeleteAPIKey(ctx, "user", "key-1"))
+	_, err = ss.FindAPIKeyByHash(ctx, "hash-1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestSQLiteStorage_Accounts(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	user := model.NewUser("account", "user@example.com", "hash", now)
+	require.NoError(t, ss.SaveUser(ctx, user))
+	assert.ErrorIs(t, ss.SaveUser(ctx, model.NewUser("other", "user@example.com", "hash", now)),
+		ErrEmailTaken)
+	found, err := ss.FindUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	assert.Equal(t, user, found)
+	_, err = ss.FindUserByEmail(ctx, "unknown@example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	id, err := ss.SaveURL(ctx, "anon", "http://localhost:30000/", "http://localhost:30000/", time.Time{})
+	require.NoError(t, err)
+	require.NoError(t, ss.SaveAPIKey(ctx, model.APIKey{ID: "key", UserID: "anon", Hash: "hash", CreatedAt: now}))
+	require.NoError(t, ss.SaveDeleteJob(ctx, model.DeleteJob{ID: "job", UserID: "anon",
+		Status: model.DeleteJobPending, CreatedAt: now, UpdatedAt: now}))
+	n, err := ss.ReassignUser(ctx, "anon", user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Reassigned{URLs: 1, APIKeys: 1, DeleteJobs: 1}, n)
+	pairs, err := ss.FindUserURLs(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []model.URLPair{model.NewURLPair(id, "http://localhost:30000/")}, pairs)
+	keys, err := ss.FindUserAPIKeys(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+	_, err = ss.FindDeleteJob(ctx, user.ID, "job")
+	assert.NoError(t, err)
+}
+
+func TestSQLiteStorage_RevokedTokens(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	revoked, err := ss.RevokeToken(ctx, "active", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, err = ss.RevokeToken(ctx, "active", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, revoked)
+	_, err = ss.RevokeToken(ctx, "expired", now.Add(time.Second))
+	require.NoError(t, err)
+
+	n, err := ss.DeleteExpiredRevokedTokens(ctx, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	isRevoked, err := ss.IsTokenRevoked(ctx, "active")
+	require.NoError(t, err)
+	assert.True(t, isRevoked)
+	isRevoked, err = ss.IsTokenRevoked(ctx, "expired")
+	require.NoError(t, err)
+	assert.False(t, isRevoked)
+}
+
+func TestSQLiteStorage_RateLimit(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	tat, allowed, err := ss.TakeRateLimit(ctx, "user", now, time.Second, 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, now.Add(time.Second).UnixNano(), tat.UnixNano())
+	_, allowed, err = ss.TakeRateLimit(ctx, "user", now, time.Second, 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	tat, allowed, err = ss.TakeRateLimit(ctx, "user", now, time.Second, 2*time.Second)
+	require.NoError(t, err)
+	assert.False(t, allowed, "burst is exhausted")
+	assert.Equal(t, now.Add(2*time.Second).UnixNano(), tat.UnixNano(), "denied request doesn't advance bucket")
+	_, allowed, err = ss.TakeRateLimit(ctx, "user", now.Add(time.Second), time.Second, 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, allowed, "token is refilled")
+
+	n, err := ss.DeleteExpiredRateLimits(ctx, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestSQLiteStorage_CountUserURLs(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	ctx := context.Background()
+	userID := generator.UUIDString()
+	now := time.Now()
+
+	deleted, err := ss.SaveURL(ctx, userID, "http://localhost:30000/", "http://localhost:30000/", time.Time{})
+	require.NoError(t, err)
+	_, err = ss.SaveURL(ctx, userID, "http://localhost:30001/", "http://localhost:30001/", now.Add(time.Second))
+	require.NoError(t, err)
+	_, err = ss.SaveURLBatch(ctx, userID, []model.BatchReqEntry{
+		model.NewBatchReqEntry("1", "http://localhost:30002/"),
+		model.NewBatchReqEntry("2", "http://localhost:30003/"),
+	})
+	require.NoError(t, err)
+	_, err = ss.SaveURL(ctx, generator.UUIDString(), "http://localhost:30004/", "http://localhost:30004/", time.Time{})
+	require.NoError(t, err)
+	_, err = ss.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(userID, []string{deleted}))
+	require.NoError(t, err)
+
+	count, err := ss.CountUserURLs(ctx, userID, now.Add(time.Minute), now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, model.URLCount{Active: 2, Created: 4}, count,
+		"deleted and expired URLs are not active but count as created")
+	count, err = ss.CountUserURLs(ctx, userID, now, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, model.URLCount{Active: 3, Created: 0}, count)
+}
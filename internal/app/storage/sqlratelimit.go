@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// rateLimitQueries dialect specific queries that are shared by SQL storages.
+// Theoretical arrival time is kept in unix nanoseconds, so queries do plain integer arithmetic.
+type rateLimitQueries struct {
+	// take advances bucket $1 at now $2 by interval $3 unless it gets ahead of now by more than $4,
+	// returns new theoretical arrival time if bucket is advanced.
+	take string
+	// find selects theoretical arrival time of bucket $1.
+	find string
+	// deleteExpired deletes buckets that are full at $1.
+	deleteExpired string
+}
+
+func takeRateLimit(ctx context.Context, db *sql.DB, q rateLimitQueries, key string, now time.Time,
+	interval time.Duration, tolerance time.Duration) (time.Time, bool, error) {
+	var tat int64
+	err := db.QueryRowContext(ctx, q.take, key, now.UnixNano(), int64(interval),
+		int64(tolerance)).Scan(&tat)
+	if err == nil {
+		return time.Unix(0, tat), true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, fmt.Errorf("take rate limit. %w", err)
+	}
+	if err = db.QueryRowContext(ctx, q.find, key).Scan(&tat); err != nil {
+		return time.Time{}, false, fmt.Errorf("find rate limit. %w", err)
+	}
+	return time.Unix(0, tat), false, nil
+}
+
+func deleteExpiredRateLimits(ctx context.Context, db *sql.DB, q rateLimitQueries,
+	now time.Time) (int64, error) {
+	res, err := db.ExecContext(ctx, q.deleteExpired, now.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("exec context. %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected. %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// revokedTokenQueries dialect specific queries that are shared by SQL storages.
+type revokedTokenQueries struct {
+	// save inserts JWT ID $1 expiring at $2, does nothing if it's already revoked.
+	save string
+	// find selects 1 if JWT ID $1 is revoked.
+	find string
+	// deleteExpired deletes tokens expired before $1.
+	deleteExpired string
+	// timeArg converts time to query argument.
+	timeArg func(t time.Time) any
+}
+
+func revokeToken(ctx context.Context, db *sql.DB, q revokedTokenQueries, id string,
+	expiresAt time.Time) (bool, error) {
+	res, err := db.ExecContext(ctx, q.save, id, q.timeArg(expiresAt))
+	if err != nil {
+		return false, fmt.Errorf("exec context. %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected. %w", err)
+	}
+	return n > 0, nil
+}
+
+func isTokenRevoked(ctx context.Context, db *sql.DB, q revokedTokenQueries, id string) (bool, error) {
+	var one int
+	err := db.QueryRowContext(ctx, q.find, id).Scan(&one)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("scan revoked token. %w", err)
+	}
+	return true, nil
+}
+
+func deleteExpiredRevokedTokens(ctx context.Context, db *sql.DB, q revokedTokenQueries,
+	now time.Time) (int64, error) {
+	res, err := db.ExecContext(ctx, q.deleteExpired, q.timeArg(now))
+	if err != nil {
+		return 0, fmt.Errorf("exec context. %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected. %w", err)
+	}
+	return n, nil
+}
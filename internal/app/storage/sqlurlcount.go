@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+)
+
+// urlCountQueries dialect specific queries that are shared by SQL storages.
+type urlCountQueries struct {
+	// count selects amount of URLs of user $1 that are active at $2 and created since $3.
+	count string
+	// lock locks saving URLs of user $1 until the end of transaction,
+	// empty if transactions of the dialect are exclusive anyway.
+	lock string
+	// timeArg converts time to query argument.
+	timeArg func(t time.Time) any
+}
+
+func countUserURLs(ctx context.Context, q queryRower, qs urlCountQueries, userID string,
+	now time.Time, since time.Time) (model.URLCount, error) {
+	var count model.URLCount
+	err := q.QueryRowContext(ctx, qs.count, userID, qs.timeArg(now), qs.timeArg(since)).
+		Scan(&count.Active, &count.Created)
+	if err != nil {
+		return count, fmt.Errorf("scan URL count. %w", err)
+	}
+	return count, nil
+}
+
+// lockUserURLs locks saving URLs of user in tx if ctx has limit of user's URLs.
+func lockUserURLs(ctx context.Context, tx *sql.Tx, qs urlCountQueries, userID string) error {
+	if _, ok := urlLimit(ctx); !ok || qs.lock == "" {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, qs.lock, userID); err != nil {
+		return fmt.Errorf("lock user URLs. %w", err)
+	}
+	return nil
+}
+
+// checkSavedURLLimit returns [*LimitError] if n URLs just saved in tx exceed limit from ctx,
+// so tx must be rolled back. URLs of user must be locked by [lockUserURLs] before they are saved.
+func checkSavedURLLimit(ctx context.Context, tx *sql.Tx, qs urlCountQueries, userID string, n int) error {
+	limit, ok := urlLimit(ctx)
+	if !ok || n == 0 {
+		return nil
+	}
+	count, err := countUserURLs(ctx, tx, qs, userID, time.Now(), limit.Since)
+	if err != nil {
+		return err
+	}
+	count.Active -= n
+	count.Created -= n
+	return checkURLLimit(limit, count, n)
+}
+
+// saveLimited runs save that saves single URL of user. If ctx has limit of user's URLs,
+// save runs in transaction that is rolled back when the limit is exceeded.
+func saveLimited(ctx context.Context, db *sql.DB, qs urlCountQueries, userID string,
+	save func(q queryRower) (string, error)) (string, error) {
+	if _, ok := urlLimit(ctx); !ok {
+		return save(db)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("begin tx. %w", err)
+	}
+	defer tx.Rollback()
+	if err = lockUserURLs(ctx, tx, qs, userID); err != nil {
+		return "", err
+	}
+	res, err := save(tx)
+	if err != nil {
+		return res, err
+	}
+	if err = checkSavedURLLimit(ctx, tx, qs, userID, 1); err != nil {
+		return "", err
+	}
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("tx commit. %w", err)
+	}
+	return res, nil
+}
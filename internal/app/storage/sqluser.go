@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+)
+
+// userQueries dialect specific queries that are shared by SQL storages.
+type userQueries struct {
+	// save inserts user, does nothing if email $2 is taken, arguments are listed in saveUser.
+	save string
+	// findByEmail selects user by email $1.
+	findByEmail string
+	// reassignURLs moves URLs of user $1 to user $2.
+	reassignURLs string
+	// reassignKeys moves API keys of user $1 to user $2.
+	reassignKeys string
+	// reassignJobs moves delete jobs of user $1 to user $2.
+	reassignJobs string
+	// timeArg converts time to query argument.
+	timeArg func(t time.Time) any
+	// timeDst returns scan destination that stores column value to t.
+	timeDst func(t *time.Time) any
+}
+
+func saveUser(ctx context.Context, db *sql.DB, q userQueries, user model.User) error {
+	res, err := db.ExecContext(ctx, q.save, user.ID, user.Email, user.PasswordHash,
+		q.timeArg(user.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("exec context. %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected. %w", err)
+	}
+	if n == 0 {
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+func findUserByEmail(ctx context.Context, db *sql.DB, q userQueries, email string) (model.User, error) {
+	var user model.User
+	err := db.QueryRowContext(ctx, q.findByEmail, email).Scan(&user.ID, &user.Email,
+		&user.PasswordHash, q.timeDst(&user.CreatedAt))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user, fmt.Errorf("FindUserByEmail. %w", ErrNotFound)
+		}
+		return user, fmt.Errorf("scan user. %w", err)
+	}
+	return user, nil
+}
+
+func reassignUser(ctx context.Context, db *sql.DB, q userQueries, from string,
+	to string) (model.Reassigned, error) {
+	var res model.Reassigned
+	if from == to {
+		return res, nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return res, fmt.Errorf("begin tx. %w", err)
+	}
+	defer tx.Rollback()
+	for _, r := range []struct {
+		query string
+		n     *int64
+	}{{q.reassignURLs, &res.URLs}, {q.reassignKeys, &res.APIKeys}, {q.reassignJobs, &res.DeleteJobs}} {
+		result, err := tx.ExecContext(ctx, r.query, from, to)
+		if err != nil {
+			return model.Reassigned{}, fmt.Errorf("exec context. %w", err)
+		}
+		if *r.n, err = result.RowsAffected(); err != nil {
+			return model.Reassigned{}, fmt.Errorf("rows affected. %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return model.Reassigned{}, fmt.Errorf("tx commit. %w", err)
+	}
+	return res, nil
+}
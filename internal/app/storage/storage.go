@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/denis-oreshkevich/shortener/internal/app/model"
 )
@@ -10,21 +11,191 @@ import (
 // ErrPingNotDB error happens when you try to Ping not DB storage.
 var ErrPingNotDB = errors.New("ping not a db storage")
 
+// ErrNotFound error happens when short URL doesn't exist.
+var ErrNotFound = errors.New("short URL not found")
+
 // ErrResultIsDeleted error happens when you try to get deleted URL.
 var ErrResultIsDeleted = errors.New("result is deleted")
 
+// ErrResultIsExpired error happens when you try to get expired URL.
+var ErrResultIsExpired = errors.New("result is expired")
+
+// ErrIDConflict error happens when short ID is already taken by another URL.
+var ErrIDConflict = errors.New("short ID is already taken")
+
+// ErrIDGeneration error happens when unique short ID can't be generated.
+var ErrIDGeneration = errors.New("can't generate unique short ID")
+
+// ErrEmailTaken error happens when email is already registered by another user.
+var ErrEmailTaken = errors.New("email is already registered")
+
+// ErrCompactNotSupported error happens when storage can't be compacted.
+var ErrCompactNotSupported = errors.New("compact is not supported by storage")
+
+// ErrRateLimitNotSupported error happens when storage can't keep rate limit buckets.
+var ErrRateLimitNotSupported = errors.New("rate limit is not supported by storage")
+
+// maxGenerateAttempts limits retries on short ID collision.
+const maxGenerateAttempts = 10
+
 // Storage interface for all methods to make communication with repository.
 type Storage interface {
-	SaveURL(ctx context.Context, userID string, url string) (string, error)
+	// SaveURL saves url with its canonical form and returns short ID.
+	// URLs are deduplicated by canonical form: if URL with the same canonical form is already saved,
+	// its short ID and [ErrDBConflict] are returned. Deleted and expired URLs are not deduplicated.
+	// If ctx has [model.URLLimitKey], URL that is not deduplicated is saved only within the limit,
+	// [*LimitError] is returned otherwise. Limit is checked atomically with the save.
+	SaveURL(ctx context.Context, userID string, url string, canonical string,
+		expiresAt time.Time) (string, error)
+	// SaveURLWithID saves url under provided short ID, it is deduplicated the same way as in SaveURL.
+	// Zero createdAt means that creation time is unknown, such URL doesn't count in daily quota.
+	SaveURLWithID(ctx context.Context, userID string, id string, url string, canonical string,
+		expiresAt time.Time, createdAt time.Time) (string, error)
+
+	// SaveURLBatch saves entries of batch, entry whose canonical form is already saved
+	// gets existing short ID. Limit from ctx is checked the same way as in SaveURL.
 	SaveURLBatch(ctx context.Context, userID string,
 		batch []model.BatchReqEntry) ([]model.BatchRespEntry, error)
 	FindURL(ctx context.Context, id string) (*OrigURL, error)
 
 	FindUserURLs(ctx context.Context, userID string) ([]model.URLPair, error)
 
-	DeleteUserURLs(ctx context.Context, bde model.BatchDeleteEntry) error
+	// FindUserURLsPage returns up to limit user's URLs with short ID greater than after
+	// ordered by short ID, so all user's URLs can be read page by page.
+	FindUserURLsPage(ctx context.Context, userID string, after string, limit int) ([]model.URLPair, error)
+
+	// DeleteUserURLs marks user's URLs deleted and returns outcome of every requested short ID.
+	// Short IDs that don't exist or belong to another user are reported in results, not as error.
+	DeleteUserURLs(ctx context.Context, bde model.BatchDeleteEntry) ([]model.DeleteResult, error)
+
+	DeleteExpiredURLs(ctx context.Context, now time.Time) (int64, error)
+
+	// CountUserURLs counts user's URLs that are neither deleted nor expired at now
+	// and URLs created since since, URLs saved before creation time was tracked aren't counted.
+	CountUserURLs(ctx context.Context, userID string, now time.Time, since time.Time) (model.URLCount, error)
 
 	FindStats(ctx context.Context) (model.Stat, error)
 
+	// ExportURLs returns up to limit records with short ID greater than after
+	// ordered by short ID. Deleted and expired records are returned too.
+	ExportURLs(ctx context.Context, after string, limit int) ([]ExportRecord, error)
+	// ImportURL saves exported record under its short ID with deleted flag and expiration in one write.
+	// Live record is deduplicated the same way as in SaveURLWithID, deleted record is not deduplicated.
+	// Returns [ErrIDConflict] if short ID is already taken.
+	ImportURL(ctx context.Context, rec ExportRecord) (string, error)
+
+	SaveClicks(ctx context.Context, clicks []model.Click) error
+
+	// FindClickStats returns click statistic of user's short URL
+	// or [ErrNotFound] if user doesn't own it.
+	FindClickStats(ctx context.Context, userID string, id string, top int) (model.ClickStats, error)
+
+	// SaveDeleteJob inserts job or replaces it if job with the same ID is already saved.
+	SaveDeleteJob(ctx context.Context, job model.DeleteJob) error
+
+	// FindDeleteJob returns user's delete job or [ErrNotFound] if user doesn't own it.
+	FindDeleteJob(ctx context.Context, userID string, id string) (model.DeleteJob, error)
+
+	// FindPendingDeleteJobs returns jobs that are not finished yet ordered by creation time.
+	FindPendingDeleteJobs(ctx context.Context) ([]model.DeleteJob, error)
+
+	SaveAPIKey(ctx context.Context, key model.APIKey) error
+
+	// FindAPIKeyByHash returns API key by hash of the key or [ErrNotFound] if key is unknown or revoked.
+	FindAPIKeyByHash(ctx context.Context, hash string) (model.APIKey, error)
+
+	// FindUserAPIKeys returns user's API keys ordered by creation time.
+	FindUserAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error)
+
+	// DeleteAPIKey revokes user's API key or returns [ErrNotFound] if user doesn't own it.
+	DeleteAPIKey(ctx context.Context, userID string, id string) error
+
+	// SaveUser saves registered user or returns [ErrEmailTaken] if email is already registered.
+	SaveUser(ctx context.Context, user model.User) error
+
+	// FindUserByEmail returns registered user or [ErrNotFound].
+	FindUserByEmail(ctx context.Context, email string) (model.User, error)
+
+	// ReassignUser moves URLs, API keys and delete jobs of user from to user to in one operation
+	// and returns amounts of moved records. URLs are moved regardless of limits of user to.
+	ReassignUser(ctx context.Context, from string, to string) (model.Reassigned, error)
+
+	// RevokeToken adds JWT ID to the denylist until token expires at expiresAt.
+	// Returns false if token is already revoked.
+	RevokeToken(ctx context.Context, id string, expiresAt time.Time) (bool, error)
+
+	// IsTokenRevoked checks whether JWT ID is in the denylist.
+	IsTokenRevoked(ctx context.Context, id string) (bool, error)
+
+	// DeleteExpiredRevokedTokens removes tokens expired before now from the denylist,
+	// they are rejected by expiration anyway.
+	DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error)
+
 	Ping(ctx context.Context) error
 }
+
+// Compactor is implemented by storages that can reclaim space taken by deleted records.
+type Compactor interface {
+	Compact(ctx context.Context) error
+}
+
+// Compact compacts st if it implements [Compactor]
+// and returns [ErrCompactNotSupported] otherwise.
+func Compact(ctx context.Context, st Storage) error {
+	c, ok := st.(Compactor)
+	if !ok {
+		return ErrCompactNotSupported
+	}
+	return c.Compact(ctx)
+}
+
+// HealthChecker is implemented by storages that can report their own health.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) []model.HealthCheck
+}
+
+// CheckHealth returns health checks of st if it implements [HealthChecker].
+// Otherwise st is pinged, [ErrPingNotDB] is treated as healthy.
+func CheckHealth(ctx context.Context, st Storage) []model.HealthCheck {
+	if hc, ok := st.(HealthChecker); ok {
+		return hc.CheckHealth(ctx)
+	}
+	err := st.Ping(ctx)
+	if errors.Is(err, ErrPingNotDB) {
+		err = nil
+	}
+	return []model.HealthCheck{model.NewHealthCheck("storage", "", err)}
+}
+
+// RateLimitStore is implemented by storages that can keep rate limit buckets
+// shared by several instances. Bucket is theoretical arrival time of the next request.
+type RateLimitStore interface {
+	// TakeRateLimit advances bucket key by interval unless it gets ahead of now by more than tolerance.
+	// Returns theoretical arrival time after the call and whether request is allowed.
+	TakeRateLimit(ctx context.Context, key string, now time.Time, interval time.Duration,
+		tolerance time.Duration) (time.Time, bool, error)
+
+	// DeleteExpiredRateLimits removes buckets that are full at now.
+	DeleteExpiredRateLimits(ctx context.Context, now time.Time) (int64, error)
+}
+
+// TakeRateLimit takes token from bucket of st if it implements [RateLimitStore]
+// and returns [ErrRateLimitNotSupported] otherwise.
+func TakeRateLimit(ctx context.Context, st Storage, key string, now time.Time,
+	interval time.Duration, tolerance time.Duration) (time.Time, bool, error) {
+	rs, ok := st.(RateLimitStore)
+	if !ok {
+		return time.Time{}, false, ErrRateLimitNotSupported
+	}
+	return rs.TakeRateLimit(ctx, key, now, interval, tolerance)
+}
+
+// DeleteExpiredRateLimits removes full buckets of st if it implements [RateLimitStore]
+// and returns [ErrRateLimitNotSupported] otherwise.
+func DeleteExpiredRateLimits(ctx context.Context, st Storage, now time.Time) (int64, error) {
+	rs, ok := st.(RateLimitStore)
+	if !ok {
+		return 0, ErrRateLimitNotSupported
+	}
+	return rs.DeleteExpiredRateLimits(ctx, now)
+}
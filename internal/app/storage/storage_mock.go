@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"time"
+
 	"github.com/denis-oreshkevich/shortener/internal/app/model"
 	"github.com/stretchr/testify/mock"
 )
@@ -20,16 +22,101 @@ func (m *MockedStorage) FindURL(ctx context.Context, id string) (*OrigURL, error
 	return args.Get(0).(*OrigURL), args.Error(1)
 }
 
-func (m *MockedStorage) DeleteUserURLs(ctx context.Context, bde model.BatchDeleteEntry) error {
+func (m *MockedStorage) DeleteUserURLs(ctx context.Context,
+	bde model.BatchDeleteEntry) ([]model.DeleteResult, error) {
 	args := m.Called(ctx, bde)
+	return args.Get(0).([]model.DeleteResult), args.Error(1)
+}
+
+func (m *MockedStorage) SaveDeleteJob(ctx context.Context, job model.DeleteJob) error {
+	args := m.Called(ctx, job)
+	return args.Error(0)
+}
+
+func (m *MockedStorage) FindDeleteJob(ctx context.Context, userID string,
+	id string) (model.DeleteJob, error) {
+	args := m.Called(ctx, userID, id)
+	return args.Get(0).(model.DeleteJob), args.Error(1)
+}
+
+func (m *MockedStorage) FindPendingDeleteJobs(ctx context.Context) ([]model.DeleteJob, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.DeleteJob), args.Error(1)
+}
+
+func (m *MockedStorage) SaveAPIKey(ctx context.Context, key model.APIKey) error {
+	args := m.Called(ctx, key)
 	return args.Error(0)
 }
 
-func (m *MockedStorage) SaveURL(ctx context.Context, userID string, url string) (string, error) {
-	args := m.Called(ctx, userID, url)
+func (m *MockedStorage) FindAPIKeyByHash(ctx context.Context, hash string) (model.APIKey, error) {
+	args := m.Called(ctx, hash)
+	return args.Get(0).(model.APIKey), args.Error(1)
+}
+
+func (m *MockedStorage) FindUserAPIKeys(ctx context.Context, userID string) ([]model.APIKey, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]model.APIKey), args.Error(1)
+}
+
+func (m *MockedStorage) DeleteAPIKey(ctx context.Context, userID string, id string) error {
+	args := m.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (m *MockedStorage) SaveUser(ctx context.Context, user model.User) error {
+	args := m.Called(ctx, user)
+	return args.Error(0)
+}
+
+func (m *MockedStorage) FindUserByEmail(ctx context.Context, email string) (model.User, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(model.User), args.Error(1)
+}
+
+func (m *MockedStorage) ReassignUser(ctx context.Context, from string, to string) (model.Reassigned, error) {
+	args := m.Called(ctx, from, to)
+	return args.Get(0).(model.Reassigned), args.Error(1)
+}
+
+func (m *MockedStorage) RevokeToken(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	args := m.Called(ctx, id, expiresAt)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockedStorage) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockedStorage) DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockedStorage) SaveURL(ctx context.Context, userID string, url string, canonical string,
+	expiresAt time.Time) (string, error) {
+	args := m.Called(ctx, userID, url, canonical, expiresAt)
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockedStorage) SaveURLWithID(ctx context.Context, userID string,
+	id string, url string, canonical string, expiresAt time.Time, createdAt time.Time) (string, error) {
+	args := m.Called(ctx, userID, id, url, canonical, expiresAt, createdAt)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockedStorage) DeleteExpiredURLs(ctx context.Context, now time.Time) (int64, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockedStorage) CountUserURLs(ctx context.Context, userID string,
+	now time.Time, since time.Time) (model.URLCount, error) {
+	args := m.Called(ctx, userID, now, since)
+	return args.Get(0).(model.URLCount), args.Error(1)
+}
+
 func (m *MockedStorage) SaveURLBatch(ctx context.Context, userID string,
 	batch []model.BatchReqEntry) ([]model.BatchRespEntry, error) {
 	args := m.Called(ctx, userID, batch)
@@ -41,6 +128,34 @@ func (m *MockedStorage) FindUserURLs(ctx context.Context, userID string) ([]mode
 	return args.Get(0).([]model.URLPair), args.Error(1)
 }
 
+func (m *MockedStorage) FindUserURLsPage(ctx context.Context, userID string,
+	after string, limit int) ([]model.URLPair, error) {
+	args := m.Called(ctx, userID, after, limit)
+	return args.Get(0).([]model.URLPair), args.Error(1)
+}
+
+func (m *MockedStorage) ExportURLs(ctx context.Context, after string,
+	limit int) ([]ExportRecord, error) {
+	args := m.Called(ctx, after, limit)
+	return args.Get(0).([]ExportRecord), args.Error(1)
+}
+
+func (m *MockedStorage) ImportURL(ctx context.Context, rec ExportRecord) (string, error) {
+	args := m.Called(ctx, rec)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockedStorage) SaveClicks(ctx context.Context, clicks []model.Click) error {
+	args := m.Called(ctx, clicks)
+	return args.Error(0)
+}
+
+func (m *MockedStorage) FindClickStats(ctx context.Context, userID string,
+	id string, top int) (model.ClickStats, error) {
+	args := m.Called(ctx, userID, id, top)
+	return args.Get(0).(model.ClickStats), args.Error(1)
+}
+
 func (m *MockedStorage) Ping(ctx context.Context) error {
 	args := m.Called(ctx)
 	return args.Error(0)
@@ -3,21 +3,190 @@ package storage
 import (
 	"context"
 	"os"
+	"path"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
 	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+func TestStorage_CanonicalDedup(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "storage.json")
+	fs, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	tests := []struct {
+		name string
+		st   Storage
+	}{
+		{name: "map #1", st: NewMapStorage(generator.DefaultIDGenerator())},
+		{name: "file #2", st: fs},
+		{name: "sqlite #3", st: newTestSQLiteStorage(t)},
+	}
+	const canonical = "http://example.com/a"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			userID := generator.UUIDString()
+			id, err := tt.st.SaveURL(ctx, userID, "HTTP://Example.com:80/a", canonical, time.Time{})
+			require.NoError(t, err)
+
+			existing, err := tt.st.SaveURL(ctx, generator.UUIDString(), "http://example.com/%61", canonical, time.Time{})
+			assert.ErrorIs(t, err, ErrDBConflict)
+			assert.Equal(t, id, existing)
+			existing, err = tt.st.SaveURLWithID(ctx, userID, "alias", "http://EXAMPLE.com/a", canonical, time.Time{}, time.Now())
+			assert.ErrorIs(t, err, ErrDBConflict)
+			assert.Equal(t, id, existing)
+
+			dup := model.NewBatchReqEntry("1", "http://example.com:80/a")
+			dup.CanonicalURL = canonical
+			resp, err := tt.st.SaveURLBatch(ctx, userID, []model.BatchReqEntry{dup,
+				model.NewBatchReqEntry("2", "http://example.com/b"),
+				model.NewBatchReqEntry("3", "http://example.com/b")})
+			require.NoError(t, err)
+			require.Len(t, resp, 3)
+			assert.Equal(t, model.NewBatchRespEntry("1", id), resp[0])
+			assert.NotEqual(t, resp[0].ShortURL, resp[1].ShortURL)
+			assert.Equal(t, resp[1].ShortURL, resp[2].ShortURL, "duplicates in batch get the same ID")
+
+			orig, err := tt.st.FindURL(ctx, id)
+			require.NoError(t, err)
+			assert.Equal(t, "HTTP://Example.com:80/a", orig.OriginalURL, "original URL is kept")
+			page, err := tt.st.ExportURLs(ctx, "", 10)
+			require.NoError(t, err)
+			assert.Len(t, page, 2)
+		})
+	}
+
+	require.NoError(t, fs.Close())
+	restored, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	defer restored.Close()
+	_, err = restored.SaveURL(context.Background(), generator.UUIDString(), "http://example.com:80/a",
+		canonical, time.Time{})
+	assert.ErrorIs(t, err, ErrDBConflict, "canonical URL is restored from file")
+}
+
+func TestStorage_CanonicalDedupDeadURLs(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "storage.json")
+	fs, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	tests := []struct {
+		name string
+		st   Storage
+	}{
+		{name: "map #1", st: NewMapStorage(generator.DefaultIDGenerator())},
+		{name: "file #2", st: fs},
+		{name: "sqlite #3", st: newTestSQLiteStorage(t)},
+	}
+	const deleted = "http://example.com/deleted"
+	const expired = "http://example.com/expired"
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			userID := generator.UUIDString()
+			id, err := tt.st.SaveURL(ctx, userID, deleted, deleted, time.Time{})
+			require.NoError(t, err)
+			_, err = tt.st.DeleteUserURLs(ctx, model.NewBatchDeleteEntry(userID, []string{id}))
+			require.NoError(t, err)
+
+			saved, err := tt.st.SaveURL(ctx, userID, deleted, deleted, time.Time{})
+			require.NoError(t, err, "deleted URL is not deduplicated")
+			assert.NotEqual(t, id, saved)
+			existing, err := tt.st.SaveURL(ctx, userID, deleted, deleted, time.Time{})
+			assert.ErrorIs(t, err, ErrDBConflict)
+			assert.Equal(t, saved, existing, "new URL is deduplicated")
+
+			_, err = tt.st.SaveURLWithID(ctx, userID, "expired", expired, expired,
+				time.Now().Add(-time.Hour), time.Now())
+			require.NoError(t, err)
+			dup := model.NewBatchReqEntry("1", expired)
+			dup.CanonicalURL = expired
+			resp, err := tt.st.SaveURLBatch(ctx, userID, []model.BatchReqEntry{dup})
+			require.NoError(t, err, "expired URL is not deduplicated")
+			require.Len(t, resp, 1)
+			newID := path.Base(resp[0].ShortURL)
+			assert.NotEqual(t, "expired", newID)
+			orig, err := tt.st.FindURL(ctx, newID)
+			require.NoError(t, err)
+			assert.Equal(t, expired, orig.OriginalURL)
+			_, err = tt.st.FindURL(ctx, "expired")
+			assert.Error(t, err, "expired URL stays dead")
+		})
+	}
+
+	require.NoError(t, fs.Compact(context.Background()))
+	require.NoError(t, fs.Close())
+	restored, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	defer restored.Close()
+	for _, canonical := range []string{deleted, expired} {
+		_, err = restored.SaveURL(context.Background(), generator.UUIDString(), canonical, canonical, time.Time{})
+		assert.ErrorIs(t, err, ErrDBConflict, "live URL is restored from compacted file")
+	}
+}
+
+func TestStorage_ImportURL(t *testing.T) {
+	fs, err := NewFileStorage(filepath.Join(t.TempDir(), "storage.json"), generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	defer fs.Close()
+	tests := []struct {
+		name string
+		st   Storage
+	}{
+		{name: "map #1", st: NewMapStorage(generator.DefaultIDGenerator())},
+		{name: "file #2", st: fs},
+		{name: "sqlite #3", st: newTestSQLiteStorage(t)},
+	}
+	const u = "http://example.com/imported"
+	createdAt := time.UnixMilli(1700000000000)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			userID := generator.UUIDString()
+			live := ExportRecord{ShortURL: "live", OriginalURL: u, CanonicalURL: u, UserID: userID,
+				CreatedAt: createdAt}
+			id, err := tt.st.ImportURL(ctx, live)
+			require.NoError(t, err)
+			assert.Equal(t, "live", id)
+
+			dead := live
+			dead.ShortURL, dead.DeletedFlag = "dead", true
+			_, err = tt.st.ImportURL(ctx, dead)
+			require.NoError(t, err, "deleted record is not deduplicated")
+			_, err = tt.st.FindURL(ctx, "dead")
+			assert.ErrorIs(t, err, ErrResultIsDeleted)
+
+			dup := live
+			dup.ShortURL = "dup"
+			existing, err := tt.st.ImportURL(ctx, dup)
+			assert.ErrorIs(t, err, ErrDBConflict)
+			assert.Equal(t, "live", existing)
+			_, err = tt.st.ImportURL(ctx, dead)
+			assert.ErrorIs(t, err, ErrIDConflict)
+
+			page, err := tt.st.ExportURLs(ctx, "", 10)
+			require.NoError(t, err)
+			require.Len(t, page, 2)
+			assert.Equal(t, dead.ShortURL, page[0].ShortURL)
+			assert.True(t, page[0].DeletedFlag)
+			assert.True(t, createdAt.Equal(page[0].CreatedAt))
+		})
+	}
+}
+
 func BenchmarkStorageSave(b *testing.B) {
 	fn := "./test"
-	fs, err := NewFileStorage(fn)
+	fs, err := NewFileStorage(fn, generator.DefaultIDGenerator(), 0)
 	require.NoError(b, err)
 	defer func() {
 		err := os.Remove(fn)
 		require.NoError(b, err)
 	}()
-	ms := NewMapStorage()
+	ms := NewMapStorage(generator.DefaultIDGenerator())
 
 	ctx := context.Background()
 	userID := generator.UUIDString()
@@ -26,13 +195,65 @@ func BenchmarkStorageSave(b *testing.B) {
 	b.ResetTimer()
 	b.Run("fileStorage", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			fs.SaveURL(ctx, userID, baseURL+generator.UUIDString())
+			url := baseURL + generator.UUIDString()
+			fs.SaveURL(ctx, userID, url, url, time.Time{})
 		}
 	})
 
 	b.Run("mapStorage", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			ms.SaveURL(ctx, userID, baseURL+generator.UUIDString())
+			url := baseURL + generator.UUIDString()
+			ms.SaveURL(ctx, userID, url, url, time.Time{})
 		}
 	})
 }
+
+func TestStorage_URLLimit(t *testing.T) {
+	fs, err := NewFileStorage(filepath.Join(t.TempDir(), "storage.json"), generator.DefaultIDGenerator(), 0)
+	require.NoError(t, err)
+	defer fs.Close()
+	tests := []struct {
+		name string
+		st   Storage
+	}{
+		{name: "map #1", st: NewMapStorage(generator.DefaultIDGenerator())},
+		{name: "file #2", st: fs},
+		{name: "sqlite #3", st: newTestSQLiteStorage(t)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := generator.UUIDString()
+			ctx := context.WithValue(context.Background(), model.URLLimitKey{},
+				model.URLLimit{MaxActive: 2, Since: time.Now().Add(-time.Hour)})
+			id, err := tt.st.SaveURL(ctx, userID, "http://limit.test/a", "http://limit.test/a", time.Time{})
+			require.NoError(t, err)
+
+			batch := []model.BatchReqEntry{
+				model.NewBatchReqEntry("1", "http://limit.test/a"),
+				model.NewBatchReqEntry("2", "http://limit.test/b"),
+				model.NewBatchReqEntry("3", "http://limit.test/c"),
+			}
+			_, err = tt.st.SaveURLBatch(ctx, userID, batch)
+			var le *LimitError
+			require.ErrorAs(t, err, &le)
+			assert.Equal(t, LimitError{Limit: 2, Used: 1, Requested: 2}, *le, "deduplicated entry is not counted")
+
+			resp, err := tt.st.SaveURLBatch(ctx, userID, batch[:2])
+			require.NoError(t, err)
+			assert.Equal(t, id, path.Base(resp[0].ShortURL))
+
+			existing, err := tt.st.SaveURL(ctx, userID, "http://limit.test/b", "http://limit.test/b", time.Time{})
+			assert.ErrorIs(t, err, ErrDBConflict, "saved URL is reported as conflict at the limit")
+			assert.Equal(t, path.Base(resp[1].ShortURL), existing)
+			_, err = tt.st.SaveURLWithID(ctx, userID, "limit-c", "http://limit.test/c", "http://limit.test/c",
+				time.Time{}, time.Now())
+			require.ErrorAs(t, err, &le)
+			_, err = tt.st.FindURL(ctx, "limit-c")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			count, err := tt.st.CountUserURLs(ctx, userID, time.Now(), time.Now().Add(-time.Hour))
+			require.NoError(t, err)
+			assert.Equal(t, 2, count.Active)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/model"
+)
+
+// LimitError error happens when saving URLs would exceed [model.URLLimit] of user.
+type LimitError struct {
+	// Daily is true if limit of created URLs is exceeded and false if limit of active URLs.
+	Daily     bool
+	Limit     int
+	Used      int
+	Requested int
+}
+
+// Error returns description of exceeded limit.
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("URLs limit exceeded: %d of %d used, %d requested", e.Used, e.Limit, e.Requested)
+}
+
+// urlLimit returns limit of user's URLs from ctx, see [model.URLLimitKey].
+func urlLimit(ctx context.Context) (model.URLLimit, bool) {
+	limit, ok := ctx.Value(model.URLLimitKey{}).(model.URLLimit)
+	return limit, ok
+}
+
+// checkURLLimit returns [*LimitError] if user who has count URLs can't save n more.
+func checkURLLimit(limit model.URLLimit, count model.URLCount, n int) error {
+	if limit.MaxActive > 0 && count.Active+n > limit.MaxActive {
+		return &LimitError{Limit: limit.MaxActive, Used: count.Active, Requested: n}
+	}
+	if limit.MaxPerDay > 0 && count.Created+n > limit.MaxPerDay {
+		return &LimitError{Daily: true, Limit: limit.MaxPerDay, Used: count.Created, Requested: n}
+	}
+	return nil
+}
+
+// checkURLLimitNotSync returns [*LimitError] if user can't save n more URLs within limit from ctx.
+func (ms *MapStorage) checkURLLimitNotSync(ctx context.Context, userID string, n int, now time.Time) error {
+	limit, ok := urlLimit(ctx)
+	if !ok || n == 0 {
+		return nil
+	}
+	return checkURLLimit(limit, ms.countUserURLsNotSync(userID, now, limit.Since), n)
+}
+
+// newURLsNotSync counts URLs of batch that are not deduplicated, so they would be saved.
+func (ms *MapStorage) newURLsNotSync(batch []model.BatchReqEntry, now time.Time) int {
+	canonical := make(map[string]struct{}, len(batch))
+	for _, b := range batch {
+		if _, ok := ms.liveCanonicalNotSync(b.CanonicalURL, now); !ok {
+			canonical[b.CanonicalURL] = struct{}{}
+		}
+	}
+	return len(canonical)
+}
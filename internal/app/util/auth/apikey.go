@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// APIKeyPrefix prefix of every API key, it tells API key from JWT.
+const APIKeyPrefix = "shk_"
+
+// apiKeyDisplayLen length of the key beginning that is stored to recognize the key in list.
+const apiKeyDisplayLen = len(APIKeyPrefix) + 6
+
+// NewAPIKey generates new random API key and returns it with its display prefix.
+func NewAPIKey() (key string, prefix string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("rand.Read: %w", err)
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:apiKeyDisplayLen], nil
+}
+
+// IsAPIKey reports whether token looks like API key.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// HashAPIKey returns hash of API key that is stored instead of the key.
+// Keys have 256 bits of entropy, so fast hash is enough and allows lookup by hash.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/denis-oreshkevich/shortener/internal/app/util/generator"
@@ -9,25 +11,158 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 )
 
-// Constants for JWT generation.
+// TokenExp lifetime of JWT issued by [GenerateToken] to clients that can't refresh it.
+const TokenExp = time.Hour * 5
+
+// Default lifetimes of session tokens, see [SetTokenTTL].
 const (
-	SecretKey = "MegaSecretKey"
-	TokenExp  = time.Hour * 5
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
 )
 
-// GenerateToken generates new JWT.
+// useRefresh value of use claim of refresh token.
+const useRefresh = "refresh"
+
+// ErrInvalidToken indicates that JWT is not valid.
+var ErrInvalidToken = errors.New("token is not valid")
+
+// Claims claims of JWT. Account is set if subject is registered user, not anonymous one.
+// Use is set to "refresh" in refresh token, it can't be used to access API.
+type Claims struct {
+	jwt.RegisteredClaims
+	Account bool   `json:"acc,omitempty"`
+	Use     string `json:"use,omitempty"`
+}
+
+// Session pair of short-lived access token and long-lived refresh token of the same user.
+type Session struct {
+	Access        string
+	Refresh       string
+	AccessClaims  *Claims
+	RefreshClaims *Claims
+}
+
+var (
+	ttlMx      sync.RWMutex
+	accessTTL  = DefaultAccessTokenTTL
+	refreshTTL = DefaultRefreshTokenTTL
+)
+
+// SetTokenTTL sets lifetimes of access and refresh tokens issued by [NewSession].
+func SetTokenTTL(access time.Duration, refresh time.Duration) {
+	ttlMx.Lock()
+	defer ttlMx.Unlock()
+	accessTTL = access
+	refreshTTL = refresh
+}
+
+// AccessTokenTTL returns lifetime of access token.
+func AccessTokenTTL() time.Duration {
+	ttlMx.RLock()
+	defer ttlMx.RUnlock()
+	return accessTTL
+}
+
+// RefreshTokenTTL returns lifetime of refresh token.
+func RefreshTokenTTL() time.Duration {
+	ttlMx.RLock()
+	defer ttlMx.RUnlock()
+	return refreshTTL
+}
+
+// GenerateToken generates new JWT of anonymous user with [TokenExp] lifetime
+// signed by the active key of [Keys].
 func GenerateToken() (string, error) {
 	id := generator.UUIDString()
 	logger.Log.Debug(fmt.Sprintf("creating new token for sub = %s", id))
-	claims := jwt.RegisteredClaims{
-		Subject:   id,
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenExp)),
+	token, _, err := generateToken(id, false, "", TokenExp)
+	return token, err
+}
+
+// NewAnonymousSession issues session of new anonymous user.
+func NewAnonymousSession() (Session, error) {
+	return NewSession(generator.UUIDString(), false)
+}
+
+// NewSession issues access and refresh tokens of user sub.
+func NewSession(sub string, account bool) (Session, error) {
+	logger.Log.Debug(fmt.Sprintf("creating new session for sub = %s", sub))
+	access, accessClaims, err := generateToken(sub, account, "", AccessTokenTTL())
+	if err != nil {
+		return Session{}, err
+	}
+	refresh, refreshClaims, err := generateToken(sub, account, useRefresh, RefreshTokenTTL())
+	if err != nil {
+		return Session{}, err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return Session{
+		Access:        access,
+		Refresh:       refresh,
+		AccessClaims:  accessClaims,
+		RefreshClaims: refreshClaims,
+	}, nil
+}
+
+func generateToken(sub string, account bool, use string, ttl time.Duration) (string, *Claims, error) {
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        generator.UUIDString(),
+			Subject:   sub,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
+		Account: account,
+		Use:     use,
+	}
+	token, err := Keys().Sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
 
-	tokenString, err := token.SignedString([]byte(SecretKey))
+// ParseToken validates JWT by [Keys] and returns user ID from its subject.
+func ParseToken(tokenString string) (string, error) {
+	claims, err := ParseClaims(tokenString)
 	if err != nil {
-		return "", fmt.Errorf("signedString. %w", err)
+		return "", err
+	}
+	return claims.Subject, nil
+}
+
+// ParseClaims validates access JWT by [Keys] and returns its claims.
+// Refresh token is rejected with [ErrInvalidToken].
+func ParseClaims(tokenString string) (*Claims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Use != "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// ParseRefreshClaims validates refresh JWT by [Keys] and returns its claims.
+// Access token is rejected with [ErrInvalidToken].
+func ParseRefreshClaims(tokenString string) (*Claims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Use != useRefresh || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func parseClaims(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, Keys().Keyfunc)
+	if err != nil {
+		return nil, fmt.Errorf("parsing jwt with claims. %w", err)
+	}
+	if !token.Valid {
+		return nil, ErrInvalidToken
 	}
-	return tokenString, nil
+	return claims, nil
 }
@@ -0,0 +1,314 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Supported signing algorithms.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// DefaultKeyID kid of the key created from single HMAC secret.
+const DefaultKeyID = "default"
+
+// ErrUnknownKey indicates that token is signed by key that is not in key set.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key single signing key. Key without private part only verifies tokens.
+type Key struct {
+	ID        string
+	Alg       string
+	signKey   any
+	verifyKey any
+}
+
+// CanSign reports whether key has private part.
+func (k Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+func (k Key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Alg)
+}
+
+// KeySet keys to sign and verify JWT. Only the active key signs,
+// all keys verify, so tokens signed by retired keys stay valid until they expire.
+type KeySet struct {
+	active string
+	keys   map[string]Key
+}
+
+// NewKeySet creates key set, active key must be present and able to sign.
+func NewKeySet(active string, keys ...Key) (*KeySet, error) {
+	ks := &KeySet{active: active, keys: make(map[string]Key, len(keys))}
+	for _, k := range keys {
+		if k.ID == "" {
+			return nil, errors.New("key without kid")
+		}
+		if _, ok := ks.keys[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate kid %s", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+	k, ok := ks.keys[active]
+	if !ok {
+		return nil, fmt.Errorf("active key %s: %w", active, ErrUnknownKey)
+	}
+	if !k.CanSign() {
+		return nil, fmt.Errorf("active key %s has no private key", active)
+	}
+	return ks, nil
+}
+
+// NewHMACKey creates HS256 key from secret.
+func NewHMACKey(id string, secret []byte) (Key, error) {
+	if len(secret) < 32 {
+		return Key{}, fmt.Errorf("key %s: HMAC secret must be at least 32 bytes", id)
+	}
+	return Key{ID: id, Alg: AlgHS256, signKey: secret, verifyKey: secret}, nil
+}
+
+// NewRSAKey creates RS256 key, priv may be nil for verify only key.
+func NewRSAKey(id string, priv *rsa.PrivateKey, pub *rsa.PublicKey) Key {
+	k := Key{ID: id, Alg: AlgRS256, verifyKey: pub}
+	if priv != nil {
+		k.signKey = priv
+		k.verifyKey = &priv.PublicKey
+	}
+	return k
+}
+
+// NewEdDSAKey creates EdDSA key, priv may be nil for verify only key.
+func NewEdDSAKey(id string, priv ed25519.PrivateKey, pub ed25519.PublicKey) Key {
+	k := Key{ID: id, Alg: AlgEdDSA, verifyKey: pub}
+	if priv != nil {
+		k.signKey = priv
+		k.verifyKey = priv.Public()
+	}
+	return k
+}
+
+// Sign signs claims by the active key and sets its kid header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	k := ks.keys[ks.active]
+	token := jwt.NewWithClaims(k.method(), claims)
+	token.Header["kid"] = k.ID
+	s, err := token.SignedString(k.signKey)
+	if err != nil {
+		return "", fmt.Errorf("signedString. %w", err)
+	}
+	return s, nil
+}
+
+// Keyfunc returns verification key by kid header, tokens without kid are verified by the active key.
+// Algorithm of token must match algorithm of the key.
+func (ks *KeySet) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		kid = ks.active
+	}
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("kid %s: %w", kid, ErrUnknownKey)
+	}
+	if t.Method.Alg() != k.Alg {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+	return k.verifyKey, nil
+}
+
+// JWK public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns public keys of asymmetric keys, HMAC keys are never published.
+func (ks *KeySet) JWKS() JWKS {
+	res := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	enc := base64.RawURLEncoding
+	for _, k := range ks.keys {
+		switch pub := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			res.Keys = append(res.Keys, JWK{Kty: "RSA", Kid: k.ID, Alg: k.Alg, Use: "sig",
+				N: enc.EncodeToString(pub.N.Bytes()),
+				E: enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes())})
+		case ed25519.PublicKey:
+			res.Keys = append(res.Keys, JWK{Kty: "OKP", Kid: k.ID, Alg: k.Alg, Use: "sig",
+				Crv: "Ed25519", X: enc.EncodeToString(pub)})
+		}
+	}
+	sort.Slice(res.Keys, func(i, j int) bool {
+		return res.Keys[i].Kid < res.Keys[j].Kid
+	})
+	return res
+}
+
+// keyFile model of the keys file.
+type keyFile struct {
+	Active string         `json:"active"`
+	Keys   []keyFileEntry `json:"keys"`
+}
+
+// keyFileEntry key in keys file. HMAC key has secret, asymmetric key has path
+// to PEM private key or to PEM public key if it only verifies tokens.
+type keyFileEntry struct {
+	Kid            string `json:"kid"`
+	Alg            string `json:"alg"`
+	Secret         string `json:"secret,omitempty"`
+	PrivateKeyFile string `json:"private_key_file,omitempty"`
+	PublicKeyFile  string `json:"public_key_file,omitempty"`
+}
+
+// LoadKeySet loads key set from keys file if it's set, otherwise creates single HMAC key from secret.
+// If neither is configured random HMAC key is generated, tokens don't survive restart then.
+func LoadKeySet(keysFile string, secret string) (*KeySet, error) {
+	if keysFile != "" {
+		return loadKeyFile(keysFile)
+	}
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("rand.Read: %w", err)
+		}
+		secret = string(b)
+	}
+	k, err := NewHMACKey(DefaultKeyID, []byte(secret))
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySet(DefaultKeyID, k)
+}
+
+func loadKeyFile(name string) (*KeySet, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+	var kf keyFile
+	if err = json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	keys := make([]Key, 0, len(kf.Keys))
+	for _, e := range kf.Keys {
+		k, err := e.key()
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", e.Kid, err)
+		}
+		keys = append(keys, k)
+	}
+	return NewKeySet(kf.Active, keys...)
+}
+
+func (e keyFileEntry) key() (Key, error) {
+	switch e.Alg {
+	case AlgHS256:
+		return NewHMACKey(e.Kid, []byte(e.Secret))
+	case AlgRS256:
+		if e.PrivateKeyFile != "" {
+			priv, err := readPEM(e.PrivateKeyFile, jwt.ParseRSAPrivateKeyFromPEM)
+			if err != nil {
+				return Key{}, err
+			}
+			return NewRSAKey(e.Kid, priv, nil), nil
+		}
+		pub, err := readPEM(e.PublicKeyFile, jwt.ParseRSAPublicKeyFromPEM)
+		if err != nil {
+			return Key{}, err
+		}
+		return NewRSAKey(e.Kid, nil, pub), nil
+	case AlgEdDSA:
+		if e.PrivateKeyFile != "" {
+			priv, err := readPEM(e.PrivateKeyFile, jwt.ParseEdPrivateKeyFromPEM)
+			if err != nil {
+				return Key{}, err
+			}
+			edPriv, ok := priv.(ed25519.PrivateKey)
+			if !ok {
+				return Key{}, fmt.Errorf("%s is not Ed25519 private key", e.PrivateKeyFile)
+			}
+			return NewEdDSAKey(e.Kid, edPriv, nil), nil
+		}
+		pub, err := readPEM(e.PublicKeyFile, jwt.ParseEdPublicKeyFromPEM)
+		if err != nil {
+			return Key{}, err
+		}
+		edPub, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return Key{}, fmt.Errorf("%s is not Ed25519 public key", e.PublicKeyFile)
+		}
+		return NewEdDSAKey(e.Kid, nil, edPub), nil
+	}
+	return Key{}, fmt.Errorf("unsupported alg %s", e.Alg)
+}
+
+func readPEM[T any](name string, parse func([]byte) (T, error)) (T, error) {
+	var zero T
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return zero, fmt.Errorf("os.ReadFile: %w", err)
+	}
+	v, err := parse(data)
+	if err != nil {
+		return zero, fmt.Errorf("parse %s: %w", name, err)
+	}
+	return v, nil
+}
+
+var (
+	keysMx sync.RWMutex
+	keys   *KeySet
+)
+
+// SetKeys sets key set used by [GenerateToken] and [ParseToken].
+func SetKeys(ks *KeySet) {
+	keysMx.Lock()
+	defer keysMx.Unlock()
+	keys = ks
+}
+
+// Keys returns current key set. Random HMAC key is used until [SetKeys] is called.
+func Keys() *KeySet {
+	keysMx.RLock()
+	ks := keys
+	keysMx.RUnlock()
+	if ks != nil {
+		return ks
+	}
+	keysMx.Lock()
+	defer keysMx.Unlock()
+	if keys == nil {
+		ks, err := LoadKeySet("", "")
+		if err != nil {
+			panic(err)
+		}
+		keys = ks
+	}
+	return keys
+}
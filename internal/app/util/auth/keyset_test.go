@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Subject:   "user",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+}
+
+func parse(ks *KeySet, token string) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, ks.Keyfunc)
+	return claims.Subject, err
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	oldKey, err := NewHMACKey("old", []byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey := NewRSAKey("rsa", rsaPriv, nil)
+	edKey := NewEdDSAKey("ed", edPriv, nil)
+
+	before, err := NewKeySet("old", oldKey)
+	require.NoError(t, err)
+	oldToken, err := before.Sign(testClaims())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		active string
+	}{
+		{name: "RS256 active #1", active: "rsa"},
+		{name: "EdDSA active #2", active: "ed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := NewKeySet(tt.active, oldKey, rsaKey, edKey)
+			require.NoError(t, err)
+
+			token, err := ks.Sign(testClaims())
+			require.NoError(t, err)
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.active, parsed.Header["kid"])
+
+			sub, err := parse(ks, token)
+			require.NoError(t, err)
+			assert.Equal(t, "user", sub)
+
+			sub, err = parse(ks, oldToken)
+			require.NoError(t, err)
+			assert.Equal(t, "user", sub)
+
+			_, err = parse(before, token)
+			assert.ErrorIs(t, err, ErrUnknownKey)
+		})
+	}
+}
+
+func TestKeySet_Keyfunc_algMismatch(t *testing.T) {
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ks, err := NewKeySet("rsa", NewRSAKey("rsa", rsaPriv, nil))
+	require.NoError(t, err)
+
+	// HS256 token signed with RSA public key bytes must not be accepted by RS256 key
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaPriv.PublicKey)
+	require.NoError(t, err)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	token.Header["kid"] = "rsa"
+	forged, err := token.SignedString(pubDER)
+	require.NoError(t, err)
+
+	_, err = parse(ks, forged)
+	assert.Error(t, err)
+}
+
+func TestNewKeySet_verifyOnlyActive(t *testing.T) {
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, err = NewKeySet("rsa", NewRSAKey("rsa", nil, &rsaPriv.PublicKey))
+	assert.Error(t, err)
+}
+
+func TestKeySet_JWKS(t *testing.T) {
+	hmacKey, err := NewHMACKey("hmac", []byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ks, err := NewKeySet("hmac", hmacKey, NewRSAKey("rsa", nil, &rsaPriv.PublicKey),
+		NewEdDSAKey("ed", nil, edPub))
+	require.NoError(t, err)
+
+	jwks := ks.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "ed", jwks.Keys[0].Kid)
+	assert.Equal(t, "OKP", jwks.Keys[0].Kty)
+	assert.Equal(t, "Ed25519", jwks.Keys[0].Crv)
+	assert.Equal(t, "rsa", jwks.Keys[1].Kid)
+	assert.Equal(t, "RSA", jwks.Keys[1].Kty)
+	assert.Equal(t, "AQAB", jwks.Keys[1].E)
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edPriv)
+	require.NoError(t, err)
+	edFile := filepath.Join(dir, "ed.pem")
+	require.NoError(t, os.WriteFile(edFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	kf := keyFile{
+		Active: "ed",
+		Keys: []keyFileEntry{
+			{Kid: "old", Alg: AlgHS256, Secret: "0123456789abcdef0123456789abcdef"},
+			{Kid: "ed", Alg: AlgEdDSA, PrivateKeyFile: edFile},
+		},
+	}
+	data, err := json.Marshal(kf)
+	require.NoError(t, err)
+	keysFile := filepath.Join(dir, "keys.json")
+	require.NoError(t, os.WriteFile(keysFile, data, 0600))
+
+	tests := []struct {
+		name     string
+		keysFile string
+		secret   string
+		wantKid  string
+		wantErr  bool
+	}{
+		{name: "keys file #1", keysFile: keysFile, secret: "ignored", wantKid: "ed"},
+		{name: "secret #2", secret: "0123456789abcdef0123456789abcdef", wantKid: DefaultKeyID},
+		{name: "random #3", wantKid: DefaultKeyID},
+		{name: "short secret #4", secret: "short", wantErr: true},
+		{name: "missing file #5", keysFile: filepath.Join(dir, "missing.json"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := LoadKeySet(tt.keysFile, tt.secret)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantKid, ks.active)
+		})
+	}
+}
@@ -1,23 +1,202 @@
 package generator
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync/atomic"
 
 	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
-// RandString generates new random string of specified length.
-func RandString() string {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	characters := `ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789`
-	result := make([]byte, 8)
-	for i := 0; i < 8; i++ {
-		result[i] = characters[r.Intn(len(characters))]
+// Constants for short ID generation.
+const (
+	// DefaultAlphabet base62 alphabet.
+	DefaultAlphabet = `ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789`
+
+	// DefaultLength default length of short ID.
+	DefaultLength = 8
+
+	// MaxLength max length of short ID, IDs are stored in varchar(64) column.
+	MaxLength = 64
+
+	// KindRandom crypto-random strategy.
+	KindRandom = "random"
+
+	// KindCounter base-N encoded counter strategy.
+	KindCounter = "counter"
+
+	// KindHash strategy based on hash of the original URL.
+	KindHash = "hash"
+)
+
+// ErrUnknownKind error happens when generator kind is not supported.
+var ErrUnknownKind = errors.New("unknown generator kind")
+
+// IDGenerator generates short IDs.
+// Attempt is the number of previous tries that ended with collision for the same URL,
+// so deterministic strategies can produce another ID.
+type IDGenerator interface {
+	Generate(url string, attempt int) (string, error)
+}
+
+// New creates new [IDGenerator] of specified kind.
+func New(kind string, alphabet string, length int) (IDGenerator, error) {
+	if len(alphabet) < 2 {
+		return nil, fmt.Errorf("alphabet must contain at least 2 symbols, got %q", alphabet)
+	}
+	seen := make(map[byte]struct{}, len(alphabet))
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		if c >= 0x80 {
+			return nil, fmt.Errorf("alphabet must contain only ASCII symbols, got %q", alphabet)
+		}
+		if _, ok := seen[c]; ok {
+			return nil, fmt.Errorf("alphabet contains duplicate symbol %q", c)
+		}
+		seen[c] = struct{}{}
+	}
+	if length < 1 || length > MaxLength {
+		return nil, fmt.Errorf("length must be between 1 and %d, got %d", MaxLength, length)
+	}
+	switch kind {
+	case KindRandom, "":
+		return NewRandomGenerator(alphabet, length), nil
+	case KindCounter:
+		return NewCounterGenerator(alphabet, length, 0), nil
+	case KindHash:
+		return NewHashGenerator(alphabet, length), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKind, kind)
+	}
+}
+
+// DefaultIDGenerator returns crypto-random [IDGenerator] with default alphabet and length.
+func DefaultIDGenerator() IDGenerator {
+	return NewRandomGenerator(DefaultAlphabet, DefaultLength)
+}
+
+// RandomGenerator generates crypto-random IDs.
+type RandomGenerator struct {
+	alphabet string
+	length   int
+}
+
+var _ IDGenerator = (*RandomGenerator)(nil)
+
+// NewRandomGenerator creates new [*RandomGenerator].
+func NewRandomGenerator(alphabet string, length int) *RandomGenerator {
+	return &RandomGenerator{
+		alphabet: alphabet,
+		length:   length,
+	}
+}
+
+// Generate generates new random ID. URL and attempt are ignored.
+func (g *RandomGenerator) Generate(url string, attempt int) (string, error) {
+	max := big.NewInt(int64(len(g.alphabet)))
+	result := make([]byte, g.length)
+	for i := range result {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("rand.Int: %w", err)
+		}
+		result[i] = g.alphabet[n.Int64()]
 	}
 	logger.Log.Debug("generated ID is " + string(result))
-	return string(result)
+	return string(result), nil
+}
+
+// CounterGenerator generates IDs by encoding sequential counter with alphabet.
+// IDs are left padded to length and may become longer when the counter grows.
+type CounterGenerator struct {
+	alphabet string
+	length   int
+	counter  atomic.Uint64
+}
+
+var _ IDGenerator = (*CounterGenerator)(nil)
+
+// NewCounterGenerator creates new [*CounterGenerator] starting from start value.
+func NewCounterGenerator(alphabet string, length int, start uint64) *CounterGenerator {
+	g := &CounterGenerator{
+		alphabet: alphabet,
+		length:   length,
+	}
+	g.counter.Store(start)
+	return g
+}
+
+// Reset sets counter to start value.
+func (g *CounterGenerator) Reset(start uint64) {
+	g.counter.Store(start)
+}
+
+// Generate encodes next counter value. URL and attempt are ignored.
+func (g *CounterGenerator) Generate(url string, attempt int) (string, error) {
+	n := g.counter.Add(1) - 1
+	return encode(new(big.Int).SetUint64(n), g.alphabet, g.length), nil
+}
+
+// HashGenerator generates IDs from SHA-256 hash of the URL.
+// The same URL always gets the same ID on the first attempt.
+type HashGenerator struct {
+	alphabet string
+	length   int
+}
+
+var _ IDGenerator = (*HashGenerator)(nil)
+
+// NewHashGenerator creates new [*HashGenerator].
+func NewHashGenerator(alphabet string, length int) *HashGenerator {
+	return &HashGenerator{
+		alphabet: alphabet,
+		length:   length,
+	}
+}
+
+// Generate encodes hash of the URL salted with attempt number.
+func (g *HashGenerator) Generate(url string, attempt int) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(url))
+	if attempt > 0 {
+		var salt [8]byte
+		binary.BigEndian.PutUint64(salt[:], uint64(attempt))
+		h.Write(salt[:])
+	}
+	id := encode(new(big.Int).SetBytes(h.Sum(nil)), g.alphabet, g.length)
+	return id[:g.length], nil
+}
+
+func encode(n *big.Int, alphabet string, length int) string {
+	base := big.NewInt(int64(len(alphabet)))
+	mod := new(big.Int)
+	var res []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		res = append(res, alphabet[mod.Int64()])
+	}
+	for len(res) < length {
+		res = append(res, alphabet[0])
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return string(res)
+}
+
+// RandString generates new random string of default length.
+func RandString() string {
+	id, err := DefaultIDGenerator().Generate("", 0)
+	if err != nil {
+		logger.Log.Error("generate ID", zap.Error(err))
+	}
+	return id
 }
 
 // UUIDString generates string UUID.
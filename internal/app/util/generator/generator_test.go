@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRandString(t *testing.T) {
@@ -48,3 +49,87 @@ func TestUUIDString(t *testing.T) {
 		})
 	}
 }
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name   string
+		kind   string
+		assert func(gen IDGenerator, err error)
+	}{
+		{
+			name: "random generator #1",
+			kind: KindRandom,
+			assert: func(gen IDGenerator, err error) {
+				require.NoError(t, err)
+				first, err := gen.Generate("http://localhost:8080/", 0)
+				require.NoError(t, err)
+				second, err := gen.Generate("http://localhost:8080/", 0)
+				require.NoError(t, err)
+				assert.Len(t, first, 6)
+				assert.NotEqual(t, first, second)
+			},
+		},
+		{
+			name: "counter generator #2",
+			kind: KindCounter,
+			assert: func(gen IDGenerator, err error) {
+				require.NoError(t, err)
+				first, err := gen.Generate("http://localhost:8080/", 0)
+				require.NoError(t, err)
+				second, err := gen.Generate("http://localhost:8080/", 0)
+				require.NoError(t, err)
+				assert.Equal(t, "aaaaaa", first)
+				assert.Equal(t, "aaaaab", second)
+			},
+		},
+		{
+			name: "hash generator #3",
+			kind: KindHash,
+			assert: func(gen IDGenerator, err error) {
+				require.NoError(t, err)
+				first, err := gen.Generate("http://localhost:8080/", 0)
+				require.NoError(t, err)
+				same, err := gen.Generate("http://localhost:8080/", 0)
+				require.NoError(t, err)
+				retry, err := gen.Generate("http://localhost:8080/", 1)
+				require.NoError(t, err)
+				assert.Len(t, first, 6)
+				assert.Equal(t, first, same)
+				assert.NotEqual(t, first, retry)
+			},
+		},
+		{
+			name: "unknown generator #4",
+			kind: "unknown",
+			assert: func(gen IDGenerator, err error) {
+				assert.ErrorIs(t, err, ErrUnknownKind)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := New(tt.kind, "abcdefghijklmnopqrstuvwxyz", 6)
+			tt.assert(gen, err)
+		})
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet string
+		length   int
+	}{
+		{name: "short alphabet #1", alphabet: "a", length: 6},
+		{name: "non-ASCII alphabet #2", alphabet: "abcабв", length: 6},
+		{name: "duplicate symbols #3", alphabet: "abca", length: 6},
+		{name: "zero length #4", alphabet: DefaultAlphabet, length: 0},
+		{name: "too long #5", alphabet: DefaultAlphabet, length: MaxLength + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(KindRandom, tt.alphabet, tt.length)
+			assert.Error(t, err)
+		})
+	}
+}
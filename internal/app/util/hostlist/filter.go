@@ -0,0 +1,134 @@
+package hostlist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/util/logger"
+	"go.uber.org/zap"
+)
+
+// Filter allows hosts by allowlist and blocklist loaded from files.
+// Lists are replaced as a whole on reload, failed reload keeps previous lists.
+type Filter struct {
+	allowPath string
+	blockPath string
+
+	mx    sync.RWMutex
+	allow *List
+	block *List
+	// stamps modification stamps of files the lists are loaded from.
+	stamps [2]fileStamp
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewFilter creates new [*Filter] with lists loaded from files, empty path means empty list.
+func NewFilter(allowPath string, blockPath string) (*Filter, error) {
+	f := &Filter{allowPath: allowPath, blockPath: blockPath}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload loads both lists from files again.
+func (f *Filter) Reload() error {
+	allowStamp, allowStampErr := stat(f.allowPath)
+	blockStamp, blockStampErr := stat(f.blockPath)
+	if err := errors.Join(allowStampErr, blockStampErr); err != nil {
+		return err
+	}
+	allow, err := Load(f.allowPath)
+	if err != nil {
+		return fmt.Errorf("load allowlist: %w", err)
+	}
+	block, err := Load(f.blockPath)
+	if err != nil {
+		return fmt.Errorf("load blocklist: %w", err)
+	}
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.allow, f.block = allow, block
+	f.stamps = [2]fileStamp{allowStamp, blockStamp}
+	logger.Log.Info("host lists loaded", zap.Int("allowed", allow.Len()), zap.Int("blocked", block.Len()))
+	return nil
+}
+
+// Blocked reports whether host is in blocklist. Nil filter blocks nothing.
+func (f *Filter) Blocked(host string) bool {
+	if f == nil {
+		return false
+	}
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	return f.block.Match(host)
+}
+
+// Allowed reports whether host is in allowlist or allowlist is empty.
+// Nil filter allows every host.
+func (f *Filter) Allowed(host string) bool {
+	if f == nil {
+		return true
+	}
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	return f.allow.Len() == 0 || f.allow.Match(host)
+}
+
+// Watch reloads lists on every value from signals and when files change,
+// files are checked every interval, zero interval disables the check.
+// It blocks until ctx is done.
+func (f *Filter) Watch(ctx context.Context, interval time.Duration, signals <-chan os.Signal) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			if err := f.Reload(); err != nil {
+				logger.Log.Error("reload host lists", zap.Error(err))
+			}
+		case <-tick:
+			if !f.changed() {
+				continue
+			}
+			if err := f.Reload(); err != nil {
+				logger.Log.Error("reload host lists", zap.Error(err))
+			}
+		}
+	}
+}
+
+// changed reports whether any file differs from the loaded one.
+// File that can't be read is reported as changed, so error is logged by reload.
+func (f *Filter) changed() bool {
+	allowStamp, allowErr := stat(f.allowPath)
+	blockStamp, blockErr := stat(f.blockPath)
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+	return allowErr != nil || blockErr != nil || f.stamps != [2]fileStamp{allowStamp, blockStamp}
+}
+
+func stat(path string) (fileStamp, error) {
+	if path == "" {
+		return fileStamp{}, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, fmt.Errorf("os.Stat: %w", err)
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
@@ -0,0 +1,151 @@
+// Package hostlist matches hosts of URLs against lists of exact hosts,
+// wildcard suffixes and CIDRs loaded from files.
+package hostlist
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalidEntry indicates that list entry can't be parsed.
+var ErrInvalidEntry = errors.New("invalid host list entry")
+
+// hostProfile is [idna.Lookup] that allows underscores like URL validator does,
+// so entries match hosts of URLs that are shortened.
+var hostProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
+// List set of host patterns. Empty list matches nothing.
+type List struct {
+	exact    map[string]struct{}
+	suffixes []string
+	nets     []*net.IPNet
+}
+
+// Parse parses list with single entry per line, empty lines and text after # are ignored.
+// Entry is exact host like example.com, wildcard like *.example.com that matches
+// every subdomain of example.com but not example.com itself, IP address or CIDR
+// like 10.0.0.0/8 that matches IP hosts.
+func Parse(r io.Reader) (*List, error) {
+	l := &List{exact: make(map[string]struct{})}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		entry, _, _ := strings.Cut(scanner.Text(), "#")
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if err := l.add(entry); err != nil {
+			return nil, fmt.Errorf("line #%d: %w", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanner.Err: %w", err)
+	}
+	return l, nil
+}
+
+// Load parses list from file, empty path means empty list.
+func Load(path string) (*List, error) {
+	if path == "" {
+		return &List{}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("os.Open: %w", err)
+	}
+	defer f.Close()
+	l, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return l, nil
+}
+
+func (l *List) add(entry string) error {
+	if strings.Contains(entry, "/") {
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return fmt.Errorf("%q: %v. %w", entry, err, ErrInvalidEntry)
+		}
+		l.nets = append(l.nets, ipNet)
+		return nil
+	}
+	if ip := net.ParseIP(strings.Trim(entry, "[]")); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		l.nets = append(l.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		return nil
+	}
+	host, wildcard := strings.CutPrefix(entry, "*.")
+	host, err := toASCII(host)
+	if err != nil {
+		return fmt.Errorf("%q: %v. %w", entry, err, ErrInvalidEntry)
+	}
+	if !validHost(host) {
+		return fmt.Errorf("%q. %w", entry, ErrInvalidEntry)
+	}
+	if wildcard {
+		l.suffixes = append(l.suffixes, "."+host)
+		return nil
+	}
+	l.exact[host] = struct{}{}
+	return nil
+}
+
+// Len returns amount of entries.
+func (l *List) Len() int {
+	return len(l.exact) + len(l.suffixes) + len(l.nets)
+}
+
+// Match reports whether host matches any entry. Host must not contain port.
+func (l *List) Match(host string) bool {
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		for _, n := range l.nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	host = Normalize(host)
+	if _, ok := l.exact[host]; ok {
+		return true
+	}
+	for _, s := range l.suffixes {
+		if strings.HasSuffix(host, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize lowercases host, converts internationalized name to punycode and drops
+// trailing dot of fully qualified name. Host that can't be converted is only lowercased.
+func Normalize(host string) string {
+	if ascii, err := toASCII(host); err == nil {
+		return ascii
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// toASCII converts host to lower case punycode without trailing dot.
+func toASCII(host string) (string, error) {
+	ascii, err := hostProfile.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("idna.ToASCII: %w", err)
+	}
+	return strings.TrimSuffix(ascii, "."), nil
+}
+
+func validHost(host string) bool {
+	return host != "" && !strings.ContainsAny(host, " \t*:/?@")
+}
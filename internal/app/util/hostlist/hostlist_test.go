@@ -0,0 +1,101 @@
+package hostlist
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList_Match(t *testing.T) {
+	l, err := Parse(strings.NewReader(`
+# phishing
+Evil.com
+*.bad.org   # every subdomain
+10.0.0.0/8
+192.168.1.1
+2001:db8::/32
+пример.рф
+*.Пример.com
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 7, l.Len())
+
+	tests := []struct {
+		name string
+		host string
+		want bool
+	}{
+		{name: "exact #1", host: "evil.com", want: true},
+		{name: "exact case and trailing dot #2", host: "EVIL.com.", want: true},
+		{name: "subdomain of exact #3", host: "www.evil.com", want: false},
+		{name: "wildcard subdomain #4", host: "a.b.bad.org", want: true},
+		{name: "wildcard parent #5", host: "bad.org", want: false},
+		{name: "suffix without dot #6", host: "notbad.org", want: false},
+		{name: "CIDR #7", host: "10.1.2.3", want: true},
+		{name: "single IP #8", host: "192.168.1.1", want: true},
+		{name: "IPv6 CIDR #9", host: "[2001:db8::1]", want: true},
+		{name: "other IP #10", host: "192.168.1.2", want: false},
+		{name: "other host #11", host: "example.com", want: false},
+		{name: "Unicode entry by punycode #12", host: "xn--e1afmkfd.xn--p1ai", want: true},
+		{name: "Unicode entry by Unicode #13", host: "ПРИМЕР.рф", want: true},
+		{name: "Unicode wildcard by punycode #14", host: "www.xn--e1afmkfd.com", want: true},
+		{name: "Unicode wildcard parent #15", host: "xn--e1afmkfd.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, l.Match(tt.host))
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/33", "*.", "evil.com/path", "a*b.com"} {
+		_, err := Parse(strings.NewReader(entry))
+		assert.ErrorIs(t, err, ErrInvalidEntry, entry)
+	}
+}
+
+func TestFilter_Reload(t *testing.T) {
+	dir := t.TempDir()
+	allowPath := filepath.Join(dir, "allow.txt")
+	blockPath := filepath.Join(dir, "block.txt")
+	require.NoError(t, os.WriteFile(allowPath, nil, 0o600))
+	require.NoError(t, os.WriteFile(blockPath, []byte("evil.com\n"), 0o600))
+
+	f, err := NewFilter(allowPath, blockPath)
+	require.NoError(t, err)
+	assert.True(t, f.Blocked("evil.com"))
+	assert.True(t, f.Allowed("example.com"), "empty allowlist allows everything")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.Watch(ctx, 10*time.Millisecond, signals)
+	}()
+
+	require.NoError(t, os.WriteFile(allowPath, []byte("example.com\n"), 0o600))
+	assert.Eventually(t, func() bool {
+		return !f.Allowed("example.org")
+	}, time.Second, 10*time.Millisecond, "changed file is reloaded")
+	assert.True(t, f.Allowed("example.com"))
+
+	require.NoError(t, os.WriteFile(blockPath, []byte("*.invalid*\n"), 0o600))
+	signals <- syscall.SIGHUP
+	assert.True(t, f.Blocked("evil.com"), "invalid list keeps previous one")
+
+	cancel()
+	<-done
+
+	var nilFilter *Filter
+	assert.True(t, nilFilter.Allowed("evil.com"))
+	assert.False(t, nilFilter.Blocked("evil.com"))
+}
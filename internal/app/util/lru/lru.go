@@ -0,0 +1,92 @@
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache bounded LRU cache with per entry expiration.
+// It is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	mx    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[K]*list.Element
+	now   func() time.Time
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// New creates new [*Cache] that holds at most size entries.
+func New[K comparable, V any](size int) *Cache[K, V] {
+	return &Cache[K, V]{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[K]*list.Element, size),
+		now:   time.Now,
+	}
+}
+
+// Get returns value by key if it is present and not expired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	e := el.Value.(*entry[K, V])
+	if !c.now().Before(e.expiresAt) {
+		c.removeElement(el)
+		return zero, false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+// Add adds value that expires after ttl, the least recently used entry
+// is evicted if cache is full.
+func (c *Cache[K, V]) Add(key K, value V, ttl time.Duration) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	expiresAt := c.now().Add(ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value = value
+		e.expiresAt = expiresAt
+		c.ll.MoveToFront(el)
+		return
+	}
+	el := c.ll.PushFront(&entry[K, V]{key: key, value: value, expiresAt: expiresAt})
+	c.items[key] = el
+	if c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Remove removes value by key.
+func (c *Cache[K, V]) Remove(key K) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// Len returns amount of entries including expired ones that are not evicted yet.
+func (c *Cache[K, V]) Len() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.ll.Len()
+}
+
+func (c *Cache[K, V]) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
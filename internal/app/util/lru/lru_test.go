@@ -0,0 +1,38 @@
+package lru
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	c := New[string, int](2)
+	c.now = func() time.Time {
+		return now
+	}
+
+	c.Add("a", 1, time.Minute)
+	c.Add("b", 2, time.Minute)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	c.Add("c", 3, time.Second)
+	_, ok = c.Get("b")
+	assert.False(t, ok, "least recently used entry must be evicted")
+	assert.Equal(t, 2, c.Len())
+
+	now = now.Add(time.Second)
+	_, ok = c.Get("c")
+	assert.False(t, ok, "expired entry must not be returned")
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+
+	c.Remove("a")
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
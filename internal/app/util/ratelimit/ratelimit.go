@@ -0,0 +1,215 @@
+// Package ratelimit implements token bucket rate limiting.
+//
+// Bucket is kept as theoretical arrival time of the next request (GCRA),
+// that is equivalent to token bucket but needs single value per key,
+// so state can be updated atomically in shared storage.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denis-oreshkevich/shortener/internal/app/util/lru"
+)
+
+// ErrInvalidLimit indicates that limit can't be parsed.
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+// Limit token bucket that holds at most Burst tokens and is refilled by Rate tokens per second.
+// Zero limit doesn't limit anything.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit parses limit like "10/s", "100/m:200" or "1000/1h", burst equals count if omitted.
+// Empty string, "0" and "off" mean no limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "", "0", "off":
+		return Limit{}, nil
+	}
+	rate, burst, hasBurst := strings.Cut(s, ":")
+	count, unit, ok := strings.Cut(rate, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%q has no period. %w", s, ErrInvalidLimit)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("%q count must be positive integer. %w", s, ErrInvalidLimit)
+	}
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		per, err = time.ParseDuration(unit)
+		if err != nil || per <= 0 {
+			return Limit{}, fmt.Errorf("%q period must be s, m, h or positive duration. %w", s, ErrInvalidLimit)
+		}
+	}
+	b := n
+	if hasBurst {
+		b, err = strconv.Atoi(burst)
+		if err != nil || b <= 0 {
+			return Limit{}, fmt.Errorf("%q burst must be positive integer. %w", s, ErrInvalidLimit)
+		}
+	}
+	return Limit{Rate: float64(n) / per.Seconds(), Burst: b}, nil
+}
+
+// Enabled reports whether limit limits anything.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Scale returns limit with rate and burst multiplied by factor.
+func (l Limit) Scale(factor int) Limit {
+	return Limit{Rate: l.Rate * float64(factor), Burst: l.Burst * factor}
+}
+
+// interval time to refill single token.
+func (l Limit) interval() time.Duration {
+	return time.Duration(float64(time.Second) / l.Rate)
+}
+
+// Store keeps state of buckets.
+type Store interface {
+	// Take advances theoretical arrival time of bucket key by interval
+	// unless it gets ahead of now by more than tolerance.
+	// Returns theoretical arrival time after the call and whether request is allowed.
+	Take(ctx context.Context, key string, now time.Time, interval time.Duration,
+		tolerance time.Duration) (time.Time, bool, error)
+}
+
+// StoreFunc adapter to use function as [Store].
+type StoreFunc func(ctx context.Context, key string, now time.Time, interval time.Duration,
+	tolerance time.Duration) (time.Time, bool, error)
+
+// Take calls f.
+func (f StoreFunc) Take(ctx context.Context, key string, now time.Time, interval time.Duration,
+	tolerance time.Duration) (time.Time, bool, error) {
+	return f(ctx, key, now, interval, tolerance)
+}
+
+// Result outcome of taking token from bucket.
+type Result struct {
+	Allowed bool
+	// Limit burst of the bucket.
+	Limit int
+	// Remaining amount of tokens left in the bucket.
+	Remaining int
+	// Reset time until bucket is full again.
+	Reset time.Duration
+	// RetryAfter time until next token is available if request is not allowed.
+	RetryAfter time.Duration
+}
+
+// Stricter returns result that leaves less room for requests.
+func (r Result) Stricter(other Result) Result {
+	switch {
+	case r.Limit == 0:
+		return other
+	case other.Limit == 0:
+		return r
+	case r.Allowed != other.Allowed:
+		if r.Allowed {
+			return other
+		}
+		return r
+	case !r.Allowed:
+		if other.RetryAfter > r.RetryAfter {
+			return other
+		}
+		return r
+	case other.Remaining < r.Remaining:
+		return other
+	default:
+		return r
+	}
+}
+
+// Limiter takes tokens from buckets kept in [Store].
+type Limiter struct {
+	store Store
+	now   func() time.Time
+}
+
+// New creates new [*Limiter].
+func New(store Store) *Limiter {
+	return &Limiter{store: store, now: time.Now}
+}
+
+// Allow takes token from bucket key with limit. Disabled limit allows everything
+// and returns zero [Result.Limit].
+func (l *Limiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if !limit.Enabled() {
+		return Result{Allowed: true}, nil
+	}
+	now := l.now()
+	interval := limit.interval()
+	tolerance := interval * time.Duration(limit.Burst)
+	tat, allowed, err := l.store.Take(ctx, key, now, interval, tolerance)
+	if err != nil {
+		return Result{}, fmt.Errorf("store.Take. %w", err)
+	}
+	if tat.Before(now) {
+		tat = now
+	}
+	ahead := tat.Sub(now)
+	res := Result{Allowed: allowed, Limit: limit.Burst, Reset: ahead}
+	if allowed {
+		res.Remaining = int((tolerance - ahead) / interval)
+	} else {
+		res.RetryAfter = ahead + interval - tolerance
+	}
+	return res, nil
+}
+
+// MemoryStore keeps buckets in memory of the process.
+// The least recently used buckets are dropped when store is full.
+type MemoryStore struct {
+	mx      sync.Mutex
+	buckets *lru.Cache[string, time.Time]
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates new [*MemoryStore] that holds at most size buckets.
+func NewMemoryStore(size int) *MemoryStore {
+	return &MemoryStore{buckets: lru.New[string, time.Time](size)}
+}
+
+// Take advances theoretical arrival time of bucket key.
+// Bucket is forgotten when it becomes full, it's the same as missing one.
+func (ms *MemoryStore) Take(ctx context.Context, key string, now time.Time,
+	interval time.Duration, tolerance time.Duration) (time.Time, bool, error) {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	tat, ok := ms.buckets.Get(key)
+	if !ok || tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(interval)
+	if next.Sub(now) > tolerance {
+		return tat, false, nil
+	}
+	ms.buckets.Add(key, next, next.Sub(now))
+	return next, true, nil
+}
+
+// Seconds rounds d up to whole seconds as rate limit headers require.
+func Seconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
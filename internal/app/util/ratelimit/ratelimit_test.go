@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{name: "per second #1", value: "10/s", want: Limit{Rate: 10, Burst: 10}},
+		{name: "per minute with burst #2", value: "120/m:5", want: Limit{Rate: 2, Burst: 5}},
+		{name: "custom period #3", value: "30/30s", want: Limit{Rate: 1, Burst: 30}},
+		{name: "off #4", value: "off", want: Limit{}},
+		{name: "empty #5", value: "", want: Limit{}},
+		{name: "no period #6", value: "10", wantErr: true},
+		{name: "zero count #7", value: "0/s", wantErr: true},
+		{name: "bad burst #8", value: "10/s:0", wantErr: true},
+		{name: "bad period #9", value: "10/week", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLimit(tt.value)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidLimit)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	l := New(NewMemoryStore(10))
+	l.now = func() time.Time {
+		return now
+	}
+	limit := Limit{Rate: 1, Burst: 3}
+
+	for i := 2; i >= 0; i-- {
+		res, err := l.Allow(ctx, "user", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+	res, err := l.Allow(ctx, "user", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed, "burst is exhausted")
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 3*time.Second, res.Reset)
+
+	res, err = l.Allow(ctx, "other", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed, "buckets are separate")
+
+	now = now.Add(time.Second)
+	res, err = l.Allow(ctx, "user", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed, "token is refilled")
+	assert.Equal(t, 0, res.Remaining)
+
+	res, err = l.Allow(ctx, "user", Limit{})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed, "disabled limit allows everything")
+	assert.Zero(t, res.Limit)
+}
+
+func TestResult_Stricter(t *testing.T) {
+	allowed := Result{Allowed: true, Limit: 10, Remaining: 5}
+	fewer := Result{Allowed: true, Limit: 100, Remaining: 1}
+	denied := Result{Allowed: false, Limit: 10, RetryAfter: time.Second}
+	assert.Equal(t, fewer, allowed.Stricter(fewer))
+	assert.Equal(t, denied, fewer.Stricter(denied))
+	assert.Equal(t, denied, denied.Stricter(allowed))
+	assert.Equal(t, allowed, Result{Allowed: true}.Stricter(allowed))
+}
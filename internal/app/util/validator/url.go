@@ -0,0 +1,331 @@
+package validator
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Reasons of URL rejection, see [URLError].
+const (
+	ReasonTooLong     = "url_too_long"
+	ReasonSyntax      = "url_invalid_syntax"
+	ReasonScheme      = "url_scheme_not_allowed"
+	ReasonHost        = "url_invalid_host"
+	ReasonPrivateHost = "url_private_host"
+)
+
+// DefaultMaxURLLength max length of URL of [DefaultURLPolicy].
+const DefaultMaxURLLength = 2048
+
+const (
+	subDelims       = "!$&'()*+,;="
+	upperHexDigits  = "0123456789ABCDEF"
+	maxDomainLength = 253
+	maxLabelLength  = 63
+)
+
+// URLError describes why URL is rejected. Reason is one of Reason constants.
+type URLError struct {
+	Reason string
+	Detail string
+}
+
+func (e *URLError) Error() string {
+	return "invalid url: " + e.Detail
+}
+
+func urlError(reason string, format string, args ...any) *URLError {
+	return &URLError{Reason: reason, Detail: fmt.Sprintf(format, args...)}
+}
+
+// URLPolicy rules URLs are checked against.
+type URLPolicy struct {
+	// Schemes allowed schemes in lower case.
+	Schemes []string
+	// AllowPrivate allows hosts that are localhost or loopback, private, link-local
+	// or unspecified IP addresses.
+	AllowPrivate bool
+	// MaxLength max length of URL in bytes, 0 means no limit.
+	MaxLength int
+}
+
+// DefaultURLPolicy returns policy that allows http and https URLs up to [DefaultMaxURLLength].
+func DefaultURLPolicy() URLPolicy {
+	return URLPolicy{
+		Schemes:      []string{"http", "https"},
+		AllowPrivate: true,
+		MaxLength:    DefaultMaxURLLength,
+	}
+}
+
+var urlPolicy = DefaultURLPolicy()
+
+// domainProfile converts internationalized domain names to punycode.
+// Underscores are allowed because they are common in host names even though DNS forbids them.
+var domainProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
+// SetURLPolicy replaces the policy used by [URL].
+// It should be called once on startup before serving requests.
+func SetURLPolicy(p URLPolicy) {
+	urlPolicy = p
+}
+
+// URL checks URL against policy set by [SetURLPolicy], see [URLPolicy.Check].
+func URL(rawURL string) (string, error) {
+	return urlPolicy.Check(rawURL)
+}
+
+// Check parses absolute URL according to RFC 3986 and checks it against the policy.
+// Returned URL has internationalized host converted to punycode and non-ASCII characters
+// percent-encoded, otherwise it is the same as rawURL without surrounding spaces.
+// Returns [*URLError] if URL is rejected.
+func (p URLPolicy) Check(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if p.MaxLength > 0 && len(rawURL) > p.MaxLength {
+		return "", urlError(ReasonTooLong, "length %d exceeds %d", len(rawURL), p.MaxLength)
+	}
+	scheme, rest, err := cutScheme(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if !p.schemeAllowed(strings.ToLower(scheme)) {
+		return "", urlError(ReasonScheme, "scheme %q is not allowed", scheme)
+	}
+	rest, ok := strings.CutPrefix(rest, "//")
+	if !ok {
+		return "", urlError(ReasonSyntax, "authority is missing")
+	}
+	authority, tail := rest, ""
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		authority, tail = rest[:i], rest[i:]
+	}
+
+	var b strings.Builder
+	b.WriteString(scheme + "://")
+	hostPort := authority
+	if i := strings.LastIndexByte(authority, '@'); i >= 0 {
+		userinfo, uErr := encodeComponent("userinfo", authority[:i], ":")
+		if uErr != nil {
+			return "", uErr
+		}
+		b.WriteString(userinfo + "@")
+		hostPort = authority[i+1:]
+	}
+	host, port, err := splitHostPort(hostPort)
+	if err != nil {
+		return "", err
+	}
+	if host, err = p.checkHost(host); err != nil {
+		return "", err
+	}
+	b.WriteString(host)
+	if port != "" {
+		b.WriteString(":" + port)
+	}
+
+	tail, fragment, hasFragment := strings.Cut(tail, "#")
+	path, query, hasQuery := strings.Cut(tail, "?")
+	if path, err = encodeComponent("path", path, ":@/"); err != nil {
+		return "", err
+	}
+	b.WriteString(path)
+	if hasQuery {
+		if query, err = encodeComponent("query", query, ":@/?"); err != nil {
+			return "", err
+		}
+		b.WriteString("?" + query)
+	}
+	if hasFragment {
+		if fragment, err = encodeComponent("fragment", fragment, ":@/?"); err != nil {
+			return "", err
+		}
+		b.WriteString("#" + fragment)
+	}
+	res := b.String()
+	if p.MaxLength > 0 && len(res) > p.MaxLength {
+		return "", urlError(ReasonTooLong, "length %d of encoded url exceeds %d", len(res), p.MaxLength)
+	}
+	return res, nil
+}
+
+func (p URLPolicy) schemeAllowed(scheme string) bool {
+	for _, s := range p.Schemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// cutScheme splits URL into scheme and the rest after colon.
+func cutScheme(rawURL string) (string, string, error) {
+	scheme, rest, ok := strings.Cut(rawURL, ":")
+	if !ok || scheme == "" {
+		return "", "", urlError(ReasonSyntax, "scheme is missing")
+	}
+	for i := 0; i < len(scheme); i++ {
+		c := scheme[i]
+		if isAlpha(c) || i > 0 && (isDigit(c) || c == '+' || c == '-' || c == '.') {
+			continue
+		}
+		return "", "", urlError(ReasonSyntax, "invalid character %q in scheme", c)
+	}
+	return scheme, rest, nil
+}
+
+// splitHostPort splits authority without userinfo into host and port, port may be empty.
+func splitHostPort(hostPort string) (string, string, error) {
+	host, port := hostPort, ""
+	if strings.HasPrefix(hostPort, "[") {
+		end := strings.IndexByte(hostPort, ']')
+		if end < 0 {
+			return "", "", urlError(ReasonHost, "missing ']' in host")
+		}
+		host = hostPort[:end+1]
+		rest := hostPort[end+1:]
+		if rest != "" {
+			var ok bool
+			if port, ok = strings.CutPrefix(rest, ":"); !ok {
+				return "", "", urlError(ReasonHost, "unexpected %q after host", rest)
+			}
+		}
+	} else if i := strings.LastIndexByte(hostPort, ':'); i >= 0 {
+		host, port = hostPort[:i], hostPort[i+1:]
+	}
+	if port == "" {
+		return host, "", nil
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return "", "", urlError(ReasonSyntax, "invalid port %q", port)
+	}
+	return host, port, nil
+}
+
+// checkHost validates host and converts internationalized domain name to punycode.
+func (p URLPolicy) checkHost(host string) (string, error) {
+	if host == "" {
+		return "", urlError(ReasonHost, "host is missing")
+	}
+	if inner, ok := strings.CutPrefix(host, "["); ok {
+		inner = strings.TrimSuffix(inner, "]")
+		ip := net.ParseIP(inner)
+		if ip == nil || !strings.Contains(inner, ":") {
+			return "", urlError(ReasonHost, "invalid IPv6 address %q", inner)
+		}
+		return host, p.checkIP(ip)
+	}
+	if isIPv4Like(host) {
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return "", urlError(ReasonHost, "invalid IPv4 address %q", host)
+		}
+		return host, p.checkIP(ip)
+	}
+	name, err := url.PathUnescape(host)
+	if err != nil {
+		return "", urlError(ReasonHost, "invalid percent-encoding in host %q", host)
+	}
+	ascii, err := domainProfile.ToASCII(name)
+	if err != nil {
+		return "", urlError(ReasonHost, "invalid domain name %q: %v", name, err)
+	}
+	if err = checkDomain(ascii); err != nil {
+		return "", err
+	}
+	if !p.AllowPrivate && isLocalhost(ascii) {
+		return "", urlError(ReasonPrivateHost, "host %s is local", ascii)
+	}
+	return ascii, nil
+}
+
+func (p URLPolicy) checkIP(ip net.IP) error {
+	if p.AllowPrivate {
+		return nil
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return urlError(ReasonPrivateHost, "address %s is not public", ip)
+	}
+	return nil
+}
+
+// checkDomain checks characters and lengths of labels of ASCII domain name,
+// single trailing dot of fully qualified name is allowed.
+func checkDomain(name string) error {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > maxDomainLength {
+		return urlError(ReasonHost, "invalid length of domain name %q", name)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > maxLabelLength {
+			return urlError(ReasonHost, "invalid length of label %q", label)
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !isAlpha(c) && !isDigit(c) && c != '-' && c != '_' {
+				return urlError(ReasonHost, "invalid character %q in host", c)
+			}
+		}
+	}
+	return nil
+}
+
+func isLocalhost(name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	return name == "localhost" || strings.HasSuffix(name, ".localhost")
+}
+
+// isIPv4Like reports whether host consists of digits and dots only,
+// such host is IPv4 address and not a domain name.
+func isIPv4Like(host string) bool {
+	for i := 0; i < len(host); i++ {
+		if !isDigit(host[i]) && host[i] != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeComponent percent-encodes non-ASCII bytes of URL component and checks that other
+// characters are unreserved, sub-delims, valid percent-encoded octets or one of extra.
+func encodeComponent(name string, s string, extra string) (string, error) {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 0x80:
+			b.WriteByte('%')
+			b.WriteByte(upperHexDigits[c>>4])
+			b.WriteByte(upperHexDigits[c&0x0f])
+		case c == '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return "", urlError(ReasonSyntax, "invalid percent-encoding in %s", name)
+			}
+			b.WriteString(s[i : i+3])
+			i += 2
+		case isAlpha(c) || isDigit(c) || strings.IndexByte("-._~"+subDelims+extra, c) >= 0:
+			b.WriteByte(c)
+		default:
+			return "", urlError(ReasonSyntax, "invalid character %q in %s", c, name)
+		}
+	}
+	return b.String(), nil
+}
+
+func isAlpha(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
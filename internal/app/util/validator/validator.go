@@ -1,23 +1,69 @@
 package validator
 
-import "regexp"
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
 
 // Constants for validation.
 const (
-	URLRegex = "^(?:http|http(s)):\\/\\/(www\\.)?[-a-zA-Z0-9@:%._\\+~#=]{1,256}(\\.|:)[a-zA-Z0-9()]{1,6}\\b([-a-zA-Z0-9()@:%_\\+.~#?&//=]*)"
-
 	IDRegex = "^[A-Za-z0-9]{8}$"
+
+	// AliasRegex default grammar for custom short IDs.
+	AliasRegex = "^[A-Za-z0-9][A-Za-z0-9_-]{3,63}$"
 )
 
-var urlMatcher = regexp.MustCompile(URLRegex)
 var idMatcher = regexp.MustCompile(IDRegex)
+var aliasMatcher = regexp.MustCompile(AliasRegex)
 
-// URL Validates URL.
-func URL(url string) bool {
-	return urlMatcher.MatchString(url)
+// reservedAliases holds the path segments that are already taken by routes.
+var reservedAliases = map[string]struct{}{
+	"api":     {},
+	"ping":    {},
+	"metrics": {},
+	"healthz": {},
+	"readyz":  {},
 }
 
-// ID validates short ID.
+// ID validates short ID. Both generated IDs and custom aliases are accepted.
 func ID(url string) bool {
-	return idMatcher.MatchString(url)
+	return idMatcher.MatchString(url) || aliasMatcher.MatchString(url)
+}
+
+// Alias validates custom short ID chosen by user.
+func Alias(alias string) bool {
+	if _, ok := reservedAliases[alias]; ok {
+		return false
+	}
+	return aliasMatcher.MatchString(alias)
+}
+
+// SetIDAlphabet replaces the grammar of generated short IDs.
+// IDs may be longer than length because counter based IDs grow over time.
+func SetIDAlphabet(alphabet string, length int) error {
+	var b strings.Builder
+	for _, r := range alphabet {
+		if r < 128 && !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	m, err := regexp.Compile(fmt.Sprintf("^[%s]{%d,}$", b.String(), length))
+	if err != nil {
+		return fmt.Errorf("regexp.Compile: %w", err)
+	}
+	idMatcher = m
+	return nil
+}
+
+// SetAliasPattern replaces the grammar used by [Alias].
+// It should be called once on startup before serving requests.
+func SetAliasPattern(pattern string) error {
+	m, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("regexp.Compile: %w", err)
+	}
+	aliasMatcher = m
+	return nil
 }
@@ -0,0 +1,29 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlias(t *testing.T) {
+	tests := []struct {
+		name  string
+		alias string
+		want  bool
+	}{
+		{name: "simple #1", alias: "spring-sale", want: true},
+		{name: "too short #2", alias: "abc", want: false},
+		{name: "invalid character #3", alias: "spring/sale", want: false},
+		{name: "reserved api #4", alias: "api", want: false},
+		{name: "reserved ping #5", alias: "ping", want: false},
+		{name: "reserved metrics #6", alias: "metrics", want: false},
+		{name: "reserved healthz #7", alias: "healthz", want: false},
+		{name: "reserved readyz #8", alias: "readyz", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Alias(tt.alias))
+		})
+	}
+}
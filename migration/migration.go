@@ -1,6 +1,44 @@
 package migration
 
-import "embed"
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
 
-//go:embed *.sql
+// Directories with migrations of supported SQL dialects.
+const (
+	PostgresDir = "postgres"
+	SQLiteDir   = "sqlite"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
 var SQLFiles embed.FS
+
+// LatestVersion returns version of the newest embedded migration in dir.
+// Version is the numeric prefix of the file name, e.g. 4 for 0004_clicks.sql.
+func LatestVersion(dir string) (int64, error) {
+	entries, err := fs.ReadDir(SQLFiles, dir)
+	if err != nil {
+		return 0, fmt.Errorf("fs.ReadDir: %w", err)
+	}
+	var latest int64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || path.Ext(name) != ".sql" {
+			continue
+		}
+		prefix, _, _ := strings.Cut(name, "_")
+		v, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse version of %s: %w", name, err)
+		}
+		if v > latest {
+			latest = v
+		}
+	}
+	return latest, nil
+}
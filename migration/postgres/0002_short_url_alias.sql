@@ -0,0 +1,3 @@
+-- +goose Up
+alter table courses.shortener alter column short_url type varchar(64);
+-- +goose Down
@@ -0,0 +1,6 @@
+-- +goose Up
+alter table courses.shortener add column if not exists expires_at timestamptz;
+
+create index if not exists shortener_expires_at_idx on courses.shortener (expires_at)
+    where expires_at is not null and not is_deleted;
+-- +goose Down
@@ -0,0 +1,13 @@
+-- +goose Up
+create table if not exists courses.shortener_click
+(
+    id         bigserial primary key,
+    short_url  varchar(64) not null,
+    clicked_at timestamptz not null,
+    referrer   varchar     not null default '',
+    user_agent varchar     not null default '',
+    ip         varchar     not null default ''
+);
+
+create index if not exists shortener_click_short_url_idx on courses.shortener_click (short_url, clicked_at);
+-- +goose Down
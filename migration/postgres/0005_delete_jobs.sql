@@ -0,0 +1,15 @@
+-- +goose Up
+create table if not exists courses.shortener_delete_job
+(
+    id         varchar(64) primary key,
+    user_id    varchar     not null,
+    status     varchar(16) not null,
+    attempts   integer     not null default 0,
+    error      varchar     not null default '',
+    results    jsonb       not null,
+    created_at timestamptz not null,
+    updated_at timestamptz not null
+);
+
+create index if not exists shortener_delete_job_status_idx on courses.shortener_delete_job (status, created_at);
+-- +goose Down
@@ -0,0 +1,3 @@
+-- +goose Up
+create index if not exists shortener_user_id_short_url_idx on courses.shortener (user_id, short_url);
+-- +goose Down
@@ -0,0 +1,14 @@
+-- +goose Up
+create table if not exists courses.shortener_api_key
+(
+    id         varchar(64) primary key,
+    user_id    varchar     not null,
+    name       varchar     not null default '',
+    prefix     varchar(16) not null,
+    hash       varchar(64) not null unique,
+    scopes     varchar     not null default '',
+    created_at timestamptz not null
+);
+
+create index if not exists shortener_api_key_user_id_idx on courses.shortener_api_key (user_id, created_at);
+-- +goose Down
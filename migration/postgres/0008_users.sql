@@ -0,0 +1,9 @@
+-- +goose Up
+create table if not exists courses.shortener_user
+(
+    id            varchar(64) primary key,
+    email         varchar     not null unique,
+    password_hash varchar     not null,
+    created_at    timestamptz not null
+);
+-- +goose Down
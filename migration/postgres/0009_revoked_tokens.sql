@@ -0,0 +1,9 @@
+-- +goose Up
+create table if not exists courses.shortener_revoked_token
+(
+    id         varchar(64) primary key,
+    expires_at timestamptz not null
+);
+create index if not exists shortener_revoked_token_expires_at_idx
+    on courses.shortener_revoked_token (expires_at);
+-- +goose Down
@@ -0,0 +1,7 @@
+-- +goose Up
+-- created_at is null for URLs saved before it was tracked, they don't count in daily quota.
+alter table courses.shortener add column if not exists created_at timestamptz;
+
+create index if not exists shortener_user_id_created_at_idx on courses.shortener (user_id, created_at)
+    where created_at is not null;
+-- +goose Down
@@ -0,0 +1,10 @@
+-- +goose Up
+-- URLs are deduplicated by canonical form instead of the original string.
+-- Canonical form of URLs saved before it was tracked is their original string.
+alter table courses.shortener add column if not exists canonical_url varchar;
+update courses.shortener set canonical_url = original_url where canonical_url is null;
+alter table courses.shortener alter column canonical_url set not null;
+
+alter table courses.shortener drop constraint if exists shortener_original_url_key;
+create unique index if not exists shortener_canonical_url_idx on courses.shortener (canonical_url);
+-- +goose Down
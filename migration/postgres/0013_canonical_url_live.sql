@@ -0,0 +1,7 @@
+-- +goose Up
+-- Deleted URLs are left out of deduplication, so the same URL can be shortened again.
+-- Expired URLs are marked deleted when they block new one.
+drop index if exists courses.shortener_canonical_url_idx;
+create unique index if not exists shortener_canonical_url_idx on courses.shortener (canonical_url)
+    where not is_deleted;
+-- +goose Down
@@ -0,0 +1,10 @@
+-- +goose Up
+create table if not exists shortener
+(
+    id           integer primary key autoincrement,
+    short_url    varchar(8) unique not null,
+    original_url varchar unique    not null,
+    user_id      varchar           not null,
+    is_deleted   boolean           not null default false
+);
+-- +goose Down
@@ -0,0 +1,4 @@
+-- +goose Up
+-- SQLite doesn't enforce varchar length, short_url already fits aliases.
+select 1;
+-- +goose Down
@@ -0,0 +1,7 @@
+-- +goose Up
+-- expires_at holds unix time in milliseconds so it can be compared as a number.
+alter table shortener add column expires_at integer;
+
+create index if not exists shortener_expires_at_idx on shortener (expires_at)
+    where expires_at is not null and not is_deleted;
+-- +goose Down
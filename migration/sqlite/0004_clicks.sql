@@ -0,0 +1,14 @@
+-- +goose Up
+-- clicked_at holds unix time in milliseconds.
+create table if not exists shortener_click
+(
+    id         integer primary key autoincrement,
+    short_url  varchar not null,
+    clicked_at integer not null,
+    referrer   varchar not null default '',
+    user_agent varchar not null default '',
+    ip         varchar not null default ''
+);
+
+create index if not exists shortener_click_short_url_idx on shortener_click (short_url, clicked_at);
+-- +goose Down
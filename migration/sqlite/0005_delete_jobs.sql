@@ -0,0 +1,16 @@
+-- +goose Up
+-- created_at and updated_at hold unix time in milliseconds, results hold JSON array.
+create table if not exists shortener_delete_job
+(
+    id         varchar primary key,
+    user_id    varchar not null,
+    status     varchar not null,
+    attempts   integer not null default 0,
+    error      varchar not null default '',
+    results    text    not null,
+    created_at integer not null,
+    updated_at integer not null
+);
+
+create index if not exists shortener_delete_job_status_idx on shortener_delete_job (status, created_at);
+-- +goose Down
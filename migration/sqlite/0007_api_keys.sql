@@ -0,0 +1,15 @@
+-- +goose Up
+-- scopes hold comma separated list, created_at holds unix time in milliseconds.
+create table if not exists shortener_api_key
+(
+    id         varchar primary key,
+    user_id    varchar not null,
+    name       varchar not null default '',
+    prefix     varchar not null,
+    hash       varchar not null unique,
+    scopes     varchar not null default '',
+    created_at integer not null
+);
+
+create index if not exists shortener_api_key_user_id_idx on shortener_api_key (user_id, created_at);
+-- +goose Down
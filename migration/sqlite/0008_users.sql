@@ -0,0 +1,10 @@
+-- +goose Up
+-- created_at holds unix time in milliseconds.
+create table if not exists shortener_user
+(
+    id            varchar primary key,
+    email         varchar not null unique,
+    password_hash varchar not null,
+    created_at    integer not null
+);
+-- +goose Down
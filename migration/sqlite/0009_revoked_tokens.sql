@@ -0,0 +1,10 @@
+-- +goose Up
+-- expires_at holds unix time in milliseconds.
+create table if not exists shortener_revoked_token
+(
+    id         varchar primary key,
+    expires_at integer not null
+);
+create index if not exists shortener_revoked_token_expires_at_idx
+    on shortener_revoked_token (expires_at);
+-- +goose Down
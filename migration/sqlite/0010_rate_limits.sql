@@ -0,0 +1,8 @@
+-- +goose Up
+-- tat holds theoretical arrival time of the next request in unix nanoseconds.
+create table if not exists shortener_rate_limit
+(
+    key varchar primary key,
+    tat integer not null
+);
+-- +goose Down
@@ -0,0 +1,7 @@
+-- +goose Up
+-- created_at holds unix time in milliseconds, it's null for URLs saved before it was tracked.
+alter table shortener add column created_at integer;
+
+create index if not exists shortener_user_id_created_at_idx on shortener (user_id, created_at)
+    where created_at is not null;
+-- +goose Down
@@ -0,0 +1,31 @@
+-- +goose Up
+-- Deleted URLs are left out of deduplication, so the same URL can be shortened again.
+-- Expired URLs are marked deleted when they block new one.
+-- SQLite can't drop unique constraint of canonical_url, so the table is rebuilt.
+create table shortener_new
+(
+    id            integer primary key autoincrement,
+    short_url     varchar unique not null,
+    original_url  varchar        not null,
+    canonical_url varchar        not null,
+    user_id       varchar        not null,
+    is_deleted    boolean        not null default false,
+    expires_at    integer,
+    created_at    integer
+);
+
+insert into shortener_new (id, short_url, original_url, canonical_url, user_id, is_deleted, expires_at, created_at)
+select id, short_url, original_url, canonical_url, user_id, is_deleted, expires_at, created_at
+from shortener;
+
+drop table shortener;
+alter table shortener_new rename to shortener;
+
+create unique index if not exists shortener_canonical_url_idx on shortener (canonical_url)
+    where not is_deleted;
+create index if not exists shortener_expires_at_idx on shortener (expires_at)
+    where expires_at is not null and not is_deleted;
+create index if not exists shortener_user_id_short_url_idx on shortener (user_id, short_url);
+create index if not exists shortener_user_id_created_at_idx on shortener (user_id, created_at)
+    where created_at is not null;
+-- +goose Down